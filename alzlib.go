@@ -7,9 +7,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Azure/alzlib/assets"
 	"github.com/Azure/alzlib/cache"
@@ -44,14 +46,18 @@ type AlzLib struct {
 	architectures                 map[string]*Architecture
 	policyAssignments             map[string]*assets.PolicyAssignment
 	policyDefinitions             map[string]*assets.PolicyDefinitionVersions
+	policyExemptions              map[string]*assets.PolicyExemption
 	policySetDefinitions          map[string]*assets.PolicySetDefinitionVersions
 	roleDefinitions               map[string]*assets.RoleDefinition
 	defaultPolicyAssignmentValues DefaultPolicyAssignmentValues
 	metadata                      []*Metadata
+	provenance                    map[AssetType]map[string]*Provenance
 
-	cache   BuiltInCache
-	clients *azureClients
-	mu      sync.RWMutex // mu is a mutex to concurrency protect the AlzLib maps
+	cache        BuiltInCache
+	lockFile     *LockFile
+	lockFileMode LockFileMode
+	clients      *azureClients
+	mu           sync.RWMutex // mu is a mutex to concurrency protect the AlzLib maps
 }
 
 type azureClients struct {
@@ -69,6 +75,8 @@ type Options struct {
 	// UniqueRoleDefinitions indicates whether to update the role definitions to be unique per management group.
 	// If this is not set, you may end up with conflicting role definition names.
 	UniqueRoleDefinitions bool
+	// CacheCheck configures the checks performed by AlzLib.AddCache. If nil, no checks are performed.
+	CacheCheck *CacheCheck
 }
 
 // NewAlzLib returns a new instance of the alzlib library, optionally using the supplied directory
@@ -86,9 +94,11 @@ func NewAlzLib(opts *Options) *AlzLib {
 		architectures:                 make(map[string]*Architecture),
 		policyAssignments:             make(map[string]*assets.PolicyAssignment),
 		policyDefinitions:             make(map[string]*assets.PolicyDefinitionVersions),
+		policyExemptions:              make(map[string]*assets.PolicyExemption),
 		policySetDefinitions:          make(map[string]*assets.PolicySetDefinitionVersions),
 		roleDefinitions:               make(map[string]*assets.RoleDefinition),
 		metadata:                      make([]*Metadata, 0, InitialMetadataSliceCapacity),
+		provenance:                    make(map[AssetType]map[string]*Provenance),
 		defaultPolicyAssignmentValues: make(DefaultPolicyAssignmentValues),
 		clients:                       new(azureClients),
 		mu:                            sync.RWMutex{},
@@ -145,6 +155,38 @@ func (az *AlzLib) AddPolicyAssignments(pas ...*assets.PolicyAssignment) error {
 	return nil
 }
 
+// AddPolicyExemptions adds policy exemptions to the AlzLib struct.
+func (az *AlzLib) AddPolicyExemptions(pes ...*assets.PolicyExemption) error {
+	az.mu.Lock()
+	defer az.mu.Unlock()
+
+	for _, pe := range pes {
+		if pe == nil || pe.Name == nil || *pe.Name == "" {
+			continue
+		}
+
+		if _, exists := az.policyExemptions[*pe.Name]; exists && !az.Options.AllowOverwrite {
+			return fmt.Errorf(
+				"Alzlib.AddPolicyExemptions: policy exemption with name %s already exists and allow overwrite not set",
+				*pe.Name,
+			)
+		}
+
+		cpy, err := deep.Copy(pe)
+		if err != nil {
+			return fmt.Errorf(
+				"Alzlib.AddPolicyExemptions: error making deep copy of policy exemption %s: %w",
+				*pe.Name,
+				err,
+			)
+		}
+
+		az.policyExemptions[*pe.Name] = cpy
+	}
+
+	return nil
+}
+
 // AddPolicyDefinitions adds policy definitions to the AlzLib struct.
 func (az *AlzLib) AddPolicyDefinitions(pds ...*assets.PolicyDefinition) error {
 	az.mu.Lock()
@@ -265,6 +307,21 @@ func (az *AlzLib) PolicyDefinitions() []string {
 	return result
 }
 
+// PolicyExemptions returns a slice of all the policy exemption names in the library.
+func (az *AlzLib) PolicyExemptions() []string {
+	az.mu.RLock()
+	defer az.mu.RUnlock()
+
+	result := make([]string, 0, len(az.policyExemptions))
+	for k := range az.policyExemptions {
+		result = append(result, k)
+	}
+
+	slices.Sort(result)
+
+	return result
+}
+
 // PolicySetDefinitions returns a slice of all the policy set definition names in the library.
 func (az *AlzLib) PolicySetDefinitions() []string {
 	az.mu.RLock()
@@ -429,6 +486,16 @@ func (az *AlzLib) PolicyAssignmentExists(name string) bool {
 	return exists
 }
 
+// PolicyExemptionExists returns true if the policy exemption name exists in the AlzLib struct.
+func (az *AlzLib) PolicyExemptionExists(name string) bool {
+	az.mu.RLock()
+	defer az.mu.RUnlock()
+
+	_, exists := az.policyExemptions[name]
+
+	return exists
+}
+
 // RoleDefinitionExists returns true if the role definition name exists in the AlzLib struct.
 func (az *AlzLib) RoleDefinitionExists(name string) bool {
 	az.mu.RLock()
@@ -458,6 +525,20 @@ func (az *AlzLib) PolicyDefinition(name string, version *string) *assets.PolicyD
 	return deep.MustCopy(pdv)
 }
 
+// PolicyDefinitionVersions returns a deep copy of all versions of the requested policy definition.
+// This is safe to modify without affecting the original.
+func (az *AlzLib) PolicyDefinitionVersions(name string) *assets.PolicyDefinitionVersions {
+	az.mu.RLock()
+	defer az.mu.RUnlock()
+
+	pd, ok := az.policyDefinitions[name]
+	if !ok {
+		return nil
+	}
+
+	return deep.MustCopy(pd)
+}
+
 // SetAssignPermissionsOnDefinitionParameter sets the AssignPermissions metadata field to true for
 // for the definition (all versions) and parameter with the given name.
 func (az *AlzLib) SetAssignPermissionsOnDefinitionParameter(
@@ -508,6 +589,20 @@ func (az *AlzLib) PolicyAssignment(name string) *assets.PolicyAssignment {
 	return deep.MustCopy(pa)
 }
 
+// PolicyExemption returns a deep copy of the requested policy exemption.
+// This is safe to modify without affecting the original.
+func (az *AlzLib) PolicyExemption(name string) *assets.PolicyExemption {
+	az.mu.RLock()
+	defer az.mu.RUnlock()
+
+	pe, ok := az.policyExemptions[name]
+	if !ok {
+		return nil
+	}
+
+	return deep.MustCopy(pe)
+}
+
 // PolicySetDefinition returns a deep copy of the requested policy set definition.
 // This is safe to modify without affecting the original.
 func (az *AlzLib) PolicySetDefinition(name string, version *string) *assets.PolicySetDefinition {
@@ -527,6 +622,20 @@ func (az *AlzLib) PolicySetDefinition(name string, version *string) *assets.Poli
 	return deep.MustCopy(psdv)
 }
 
+// PolicySetDefinitionVersions returns a deep copy of all versions of the requested policy set definition.
+// This is safe to modify without affecting the original.
+func (az *AlzLib) PolicySetDefinitionVersions(name string) *assets.PolicySetDefinitionVersions {
+	az.mu.RLock()
+	defer az.mu.RUnlock()
+
+	psd, ok := az.policySetDefinitions[name]
+	if !ok {
+		return nil
+	}
+
+	return deep.MustCopy(psd)
+}
+
 // RoleDefinition returns a deep copy of the requested role definition.
 // This is safe to modify without affecting the original.
 func (az *AlzLib) RoleDefinition(name string) *assets.RoleDefinition {
@@ -557,18 +666,59 @@ type BuiltInCache interface {
 	PolicySetDefinitionVersionsByName(name string) *assets.PolicySetDefinitionVersions
 }
 
+// BuiltInCacheLookup is an optional interface of a [BuiltInCache] whose lookups can fail,
+// e.g. a [cache.Cache] in the indexed format with a record that cannot be decoded.
+// When the cache implements it, [AlzLib.GetDefinitionsFromAzure] returns the lookup error
+// rather than treating the definition as not cached and fetching it from Azure.
+type BuiltInCacheLookup interface {
+	// LookupPolicyDefinitionVersions returns the policy definition versions for the given name,
+	// or nil if not found.
+	LookupPolicyDefinitionVersions(name string) (*assets.PolicyDefinitionVersions, error)
+	// LookupPolicySetDefinitionVersions returns the policy set definition versions for the given name,
+	// or nil if not found.
+	LookupPolicySetDefinitionVersions(name string) (*assets.PolicySetDefinitionVersions, error)
+}
+
+var _ BuiltInCacheLookup = (*cache.Cache)(nil)
+
 // AddCache stores a [BuiltInCache] for lazy lookup during [AlzLib.GetDefinitionsFromAzure].
 // Definitions are fetched from the cache on demand rather than being loaded eagerly.
 // The cache is retained for the lifetime of AlzLib; call AddCache(nil) to release it
 // explicitly and allow the garbage collector to reclaim the memory.
 // A previously stored cache is replaced by the new one.
+// The cache is checked against [Options.CacheCheck] and Warn is called for each failed check,
+// use [AlzLib.AddCacheWithChecks] to reject a cache that fails a check.
 func (az *AlzLib) AddCache(c BuiltInCache) {
+	failed, warnings := az.Options.CacheCheck.check(c, time.Now())
+	az.Options.CacheCheck.warn(warnings)
+	az.Options.CacheCheck.warn(failed)
+
 	az.mu.Lock()
 	defer az.mu.Unlock()
 
 	az.cache = c
 }
 
+// AddCacheWithChecks is like [AlzLib.AddCache], but if [CacheCheck.Reject] is set a cache that fails
+// a check is not added and an error wrapping [ErrCacheCheck] is returned, see [CacheCheck].
+func (az *AlzLib) AddCacheWithChecks(c BuiltInCache) error {
+	failed, warnings := az.Options.CacheCheck.check(c, time.Now())
+	az.Options.CacheCheck.warn(warnings)
+
+	if len(failed) > 0 && az.Options.CacheCheck.Reject {
+		return fmt.Errorf("Alzlib.AddCacheWithChecks: %w: %s", ErrCacheCheck, strings.Join(failed, ", "))
+	}
+
+	az.Options.CacheCheck.warn(failed)
+
+	az.mu.Lock()
+	defer az.mu.Unlock()
+
+	az.cache = c
+
+	return nil
+}
+
 // ExportBuiltInCache creates a [cache.Cache] from the built-in policy definitions and policy
 // set definitions that are currently loaded in AlzLib. Definitions are included when their
 // policy type is [armpolicy.PolicyTypeBuiltIn], [armpolicy.PolicyTypeStatic], or is
@@ -681,8 +831,10 @@ func (az *AlzLib) Init(ctx context.Context, libs ...LibraryReference) error {
 			return fmt.Errorf("Alzlib.Init: error processing library %v: %w", ref, err)
 		}
 
+		var md *Metadata
 		if res.Metadata != nil {
-			az.metadata = append(az.metadata, NewMetadata(res.Metadata, ref))
+			md = NewMetadata(res.Metadata, ref)
+			az.metadata = append(az.metadata, md)
 		}
 
 		// Put results into the AlzLib.
@@ -698,6 +850,11 @@ func (az *AlzLib) Init(ctx context.Context, libs ...LibraryReference) error {
 			)
 		}
 
+		// Validate policy assignment parameter values and default policy value parameter types
+		if err := az.validatePolicyAssignmentParameters(res); err != nil {
+			return fmt.Errorf("Alzlib.Init: error validating policy assignment parameters: %w", err)
+		}
+
 		// Generate archetypes
 		if err := az.generateArchetypes(res); err != nil {
 			return fmt.Errorf("Alzlib.Init: error generating archetypes: %w", err)
@@ -712,6 +869,8 @@ func (az *AlzLib) Init(ctx context.Context, libs ...LibraryReference) error {
 		if err := az.generateArchitectures(res); err != nil {
 			return fmt.Errorf("Alzlib.Init: error generating architectures: %w", err)
 		}
+
+		az.addProvenance(res, md)
 	}
 
 	return nil
@@ -724,6 +883,8 @@ func (az *AlzLib) Init(ctx context.Context, libs ...LibraryReference) error {
 // referenced definitions are then fetched as needed.
 // If a cache has been set via [AlzLib.AddCache], definitions are looked up from the cache
 // before falling back to Azure API calls.
+// If a lock file has been set via [AlzLib.AddLockFile], the resolution of each request is recorded
+// in, or verified against, the lock file.
 // The cache is retained for the lifetime of AlzLib; callers can explicitly clear it by calling
 // AddCache(nil) when they no longer need it.
 func (az *AlzLib) GetDefinitionsFromAzure(ctx context.Context, reqs []BuiltInRequest) error {
@@ -813,6 +974,10 @@ func (az *AlzLib) GetDefinitionsFromAzure(ctx context.Context, reqs []BuiltInReq
 		}
 	}
 
+	if err := az.lockBuiltInRequests(reqs); err != nil {
+		return fmt.Errorf("Alzlib.GetDefinitionsFromAzure: lock file: %w", err)
+	}
+
 	return nil
 }
 
@@ -852,6 +1017,159 @@ func (az *AlzLib) AssignmentReferencedDefinitionHasParameter(
 	return false
 }
 
+// ValidateAssignmentParameterValue validates a parameter value for an assignment against the parameter
+// definition in the referenced definition or set definition, see [assets.ValidateParameterValue].
+// It returns an error if the parameter does not exist in the referenced definition.
+// If the referenced definition is not present in AlzLib, e.g. a built-in definition that has not
+// been fetched, the value is not validated.
+func (az *AlzLib) ValidateAssignmentParameterValue(
+	res *arm.ResourceID,
+	definitionVersion *string,
+	param string,
+	value any,
+) error {
+	az.mu.RLock()
+	defer az.mu.RUnlock()
+
+	paramDef, found := az.referencedParameterDefinition(res, definitionVersion, param)
+	if !found {
+		return nil
+	}
+
+	if paramDef == nil {
+		return fmt.Errorf(
+			"Alzlib.ValidateAssignmentParameterValue: parameter `%s` not found in referenced %s `%s`",
+			param,
+			res.ResourceType.Type,
+			res.Name,
+		)
+	}
+
+	return assets.ValidateParameterValue(param, paramDef, value)
+}
+
+// referencedParameterDefinition returns the parameter definition from the definition or set definition
+// referenced by an assignment. The boolean reports whether the referenced definition is present in AlzLib,
+// the parameter definition is nil if the definition does not have the parameter.
+func (az *AlzLib) referencedParameterDefinition(
+	res *arm.ResourceID,
+	definitionVersion *string,
+	param string,
+) (*armpolicy.ParameterDefinitionsValue, bool) {
+	switch strings.ToLower(res.ResourceType.Type) {
+	case PolicyDefinitionsType:
+		pdvs, ok := az.policyDefinitions[res.Name]
+		if !ok {
+			return nil, false
+		}
+
+		pd, err := pdvs.GetVersion(definitionVersion)
+		if err != nil {
+			return nil, false
+		}
+
+		return pd.Parameter(param), true
+	case PolicySetDefinitionsType:
+		psdvs, ok := az.policySetDefinitions[res.Name]
+		if !ok {
+			return nil, false
+		}
+
+		psd, err := psdvs.GetVersion(definitionVersion)
+		if err != nil {
+			return nil, false
+		}
+
+		return psd.Parameter(param), true
+	}
+
+	return nil, false
+}
+
+// validatePolicyAssignmentParameters validates the parameter values of the policy assignments,
+// and the parameter types of the default policy values, in the processed library result.
+// Assignments that reference definitions or parameters not present in AlzLib are not validated.
+// Default policy assignment values are validated when they are applied to a hierarchy,
+// see deployment.WithParameters.
+func (az *AlzLib) validatePolicyAssignmentParameters(res *processor.Result) error {
+	var merr error
+
+	for _, name := range slices.Sorted(maps.Keys(res.PolicyAssignments)) {
+		pa := res.PolicyAssignments[name]
+
+		ref, version, err := pa.ReferencedPolicyDefinitionResourceIDAndVersion()
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("policy assignment `%s`: %w", name, err))
+			continue
+		}
+
+		for _, param := range slices.Sorted(maps.Keys(pa.Properties.Parameters)) {
+			v := pa.Properties.Parameters[param]
+			if v == nil {
+				continue
+			}
+
+			// Parameters that are not present in the referenced definition are reported by the library checks.
+			paramDef, _ := az.referencedParameterDefinition(ref, version, param)
+			if err := assets.ValidateParameterValue(param, paramDef, v.Value); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("policy assignment `%s`: %w", name, err))
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(res.LibDefaultPolicyValues)) {
+		if err := az.validateDefaultPolicyValueTypes(res.LibDefaultPolicyValues[name]); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("default policy value `%s`: %w", name, err))
+		}
+	}
+
+	return merr
+}
+
+// validateDefaultPolicyValueTypes checks that the parameters a default policy value is applied to all have
+// the same type, as a single value cannot be valid for parameters of different types.
+// Assignments, definitions and parameters that are not present in AlzLib are reported by the library checks.
+func (az *AlzLib) validateDefaultPolicyValueTypes(def *processor.LibDefaultPolicyValuesDefaults) error {
+	var firstType armpolicy.ParameterType
+
+	var firstParam string
+
+	for _, a := range def.PolicyAssignments {
+		pa, ok := az.policyAssignments[a.PolicyAssignmentName]
+		if !ok {
+			continue
+		}
+
+		ref, version, err := pa.ReferencedPolicyDefinitionResourceIDAndVersion()
+		if err != nil {
+			continue
+		}
+
+		for _, param := range a.ParameterNames {
+			paramDef, _ := az.referencedParameterDefinition(ref, version, param)
+			if paramDef == nil || paramDef.Type == nil {
+				continue
+			}
+
+			qualified := fmt.Sprintf("`%s` of policy assignment `%s`", param, a.PolicyAssignmentName)
+
+			if firstParam == "" {
+				firstType, firstParam = *paramDef.Type, qualified
+				continue
+			}
+
+			if !strings.EqualFold(string(firstType), string(*paramDef.Type)) {
+				return fmt.Errorf(
+					"parameter %s has type `%s`, but parameter %s has type `%s`",
+					qualified, *paramDef.Type, firstParam, firstType,
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
 // policyDefinitionVersionsPager exposes the subset of pager behaviour needed for testing.
 type policyDefinitionVersionsPager interface {
 	More() bool
@@ -866,6 +1184,7 @@ type policySetDefinitionVersionsPager interface {
 
 // policyDefinitionFromCache returns the policy definition for the given name and version
 // from the cache, or nil if the cache is unset or does not contain a matching entry.
+// An error is returned if the cache lookup fails, see [BuiltInCacheLookup].
 func (az *AlzLib) policyDefinitionFromCache(name string, version *string) (*assets.PolicyDefinition, error) {
 	az.mu.RLock()
 	c := az.cache
@@ -875,7 +1194,21 @@ func (az *AlzLib) policyDefinitionFromCache(name string, version *string) (*asse
 		return nil, nil
 	}
 
-	pdvs := c.PolicyDefinitionVersionsByName(name)
+	var (
+		pdvs *assets.PolicyDefinitionVersions
+		err  error
+	)
+
+	if l, ok := c.(BuiltInCacheLookup); ok {
+		pdvs, err = l.LookupPolicyDefinitionVersions(name)
+	} else {
+		pdvs = c.PolicyDefinitionVersionsByName(name)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("getting policy definition %s from cache: %w", name, err)
+	}
+
 	if pdvs == nil {
 		return nil, nil
 	}
@@ -894,6 +1227,7 @@ func (az *AlzLib) policyDefinitionFromCache(name string, version *string) (*asse
 
 // policySetDefinitionFromCache returns the policy set definition for the given name and version
 // from the cache, or nil if the cache is unset or does not contain a matching entry.
+// An error is returned if the cache lookup fails, see [BuiltInCacheLookup].
 func (az *AlzLib) policySetDefinitionFromCache(name string, version *string) (*assets.PolicySetDefinition, error) {
 	az.mu.RLock()
 	c := az.cache
@@ -903,7 +1237,21 @@ func (az *AlzLib) policySetDefinitionFromCache(name string, version *string) (*a
 		return nil, nil
 	}
 
-	psdvs := c.PolicySetDefinitionVersionsByName(name)
+	var (
+		psdvs *assets.PolicySetDefinitionVersions
+		err   error
+	)
+
+	if l, ok := c.(BuiltInCacheLookup); ok {
+		psdvs, err = l.LookupPolicySetDefinitionVersions(name)
+	} else {
+		psdvs = c.PolicySetDefinitionVersionsByName(name)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("getting policy set definition %s from cache: %w", name, err)
+	}
+
 	if psdvs == nil {
 		return nil, nil
 	}
@@ -1529,6 +1877,17 @@ func (az *AlzLib) addPolicyAndRoleAssets(res *processor.Result) error {
 		az.policyAssignments[k] = v
 	}
 
+	for k, v := range res.PolicyExemptions {
+		if _, exists := az.policyExemptions[k]; exists && !az.Options.AllowOverwrite {
+			return fmt.Errorf(
+				"Alzlib.addProcessedResult: policy exemption %s already exists in the library",
+				k,
+			)
+		}
+
+		az.policyExemptions[k] = v
+	}
+
 	for k, v := range res.RoleDefinitions {
 		if _, exists := az.roleDefinitions[k]; exists && !az.Options.AllowOverwrite {
 			return fmt.Errorf(
@@ -1593,6 +1952,7 @@ func (az *AlzLib) generateArchetypes(res *processor.Result) error {
 				Name:                 "empty",
 				PolicyAssignments:    mapset.NewThreadUnsafeSet[string](),
 				PolicyDefinitions:    mapset.NewThreadUnsafeSet[string](),
+				PolicyExemptions:     mapset.NewThreadUnsafeSet[string](),
 				PolicySetDefinitions: mapset.NewThreadUnsafeSet[string](),
 				RoleDefinitions:      mapset.NewThreadUnsafeSet[string](),
 			}
@@ -1646,6 +2006,18 @@ func (az *AlzLib) generateArchetypes(res *processor.Result) error {
 			arch.PolicyAssignments.Add(pa)
 		}
 
+		for pe := range v.PolicyExemptions.Iter() {
+			if _, ok := az.policyExemptions[pe]; !ok {
+				return fmt.Errorf(
+					"Alzlib.generateArchetypes: error processing archetype %s, policy exemption %s does not exist in the library",
+					k,
+					pe,
+				)
+			}
+
+			arch.PolicyExemptions.Add(pe)
+		}
+
 		for rd := range v.RoleDefinitions.Iter() {
 			if _, ok := az.roleDefinitions[rd]; !ok {
 				return fmt.Errorf(
@@ -1751,6 +2123,28 @@ func (az *AlzLib) generateOverrideArchetypes(res *processor.Result) error {
 			}
 		}
 
+		for pe := range ovr.PolicyExemptionsToAdd.Iter() {
+			if _, ok := az.policyExemptions[pe]; !ok {
+				return fmt.Errorf(
+					"Alzlib.generateOverrideArchetypes: error processing override archetype `%s`, "+
+						"policy exemption `%s` does not exist in the library",
+					name,
+					pe,
+				)
+			}
+		}
+
+		for pe := range ovr.PolicyExemptionsToRemove.Iter() {
+			if _, ok := az.policyExemptions[pe]; !ok {
+				return fmt.Errorf(
+					"Alzlib.generateOverrideArchetypes: error processing override archetype `%s`, "+
+						"policy exemption `%s` does not exist in the library",
+					name,
+					pe,
+				)
+			}
+		}
+
 		for rd := range ovr.RoleDefinitionsToAdd.Iter() {
 			if _, ok := az.roleDefinitions[rd]; !ok {
 				return fmt.Errorf(
@@ -1783,6 +2177,9 @@ func (az *AlzLib) generateOverrideArchetypes(res *processor.Result) error {
 			PolicyAssignments: base.PolicyAssignments.Clone().
 				Union(ovr.PolicyAssignmentsToAdd).
 				Difference(ovr.PolicyAssignmentsToRemove),
+			PolicyExemptions: base.PolicyExemptions.Clone().
+				Union(ovr.PolicyExemptionsToAdd).
+				Difference(ovr.PolicyExemptionsToRemove),
 			RoleDefinitions: base.RoleDefinitions.Clone().
 				Union(ovr.RoleDefinitionsToAdd).
 				Difference(ovr.RoleDefinitionsToRemove),
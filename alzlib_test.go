@@ -6,6 +6,7 @@ package alzlib
 import (
 	"bytes"
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -212,6 +213,7 @@ func TestGenerateOverrideArchetypes(t *testing.T) {
 		PolicyDefinitions:    mapset.NewThreadUnsafeSet("policy1", "policy2"),
 		PolicySetDefinitions: mapset.NewThreadUnsafeSet("policySet1", "policySet2"),
 		PolicyAssignments:    mapset.NewThreadUnsafeSet("assignment1", "assignment2"),
+		PolicyExemptions:     mapset.NewThreadUnsafeSet("exemption1", "exemption2"),
 		RoleDefinitions:      mapset.NewThreadUnsafeSet("role1", "role2"),
 		name:                 "baseArchetype",
 	}
@@ -226,6 +228,8 @@ func TestGenerateOverrideArchetypes(t *testing.T) {
 				PolicyDefinitionsToRemove:    mapset.NewThreadUnsafeSet("policy1"),
 				PolicyAssignmentsToAdd:       mapset.NewThreadUnsafeSet("assignment3"),
 				PolicyAssignmentsToRemove:    mapset.NewThreadUnsafeSet("assignment1"),
+				PolicyExemptionsToAdd:        mapset.NewThreadUnsafeSet("exemption3"),
+				PolicyExemptionsToRemove:     mapset.NewThreadUnsafeSet("exemption1"),
 				PolicySetDefinitionsToAdd:    mapset.NewThreadUnsafeSet("policySet3"),
 				PolicySetDefinitionsToRemove: mapset.NewThreadUnsafeSet("policySet1"),
 				RoleDefinitionsToAdd:         mapset.NewThreadUnsafeSet("role3"),
@@ -239,6 +243,9 @@ func TestGenerateOverrideArchetypes(t *testing.T) {
 	az.policyDefinitions["policy1"] = nil
 	az.policyDefinitions["policy2"] = nil
 	az.policyDefinitions["policy3"] = nil
+	az.policyExemptions["exemption1"] = nil
+	az.policyExemptions["exemption2"] = nil
+	az.policyExemptions["exemption3"] = nil
 	az.policySetDefinitions["policySet1"] = nil
 	az.policySetDefinitions["policySet2"] = nil
 	az.policySetDefinitions["policySet3"] = nil
@@ -265,6 +272,11 @@ func TestGenerateOverrideArchetypes(t *testing.T) {
 		mapset.NewThreadUnsafeSet("assignment2", "assignment3").
 			Equal(overrideArchetype.PolicyAssignments),
 	)
+	assert.True(
+		t,
+		mapset.NewThreadUnsafeSet("exemption2", "exemption3").
+			Equal(overrideArchetype.PolicyExemptions),
+	)
 	assert.True(
 		t,
 		mapset.NewThreadUnsafeSet("role2", "role3").Equal(overrideArchetype.RoleDefinitions),
@@ -528,6 +540,44 @@ func TestGenerateArchitecturesTbt(t *testing.T) {
 			expectedNotNil: "toodeep",
 			expectedError:  "architectureRecursion: recursion depth exceeded",
 		},
+		{
+			name: "subscription in two management groups",
+			setupAlzLib: func(az *AlzLib) {
+				az.archetypes["archetype1"] = &Archetype{
+					PolicyDefinitions:    mapset.NewThreadUnsafeSet[string](),
+					PolicyAssignments:    mapset.NewThreadUnsafeSet[string](),
+					PolicySetDefinitions: mapset.NewThreadUnsafeSet[string](),
+					RoleDefinitions:      mapset.NewThreadUnsafeSet[string](),
+					name:                 "archetype1",
+				}
+			},
+			processorOutput: &processor.Result{
+				LibArchitectures: map[string]*processor.LibArchitecture{
+					"subs": {
+						Name: "subs",
+						ManagementGroups: []processor.LibArchitectureManagementGroup{
+							{
+								ID:            "mg1",
+								ParentID:      nil,
+								Archetypes:    mapset.NewThreadUnsafeSet("archetype1"),
+								DisplayName:   "mg1",
+								Subscriptions: mapset.NewThreadUnsafeSet("connectivity"),
+							},
+							{
+								ID:            "mg2",
+								ParentID:      to.Ptr("mg1"),
+								Archetypes:    mapset.NewThreadUnsafeSet("archetype1"),
+								DisplayName:   "mg2",
+								Subscriptions: mapset.NewThreadUnsafeSet("Connectivity"),
+							},
+						},
+					},
+				},
+			},
+			expectedLength: 1,
+			expectedNotNil: "subs",
+			expectedError:  "subscription `Connectivity` in management group `mg2` is already in management group `mg1`",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -1097,6 +1147,59 @@ func TestAssignmentReferencedDefinitionHasParameterPolicySet(t *testing.T) {
 	assert.False(t, az.AssignmentReferencedDefinitionHasParameter(resID, to.Ptr("1.0.*"), "nonExistentParam"))
 }
 
+func TestValidateAssignmentParameterValue(t *testing.T) {
+	t.Parallel()
+
+	az := NewAlzLib(nil)
+	require.NoError(t, az.Init(context.Background(), NewCustomLibraryReference("./testdata/simple")))
+
+	resID, err := arm.ParseResourceID("/providers/Microsoft.Authorization/policyDefinitions/test-policy-definition")
+	require.NoError(t, err)
+
+	require.NoError(t, az.ValidateAssignmentParameterValue(resID, nil, "effect", "Audit"))
+	require.ErrorContains(t, az.ValidateAssignmentParameterValue(resID, nil, "effect", "Block"),
+		`invalid value for parameter 'effect': value "Block" is not one of the allowed values`)
+	require.ErrorContains(t, az.ValidateAssignmentParameterValue(resID, nil, "nonExistentParam", "foo"),
+		"parameter `nonExistentParam` not found in referenced policyDefinitions `test-policy-definition`")
+
+	// Definitions that are not present are not validated.
+	resID, err = arm.ParseResourceID("/providers/Microsoft.Authorization/policyDefinitions/not-present")
+	require.NoError(t, err)
+	require.NoError(t, az.ValidateAssignmentParameterValue(resID, nil, "effect", 1))
+}
+
+func TestInitValidatesParameterValues(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	libFS := modifiedLibraryFS(t, "./testdata/simple", map[string][2]string{
+		"test.alz_policy_assignment.json": {`"parameters": {},`, `"parameters": {"effect": {"value": "Block"}},`},
+	})
+	az := NewAlzLib(nil)
+	err := az.Init(ctx, NewCustomLibraryReferenceFromFS("invalid-assignment", libFS))
+	require.ErrorContains(t, err, "policy assignment `test-pa`: invalid value for parameter 'effect'")
+
+	// Definition parameter default values are validated by the library checks, not by Init.
+	libFS = modifiedLibraryFS(t, "./testdata/simple", map[string][2]string{
+		"test.alz_policy_definition.json": {`"defaultValue": "Deny"`, `"defaultValue": 1`},
+	})
+	az = NewAlzLib(nil)
+	require.NoError(t, az.Init(ctx, NewCustomLibraryReferenceFromFS("invalid-definition-default", libFS)))
+
+	libFS = modifiedLibraryFS(t, "./testdata/simple", map[string][2]string{
+		"test.alz_policy_definition.json": {`"effect": {`, `"count": {"type": "Integer"}, "effect": {`},
+		"alz_policy_default_values.yml": {
+			"- policy_assignment_name: test-policy-assignment\n        parameter_names:\n          - effect",
+			"- policy_assignment_name: test-pa\n        parameter_names:\n          - effect\n          - count",
+		},
+	})
+	az = NewAlzLib(nil)
+	err = az.Init(ctx, NewCustomLibraryReferenceFromFS("invalid-default-types", libFS))
+	require.ErrorContains(t, err, "default policy value `test`: parameter `count` of policy assignment `test-pa` "+
+		"has type `Integer`, but parameter `effect` of policy assignment `test-pa` has type `String`")
+}
+
 func TestIntegrationGetDefinitionsFromAzure(t *testing.T) {
 	policyDefAzureBackupShouldBeEnabledForVirtualMachines, err := arm.ParseResourceID("/providers/Microsoft.Authorization/policyDefinitions/013e242c-8828-4970-87b3-ab247555486d")
 	require.NoError(t, err)
@@ -1170,6 +1273,35 @@ func (m *mockBuiltInCache) PolicySetDefinitionVersionsByName(name string) *asset
 	return m.policySetDefs[name]
 }
 
+// lookupErrorBuiltInCache implements the BuiltInCacheLookup interface for testing, failing every lookup.
+type lookupErrorBuiltInCache struct {
+	mockBuiltInCache
+}
+
+func (m *lookupErrorBuiltInCache) LookupPolicyDefinitionVersions(string) (*assets.PolicyDefinitionVersions, error) {
+	return nil, errors.New("corrupt record")
+}
+
+func (m *lookupErrorBuiltInCache) LookupPolicySetDefinitionVersions(
+	string,
+) (*assets.PolicySetDefinitionVersions, error) {
+	return nil, errors.New("corrupt record")
+}
+
+// TestAddCacheLookupError verifies that a failed cache lookup is returned rather than treated as a cache miss.
+func TestAddCacheLookupError(t *testing.T) {
+	t.Parallel()
+
+	az := NewAlzLib(nil)
+	az.AddCache(&lookupErrorBuiltInCache{})
+
+	pdResID, err := arm.ParseResourceID("/providers/Microsoft.Authorization/policyDefinitions/cached-pd")
+	require.NoError(t, err)
+
+	err = az.GetDefinitionsFromAzure(context.Background(), []BuiltInRequest{{ResourceID: pdResID}})
+	require.ErrorContains(t, err, "getting policy definition cached-pd from cache: corrupt record")
+}
+
 // TestAddCacheStoresCacheReference verifies that AddCache stores the cache reference for
 // lazy lookup, and that definitions are not immediately loaded into AlzLib.
 func TestAddCacheStoresCacheReference(t *testing.T) {
@@ -15,6 +15,7 @@ import (
 type Archetype struct {
 	PolicyDefinitions    mapset.Set[string]
 	PolicyAssignments    mapset.Set[string]
+	PolicyExemptions     mapset.Set[string]
 	PolicySetDefinitions mapset.Set[string]
 	RoleDefinitions      mapset.Set[string]
 	name                 string
@@ -25,6 +26,7 @@ func NewArchetype(name string) *Archetype {
 	return &Archetype{
 		PolicyDefinitions:    mapset.NewThreadUnsafeSet[string](),
 		PolicyAssignments:    mapset.NewThreadUnsafeSet[string](),
+		PolicyExemptions:     mapset.NewThreadUnsafeSet[string](),
 		PolicySetDefinitions: mapset.NewThreadUnsafeSet[string](),
 		RoleDefinitions:      mapset.NewThreadUnsafeSet[string](),
 		name:                 name,
@@ -41,6 +43,7 @@ func (a *Archetype) copy() *Archetype {
 	return &Archetype{
 		PolicyDefinitions:    a.PolicyDefinitions.Clone(),
 		PolicyAssignments:    a.PolicyAssignments.Clone(),
+		PolicyExemptions:     a.PolicyExemptions.Clone(),
 		PolicySetDefinitions: a.PolicySetDefinitions.Clone(),
 		RoleDefinitions:      a.RoleDefinitions.Clone(),
 		name:                 a.name,
@@ -6,6 +6,7 @@ package alzlib
 import (
 	"fmt"
 	"slices"
+	"strings"
 
 	"github.com/Azure/alzlib/internal/processor"
 	mapset "github.com/deckarep/golang-set/v2"
@@ -67,6 +68,8 @@ type ArchitectureManagementGroup struct {
 	exists       bool
 	archetypes   mapset.Set[*Archetype]
 	architecture *Architecture
+	// The subscription ids, or placeholders, placed in the management group.
+	subscriptions mapset.Set[string]
 }
 
 func newArchitectureManagementGroup(
@@ -75,12 +78,13 @@ func newArchitectureManagementGroup(
 	arch *Architecture,
 ) *ArchitectureManagementGroup {
 	return &ArchitectureManagementGroup{
-		id:           id,
-		displayName:  displayName,
-		children:     mapset.NewThreadUnsafeSet[*ArchitectureManagementGroup](),
-		exists:       exists,
-		archetypes:   mapset.NewThreadUnsafeSet[*Archetype](),
-		architecture: arch,
+		id:            id,
+		displayName:   displayName,
+		children:      mapset.NewThreadUnsafeSet[*ArchitectureManagementGroup](),
+		exists:        exists,
+		archetypes:    mapset.NewThreadUnsafeSet[*Archetype](),
+		architecture:  arch,
+		subscriptions: mapset.NewThreadUnsafeSet[string](),
 	}
 }
 
@@ -129,6 +133,14 @@ func (mg *ArchitectureManagementGroup) Exists() bool {
 	return mg.exists
 }
 
+// Subscriptions returns the sorted subscription ids, or placeholders, placed in the management group.
+func (mg *ArchitectureManagementGroup) Subscriptions() []string {
+	res := mg.subscriptions.ToSlice()
+	slices.Sort(res)
+
+	return res
+}
+
 func (a *Architecture) addMgFromProcessor(
 	libMg processor.LibArchitectureManagementGroup,
 	az *AlzLib,
@@ -167,7 +179,40 @@ func (a *Architecture) addMgFromProcessor(
 		mg.archetypes.Add(arch)
 	}
 
+	if libMg.Subscriptions != nil {
+		for sub := range libMg.Subscriptions.Iter() {
+			if sub == "" {
+				return fmt.Errorf("Architecture.addMg: empty subscription in management group `%s`", libMg.ID)
+			}
+
+			if other := a.subscriptionManagementGroup(sub); other != nil {
+				return fmt.Errorf(
+					"Architecture.addMg: subscription `%s` in management group `%s` is already in management group `%s`",
+					sub,
+					libMg.ID,
+					other.id,
+				)
+			}
+
+			mg.subscriptions.Add(sub)
+		}
+	}
+
 	a.mgs[mg.id] = mg
 
 	return nil
 }
+
+// subscriptionManagementGroup returns the management group that the subscription is placed in, or nil.
+// Subscription ids are compared case insensitively.
+func (a *Architecture) subscriptionManagementGroup(sub string) *ArchitectureManagementGroup {
+	for _, mg := range a.mgs {
+		if slices.ContainsFunc(mg.subscriptions.ToSlice(), func(s string) bool {
+			return strings.EqualFold(s, sub)
+		}) {
+			return mg
+		}
+	}
+
+	return nil
+}
@@ -7,6 +7,7 @@ import "fmt"
 
 var _ error = (*ErrPropertyMustNotBeNil)(nil)
 var _ error = (*ErrPropertyLength)(nil)
+var _ error = (*ErrParameterValue)(nil)
 
 // ErrPropertyMustNotBeNil is an error type that indicates a required property is nil.
 type ErrPropertyMustNotBeNil struct {
@@ -46,3 +47,19 @@ func NewErrPropertyLength(propertyName string, minLength, maxLength, actualLengt
 		ActualLength: actualLength,
 	}
 }
+
+// ErrParameterValue is an error type that indicates a policy parameter value is not valid for the parameter definition.
+type ErrParameterValue struct {
+	ParameterName string
+	Reason        string
+}
+
+// Error implements the error interface for type ErrParameterValue.
+func (e *ErrParameterValue) Error() string {
+	return fmt.Sprintf("invalid value for parameter '%s': %s", e.ParameterName, e.Reason)
+}
+
+// NewErrParameterValue creates a new ErrParameterValue error.
+func NewErrParameterValue(parameterName, reason string) error {
+	return &ErrParameterValue{ParameterName: parameterName, Reason: reason}
+}
@@ -0,0 +1,384 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package assets
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+// ValidateParameterValue validates a policy assignment parameter value against the parameter definition
+// of the referenced policy definition or policy set definition.
+// It checks the parameter type, the allowed values and, for object parameters, the JSON schema.
+// Only a subset of JSON schema is supported: type, enum, const, required, properties, additionalProperties,
+// items, minimum, maximum, minLength, maxLength, pattern, minItems and maxItems. Other keywords are ignored.
+// ARM template expressions, e.g. `[parameters('foo')]`, and nil values are not validated as they are
+// only resolved at deployment time.
+// The returned error is of type *ErrParameterValue.
+func ValidateParameterValue(name string, def *armpolicy.ParameterDefinitionsValue, value any) error {
+	if def == nil || value == nil {
+		return nil
+	}
+
+	if s, ok := value.(string); ok && isArmExpression(s) {
+		return nil
+	}
+
+	v, err := normaliseParameterValue(value)
+	if err != nil {
+		return NewErrParameterValue(name, err.Error())
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	if def.Type != nil {
+		if err := validateParameterType(*def.Type, v); err != nil {
+			return NewErrParameterValue(name, err.Error())
+		}
+	}
+
+	if len(def.AllowedValues) > 0 && !parameterValueAllowed(def.AllowedValues, v) {
+		return NewErrParameterValue(name, fmt.Sprintf("value %s is not one of the allowed values %s",
+			parameterValueString(v), parameterValueString(def.AllowedValues)))
+	}
+
+	if def.Schema != nil {
+		schema, err := normaliseParameterValue(def.Schema)
+		if err != nil {
+			return NewErrParameterValue(name, fmt.Sprintf("invalid schema: %v", err))
+		}
+
+		if err := validateParameterSchema("$", schema, v); err != nil {
+			return NewErrParameterValue(name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// isArmExpression reports whether the string is an ARM template expression.
+// Strings starting with `[[` are escaped literals.
+func isArmExpression(s string) bool {
+	return strings.HasPrefix(s, "[") && !strings.HasPrefix(s, "[[") && strings.HasSuffix(s, "]")
+}
+
+// normaliseParameterValue converts the value to the generic types produced by encoding/json,
+// so that values set in code, e.g. []string, compare the same as values read from files.
+func normaliseParameterValue(value any) (any, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal value: %w", err)
+	}
+
+	var res any
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal value: %w", err)
+	}
+
+	return res, nil
+}
+
+// validateParameterType validates the normalised value against the parameter type.
+// The type is compared case-insensitively, as library files use e.g. `string` as well as `String`.
+func validateParameterType(typ armpolicy.ParameterType, v any) error {
+	var ok bool
+
+	for _, pt := range armpolicy.PossibleParameterTypeValues() {
+		if strings.EqualFold(string(typ), string(pt)) {
+			typ = pt
+			break
+		}
+	}
+
+	switch typ {
+	case armpolicy.ParameterTypeArray:
+		_, ok = v.([]any)
+	case armpolicy.ParameterTypeBoolean:
+		_, ok = v.(bool)
+	case armpolicy.ParameterTypeDateTime:
+		var s string
+		if s, ok = v.(string); ok {
+			_, err := time.Parse(time.RFC3339, s)
+			_, dateErr := time.Parse(time.DateOnly, s)
+			ok = err == nil || dateErr == nil
+		}
+	case armpolicy.ParameterTypeFloat:
+		_, ok = v.(float64)
+	case armpolicy.ParameterTypeInteger:
+		var f float64
+		if f, ok = v.(float64); ok {
+			ok = f == math.Trunc(f)
+		}
+	case armpolicy.ParameterTypeObject:
+		_, ok = v.(map[string]any)
+	case armpolicy.ParameterTypeString:
+		_, ok = v.(string)
+	default:
+		// Unknown types are not validated.
+		return nil
+	}
+
+	if !ok {
+		return fmt.Errorf("value %s is not of type %s", parameterValueString(v), typ)
+	}
+
+	return nil
+}
+
+// parameterValueAllowed reports whether the normalised value is one of the allowed values.
+// For arrays, Azure Policy applies the allowed values to each element, so an array is also allowed
+// if all of its elements are allowed values.
+func parameterValueAllowed(allowedValues []any, v any) bool {
+	allowed, err := normaliseParameterValue(allowedValues)
+	if err != nil {
+		return true
+	}
+
+	allowedSlice, _ := allowed.([]any)
+	contains := func(v any) bool {
+		return slices.ContainsFunc(allowedSlice, func(a any) bool {
+			return parameterValuesEqual(a, v)
+		})
+	}
+
+	if contains(v) {
+		return true
+	}
+
+	if arr, ok := v.([]any); ok {
+		return !slices.ContainsFunc(arr, func(e any) bool { return !contains(e) })
+	}
+
+	return false
+}
+
+// parameterValuesEqual compares two normalised values. Strings are compared case-insensitively,
+// as Azure Policy does for allowed values.
+func parameterValuesEqual(a, b any) bool {
+	as, aok := a.(string)
+	bs, bok := b.(string)
+
+	if aok && bok {
+		return strings.EqualFold(as, bs)
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func parameterValueString(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return string(b)
+}
+
+// validateParameterSchema validates the normalised value against the supported subset of JSON schema.
+func validateParameterSchema(path string, schema, v any) error {
+	s, ok := schema.(map[string]any)
+	if !ok {
+		// Boolean schemas: false rejects everything.
+		if b, isBool := schema.(bool); isBool && !b {
+			return fmt.Errorf("%s: value is not allowed", path)
+		}
+
+		return nil
+	}
+
+	if err := validateSchemaType(path, s["type"], v); err != nil {
+		return err
+	}
+
+	if enum, ok := s["enum"].([]any); ok && !slices.ContainsFunc(enum, func(e any) bool {
+		return reflect.DeepEqual(e, v)
+	}) {
+		return fmt.Errorf("%s: value %s is not one of %s", path, parameterValueString(v), parameterValueString(enum))
+	}
+
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, v) {
+		return fmt.Errorf("%s: value %s is not %s", path, parameterValueString(v), parameterValueString(c))
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		return validateSchemaObject(path, s, val)
+	case []any:
+		return validateSchemaArray(path, s, val)
+	case string:
+		return validateSchemaString(path, s, val)
+	case float64:
+		return validateSchemaNumber(path, s, val)
+	}
+
+	return nil
+}
+
+func validateSchemaType(path string, typ, v any) error {
+	var types []string
+
+	switch t := typ.(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, tt := range t {
+			if ts, ok := tt.(string); ok {
+				types = append(types, ts)
+			}
+		}
+	default:
+		return nil
+	}
+
+	for _, t := range types {
+		if schemaTypeMatches(t, v) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s: value %s is not of type %s", path, parameterValueString(v), strings.Join(types, " or "))
+}
+
+func schemaTypeMatches(typ string, v any) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "null":
+		return v == nil
+	default:
+		return true
+	}
+}
+
+func validateSchemaObject(path string, s, v map[string]any) error {
+	if required, ok := s["required"].([]any); ok {
+		for _, r := range required {
+			name, ok := r.(string)
+			if !ok {
+				continue
+			}
+
+			if _, exists := v[name]; !exists {
+				return fmt.Errorf("%s: required property `%s` is missing", path, name)
+			}
+		}
+	}
+
+	props, _ := s["properties"].(map[string]any)
+
+	for _, k := range sortedMapKeys(v) {
+		if ps, ok := props[k]; ok {
+			if err := validateParameterSchema(path+"."+k, ps, v[k]); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if ap, ok := s["additionalProperties"]; ok {
+			if err := validateParameterSchema(path+"."+k, ap, v[k]); err != nil {
+				return fmt.Errorf("%s: additional property `%s` is not allowed: %w", path, k, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateSchemaArray(path string, s map[string]any, v []any) error {
+	if minItems, ok := s["minItems"].(float64); ok && float64(len(v)) < minItems {
+		return fmt.Errorf("%s: array has %d items, minimum is %v", path, len(v), minItems)
+	}
+
+	if maxItems, ok := s["maxItems"].(float64); ok && float64(len(v)) > maxItems {
+		return fmt.Errorf("%s: array has %d items, maximum is %v", path, len(v), maxItems)
+	}
+
+	items, ok := s["items"]
+	if !ok {
+		return nil
+	}
+
+	for i, item := range v {
+		if err := validateParameterSchema(fmt.Sprintf("%s[%d]", path, i), items, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateSchemaString(path string, s map[string]any, v string) error {
+	length := float64(len([]rune(v)))
+	if minLength, ok := s["minLength"].(float64); ok && length < minLength {
+		return fmt.Errorf("%s: string length %v is less than minimum %v", path, length, minLength)
+	}
+
+	if maxLength, ok := s["maxLength"].(float64); ok && length > maxLength {
+		return fmt.Errorf("%s: string length %v is greater than maximum %v", path, length, maxLength)
+	}
+
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			// Patterns that are not supported by the Go regexp engine are not validated.
+			return nil //nolint:nilerr
+		}
+
+		if !re.MatchString(v) {
+			return fmt.Errorf("%s: string %q does not match pattern %q", path, v, pattern)
+		}
+	}
+
+	return nil
+}
+
+func validateSchemaNumber(path string, s map[string]any, v float64) error {
+	if minimum, ok := s["minimum"].(float64); ok && v < minimum {
+		return fmt.Errorf("%s: value %v is less than minimum %v", path, v, minimum)
+	}
+
+	if maximum, ok := s["maximum"].(float64); ok && v > maximum {
+		return fmt.Errorf("%s: value %v is greater than maximum %v", path, v, maximum)
+	}
+
+	return nil
+}
+
+func sortedMapKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
@@ -0,0 +1,201 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package assets
+
+import (
+	"testing"
+
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateParameterValue(t *testing.T) {
+	t.Parallel()
+
+	objectSchema := map[string]any{
+		"type":     "object",
+		"required": []any{"name"},
+		"properties": map[string]any{
+			"name":  map[string]any{"type": "string", "pattern": "^[a-z]+$"},
+			"count": map[string]any{"type": "integer", "minimum": 1, "maximum": 10},
+			"tags": map[string]any{
+				"type":     "array",
+				"maxItems": 2,
+				"items":    map[string]any{"type": "string"},
+			},
+		},
+		"additionalProperties": false,
+	}
+
+	cases := []struct {
+		name    string
+		def     *armpolicy.ParameterDefinitionsValue
+		value   any
+		wantErr string
+	}{
+		{
+			name:  "string",
+			def:   &armpolicy.ParameterDefinitionsValue{Type: to.Ptr(armpolicy.ParameterTypeString)},
+			value: "foo",
+		},
+		{
+			name:    "string wrong type",
+			def:     &armpolicy.ParameterDefinitionsValue{Type: to.Ptr(armpolicy.ParameterTypeString)},
+			value:   1,
+			wantErr: "value 1 is not of type String",
+		},
+		{
+			name:    "lowercase string type",
+			def:     &armpolicy.ParameterDefinitionsValue{Type: to.Ptr(armpolicy.ParameterType("string"))},
+			value:   1,
+			wantErr: "value 1 is not of type String",
+		},
+		{
+			name:    "lowercase array type",
+			def:     &armpolicy.ParameterDefinitionsValue{Type: to.Ptr(armpolicy.ParameterType("array"))},
+			value:   "foo",
+			wantErr: `value "foo" is not of type Array`,
+		},
+		{
+			name:  "arm expression is not validated",
+			def:   &armpolicy.ParameterDefinitionsValue{Type: to.Ptr(armpolicy.ParameterTypeInteger)},
+			value: "[parameters('foo')]",
+		},
+		{
+			name:  "nil is not validated",
+			def:   &armpolicy.ParameterDefinitionsValue{Type: to.Ptr(armpolicy.ParameterTypeInteger)},
+			value: nil,
+		},
+		{
+			name:    "integer with fraction",
+			def:     &armpolicy.ParameterDefinitionsValue{Type: to.Ptr(armpolicy.ParameterTypeInteger)},
+			value:   1.5,
+			wantErr: "value 1.5 is not of type Integer",
+		},
+		{
+			name:  "array from typed slice",
+			def:   &armpolicy.ParameterDefinitionsValue{Type: to.Ptr(armpolicy.ParameterTypeArray)},
+			value: []string{"a", "b"},
+		},
+		{
+			name:    "datetime",
+			def:     &armpolicy.ParameterDefinitionsValue{Type: to.Ptr(armpolicy.ParameterTypeDateTime)},
+			value:   "yesterday",
+			wantErr: `value "yesterday" is not of type DateTime`,
+		},
+		{
+			name: "allowed values are case insensitive",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:          to.Ptr(armpolicy.ParameterTypeString),
+				AllowedValues: []any{"Audit", "Deny"},
+			},
+			value: "deny",
+		},
+		{
+			name: "not an allowed value",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:          to.Ptr(armpolicy.ParameterTypeString),
+				AllowedValues: []any{"Audit", "Deny"},
+			},
+			value:   "Block",
+			wantErr: `value "Block" is not one of the allowed values ["Audit","Deny"]`,
+		},
+		{
+			name: "allowed array value",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:          to.Ptr(armpolicy.ParameterTypeArray),
+				AllowedValues: []any{[]any{"a"}, []any{"a", "b"}},
+			},
+			value: []string{"a", "b"},
+		},
+		{
+			name: "array elements are allowed values",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:          to.Ptr(armpolicy.ParameterTypeArray),
+				AllowedValues: []any{"a", "b", "c"},
+			},
+			value: []string{"a", "c"},
+		},
+		{
+			name: "array element is not an allowed value",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:          to.Ptr(armpolicy.ParameterTypeArray),
+				AllowedValues: []any{"a", "b", "c"},
+			},
+			value:   []string{"a", "d"},
+			wantErr: `value ["a","d"] is not one of the allowed values`,
+		},
+		{
+			name: "schema valid",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:   to.Ptr(armpolicy.ParameterTypeObject),
+				Schema: objectSchema,
+			},
+			value: map[string]any{"name": "foo", "count": 2, "tags": []string{"x"}},
+		},
+		{
+			name: "schema missing required property",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:   to.Ptr(armpolicy.ParameterTypeObject),
+				Schema: objectSchema,
+			},
+			value:   map[string]any{"count": 2},
+			wantErr: "$: required property `name` is missing",
+		},
+		{
+			name: "schema nested violation",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:   to.Ptr(armpolicy.ParameterTypeObject),
+				Schema: objectSchema,
+			},
+			value:   map[string]any{"name": "foo", "count": 11},
+			wantErr: "$.count: value 11 is greater than maximum 10",
+		},
+		{
+			name: "schema array item violation",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:   to.Ptr(armpolicy.ParameterTypeObject),
+				Schema: objectSchema,
+			},
+			value:   map[string]any{"name": "foo", "tags": []any{1}},
+			wantErr: "$.tags[0]: value 1 is not of type string",
+		},
+		{
+			name: "schema additional property",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:   to.Ptr(armpolicy.ParameterTypeObject),
+				Schema: objectSchema,
+			},
+			value:   map[string]any{"name": "foo", "other": true},
+			wantErr: "$: additional property `other` is not allowed",
+		},
+		{
+			name: "schema pattern",
+			def: &armpolicy.ParameterDefinitionsValue{
+				Type:   to.Ptr(armpolicy.ParameterTypeObject),
+				Schema: objectSchema,
+			},
+			value:   map[string]any{"name": "Foo"},
+			wantErr: `$.name: string "Foo" does not match pattern "^[a-z]+$"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateParameterValue("param", tc.def, tc.value)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var pvErr *ErrParameterValue
+
+			assert.ErrorAs(t, err, &pvErr)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
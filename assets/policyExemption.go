@@ -0,0 +1,155 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package assets
+
+import (
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+const (
+	// PolicyExemptionNameMaxLength is the maximum length of a policy exemption name.
+	PolicyExemptionNameMaxLength = 64
+	// PolicyExemptionDisplayNameMaxLength is the maximum length of a policy exemption display name.
+	PolicyExemptionDisplayNameMaxLength = 128
+	// PolicyExemptionDescriptionMaxLength is the maximum length of a policy exemption description.
+	PolicyExemptionDescriptionMaxLength = 512
+)
+
+// PolicyExemption represents a policy exemption in Azure.
+// It wraps the armpolicy.Exemption type and provides additional methods for validation and
+// working with policy exemptions.
+type PolicyExemption struct {
+	armpolicy.Exemption
+}
+
+// NewPolicyExemption creates a new PolicyExemption instance from an armpolicy.Exemption.
+// The caller is responsible for ensuring that the policy exemption is valid.
+// Use either the UnmarshalJSON method, or the ValidatePolicyExemption function to validate the
+// exemption.
+func NewPolicyExemption(pe armpolicy.Exemption) *PolicyExemption {
+	return &PolicyExemption{pe}
+}
+
+// NewPolicyExemptionValidate creates a new PolicyExemption instance and validates it.
+func NewPolicyExemptionValidate(pe armpolicy.Exemption) (*PolicyExemption, error) {
+	peObj := &PolicyExemption{pe}
+	if err := ValidatePolicyExemption(peObj); err != nil {
+		return nil, fmt.Errorf("NewPolicyExemptionValidate: %w", err)
+	}
+
+	return peObj, nil
+}
+
+// ReferencedPolicyAssignmentName returns the name of the policy assignment that is exempted,
+// i.e. the last segment of properties.policyAssignmentId.
+// The scope of the id is not relevant in the library as it is rewritten when the exemption is
+// added to a management group.
+func (pe *PolicyExemption) ReferencedPolicyAssignmentName() (string, error) {
+	id, err := arm.ParseResourceID(*pe.Properties.PolicyAssignmentID)
+	if err != nil {
+		return "", fmt.Errorf("PolicyExemption.ReferencedPolicyAssignmentName: %w", err)
+	}
+
+	return id.Name, nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for type PolicyExemption.
+// It performs validity checks on mandatory fields.
+func (pe *PolicyExemption) UnmarshalJSON(data []byte) error {
+	if err := pe.Exemption.UnmarshalJSON(data); err != nil {
+		return fmt.Errorf("PolicyExemption.UnmarshalJSON: %w", err)
+	}
+
+	return ValidatePolicyExemption(pe)
+}
+
+// ValidatePolicyExemption performs validation checks on the policy exemption.
+// To reduce the risk of nil pointer dereferences, it will create empty values for optional fields.
+func ValidatePolicyExemption(pe *PolicyExemption) error {
+	if pe == nil {
+		return NewErrPropertyMustNotBeNil("PolicyExemption")
+	}
+
+	if pe.Name == nil {
+		return NewErrPropertyMustNotBeNil("name")
+	}
+
+	if *pe.Name == "" || utf8.RuneCountInString(*pe.Name) > PolicyExemptionNameMaxLength {
+		return NewErrPropertyLength(
+			"name",
+			1,
+			PolicyExemptionNameMaxLength,
+			utf8.RuneCountInString(*pe.Name),
+		)
+	}
+
+	if pe.Properties == nil {
+		return NewErrPropertyMustNotBeNil("properties")
+	}
+
+	if pe.Properties.PolicyAssignmentID == nil {
+		return NewErrPropertyMustNotBeNil("properties.policyAssignmentId")
+	}
+
+	if _, err := pe.ReferencedPolicyAssignmentName(); err != nil {
+		return fmt.Errorf("ValidatePolicyExemption: invalid properties.policyAssignmentId: %w", err)
+	}
+
+	if pe.Properties.ExemptionCategory == nil {
+		return NewErrPropertyMustNotBeNil("properties.exemptionCategory")
+	}
+
+	if !slices.Contains(armpolicy.PossibleExemptionCategoryValues(), *pe.Properties.ExemptionCategory) {
+		return fmt.Errorf(
+			"ValidatePolicyExemption: properties.exemptionCategory `%s` is invalid, must be one of %v",
+			*pe.Properties.ExemptionCategory,
+			armpolicy.PossibleExemptionCategoryValues(),
+		)
+	}
+
+	if pe.Properties.DisplayName != nil &&
+		utf8.RuneCountInString(*pe.Properties.DisplayName) > PolicyExemptionDisplayNameMaxLength {
+		return NewErrPropertyLength(
+			"properties.displayName",
+			0,
+			PolicyExemptionDisplayNameMaxLength,
+			utf8.RuneCountInString(*pe.Properties.DisplayName),
+		)
+	}
+
+	if pe.Properties.Description != nil &&
+		utf8.RuneCountInString(*pe.Properties.Description) > PolicyExemptionDescriptionMaxLength {
+		return NewErrPropertyLength(
+			"properties.description",
+			0,
+			PolicyExemptionDescriptionMaxLength,
+			utf8.RuneCountInString(*pe.Properties.Description),
+		)
+	}
+
+	if pe.Properties.Metadata == nil {
+		pe.Properties.Metadata = any(map[string]any{})
+	}
+
+	if pe.Properties.PolicyDefinitionReferenceIDs == nil {
+		pe.Properties.PolicyDefinitionReferenceIDs = make([]*string, 0)
+	}
+
+	for i, ref := range pe.Properties.PolicyDefinitionReferenceIDs {
+		if ref == nil || *ref == "" {
+			return fmt.Errorf("ValidatePolicyExemption: properties.policyDefinitionReferenceIds[%d] is empty", i)
+		}
+	}
+
+	if pe.Properties.ResourceSelectors == nil {
+		pe.Properties.ResourceSelectors = make([]*armpolicy.ResourceSelector, 0)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package assets
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyExemptionUnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`{
+  "name": "exempt-pa",
+  "properties": {
+    "policyAssignmentId": "/providers/Microsoft.Management/managementGroups/placeholder/providers/Microsoft.Authorization/policyAssignments/pa",
+    "exemptionCategory": "Waiver"
+  }
+}`)
+
+	pe := new(PolicyExemption)
+	require.NoError(t, json.Unmarshal(data, pe))
+
+	name, err := pe.ReferencedPolicyAssignmentName()
+	require.NoError(t, err)
+	assert.Equal(t, "pa", name)
+	assert.NotNil(t, pe.Properties.Metadata)
+	assert.NotNil(t, pe.Properties.PolicyDefinitionReferenceIDs)
+	assert.NotNil(t, pe.Properties.ResourceSelectors)
+}
+
+func TestValidatePolicyExemption(t *testing.T) {
+	t.Parallel()
+
+	const assignmentID = "/providers/Microsoft.Management/managementGroups/mg/providers/" +
+		"Microsoft.Authorization/policyAssignments/pa"
+
+	testCases := []struct {
+		name    string
+		data    string
+		errWant string
+	}{
+		{
+			name:    "no name",
+			data:    `{"properties": {"policyAssignmentId": "` + assignmentID + `", "exemptionCategory": "Waiver"}}`,
+			errWant: "property 'name' must not be nil",
+		},
+		{
+			name:    "name too long",
+			data:    `{"name": "` + strings.Repeat("a", 65) + `", "properties": {}}`,
+			errWant: "property 'name' length must be between 1 and 64",
+		},
+		{
+			name:    "no properties",
+			data:    `{"name": "pe"}`,
+			errWant: "property 'properties' must not be nil",
+		},
+		{
+			name:    "no assignment id",
+			data:    `{"name": "pe", "properties": {"exemptionCategory": "Waiver"}}`,
+			errWant: "property 'properties.policyAssignmentId' must not be nil",
+		},
+		{
+			name:    "invalid assignment id",
+			data:    `{"name": "pe", "properties": {"policyAssignmentId": "pa", "exemptionCategory": "Waiver"}}`,
+			errWant: "invalid properties.policyAssignmentId",
+		},
+		{
+			name:    "no category",
+			data:    `{"name": "pe", "properties": {"policyAssignmentId": "` + assignmentID + `"}}`,
+			errWant: "property 'properties.exemptionCategory' must not be nil",
+		},
+		{
+			name:    "invalid category",
+			data:    `{"name": "pe", "properties": {"policyAssignmentId": "` + assignmentID + `", "exemptionCategory": "Nope"}}`,
+			errWant: "properties.exemptionCategory `Nope` is invalid",
+		},
+		{
+			name: "empty reference id",
+			data: `{"name": "pe", "properties": {"policyAssignmentId": "` + assignmentID +
+				`", "exemptionCategory": "Mitigated", "policyDefinitionReferenceIds": [""]}}`,
+			errWant: "properties.policyDefinitionReferenceIds[0] is empty",
+		},
+		{
+			name: "valid",
+			data: `{"name": "pe", "properties": {"policyAssignmentId": "` + assignmentID +
+				`", "exemptionCategory": "Mitigated", "policyDefinitionReferenceIds": ["ref"]}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			pe := new(PolicyExemption)
+
+			err := json.Unmarshal([]byte(tc.data), pe)
+			if tc.errWant == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorContains(t, err, tc.errWant)
+		})
+	}
+}
@@ -0,0 +1,805 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package assets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+const (
+	// PolicyRuleLogicalAllOf is the allOf logical operator, all expressions must be true.
+	PolicyRuleLogicalAllOf = "allOf"
+	// PolicyRuleLogicalAnyOf is the anyOf logical operator, at least one expression must be true.
+	PolicyRuleLogicalAnyOf = "anyOf"
+)
+
+// policyRuleOperators maps the lower case condition operators to their canonical names.
+var policyRuleOperators = map[string]string{
+	"equals":                "equals",
+	"notequals":             "notEquals",
+	"like":                  "like",
+	"notlike":               "notLike",
+	"match":                 "match",
+	"matchinsensitively":    "matchInsensitively",
+	"notmatch":              "notMatch",
+	"notmatchinsensitively": "notMatchInsensitively",
+	"contains":              "contains",
+	"notcontains":           "notContains",
+	"in":                    "in",
+	"notin":                 "notIn",
+	"containskey":           "containsKey",
+	"notcontainskey":        "notContainsKey",
+	"less":                  "less",
+	"lessorequals":          "lessOrEquals",
+	"greater":               "greater",
+	"greaterorequals":       "greaterOrEquals",
+	"exists":                "exists",
+}
+
+// PolicyRule is the parsed representation of the policy rule of a policy definition,
+// see https://learn.microsoft.com/azure/governance/policy/concepts/definition-structure-policy-rule.
+// Each node records its source path within the rule, e.g. `if.allOf[1].count.where`.
+type PolicyRule struct {
+	If   PolicyRuleExpression
+	Then *PolicyRuleThen
+}
+
+// PolicyRuleExpression is a node in the condition tree of a policy rule.
+// It is one of *PolicyRuleLogical, *PolicyRuleNot or *PolicyRuleCondition.
+type PolicyRuleExpression interface {
+	// Path returns the source path of the expression within the policy rule.
+	Path() string
+	policyRuleExpression()
+}
+
+// PolicyRuleLogical is an allOf or anyOf expression.
+type PolicyRuleLogical struct {
+	// Operator is either PolicyRuleLogicalAllOf or PolicyRuleLogicalAnyOf.
+	Operator    string
+	Expressions []PolicyRuleExpression
+	path        string
+}
+
+// PolicyRuleNot is a not expression.
+type PolicyRuleNot struct {
+	Expression PolicyRuleExpression
+	path       string
+}
+
+// PolicyRuleCondition is a condition that compares an operand using an operator,
+// e.g. `{"field": "type", "equals": "Microsoft.Network/virtualNetworks"}`.
+type PolicyRuleCondition struct {
+	// Operand is one of *PolicyRuleField, *PolicyRuleValue or *PolicyRuleCount.
+	Operand PolicyRuleOperand
+	// Operator is the canonical name of the condition operator, e.g. `notEquals`.
+	Operator string
+	// Argument is the value compared against, it may contain ARM template expressions.
+	Argument any
+	path     string
+}
+
+// PolicyRuleOperand is the left hand side of a condition.
+// It is one of *PolicyRuleField, *PolicyRuleValue or *PolicyRuleCount.
+type PolicyRuleOperand interface {
+	// Path returns the source path of the operand within the policy rule.
+	Path() string
+	policyRuleOperand()
+}
+
+// PolicyRuleField is a field operand, it refers to a resource property or alias.
+type PolicyRuleField struct {
+	Field string
+	path  string
+}
+
+// PolicyRuleValue is a value operand, usually an ARM template expression.
+type PolicyRuleValue struct {
+	Value any
+	path  string
+}
+
+// PolicyRuleCount is a count operand. Field counts have Field set to an array alias,
+// value counts have Value set and optionally Name.
+type PolicyRuleCount struct {
+	Field string
+	Value any
+	Name  string
+	// Where is the optional condition that array members must meet to be counted.
+	Where PolicyRuleExpression
+	path  string
+}
+
+// PolicyRuleThen is the then block of a policy rule.
+type PolicyRuleThen struct {
+	// Effect is the effect, it may be an ARM template expression such as `[parameters('effect')]`.
+	Effect string
+	// Details is nil if the rule has no details.
+	Details *PolicyRuleDetails
+	path    string
+}
+
+// PolicyRuleDetails are the effect details of a policy rule.
+// Only the commonly used properties are parsed, the original value is available in Raw.
+type PolicyRuleDetails struct {
+	// Type is the related resource type of the auditIfNotExists and deployIfNotExists effects.
+	Type string
+	// Name is the related resource name of the auditIfNotExists and deployIfNotExists effects.
+	Name string
+	// ExistenceCondition is the optional condition of the auditIfNotExists and deployIfNotExists effects.
+	ExistenceCondition PolicyRuleExpression
+	// RoleDefinitionIDs are the role definitions required to remediate.
+	RoleDefinitionIDs []string
+	// Operations are the field operations of the modify and append effects.
+	Operations []*PolicyRuleOperation
+	// Raw is the unparsed details value.
+	Raw  any
+	path string
+}
+
+// PolicyRuleOperation is a field operation of the modify or append effects.
+// For append, Operation is empty.
+type PolicyRuleOperation struct {
+	Operation string
+	Field     string
+	Value     any
+	Condition string
+	path      string
+}
+
+// PolicyRuleError is a problem found when parsing a policy rule.
+type PolicyRuleError struct {
+	Path    string
+	Message string
+}
+
+var _ error = (*PolicyRuleError)(nil)
+
+// Error implements the error interface for type PolicyRuleError.
+func (e *PolicyRuleError) Error() string {
+	if e.Path == "" {
+		return "policy rule: " + e.Message
+	}
+
+	return fmt.Sprintf("policy rule `%s`: %s", e.Path, e.Message)
+}
+
+// Path returns the source path of the expression.
+func (e *PolicyRuleLogical) Path() string { return e.path }
+
+// Path returns the source path of the expression.
+func (e *PolicyRuleNot) Path() string { return e.path }
+
+// Path returns the source path of the expression.
+func (e *PolicyRuleCondition) Path() string { return e.path }
+
+// Path returns the source path of the operand.
+func (o *PolicyRuleField) Path() string { return o.path }
+
+// Path returns the source path of the operand.
+func (o *PolicyRuleValue) Path() string { return o.path }
+
+// Path returns the source path of the operand.
+func (o *PolicyRuleCount) Path() string { return o.path }
+
+// Path returns the source path of the then block.
+func (t *PolicyRuleThen) Path() string { return t.path }
+
+// Path returns the source path of the details.
+func (d *PolicyRuleDetails) Path() string { return d.path }
+
+// Path returns the source path of the operation.
+func (o *PolicyRuleOperation) Path() string { return o.path }
+
+func (*PolicyRuleLogical) policyRuleExpression()   {}
+func (*PolicyRuleNot) policyRuleExpression()       {}
+func (*PolicyRuleCondition) policyRuleExpression() {}
+func (*PolicyRuleField) policyRuleOperand()        {}
+func (*PolicyRuleValue) policyRuleOperand()        {}
+func (*PolicyRuleCount) policyRuleOperand()        {}
+
+// ParsePolicyRule parses the policy rule of a policy definition, as found in `properties.policyRule`.
+// Property names are matched case-insensitively, as they are by Azure Policy.
+// All problems found are returned, joined using errors.Join, each problem is of type *PolicyRuleError.
+// The returned rule is nil if there are problems.
+func ParsePolicyRule(rule any) (*PolicyRule, error) {
+	b, err := json.Marshal(rule)
+	if err != nil {
+		return nil, fmt.Errorf("ParsePolicyRule: could not marshal policy rule: %w", err)
+	}
+
+	var generic any
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil, fmt.Errorf("ParsePolicyRule: could not unmarshal policy rule: %w", err)
+	}
+
+	p := new(policyRuleParser)
+
+	res := p.parseRule(generic)
+	if len(p.errs) > 0 {
+		return nil, errors.Join(p.errs...)
+	}
+
+	return res, nil
+}
+
+// ParsePolicyRule parses the policy rule of the policy definition, see ParsePolicyRule.
+func (pd *PolicyDefinition) ParsePolicyRule() (*PolicyRule, error) {
+	if pd == nil || pd.Properties == nil || pd.Properties.PolicyRule == nil {
+		return nil, errors.New(
+			"PolicyDefinition.ParsePolicyRule: policy definition is nil, missing properties or policy rule",
+		)
+	}
+
+	return ParsePolicyRule(pd.Properties.PolicyRule)
+}
+
+// Expressions returns all expressions in the policy rule in depth first order, including the where conditions of
+// count operands and the existence condition of the effect details.
+func (r *PolicyRule) Expressions() iter.Seq[PolicyRuleExpression] {
+	return func(yield func(PolicyRuleExpression) bool) {
+		if !walkPolicyRuleExpression(r.If, yield) {
+			return
+		}
+
+		if r.Then != nil && r.Then.Details != nil {
+			walkPolicyRuleExpression(r.Then.Details.ExistenceCondition, yield)
+		}
+	}
+}
+
+// Fields returns the sorted, unique, fields referenced by the policy rule.
+// This includes field conditions, field counts and the fields of modify and append operations.
+func (r *PolicyRule) Fields() []string {
+	fields := make(map[string]struct{})
+
+	for expr := range r.Expressions() {
+		cond, ok := expr.(*PolicyRuleCondition)
+		if !ok {
+			continue
+		}
+
+		switch o := cond.Operand.(type) {
+		case *PolicyRuleField:
+			fields[o.Field] = struct{}{}
+		case *PolicyRuleCount:
+			if o.Field != "" {
+				fields[o.Field] = struct{}{}
+			}
+		}
+	}
+
+	if r.Then != nil && r.Then.Details != nil {
+		for _, op := range r.Then.Details.Operations {
+			fields[op.Field] = struct{}{}
+		}
+	}
+
+	return slices.Sorted(maps.Keys(fields))
+}
+
+// Aliases returns the sorted, unique, resource property aliases referenced by the policy rule.
+// Aliases are the fields that are namespaced by a resource provider, e.g.
+// `Microsoft.Storage/storageAccounts/minimumTlsVersion`, as opposed to fields such as `type`, `location` or `tags`.
+func (r *PolicyRule) Aliases() []string {
+	return slices.DeleteFunc(r.Fields(), func(f string) bool {
+		return !strings.Contains(f, "/") || isArmExpression(f)
+	})
+}
+
+// ResourceTypes returns the sorted, unique, resource types that the policy rule applies to or audits.
+// These are the literal values compared to the `type` field using the equals, in and like operators,
+// and the type of the effect details.
+func (r *PolicyRule) ResourceTypes() []string {
+	types := make(map[string]struct{})
+	add := func(v any) {
+		if s, ok := v.(string); ok && s != "" && !isArmExpression(s) {
+			types[s] = struct{}{}
+		}
+	}
+
+	for expr := range r.Expressions() {
+		cond, ok := expr.(*PolicyRuleCondition)
+		if !ok {
+			continue
+		}
+
+		field, ok := cond.Operand.(*PolicyRuleField)
+		if !ok || !strings.EqualFold(field.Field, "type") {
+			continue
+		}
+
+		switch cond.Operator {
+		case "equals", "like":
+			add(cond.Argument)
+		case "in":
+			if vals, ok := cond.Argument.([]any); ok {
+				for _, v := range vals {
+					add(v)
+				}
+			}
+		}
+	}
+
+	if r.Then != nil && r.Then.Details != nil {
+		add(r.Then.Details.Type)
+	}
+
+	return slices.Sorted(maps.Keys(types))
+}
+
+// Effects returns the sorted, unique, effects that the policy definition can have.
+// If the effect is a parameter reference, e.g. `[parameters('effect')]`, the allowed values of the parameter
+// are returned, or the default value if there are no allowed values.
+func (pd *PolicyDefinition) Effects() ([]string, error) {
+	rule, err := pd.ParsePolicyRule()
+	if err != nil {
+		return nil, fmt.Errorf("PolicyDefinition.Effects: %w", err)
+	}
+
+	effect := rule.Then.Effect
+
+	paramName, ok := ParameterReference(effect)
+	if !ok {
+		return []string{effect}, nil
+	}
+
+	param := pd.Parameter(paramName)
+	if param == nil {
+		return nil, fmt.Errorf("PolicyDefinition.Effects: effect parameter `%s` not found", paramName)
+	}
+
+	values := param.AllowedValues
+	if len(values) == 0 && param.DefaultValue != nil {
+		values = []any{param.DefaultValue}
+	}
+
+	effects := make(map[string]struct{}, len(values))
+
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			effects[s] = struct{}{}
+		}
+	}
+
+	return slices.Sorted(maps.Keys(effects)), nil
+}
+
+// Effect returns the effect that the policy definition has when assigned with the supplied parameter values.
+// If the effect is a parameter reference, e.g. `[parameters('effect')]`, the supplied value of the parameter
+// is returned, or the default value if no value is supplied.
+func (pd *PolicyDefinition) Effect(params map[string]*armpolicy.ParameterValuesValue) (string, error) {
+	rule, err := pd.ParsePolicyRule()
+	if err != nil {
+		return "", fmt.Errorf("PolicyDefinition.Effect: %w", err)
+	}
+
+	effect := rule.Then.Effect
+
+	paramName, ok := ParameterReference(effect)
+	if !ok {
+		return effect, nil
+	}
+
+	var value any
+
+	if pv, ok := params[paramName]; ok && pv != nil && pv.Value != nil {
+		value = pv.Value
+	} else if param := pd.Parameter(paramName); param != nil {
+		value = param.DefaultValue
+	}
+
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return "", fmt.Errorf("PolicyDefinition.Effect: effect parameter `%s` has no value", paramName)
+	}
+
+	return s, nil
+}
+
+// ParameterReference returns the parameter name if the string is a simple parameter reference
+// such as `[parameters('effect')]`.
+func ParameterReference(s string) (string, bool) {
+	const prefix, suffix = "[parameters('", "')]"
+
+	if len(s) <= len(prefix)+len(suffix) ||
+		!strings.EqualFold(s[:len(prefix)], prefix) || !strings.HasSuffix(s, suffix) {
+		return "", false
+	}
+
+	name := s[len(prefix) : len(s)-len(suffix)]
+	if strings.ContainsAny(name, "'()[]") {
+		return "", false
+	}
+
+	return name, true
+}
+
+func walkPolicyRuleExpression(expr PolicyRuleExpression, yield func(PolicyRuleExpression) bool) bool {
+	if expr == nil {
+		return true
+	}
+
+	if !yield(expr) {
+		return false
+	}
+
+	switch e := expr.(type) {
+	case *PolicyRuleLogical:
+		for _, child := range e.Expressions {
+			if !walkPolicyRuleExpression(child, yield) {
+				return false
+			}
+		}
+	case *PolicyRuleNot:
+		return walkPolicyRuleExpression(e.Expression, yield)
+	case *PolicyRuleCondition:
+		if count, ok := e.Operand.(*PolicyRuleCount); ok {
+			return walkPolicyRuleExpression(count.Where, yield)
+		}
+	}
+
+	return true
+}
+
+// policyRuleParser accumulates the problems found while parsing a policy rule.
+type policyRuleParser struct {
+	errs []error
+}
+
+// policyRuleProperty is a property of a policy rule object, with the original key.
+type policyRuleProperty struct {
+	key   string
+	value any
+}
+
+func (p *policyRuleParser) errorf(path, format string, args ...any) {
+	p.errs = append(p.errs, &PolicyRuleError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// object returns the properties of a JSON object keyed by lower case name.
+func (p *policyRuleParser) object(path string, v any) (map[string]policyRuleProperty, bool) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		p.errorf(path, "expected an object, got %s", parameterValueString(v))
+		return nil, false
+	}
+
+	res := make(map[string]policyRuleProperty, len(m))
+	for k, val := range m {
+		res[strings.ToLower(k)] = policyRuleProperty{key: k, value: val}
+	}
+
+	return res, true
+}
+
+func (p *policyRuleParser) string(path string, v any) string {
+	s, ok := v.(string)
+	if !ok {
+		p.errorf(path, "expected a string, got %s", parameterValueString(v))
+	}
+
+	return s
+}
+
+func (p *policyRuleParser) parseRule(v any) *PolicyRule {
+	props, ok := p.object("", v)
+	if !ok {
+		return nil
+	}
+
+	res := new(PolicyRule)
+
+	if prop, ok := props["if"]; ok {
+		res.If = p.parseExpression(prop.key, prop.value)
+	} else {
+		p.errorf("", "missing `if`")
+	}
+
+	if prop, ok := props["then"]; ok {
+		res.Then = p.parseThen(prop.key, prop.value)
+	} else {
+		p.errorf("", "missing `then`")
+	}
+
+	p.unexpectedProperties("", props, "if", "then")
+
+	return res
+}
+
+func (p *policyRuleParser) parseExpression(path string, v any) PolicyRuleExpression {
+	props, ok := p.object(path, v)
+	if !ok {
+		return nil
+	}
+
+	for _, op := range []string{PolicyRuleLogicalAllOf, PolicyRuleLogicalAnyOf} {
+		prop, ok := props[strings.ToLower(op)]
+		if !ok {
+			continue
+		}
+
+		p.unexpectedProperties(path, props, strings.ToLower(op))
+
+		return p.parseLogical(path+"."+prop.key, op, prop.value)
+	}
+
+	if prop, ok := props["not"]; ok {
+		p.unexpectedProperties(path, props, "not")
+
+		return &PolicyRuleNot{
+			Expression: p.parseExpression(path+"."+prop.key, prop.value),
+			path:       path,
+		}
+	}
+
+	return p.parseCondition(path, props)
+}
+
+func (p *policyRuleParser) parseLogical(path, op string, v any) PolicyRuleExpression {
+	items, ok := v.([]any)
+	if !ok {
+		p.errorf(path, "expected an array, got %s", parameterValueString(v))
+		return nil
+	}
+
+	if len(items) == 0 {
+		p.errorf(path, "expected at least one expression")
+	}
+
+	res := &PolicyRuleLogical{
+		Operator:    op,
+		Expressions: make([]PolicyRuleExpression, len(items)),
+		path:        path,
+	}
+
+	for i, item := range items {
+		res.Expressions[i] = p.parseExpression(fmt.Sprintf("%s[%d]", path, i), item)
+	}
+
+	return res
+}
+
+func (p *policyRuleParser) parseCondition(path string, props map[string]policyRuleProperty) PolicyRuleExpression {
+	res := &PolicyRuleCondition{path: path}
+
+	var operands, operators []string
+
+	for _, k := range slices.Sorted(maps.Keys(props)) {
+		prop := props[k]
+
+		switch k {
+		case "field":
+			operands = append(operands, prop.key)
+			res.Operand = &PolicyRuleField{Field: p.string(path+"."+prop.key, prop.value), path: path + "." + prop.key}
+		case "value":
+			operands = append(operands, prop.key)
+			res.Operand = &PolicyRuleValue{Value: prop.value, path: path + "." + prop.key}
+		case "count":
+			operands = append(operands, prop.key)
+			res.Operand = p.parseCount(path+"."+prop.key, prop.value)
+		default:
+			op, ok := policyRuleOperators[k]
+			if !ok {
+				p.errorf(path, "unknown property `%s`", prop.key)
+				continue
+			}
+
+			operators = append(operators, prop.key)
+			res.Operator = op
+			res.Argument = prop.value
+		}
+	}
+
+	switch len(operands) {
+	case 0:
+		p.errorf(path, "condition must have one of `field`, `value` or `count`")
+	case 1:
+	default:
+		p.errorf(path, "condition must have only one of `field`, `value` or `count`, got %s", strings.Join(operands, ", "))
+	}
+
+	switch len(operators) {
+	case 0:
+		p.errorf(path, "condition must have an operator")
+	case 1:
+		p.validateArgument(path+"."+operators[0], res.Operator, res.Argument)
+	default:
+		p.errorf(path, "condition must have only one operator, got %s", strings.Join(operators, ", "))
+	}
+
+	return res
+}
+
+func (p *policyRuleParser) validateArgument(path, op string, arg any) {
+	switch op {
+	case "exists":
+		switch a := arg.(type) {
+		case bool:
+		case string:
+			if !strings.EqualFold(a, "true") && !strings.EqualFold(a, "false") && !isArmExpression(a) {
+				p.errorf(path, "expected a boolean, got %s", parameterValueString(arg))
+			}
+		default:
+			p.errorf(path, "expected a boolean, got %s", parameterValueString(arg))
+		}
+	case "in", "notIn":
+		switch a := arg.(type) {
+		case []any:
+		case string:
+			if !isArmExpression(a) {
+				p.errorf(path, "expected an array or template expression, got %s", parameterValueString(arg))
+			}
+		default:
+			p.errorf(path, "expected an array or template expression, got %s", parameterValueString(arg))
+		}
+	}
+}
+
+func (p *policyRuleParser) parseCount(path string, v any) PolicyRuleOperand {
+	props, ok := p.object(path, v)
+	if !ok {
+		return nil
+	}
+
+	res := &PolicyRuleCount{path: path}
+
+	field, hasField := props["field"]
+	value, hasValue := props["value"]
+
+	switch {
+	case hasField && hasValue:
+		p.errorf(path, "count must have only one of `field` or `value`")
+	case hasField:
+		res.Field = p.string(path+"."+field.key, field.value)
+		if _, ok := props["name"]; ok {
+			p.errorf(path, "`name` is only supported in value counts")
+		}
+	case hasValue:
+		res.Value = value.value
+	default:
+		p.errorf(path, "count must have one of `field` or `value`")
+	}
+
+	if prop, ok := props["name"]; ok {
+		res.Name = p.string(path+"."+prop.key, prop.value)
+	}
+
+	if prop, ok := props["where"]; ok {
+		res.Where = p.parseExpression(path+"."+prop.key, prop.value)
+	}
+
+	p.unexpectedProperties(path, props, "field", "value", "name", "where")
+
+	return res
+}
+
+func (p *policyRuleParser) parseThen(path string, v any) *PolicyRuleThen {
+	props, ok := p.object(path, v)
+	if !ok {
+		return nil
+	}
+
+	res := &PolicyRuleThen{path: path}
+
+	if prop, ok := props["effect"]; ok {
+		res.Effect = p.string(path+"."+prop.key, prop.value)
+	} else {
+		p.errorf(path, "missing `effect`")
+	}
+
+	if prop, ok := props["details"]; ok {
+		res.Details = p.parseDetails(path+"."+prop.key, prop.value)
+	}
+
+	p.unexpectedProperties(path, props, "effect", "details")
+
+	return res
+}
+
+func (p *policyRuleParser) parseDetails(path string, v any) *PolicyRuleDetails {
+	res := &PolicyRuleDetails{Raw: v, path: path}
+
+	// The append effect uses an array of field and value pairs.
+	if items, ok := v.([]any); ok {
+		res.Operations = p.parseOperations(path, items)
+		return res
+	}
+
+	props, ok := v.(map[string]any)
+	if !ok {
+		// Some effects, e.g. denyAction, use details that are not parsed.
+		return res
+	}
+
+	details, _ := p.object(path, props)
+
+	if prop, ok := details["type"]; ok {
+		res.Type = p.string(path+"."+prop.key, prop.value)
+	}
+
+	if prop, ok := details["name"]; ok {
+		res.Name = p.string(path+"."+prop.key, prop.value)
+	}
+
+	if prop, ok := details["existencecondition"]; ok {
+		res.ExistenceCondition = p.parseExpression(path+"."+prop.key, prop.value)
+	}
+
+	if prop, ok := details["roledefinitionids"]; ok {
+		items, ok := prop.value.([]any)
+		if !ok {
+			p.errorf(path+"."+prop.key, "expected an array, got %s", parameterValueString(prop.value))
+		}
+
+		for i, item := range items {
+			itemPath := fmt.Sprintf("%s.%s[%d]", path, prop.key, i)
+			res.RoleDefinitionIDs = append(res.RoleDefinitionIDs, p.string(itemPath, item))
+		}
+	}
+
+	if prop, ok := details["operations"]; ok {
+		items, ok := prop.value.([]any)
+		if !ok {
+			p.errorf(path+"."+prop.key, "expected an array, got %s", parameterValueString(prop.value))
+		}
+
+		res.Operations = p.parseOperations(path+"."+prop.key, items)
+	}
+
+	return res
+}
+
+func (p *policyRuleParser) parseOperations(path string, items []any) []*PolicyRuleOperation {
+	res := make([]*PolicyRuleOperation, 0, len(items))
+
+	for i, item := range items {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+
+		props, ok := p.object(itemPath, item)
+		if !ok {
+			continue
+		}
+
+		op := &PolicyRuleOperation{path: itemPath}
+
+		if prop, ok := props["operation"]; ok {
+			op.Operation = p.string(itemPath+"."+prop.key, prop.value)
+		}
+
+		if prop, ok := props["field"]; ok {
+			op.Field = p.string(itemPath+"."+prop.key, prop.value)
+		} else {
+			p.errorf(itemPath, "missing `field`")
+		}
+
+		if prop, ok := props["value"]; ok {
+			op.Value = prop.value
+		}
+
+		if prop, ok := props["condition"]; ok {
+			op.Condition = p.string(itemPath+"."+prop.key, prop.value)
+		}
+
+		res = append(res, op)
+	}
+
+	return res
+}
+
+// unexpectedProperties reports the properties that are not in the allowed lower case names.
+func (p *policyRuleParser) unexpectedProperties(path string, props map[string]policyRuleProperty, allowed ...string) {
+	for _, k := range slices.Sorted(maps.Keys(props)) {
+		if !slices.Contains(allowed, k) {
+			p.errorf(path, "unexpected property `%s`", props[k].key)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package assets
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicyRule = `{
+  "if": {
+    "allOf": [
+      {"field": "type", "in": ["Microsoft.Storage/storageAccounts", "Microsoft.Storage/storageAccounts/blobServices"]},
+      {"not": {"field": "Microsoft.Storage/storageAccounts/minimumTlsVersion", "Equals": "TLS1_2"}},
+      {
+        "count": {
+          "field": "Microsoft.Storage/storageAccounts/networkAcls.ipRules[*]",
+          "where": {"value": "[current('Microsoft.Storage/storageAccounts/networkAcls.ipRules[*].value')]", "equals": "0.0.0.0/0"}
+        },
+        "greater": 0
+      }
+    ]
+  },
+  "Then": {
+    "effect": "[parameters('effect')]",
+    "details": {
+      "type": "Microsoft.Insights/diagnosticSettings",
+      "existenceCondition": {"field": "Microsoft.Insights/diagnosticSettings/logs.enabled", "equals": "true"},
+      "roleDefinitionIds": ["/providers/Microsoft.Authorization/roleDefinitions/00000000-0000-0000-0000-000000000000"]
+    }
+  }
+}`
+
+func TestParsePolicyRule(t *testing.T) {
+	t.Parallel()
+
+	var raw any
+	require.NoError(t, json.Unmarshal([]byte(testPolicyRule), &raw))
+
+	rule, err := ParsePolicyRule(raw)
+	require.NoError(t, err)
+
+	allOf, ok := rule.If.(*PolicyRuleLogical)
+	require.True(t, ok)
+	assert.Equal(t, PolicyRuleLogicalAllOf, allOf.Operator)
+	assert.Equal(t, "if.allOf", allOf.Path())
+	require.Len(t, allOf.Expressions, 3)
+
+	not, ok := allOf.Expressions[1].(*PolicyRuleNot)
+	require.True(t, ok)
+	assert.Equal(t, "if.allOf[1]", not.Path())
+
+	cond, ok := not.Expression.(*PolicyRuleCondition)
+	require.True(t, ok)
+	assert.Equal(t, "equals", cond.Operator)
+	assert.Equal(t, "TLS1_2", cond.Argument)
+	assert.Equal(t, "if.allOf[1].not", cond.Path())
+
+	countCond, ok := allOf.Expressions[2].(*PolicyRuleCondition)
+	require.True(t, ok)
+	count, ok := countCond.Operand.(*PolicyRuleCount)
+	require.True(t, ok)
+	assert.Equal(t, "if.allOf[2].count", count.Path())
+	require.NotNil(t, count.Where)
+	assert.Equal(t, "if.allOf[2].count.where", count.Where.Path())
+
+	assert.Equal(t, "[parameters('effect')]", rule.Then.Effect)
+	require.NotNil(t, rule.Then.Details)
+	assert.Equal(t, "Then.details", rule.Then.Details.Path())
+	assert.Len(t, rule.Then.Details.RoleDefinitionIDs, 1)
+	require.NotNil(t, rule.Then.Details.ExistenceCondition)
+
+	paths := make([]string, 0)
+	for expr := range rule.Expressions() {
+		paths = append(paths, expr.Path())
+	}
+
+	assert.Equal(t, []string{
+		"if.allOf",
+		"if.allOf[0]",
+		"if.allOf[1]",
+		"if.allOf[1].not",
+		"if.allOf[2]",
+		"if.allOf[2].count.where",
+		"Then.details.existenceCondition",
+	}, paths)
+
+	assert.Equal(t, []string{
+		"Microsoft.Insights/diagnosticSettings/logs.enabled",
+		"Microsoft.Storage/storageAccounts/minimumTlsVersion",
+		"Microsoft.Storage/storageAccounts/networkAcls.ipRules[*]",
+		"type",
+	}, rule.Fields())
+	assert.Equal(t, []string{
+		"Microsoft.Insights/diagnosticSettings/logs.enabled",
+		"Microsoft.Storage/storageAccounts/minimumTlsVersion",
+		"Microsoft.Storage/storageAccounts/networkAcls.ipRules[*]",
+	}, rule.Aliases())
+	assert.Equal(t, []string{
+		"Microsoft.Insights/diagnosticSettings",
+		"Microsoft.Storage/storageAccounts",
+		"Microsoft.Storage/storageAccounts/blobServices",
+	}, rule.ResourceTypes())
+}
+
+func TestParsePolicyRuleModifyAndAppend(t *testing.T) {
+	t.Parallel()
+
+	rule, err := ParsePolicyRule(map[string]any{
+		"if": map[string]any{"field": "location", "exists": "true"},
+		"then": map[string]any{
+			"effect": "modify",
+			"details": map[string]any{
+				"operations": []any{
+					map[string]any{"operation": "addOrReplace", "field": "tags['env']", "value": "prod"},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, rule.Then.Details.Operations, 1)
+	assert.Equal(t, "addOrReplace", rule.Then.Details.Operations[0].Operation)
+	assert.Equal(t, "then.details.operations[0]", rule.Then.Details.Operations[0].Path())
+	assert.Equal(t, []string{"location", "tags['env']"}, rule.Fields())
+	assert.Empty(t, rule.Aliases())
+
+	rule, err = ParsePolicyRule(map[string]any{
+		"if": map[string]any{"field": "type", "equals": "Microsoft.Sql/servers"},
+		"then": map[string]any{
+			"effect":  "append",
+			"details": []any{map[string]any{"field": "Microsoft.Sql/servers/minimalTlsVersion", "value": "1.2"}},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, rule.Then.Details.Operations, 1)
+	assert.Equal(t, "then.details[0]", rule.Then.Details.Operations[0].Path())
+	assert.Equal(t, []string{"Microsoft.Sql/servers/minimalTlsVersion"}, rule.Aliases())
+}
+
+func TestParsePolicyRuleErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParsePolicyRule(map[string]any{
+		"if": map[string]any{
+			"anyOf": []any{
+				map[string]any{"field": "type", "equals": "a", "notEquals": "b"},
+				map[string]any{"equals": "a"},
+				map[string]any{"field": "type", "startsWith": "a"},
+				map[string]any{"field": "type", "in": "a"},
+				map[string]any{"count": map[string]any{"where": map[string]any{}}, "greater": 0},
+			},
+		},
+		"then": map[string]any{},
+	})
+	require.Error(t, err)
+
+	var ruleErr *PolicyRuleError
+
+	require.ErrorAs(t, err, &ruleErr)
+
+	msgs := make([]string, 0)
+
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() { //nolint:errorlint,forcetypeassert
+		if errors.As(e, &ruleErr) {
+			msgs = append(msgs, ruleErr.Error())
+		}
+	}
+
+	for _, want := range []string{
+		"policy rule `if.anyOf[0]`: condition must have only one operator, got equals, notEquals",
+		"policy rule `if.anyOf[1]`: condition must have one of `field`, `value` or `count`",
+		"policy rule `if.anyOf[2]`: unknown property `startsWith`",
+		"policy rule `if.anyOf[2]`: condition must have an operator",
+		"policy rule `if.anyOf[3].in`: expected an array or template expression, got \"a\"",
+		"policy rule `if.anyOf[4].count`: count must have one of `field` or `value`",
+		"policy rule `if.anyOf[4].count.where`: condition must have one of `field`, `value` or `count`",
+		"policy rule `then`: missing `effect`",
+	} {
+		assert.True(t, slices.Contains(msgs, want), "missing error %q in %v", want, msgs)
+	}
+
+	_, err = ParsePolicyRule(map[string]any{"then": map[string]any{"effect": "deny"}})
+	require.EqualError(t, err, "policy rule: missing `if`")
+}
+
+func TestPolicyDefinitionEffects(t *testing.T) {
+	t.Parallel()
+
+	var raw any
+	require.NoError(t, json.Unmarshal([]byte(testPolicyRule), &raw))
+
+	pd := NewPolicyDefinition(armpolicy.Definition{
+		Properties: &armpolicy.DefinitionProperties{
+			PolicyRule: raw,
+			Parameters: map[string]*armpolicy.ParameterDefinitionsValue{
+				"effect": {
+					Type:          to.Ptr(armpolicy.ParameterTypeString),
+					AllowedValues: []any{"DeployIfNotExists", "Disabled"},
+				},
+			},
+		},
+	})
+
+	effects, err := pd.Effects()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DeployIfNotExists", "Disabled"}, effects)
+
+	pd.Properties.PolicyRule = map[string]any{
+		"if":   map[string]any{"field": "type", "equals": "foo"},
+		"then": map[string]any{"effect": "Deny"},
+	}
+	effects, err = pd.Effects()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Deny"}, effects)
+}
+
+func TestPolicyDefinitionEffect(t *testing.T) {
+	t.Parallel()
+
+	var raw any
+	require.NoError(t, json.Unmarshal([]byte(testPolicyRule), &raw))
+
+	pd := NewPolicyDefinition(armpolicy.Definition{
+		Properties: &armpolicy.DefinitionProperties{
+			PolicyRule: raw,
+			Parameters: map[string]*armpolicy.ParameterDefinitionsValue{
+				"effect": {
+					Type:          to.Ptr(armpolicy.ParameterTypeString),
+					AllowedValues: []any{"DeployIfNotExists", "Disabled"},
+					DefaultValue:  "DeployIfNotExists",
+				},
+			},
+		},
+	})
+
+	effect, err := pd.Effect(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "DeployIfNotExists", effect)
+
+	effect, err = pd.Effect(map[string]*armpolicy.ParameterValuesValue{"effect": {Value: "Disabled"}})
+	require.NoError(t, err)
+	assert.Equal(t, "Disabled", effect)
+
+	pd.Properties.Parameters["effect"].DefaultValue = nil
+	_, err = pd.Effect(nil)
+	require.ErrorContains(t, err, "effect parameter `effect` has no value")
+
+	pd.Properties.PolicyRule = map[string]any{
+		"if":   map[string]any{"field": "type", "equals": "foo"},
+		"then": map[string]any{"effect": "Deny"},
+	}
+	effect, err = pd.Effect(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Deny", effect)
+}
@@ -41,6 +41,10 @@ func ValidateRoleDefinition(rd *RoleDefinition) error {
 		return NewErrPropertyMustNotBeNil("name")
 	}
 
+	if rd.Properties == nil {
+		return NewErrPropertyMustNotBeNil("properties")
+	}
+
 	if rd.Properties.RoleName == nil {
 		return NewErrPropertyMustNotBeNil("properties.roleName")
 	}
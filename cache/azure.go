@@ -15,6 +15,7 @@ import (
 // NewCacheFromAzure scans an Azure tenant for all built-in policy definitions and
 // policy set definitions and returns a populated [Cache].
 // The client factory must be configured with appropriate credentials.
+// Use [Cache.SetSource] to record the cloud and tenant in the cache metadata.
 // If logger is nil, no log output is produced.
 func NewCacheFromAzure(ctx context.Context, client *armpolicy.ClientFactory, logger *slog.Logger) (*Cache, error) {
 	if client == nil {
@@ -28,6 +29,7 @@ func NewCacheFromAzure(ctx context.Context, client *armpolicy.ClientFactory, log
 	c := &Cache{
 		policyDefinitions:    make(map[string]*assets.PolicyDefinitionVersions),
 		policySetDefinitions: make(map[string]*assets.PolicySetDefinitionVersions),
+		metadata:             newMetadata(),
 	}
 
 	logger.Info("fetching policy definition versions (bulk)")
@@ -4,11 +4,14 @@
 package cache
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
 	"maps"
+	"sync"
 
 	"github.com/Azure/alzlib/assets"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
@@ -21,16 +24,26 @@ const (
 
 // Cache stores built-in Azure policy definitions and policy set definitions.
 // It is used to pre-populate AlzLib's internal maps to avoid Azure API calls.
+// A cache read from the indexed format decodes definitions on first lookup.
 type Cache struct {
+	mu                   sync.Mutex
 	policyDefinitions    map[string]*assets.PolicyDefinitionVersions
 	policySetDefinitions map[string]*assets.PolicySetDefinitionVersions
 
+	// The metadata read from the cache file, or of the created cache, nil for files without metadata.
+	metadata *Metadata
+
+	// The index and records of a cache in the indexed format, nil if all definitions are decoded.
+	index   *cacheIndex
+	records io.ReaderAt
+
 	policyDefinitionCount    int
 	policySetDefinitionCount int
 }
 
 // cacheFile is the JSON serialization structure for the cache.
 type cacheFile struct {
+	Metadata             *Metadata                     `json:"metadata,omitempty"`
 	PolicyDefinitions    map[string]*cacheVersionsJSON `json:"policyDefinitions"`
 	PolicySetDefinitions map[string]*cacheVersionsJSON `json:"policySetDefinitions"`
 }
@@ -42,11 +55,29 @@ type cacheVersionsJSON struct {
 }
 
 // NewCache deserializes a cache from the given reader.
-// The reader should contain JSON data previously written by [Cache.Save].
+// The reader should contain data previously written by [Cache.Save] or [Cache.SaveIndexed].
+// For the indexed format, the compressed data is read into memory and definitions are decoded
+// on first lookup, use [NewIndexedCache] to read them from disk instead.
 // Definitions are not validated on load because Azure built-in definitions
 // may not comply with documented property constraints.
 func NewCache(r io.Reader) (*Cache, error) {
-	gr, err := gzip.NewReader(r)
+	br := bufio.NewReader(r)
+
+	if magic, _ := br.Peek(len(indexedMagic)); string(magic) == indexedMagic {
+		b, err := io.ReadAll(io.LimitReader(br, cacheBufferMaxSize))
+		if err != nil {
+			return nil, fmt.Errorf("cache.NewCache: reading cache: %w", err)
+		}
+
+		c, err := NewIndexedCache(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return nil, fmt.Errorf("cache.NewCache: %w", err)
+		}
+
+		return c, nil
+	}
+
+	gr, err := gzip.NewReader(br)
 	if err != nil {
 		return nil, fmt.Errorf("cache.NewCache: creating gzip reader: %w", err)
 	}
@@ -59,9 +90,14 @@ func NewCache(r io.Reader) (*Cache, error) {
 		return nil, fmt.Errorf("cache.NewCache: decoding cache: %w", err)
 	}
 
+	if err := checkMetadata(cf.Metadata); err != nil {
+		return nil, fmt.Errorf("cache.NewCache: %w", err)
+	}
+
 	c := &Cache{
 		policyDefinitions:    make(map[string]*assets.PolicyDefinitionVersions, len(cf.PolicyDefinitions)),
 		policySetDefinitions: make(map[string]*assets.PolicySetDefinitionVersions, len(cf.PolicySetDefinitions)),
+		metadata:             cf.Metadata,
 	}
 
 	for name, versions := range cf.PolicyDefinitions {
@@ -156,6 +192,7 @@ func NewCacheFromDefinitions(
 	c := &Cache{
 		policyDefinitions:    make(map[string]*assets.PolicyDefinitionVersions, len(pds)),
 		policySetDefinitions: make(map[string]*assets.PolicySetDefinitionVersions, len(psds)),
+		metadata:             newMetadata(),
 	}
 
 	maps.Copy(c.policyDefinitions, pds)
@@ -169,6 +206,20 @@ func NewCacheFromDefinitions(
 // computeCounts calculates and stores the total version counts for
 // policy definitions and policy set definitions.
 func (c *Cache) computeCounts() {
+	if c.index != nil {
+		c.policyDefinitionCount = 0
+		for _, entry := range c.index.PolicyDefinitions {
+			c.policyDefinitionCount += len(entry.records())
+		}
+
+		c.policySetDefinitionCount = 0
+		for _, entry := range c.index.PolicySetDefinitions {
+			c.policySetDefinitionCount += len(entry.records())
+		}
+
+		return
+	}
+
 	c.policyDefinitionCount = 0
 	for _, pdvs := range c.policyDefinitions {
 		for range pdvs.AllVersions() {
@@ -184,9 +235,23 @@ func (c *Cache) computeCounts() {
 	}
 }
 
-// Save serializes the cache to the given writer as JSON.
+// Save serializes the cache to the given writer as gzip compressed JSON.
+// Use [Cache.SaveIndexed] to write a cache that can be read lazily.
 func (c *Cache) Save(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.loadAll(); err != nil {
+		return fmt.Errorf("cache.Save: %w", err)
+	}
+
+	md, err := c.metadataForSave()
+	if err != nil {
+		return fmt.Errorf("cache.Save: %w", err)
+	}
+
 	cf := cacheFile{
+		Metadata:             md,
 		PolicyDefinitions:    make(map[string]*cacheVersionsJSON, len(c.policyDefinitions)),
 		PolicySetDefinitions: make(map[string]*cacheVersionsJSON, len(c.policySetDefinitions)),
 	}
@@ -253,16 +318,32 @@ func (c *Cache) Save(w io.Writer) error {
 		return fmt.Errorf("cache.Save: closing gzip writer: %w", err)
 	}
 
+	c.metadata = md
+
 	return nil
 }
 
 // PolicyDefinitions returns a shallow copy of the cached policy definition version collections map.
+// For a cache in the indexed format, all definitions are decoded and those that cannot be decoded
+// are left out, call [Cache.Verify] first to detect them.
 func (c *Cache) PolicyDefinitions() map[string]*assets.PolicyDefinitionVersions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loadAll() //nolint:errcheck // documented, Verify reports the errors
+
 	return maps.Clone(c.policyDefinitions)
 }
 
 // PolicySetDefinitions returns a shallow copy of the cached policy set definition version collections map.
+// For a cache in the indexed format, all definitions are decoded and those that cannot be decoded
+// are left out, call [Cache.Verify] first to detect them.
 func (c *Cache) PolicySetDefinitions() map[string]*assets.PolicySetDefinitionVersions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loadAll() //nolint:errcheck // documented, Verify reports the errors
+
 	return maps.Clone(c.policySetDefinitions)
 }
 
@@ -280,18 +361,26 @@ func (c *Cache) PolicySetDefinitionCount() int {
 
 // PolicyDefinitionNames returns the number of unique policy definition names in the cache.
 func (c *Cache) PolicyDefinitionNames() int {
+	if c.index != nil {
+		return len(c.index.PolicyDefinitions)
+	}
+
 	return len(c.policyDefinitions)
 }
 
 // PolicySetDefinitionNames returns the number of unique policy set definition names in the cache.
 func (c *Cache) PolicySetDefinitionNames() int {
+	if c.index != nil {
+		return len(c.index.PolicySetDefinitions)
+	}
+
 	return len(c.policySetDefinitions)
 }
 
 // PolicyDefinitionVersionsForName returns all semver versions for a given policy definition name.
 func (c *Cache) PolicyDefinitionVersionsForName(name string) []semver.Version {
-	pdvs, ok := c.policyDefinitions[name]
-	if !ok {
+	pdvs := c.PolicyDefinitionVersionsByName(name)
+	if pdvs == nil {
 		return nil
 	}
 
@@ -300,8 +389,8 @@ func (c *Cache) PolicyDefinitionVersionsForName(name string) []semver.Version {
 
 // PolicySetDefinitionVersionsForName returns all semver versions for a given policy set definition name.
 func (c *Cache) PolicySetDefinitionVersionsForName(name string) []semver.Version {
-	psdvs, ok := c.policySetDefinitions[name]
-	if !ok {
+	psdvs := c.PolicySetDefinitionVersionsByName(name)
+	if psdvs == nil {
 		return nil
 	}
 
@@ -309,13 +398,48 @@ func (c *Cache) PolicySetDefinitionVersionsForName(name string) []semver.Version
 }
 
 // PolicyDefinitionVersionsByName returns the policy definition versions for the given name,
-// or nil if not found.
+// or nil if not found or, for a cache in the indexed format, if they cannot be decoded.
+// Use [Cache.LookupPolicyDefinitionVersions] to distinguish the two.
 func (c *Cache) PolicyDefinitionVersionsByName(name string) *assets.PolicyDefinitionVersions {
-	return c.policyDefinitions[name]
+	pdvs, _ := c.LookupPolicyDefinitionVersions(name)
+
+	return pdvs
 }
 
 // PolicySetDefinitionVersionsByName returns the policy set definition versions for the given name,
-// or nil if not found.
+// or nil if not found or, for a cache in the indexed format, if they cannot be decoded.
+// Use [Cache.LookupPolicySetDefinitionVersions] to distinguish the two.
 func (c *Cache) PolicySetDefinitionVersionsByName(name string) *assets.PolicySetDefinitionVersions {
-	return c.policySetDefinitions[name]
+	psdvs, _ := c.LookupPolicySetDefinitionVersions(name)
+
+	return psdvs
+}
+
+// LookupPolicyDefinitionVersions returns the policy definition versions for the given name, or nil if not found.
+// For a cache in the indexed format, an error is returned if they cannot be decoded.
+func (c *Cache) LookupPolicyDefinitionVersions(name string) (*assets.PolicyDefinitionVersions, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pdvs, err := c.policyDefinitionVersions(name)
+	if err != nil {
+		return nil, fmt.Errorf("cache.LookupPolicyDefinitionVersions: %w", err)
+	}
+
+	return pdvs, nil
+}
+
+// LookupPolicySetDefinitionVersions returns the policy set definition versions for the given name,
+// or nil if not found.
+// For a cache in the indexed format, an error is returned if they cannot be decoded.
+func (c *Cache) LookupPolicySetDefinitionVersions(name string) (*assets.PolicySetDefinitionVersions, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	psdvs, err := c.policySetDefinitionVersions(name)
+	if err != nil {
+		return nil, fmt.Errorf("cache.LookupPolicySetDefinitionVersions: %w", err)
+	}
+
+	return psdvs, nil
 }
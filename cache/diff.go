@@ -0,0 +1,389 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+// versionlessDiffKey is used in place of a version for versionless definitions.
+const versionlessDiffKey = "versionless"
+
+// DiffKind is the kind of a difference between two caches.
+type DiffKind string
+
+const (
+	// DiffKindAdded means the definition is only in the new cache.
+	DiffKindAdded DiffKind = "added"
+	// DiffKindRemoved means the definition is only in the old cache.
+	DiffKindRemoved DiffKind = "removed"
+	// DiffKindChanged means the definition is in both caches, with differences.
+	DiffKindChanged DiffKind = "changed"
+)
+
+// CacheDiff is the difference between two caches, see Diff.
+// Each slice is sorted by name and only contains definitions with differences.
+type CacheDiff struct { //nolint:revive
+	PolicyDefinitions    []DefinitionDiff `json:"policy_definitions,omitempty"`
+	PolicySetDefinitions []DefinitionDiff `json:"policy_set_definitions,omitempty"`
+}
+
+// SetDiff is the difference between two sets of strings.
+type SetDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// ValueChange is a change to a single property value.
+// Before or After is nil if the property is unset.
+type ValueChange struct {
+	Property string `json:"property"`
+	Before   any    `json:"before,omitempty"`
+	After    any    `json:"after,omitempty"`
+}
+
+// DefinitionDiff is the difference in a policy definition or policy set definition.
+// Versions contains the added and removed versions, ChangedVersions the changes to versions in both caches.
+// Versionless definitions use a version of `versionless`.
+type DefinitionDiff struct {
+	Name            string        `json:"name"`
+	Kind            DiffKind      `json:"kind"`
+	Versions        SetDiff       `json:"versions,omitzero"`
+	ChangedVersions []VersionDiff `json:"changed_versions,omitempty"`
+}
+
+// VersionDiff is the difference in the content of a definition version.
+//
+// For policy definitions, Changes covers the `effects`, see assets.PolicyDefinition.Effects,
+// the `roleDefinitionIds` and the `policyRule`, which is compared by digest. If the policy rule cannot be parsed,
+// the value of `effects` and `roleDefinitionIds` is the parse error, prefixed with `error: `.
+// For policy set definitions, Changes covers each `policyDefinitions.<referenceId>`, the referenced
+// definition name and version.
+// For both, Changes covers the type, default value and allowed values of each `parameters.<name>`.
+// Changes to other properties, such as descriptions, are not reported.
+type VersionDiff struct {
+	Version string        `json:"version"`
+	Changes []ValueChange `json:"changes"`
+}
+
+// IsEmpty reports whether the set diff has no additions or removals.
+func (s SetDiff) IsEmpty() bool {
+	return len(s.Added) == 0 && len(s.Removed) == 0
+}
+
+// IsEmpty reports whether the caches have no differences.
+func (d *CacheDiff) IsEmpty() bool {
+	return len(d.PolicyDefinitions) == 0 && len(d.PolicySetDefinitions) == 0
+}
+
+// Diff returns the difference between two caches, from the perspective of upgrading from `from` to `to`,
+// e.g. to review the built-in definitions that have been added or changed in Azure.
+// For caches in the indexed format, the definitions are decoded as needed.
+func Diff(from, to *Cache) (*CacheDiff, error) {
+	if from == nil || to == nil {
+		return nil, errors.New("cache.Diff: cache is nil")
+	}
+
+	fromPds, fromPsds := from.definitionNames()
+	toPds, toPsds := to.definitionNames()
+
+	var err error
+
+	res := new(CacheDiff)
+
+	res.PolicyDefinitions, err = diffDefinitions(
+		fromPds, toPds,
+		from.lockedPolicyDefinitionVersions, to.lockedPolicyDefinitionVersions,
+		policyDefinitionDiffProperties,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cache.Diff: policy definitions: %w", err)
+	}
+
+	res.PolicySetDefinitions, err = diffDefinitions(
+		fromPsds, toPsds,
+		from.lockedPolicySetDefinitionVersions, to.lockedPolicySetDefinitionVersions,
+		policySetDefinitionDiffProperties,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cache.Diff: policy set definitions: %w", err)
+	}
+
+	return res, nil
+}
+
+// definitionNames returns the policy definition and policy set definition names, without decoding
+// definitions in the indexed format.
+func (c *Cache) definitionNames() ([]string, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.index != nil {
+		return slices.Collect(maps.Keys(c.index.PolicyDefinitions)),
+			slices.Collect(maps.Keys(c.index.PolicySetDefinitions))
+	}
+
+	return slices.Collect(maps.Keys(c.policyDefinitions)), slices.Collect(maps.Keys(c.policySetDefinitions))
+}
+
+// lockedPolicyDefinitionVersions returns the policy definition versions for the name, holding the lock.
+func (c *Cache) lockedPolicyDefinitionVersions(name string) (*assets.PolicyDefinitionVersions, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.policyDefinitionVersions(name)
+}
+
+// lockedPolicySetDefinitionVersions returns the policy set definition versions for the name, holding the lock.
+func (c *Cache) lockedPolicySetDefinitionVersions(name string) (*assets.PolicySetDefinitionVersions, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.policySetDefinitionVersions(name)
+}
+
+// diffDefinitions compares the definitions by name and version, using properties to compare the content
+// of versions that are in both caches.
+func diffDefinitions[T assets.Versioned](
+	before, after []string,
+	lookupBefore, lookupAfter func(name string) (*assets.VersionedPolicyCollection[T], error),
+	properties func(def T) (map[string]any, error),
+) ([]DefinitionDiff, error) {
+	inBefore := make(map[string]struct{}, len(before))
+	for _, name := range before {
+		inBefore[name] = struct{}{}
+	}
+
+	inAfter := make(map[string]struct{}, len(after))
+	for _, name := range after {
+		inAfter[name] = struct{}{}
+	}
+
+	res := make([]DefinitionDiff, 0)
+
+	for _, name := range sortedUnionKeys(inBefore, inAfter) {
+		if _, ok := inBefore[name]; !ok {
+			res = append(res, DefinitionDiff{Name: name, Kind: DiffKindAdded})
+			continue
+		}
+
+		if _, ok := inAfter[name]; !ok {
+			res = append(res, DefinitionDiff{Name: name, Kind: DiffKindRemoved})
+			continue
+		}
+
+		b, err := definitionVersionsByKey(name, lookupBefore)
+		if err != nil {
+			return nil, err
+		}
+
+		a, err := definitionVersionsByKey(name, lookupAfter)
+		if err != nil {
+			return nil, err
+		}
+
+		d := DefinitionDiff{Name: name, Kind: DiffKindChanged}
+
+		for _, ver := range sortedUnionKeys(b, a) {
+			bv, inB := b[ver]
+			av, inA := a[ver]
+
+			switch {
+			case !inB:
+				d.Versions.Added = append(d.Versions.Added, ver)
+			case !inA:
+				d.Versions.Removed = append(d.Versions.Removed, ver)
+			default:
+				changes, err := diffDefinitionVersion(bv, av, properties)
+				if err != nil {
+					return nil, fmt.Errorf("`%s` version %s: %w", name, ver, err)
+				}
+
+				if len(changes) > 0 {
+					d.ChangedVersions = append(d.ChangedVersions, VersionDiff{Version: ver, Changes: changes})
+				}
+			}
+		}
+
+		if !d.Versions.IsEmpty() || len(d.ChangedVersions) > 0 {
+			res = append(res, d)
+		}
+	}
+
+	return res, nil
+}
+
+// definitionVersionsByKey returns each version of the named definition, keyed by version.
+func definitionVersionsByKey[T assets.Versioned](
+	name string,
+	lookup func(name string) (*assets.VersionedPolicyCollection[T], error),
+) (map[string]T, error) {
+	c, err := lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("`%s`: %w", name, err)
+	}
+
+	res := make(map[string]T)
+	if c == nil {
+		return res, nil
+	}
+
+	for def := range c.AllVersions() {
+		key := versionlessDiffKey
+		if v := def.GetVersion(); v != nil {
+			key = *v
+		}
+
+		res[key] = def
+	}
+
+	return res, nil
+}
+
+// diffDefinitionVersion returns the changed properties of a definition version, sorted by property.
+func diffDefinitionVersion[T assets.Versioned](
+	before, after T,
+	properties func(def T) (map[string]any, error),
+) ([]ValueChange, error) {
+	if reflect.DeepEqual(before, after) {
+		return nil, nil
+	}
+
+	bp, err := properties(before)
+	if err != nil {
+		return nil, err
+	}
+
+	ap, err := properties(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ValueChange
+
+	for _, prop := range sortedUnionKeys(bp, ap) {
+		if reflect.DeepEqual(bp[prop], ap[prop]) {
+			continue
+		}
+
+		changes = append(changes, ValueChange{Property: prop, Before: bp[prop], After: ap[prop]})
+	}
+
+	return changes, nil
+}
+
+// policyDefinitionDiffProperties returns the compared properties of a policy definition, see VersionDiff.
+// A policy rule that cannot be parsed does not fail the diff: the parse error is reported as the value
+// of `effects` and `roleDefinitionIds`, and changes to the rule are still reported by its digest.
+func policyDefinitionDiffProperties(pd *assets.PolicyDefinition) (map[string]any, error) {
+	if pd.Properties == nil {
+		return nil, errors.New("policy definition has no properties")
+	}
+
+	rule, err := json.Marshal(pd.Properties.PolicyRule)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling policy rule: %w", err)
+	}
+
+	sum := sha256.Sum256(rule)
+
+	res := map[string]any{
+		"policyRule": digestPrefix + hex.EncodeToString(sum[:]),
+	}
+
+	if effects, err := pd.Effects(); err != nil {
+		res["effects"] = diffErrorValue(err)
+	} else {
+		res["effects"] = effects
+	}
+
+	if rdids, err := pd.RoleDefinitionResourceIDs(); err != nil {
+		res["roleDefinitionIds"] = diffErrorValue(err)
+	} else if len(rdids) > 0 {
+		res["roleDefinitionIds"] = slices.Sorted(slices.Values(rdids))
+	}
+
+	addParameterDiffProperties(res, pd.Properties.Parameters)
+
+	return res, nil
+}
+
+// diffErrorValue returns the value reported for a property that could not be determined.
+func diffErrorValue(err error) string {
+	return "error: " + err.Error()
+}
+
+// policySetDefinitionDiffProperties returns the compared properties of a policy set definition,
+// see VersionDiff.
+func policySetDefinitionDiffProperties(psd *assets.PolicySetDefinition) (map[string]any, error) {
+	res := make(map[string]any)
+
+	for _, ref := range psd.PolicyDefinitionReferences() {
+		if ref == nil || ref.PolicyDefinitionReferenceID == nil || ref.PolicyDefinitionID == nil {
+			continue
+		}
+
+		referenced := *ref.PolicyDefinitionID
+		if resID, err := arm.ParseResourceID(referenced); err == nil {
+			referenced = resID.Name
+		}
+
+		if ref.DefinitionVersion != nil {
+			referenced += "@" + *ref.DefinitionVersion
+		}
+
+		res["policyDefinitions."+*ref.PolicyDefinitionReferenceID] = referenced
+	}
+
+	if psd.Properties != nil {
+		addParameterDiffProperties(res, psd.Properties.Parameters)
+	}
+
+	return res, nil
+}
+
+// addParameterDiffProperties adds the type, default value and allowed values of each parameter
+// as a `parameters.<name>` property.
+func addParameterDiffProperties(props map[string]any, params map[string]*armpolicy.ParameterDefinitionsValue) {
+	for name, param := range params {
+		if param == nil {
+			continue
+		}
+
+		p := make(map[string]any)
+
+		if param.Type != nil {
+			p["type"] = string(*param.Type)
+		}
+
+		if param.DefaultValue != nil {
+			p["defaultValue"] = param.DefaultValue
+		}
+
+		if len(param.AllowedValues) > 0 {
+			p["allowedValues"] = param.AllowedValues
+		}
+
+		props["parameters."+name] = p
+	}
+}
+
+// sortedUnionKeys returns the sorted union of the keys of the two maps.
+func sortedUnionKeys[V any](a, b map[string]V) []string {
+	res := slices.AppendSeq(slices.Collect(maps.Keys(a)), maps.Keys(b))
+	slices.Sort(res)
+
+	return slices.Compact(res)
+}
@@ -0,0 +1,181 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDiffPolicyDefinition returns a policy definition with the effect, and role definition ids if supplied.
+func newDiffPolicyDefinition(name string, version *string, effect string, rdids ...string) *assets.PolicyDefinition {
+	then := map[string]any{"effect": effect}
+	if len(rdids) > 0 {
+		then["details"] = map[string]any{"type": "Microsoft.Resources/subscriptions", "roleDefinitionIds": rdids}
+	}
+
+	return assets.NewPolicyDefinition(armpolicy.Definition{
+		Name: to.Ptr(name),
+		Properties: &armpolicy.DefinitionProperties{
+			DisplayName: to.Ptr(name),
+			PolicyRule:  map[string]any{"if": map[string]any{"field": "type", "equals": "x"}, "then": then},
+			Version:     version,
+		},
+	})
+}
+
+// newDiffCache returns a cache with the definitions.
+func newDiffCache(t *testing.T, pds []*assets.PolicyDefinition, psds []*assets.PolicySetDefinition) *Cache {
+	t.Helper()
+
+	pdvs := make(map[string]*assets.PolicyDefinitionVersions)
+	for _, pd := range pds {
+		if pdvs[*pd.Name] == nil {
+			pdvs[*pd.Name] = assets.NewPolicyDefinitionVersions()
+		}
+
+		require.NoError(t, pdvs[*pd.Name].Add(pd, false))
+	}
+
+	psdvs := make(map[string]*assets.PolicySetDefinitionVersions)
+	for _, psd := range psds {
+		if psdvs[*psd.Name] == nil {
+			psdvs[*psd.Name] = assets.NewPolicySetDefinitionVersions()
+		}
+
+		require.NoError(t, psdvs[*psd.Name].Add(psd, false))
+	}
+
+	return NewCacheFromDefinitions(pdvs, psdvs)
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	newPsd := func(version *string) *assets.PolicySetDefinition {
+		return assets.NewPolicySetDefinition(armpolicy.SetDefinition{
+			Name: to.Ptr("psd"),
+			Properties: &armpolicy.SetDefinitionProperties{
+				Version: to.Ptr("1.0.0"),
+				PolicyDefinitions: []*armpolicy.DefinitionReference{{
+					PolicyDefinitionID: to.Ptr(
+						"/providers/Microsoft.Authorization/policyDefinitions/pd",
+					),
+					PolicyDefinitionReferenceID: to.Ptr("ref"),
+					DefinitionVersion:           version,
+				}},
+			},
+		})
+	}
+
+	changed := newDiffPolicyDefinition("pd", to.Ptr("1.0.0"), "Deny", "/providers/Microsoft.Authorization/roleDefinitions/r")
+	changed.Properties.Description = to.Ptr("descriptions are not compared")
+	changed.Properties.Parameters = map[string]*armpolicy.ParameterDefinitionsValue{
+		"p": {Type: to.Ptr(armpolicy.ParameterTypeString), DefaultValue: "x"},
+	}
+
+	from := newDiffCache(t,
+		[]*assets.PolicyDefinition{
+			newDiffPolicyDefinition("pd", to.Ptr("1.0.0"), "Audit"),
+			newDiffPolicyDefinition("removed", nil, "Audit"),
+			newDiffPolicyDefinition("unchanged", nil, "Audit"),
+		},
+		[]*assets.PolicySetDefinition{newPsd(nil)},
+	)
+	toCache := newDiffCache(t,
+		[]*assets.PolicyDefinition{
+			changed,
+			newDiffPolicyDefinition("pd", to.Ptr("1.1.0"), "Audit"),
+			newDiffPolicyDefinition("added", nil, "Audit"),
+			newDiffPolicyDefinition("unchanged", nil, "Audit"),
+		},
+		[]*assets.PolicySetDefinition{newPsd(to.Ptr("1.*.*"))},
+	)
+
+	// The indexed format gives the same result.
+	var buf bytes.Buffer
+	require.NoError(t, toCache.SaveIndexed(&buf))
+
+	indexed, err := NewCache(&buf)
+	require.NoError(t, err)
+
+	for _, c := range []*Cache{toCache, indexed} {
+		d, err := Diff(from, c)
+		require.NoError(t, err)
+
+		require.Len(t, d.PolicyDefinitions, 3)
+		assert.Equal(t, DefinitionDiff{Name: "added", Kind: DiffKindAdded}, d.PolicyDefinitions[0])
+		assert.Equal(t, DefinitionDiff{Name: "removed", Kind: DiffKindRemoved}, d.PolicyDefinitions[2])
+
+		pd := d.PolicyDefinitions[1]
+		assert.Equal(t, "pd", pd.Name)
+		assert.Equal(t, DiffKindChanged, pd.Kind)
+		assert.Equal(t, SetDiff{Added: []string{"1.1.0"}}, pd.Versions)
+		require.Len(t, pd.ChangedVersions, 1)
+		assert.Equal(t, "1.0.0", pd.ChangedVersions[0].Version)
+
+		props := make([]string, 0)
+		for _, change := range pd.ChangedVersions[0].Changes {
+			props = append(props, change.Property)
+		}
+
+		assert.Equal(t, []string{"effects", "parameters.p", "policyRule", "roleDefinitionIds"}, props)
+		assert.Equal(t,
+			ValueChange{Property: "effects", Before: []string{"Audit"}, After: []string{"Deny"}},
+			pd.ChangedVersions[0].Changes[0],
+		)
+		assert.Equal(t,
+			ValueChange{Property: "parameters.p", After: map[string]any{"type": "String", "defaultValue": "x"}},
+			pd.ChangedVersions[0].Changes[1],
+		)
+
+		assert.Equal(t, []DefinitionDiff{{
+			Name: "psd",
+			Kind: DiffKindChanged,
+			ChangedVersions: []VersionDiff{{
+				Version: "1.0.0",
+				Changes: []ValueChange{{Property: "policyDefinitions.ref", Before: "pd", After: "pd@1.*.*"}},
+			}},
+		}}, d.PolicySetDefinitions)
+	}
+
+	d, err := Diff(from, from)
+	require.NoError(t, err)
+	assert.True(t, d.IsEmpty())
+
+	_, err = Diff(from, nil)
+	require.Error(t, err)
+}
+
+func TestDiffUnparsablePolicyRule(t *testing.T) {
+	t.Parallel()
+
+	from := newDiffCache(t, []*assets.PolicyDefinition{
+		newDiffPolicyDefinition("pd", nil, "[parameters('effect')]"),
+		newDiffPolicyDefinition("other", nil, "Audit"),
+	}, nil)
+	toCache := newDiffCache(t, []*assets.PolicyDefinition{
+		newDiffPolicyDefinition("pd", nil, "Deny"),
+		newDiffPolicyDefinition("other", nil, "Deny"),
+	}, nil)
+
+	d, err := Diff(from, toCache)
+	require.NoError(t, err, "a definition with an unparsable effect does not fail the diff")
+	require.Len(t, d.PolicyDefinitions, 2)
+	assert.Equal(t, "other", d.PolicyDefinitions[0].Name)
+
+	pd := d.PolicyDefinitions[1]
+	require.Len(t, pd.ChangedVersions, 1)
+	require.Len(t, pd.ChangedVersions[0].Changes, 2)
+	assert.Equal(t, "effects", pd.ChangedVersions[0].Changes[0].Property)
+	assert.Contains(t, pd.ChangedVersions[0].Changes[0].Before, "error: ")
+	assert.Equal(t, []string{"Deny"}, pd.ChangedVersions[0].Changes[0].After)
+	assert.Equal(t, "policyRule", pd.ChangedVersions[0].Changes[1].Property)
+}
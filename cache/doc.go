@@ -7,7 +7,13 @@
 // The typical workflow is:
 //
 //  1. Create a cache from an Azure tenant using [NewCacheFromAzure].
-//  2. Save the cache to a file using [Cache.Save].
+//  2. Save the cache to a file using [Cache.Save], or [Cache.SaveIndexed] to decode definitions lazily.
 //  3. Load the cache from the file using [NewCache].
 //  4. Inject the cache into AlzLib using AlzLib.AddCache.
+//
+// Use [Cache.Subset] to derive a smaller cache with only the requested definitions, without Azure
+// access, and [Diff] to compare two caches.
+//
+// Saved caches start with a [Metadata] header recording the cloud, creation time and a content digest,
+// which AlzLib.AddCache checks against the expected cloud and a maximum age.
 package cache
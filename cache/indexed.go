@@ -0,0 +1,384 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+// indexedMagic identifies the indexed cache format, see [Cache.SaveIndexed].
+const indexedMagic = "ALZCIDX1"
+
+// indexedHeaderSize is the size of the magic and the big endian uint64 length of the index.
+const indexedHeaderSize = len(indexedMagic) + 8
+
+// cacheIndex is the JSON serialization structure for the index of the indexed cache format.
+// It mirrors cacheFile, with the location of each record instead of the definition.
+type cacheIndex struct {
+	Metadata             *Metadata                   `json:"metadata,omitempty"`
+	PolicyDefinitions    map[string]*cacheIndexEntry `json:"policyDefinitions"`
+	PolicySetDefinitions map[string]*cacheIndexEntry `json:"policySetDefinitions"`
+}
+
+// cacheIndexEntry is the location of the records for a versioned policy collection.
+type cacheIndexEntry struct {
+	Versionless *cacheRecord           `json:"versionless,omitempty"`
+	Versions    map[string]cacheRecord `json:"versions,omitempty"`
+}
+
+// cacheRecord is the location of an independently gzip compressed definition, relative to the
+// start of the records.
+type cacheRecord struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// records returns the records of the entry, the versionless record first, then sorted by version string.
+func (e *cacheIndexEntry) records() []cacheRecord {
+	res := make([]cacheRecord, 0, len(e.Versions)+1)
+	if e.Versionless != nil {
+		res = append(res, *e.Versionless)
+	}
+
+	for _, ver := range slices.Sorted(maps.Keys(e.Versions)) {
+		res = append(res, e.Versions[ver])
+	}
+
+	return res
+}
+
+// NewIndexedCache opens a cache in the indexed format, previously written by [Cache.SaveIndexed].
+// Only the index is read, definitions are read and decoded on first lookup, so r must remain readable
+// for the lifetime of the cache, e.g. an open *os.File.
+// Use [NewCache] to read a cache in either format from an io.Reader.
+func NewIndexedCache(r io.ReaderAt, size int64) (*Cache, error) {
+	header := make([]byte, indexedHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("cache.NewIndexedCache: reading header: %w", err)
+	}
+
+	if string(header[:len(indexedMagic)]) != indexedMagic {
+		return nil, errors.New("cache.NewIndexedCache: not an indexed cache")
+	}
+
+	indexLen := binary.BigEndian.Uint64(header[len(indexedMagic):])
+	if indexLen > uint64(size-int64(indexedHeaderSize)) { //nolint:gosec
+		return nil, fmt.Errorf("cache.NewIndexedCache: index length %d exceeds cache size %d", indexLen, size)
+	}
+
+	recordsOffset := int64(indexedHeaderSize) + int64(indexLen) //nolint:gosec
+	recordsSize := size - recordsOffset
+
+	gr, err := gzip.NewReader(io.NewSectionReader(r, int64(indexedHeaderSize), int64(indexLen))) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("cache.NewIndexedCache: creating gzip reader for index: %w", err)
+	}
+	defer gr.Close() //nolint:errcheck
+
+	idx := new(cacheIndex)
+	if err := json.NewDecoder(io.LimitReader(gr, cacheBufferMaxSize)).Decode(idx); err != nil {
+		return nil, fmt.Errorf("cache.NewIndexedCache: decoding index: %w", err)
+	}
+
+	if err := checkMetadata(idx.Metadata); err != nil {
+		return nil, fmt.Errorf("cache.NewIndexedCache: %w", err)
+	}
+
+	for _, entries := range []map[string]*cacheIndexEntry{idx.PolicyDefinitions, idx.PolicySetDefinitions} {
+		for name, entry := range entries {
+			if entry == nil {
+				delete(entries, name)
+				continue
+			}
+
+			for _, rec := range entry.records() {
+				if rec.Offset < 0 || rec.Length <= 0 || rec.Offset+rec.Length > recordsSize {
+					return nil, fmt.Errorf("cache.NewIndexedCache: record for %s is out of bounds", name)
+				}
+			}
+		}
+	}
+
+	c := &Cache{
+		policyDefinitions:    make(map[string]*assets.PolicyDefinitionVersions),
+		policySetDefinitions: make(map[string]*assets.PolicySetDefinitionVersions),
+		metadata:             idx.Metadata,
+		index:                idx,
+		records:              io.NewSectionReader(r, recordsOffset, recordsSize),
+	}
+
+	c.computeCounts()
+
+	return c, nil
+}
+
+// SaveIndexed serializes the cache to the given writer in the indexed format.
+// Each definition is compressed independently and located by an index of names and versions,
+// so that [NewIndexedCache] and [NewCache] only decode the definitions that are looked up.
+func (c *Cache) SaveIndexed(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.loadAll(); err != nil {
+		return fmt.Errorf("cache.SaveIndexed: %w", err)
+	}
+
+	md, err := c.metadataForSave()
+	if err != nil {
+		return fmt.Errorf("cache.SaveIndexed: %w", err)
+	}
+
+	idx := cacheIndex{
+		Metadata:             md,
+		PolicyDefinitions:    make(map[string]*cacheIndexEntry, len(c.policyDefinitions)),
+		PolicySetDefinitions: make(map[string]*cacheIndexEntry, len(c.policySetDefinitions)),
+	}
+
+	var records bytes.Buffer
+
+	for _, name := range slices.Sorted(maps.Keys(c.policyDefinitions)) {
+		entry := &cacheIndexEntry{}
+
+		for pd := range c.policyDefinitions[name].AllVersions() {
+			if err := writeRecord(&records, entry, pd.Definition, pd.GetVersion()); err != nil {
+				return fmt.Errorf("cache.SaveIndexed: policy definition %s: %w", name, err)
+			}
+		}
+
+		idx.PolicyDefinitions[name] = entry
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.policySetDefinitions)) {
+		entry := &cacheIndexEntry{}
+
+		for psd := range c.policySetDefinitions[name].AllVersions() {
+			if err := writeRecord(&records, entry, psd.SetDefinition, psd.GetVersion()); err != nil {
+				return fmt.Errorf("cache.SaveIndexed: policy set definition %s: %w", name, err)
+			}
+		}
+
+		idx.PolicySetDefinitions[name] = entry
+	}
+
+	var index bytes.Buffer
+	if err := writeGzipJSON(&index, idx); err != nil {
+		return fmt.Errorf("cache.SaveIndexed: index: %w", err)
+	}
+
+	header := make([]byte, indexedHeaderSize)
+	copy(header, indexedMagic)
+	binary.BigEndian.PutUint64(header[len(indexedMagic):], uint64(index.Len())) //nolint:gosec
+
+	for _, b := range [][]byte{header, index.Bytes(), records.Bytes()} {
+		if _, err := w.Write(b); err != nil {
+			return fmt.Errorf("cache.SaveIndexed: writing cache: %w", err)
+		}
+	}
+
+	c.metadata = md
+
+	return nil
+}
+
+// writeRecord appends the compressed definition to records and adds its location to the entry.
+func writeRecord(records *bytes.Buffer, entry *cacheIndexEntry, def any, version *string) error {
+	offset := int64(records.Len())
+
+	if err := writeGzipJSON(records, def); err != nil {
+		return err
+	}
+
+	rec := cacheRecord{Offset: offset, Length: int64(records.Len()) - offset}
+
+	if version == nil {
+		entry.Versionless = &rec
+
+		return nil
+	}
+
+	if entry.Versions == nil {
+		entry.Versions = make(map[string]cacheRecord)
+	}
+
+	entry.Versions[*version] = rec
+
+	return nil
+}
+
+// writeGzipJSON writes v to w as gzip compressed JSON.
+func writeGzipJSON(w io.Writer, v any) error {
+	gw := gzip.NewWriter(w)
+
+	if err := json.NewEncoder(gw).Encode(v); err != nil {
+		return fmt.Errorf("encoding: %w", err)
+	}
+
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("closing gzip writer: %w", err)
+	}
+
+	return nil
+}
+
+// readRecord decodes the compressed JSON record into v.
+// The record is read in full so that the gzip checksum is verified.
+func (c *Cache) readRecord(rec cacheRecord, v any) error {
+	gr, err := gzip.NewReader(io.NewSectionReader(c.records, rec.Offset, rec.Length))
+	if err != nil {
+		return fmt.Errorf("creating gzip reader: %w", err)
+	}
+	defer gr.Close() //nolint:errcheck
+
+	b, err := io.ReadAll(gr)
+	if err != nil {
+		return fmt.Errorf("reading: %w", err)
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("decoding: %w", err)
+	}
+
+	return nil
+}
+
+// loadPolicyDefinitionVersions decodes the policy definition versions for the name from the records.
+func (c *Cache) loadPolicyDefinitionVersions(
+	name string,
+	entry *cacheIndexEntry,
+) (*assets.PolicyDefinitionVersions, error) {
+	pdvs := assets.NewPolicyDefinitionVersions()
+
+	for _, rec := range entry.records() {
+		var def armpolicy.Definition
+		if err := c.readRecord(rec, &def); err != nil {
+			return nil, fmt.Errorf("reading policy definition %s: %w", name, err)
+		}
+
+		if err := pdvs.Add(assets.NewPolicyDefinition(def), false); err != nil {
+			return nil, fmt.Errorf("adding policy definition %s: %w", name, err)
+		}
+	}
+
+	return pdvs, nil
+}
+
+// loadPolicySetDefinitionVersions decodes the policy set definition versions for the name from the records.
+func (c *Cache) loadPolicySetDefinitionVersions(
+	name string,
+	entry *cacheIndexEntry,
+) (*assets.PolicySetDefinitionVersions, error) {
+	psdvs := assets.NewPolicySetDefinitionVersions()
+
+	for _, rec := range entry.records() {
+		var def armpolicy.SetDefinition
+		if err := c.readRecord(rec, &def); err != nil {
+			return nil, fmt.Errorf("reading policy set definition %s: %w", name, err)
+		}
+
+		if err := psdvs.Add(assets.NewPolicySetDefinition(def), false); err != nil {
+			return nil, fmt.Errorf("adding policy set definition %s: %w", name, err)
+		}
+	}
+
+	return psdvs, nil
+}
+
+// policyDefinitionVersions returns the policy definition versions for the name, decoding them from the
+// records on first use. The caller must hold the lock.
+func (c *Cache) policyDefinitionVersions(name string) (*assets.PolicyDefinitionVersions, error) {
+	if pdvs, ok := c.policyDefinitions[name]; ok || c.index == nil {
+		return pdvs, nil
+	}
+
+	entry, ok := c.index.PolicyDefinitions[name]
+	if !ok {
+		return nil, nil
+	}
+
+	pdvs, err := c.loadPolicyDefinitionVersions(name, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	c.policyDefinitions[name] = pdvs
+
+	return pdvs, nil
+}
+
+// policySetDefinitionVersions returns the policy set definition versions for the name, decoding them from
+// the records on first use. The caller must hold the lock.
+func (c *Cache) policySetDefinitionVersions(name string) (*assets.PolicySetDefinitionVersions, error) {
+	if psdvs, ok := c.policySetDefinitions[name]; ok || c.index == nil {
+		return psdvs, nil
+	}
+
+	entry, ok := c.index.PolicySetDefinitions[name]
+	if !ok {
+		return nil, nil
+	}
+
+	psdvs, err := c.loadPolicySetDefinitionVersions(name, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	c.policySetDefinitions[name] = psdvs
+
+	return psdvs, nil
+}
+
+// loadAll decodes all records that have not yet been decoded and returns any errors.
+// Records that cannot be decoded are left out. The caller must hold the lock.
+func (c *Cache) loadAll() error {
+	if c.index == nil {
+		return nil
+	}
+
+	var errs []error
+
+	for _, name := range slices.Sorted(maps.Keys(c.index.PolicyDefinitions)) {
+		if _, err := c.policyDefinitionVersions(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.index.PolicySetDefinitions)) {
+		if _, err := c.policySetDefinitionVersions(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Verify decodes every definition in the cache and returns an error for any that cannot be decoded,
+// or if the definitions do not match the digest in the metadata.
+// A cache in the indexed format decodes definitions on first lookup. Only the Lookup methods report
+// definitions that cannot be decoded, the other accessors treat them as missing, so call Verify to check
+// a cache file up front before using them.
+func (c *Cache) Verify() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.loadAll(); err != nil {
+		return fmt.Errorf("cache.Verify: %w", err)
+	}
+
+	if err := c.verifyDigest(); err != nil {
+		return fmt.Errorf("cache.Verify: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/alzlib/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMixedCache returns a cache with versionless and versioned policy definitions and a policy set definition.
+func newMixedCache(t *testing.T) *Cache {
+	t.Helper()
+
+	versionless := makePolicyDefinitionJSON("pd-versionless", "Versionless PD", "A versionless pd", nil)
+	psd := makePolicySetDefinitionJSON("psd-one", "PSD One", "First set", to.Ptr("1.0.0"))
+
+	data, err := json.Marshal(cacheFile{
+		PolicyDefinitions: map[string]*cacheVersionsJSON{
+			"pd-versionless": {Versionless: &versionless},
+			"pd-versioned": {
+				Versions: map[string]json.RawMessage{
+					"1.0.0": makePolicyDefinitionJSON("pd-versioned", "Versioned PD v1", "Version 1", to.Ptr("1.0.0")),
+					"2.0.0": makePolicyDefinitionJSON("pd-versioned", "Versioned PD v2", "Version 2", to.Ptr("2.0.0")),
+				},
+			},
+		},
+		PolicySetDefinitions: map[string]*cacheVersionsJSON{
+			"psd-one": {Versions: map[string]json.RawMessage{"1.0.0": psd}},
+		},
+	})
+	require.NoError(t, err)
+
+	c, err := NewCache(gzipBytes(t, data))
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestIndexedCacheRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	c := newMixedCache(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.SaveIndexed(&buf))
+
+	c2, err := NewCache(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, c2.PolicyDefinitionNames())
+	assert.Equal(t, 3, c2.PolicyDefinitionCount())
+	assert.Equal(t, 1, c2.PolicySetDefinitionNames())
+	assert.Equal(t, 1, c2.PolicySetDefinitionCount())
+	assert.Empty(t, c2.policyDefinitions, "definitions must not be decoded on load")
+
+	pdvs := c2.PolicyDefinitionVersionsByName("pd-versioned")
+	require.NotNil(t, pdvs)
+
+	pd, err := pdvs.GetVersion(to.Ptr("1.*.*"))
+	require.NoError(t, err)
+	assert.Equal(t, "Versioned PD v1", *pd.Properties.DisplayName)
+	assert.Len(t, c2.policyDefinitions, 1, "only the looked up definition is decoded")
+
+	assert.Nil(t, c2.PolicyDefinitionVersionsByName("notexist"))
+	assert.Len(t, c2.PolicySetDefinitionVersionsForName("psd-one"), 1)
+	require.NoError(t, c2.Verify())
+
+	// An indexed cache can be saved in the original format.
+	var legacy bytes.Buffer
+	require.NoError(t, c2.Save(&legacy))
+
+	c3, err := NewCache(&legacy)
+	require.NoError(t, err)
+	assert.Nil(t, c3.index)
+	assert.Equal(t, c2.PolicyDefinitionCount(), c3.PolicyDefinitionCount())
+	assert.Len(t, c3.PolicyDefinitions(), 2)
+}
+
+func TestNewIndexedCache(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	require.NoError(t, newMixedCache(t).SaveIndexed(&buf))
+
+	data := buf.Bytes()
+
+	c, err := NewIndexedCache(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.Len(t, c.PolicySetDefinitions(), 1)
+
+	_, err = NewIndexedCache(bytes.NewReader([]byte("notacache-notacache")), 19)
+	require.ErrorContains(t, err, "not an indexed cache")
+
+	_, err = NewIndexedCache(bytes.NewReader(data), int64(len(data)-1))
+	require.ErrorContains(t, err, "out of bounds")
+}
+
+func TestIndexedCacheCorruptRecord(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	require.NoError(t, newMixedCache(t).SaveIndexed(&buf))
+
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+
+	c, err := NewIndexedCache(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	assert.Nil(t, c.PolicySetDefinitionVersionsByName("psd-one"))
+
+	_, err = c.LookupPolicySetDefinitionVersions("psd-one")
+	require.ErrorContains(t, err, "policy set definition psd-one")
+
+	psdvs, err := c.LookupPolicySetDefinitionVersions("notexist")
+	require.NoError(t, err)
+	assert.Nil(t, psdvs)
+
+	require.ErrorContains(t, c.Verify(), "policy set definition psd-one")
+	require.ErrorContains(t, c.SaveIndexed(&bytes.Buffer{}), "policy set definition psd-one")
+}
@@ -0,0 +1,229 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+)
+
+const (
+	// FormatVersion is the version of the cache metadata and file formats written by [Cache.Save] and
+	// [Cache.SaveIndexed]. It is incremented on incompatible changes, newer versions are rejected on load.
+	FormatVersion = 1
+
+	// digestPrefix is the prefix of the content digest.
+	digestPrefix = "sha256:"
+	// alzlibModulePath is the module path used to find the alzlib version in the build info.
+	alzlibModulePath = "github.com/Azure/alzlib"
+)
+
+// Metadata describes the origin and content of a cache. It is written as a header by [Cache.Save] and
+// [Cache.SaveIndexed]. Caches written before metadata was introduced have no metadata.
+type Metadata struct {
+	// The version of the cache format, see FormatVersion.
+	FormatVersion int `json:"formatVersion"`
+	// The cloud the definitions were read from, see CloudName.
+	Cloud string `json:"cloud,omitempty"`
+	// The tenant the definitions were read from.
+	TenantID string `json:"tenantId,omitempty"`
+	// The time the definitions were read.
+	CreatedAt time.Time `json:"createdAt"`
+	// The version of alzlib that wrote the cache.
+	AlzlibVersion string `json:"alzlibVersion,omitempty"`
+	// The number of policy definitions, counting each version separately.
+	PolicyDefinitionCount int `json:"policyDefinitionCount"`
+	// The number of policy set definitions, counting each version separately.
+	PolicySetDefinitionCount int `json:"policySetDefinitionCount"`
+	// The digest of the definitions, see Cache.Verify.
+	Digest string `json:"digest"`
+}
+
+// CloudName returns the name of the cloud used in the cache metadata, the Azure Resource Manager endpoint.
+func CloudName(cfg cloud.Configuration) string {
+	return strings.TrimSuffix(strings.ToLower(cfg.Services[cloud.ResourceManager].Endpoint), "/")
+}
+
+// Metadata returns a copy of the cache metadata, or nil if the cache was read from a file without metadata.
+// A cache created from Azure or from definitions has metadata with the creation time and source, the
+// remaining fields are set when the cache is saved.
+func (c *Cache) Metadata() *Metadata {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.metadata == nil {
+		return nil
+	}
+
+	md := *c.metadata
+
+	return &md
+}
+
+// SetSource records the cloud and tenant that the definitions were read from in the cache metadata.
+func (c *Cache) SetSource(cfg cloud.Configuration, tenantID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.metadata == nil {
+		c.metadata = newMetadata()
+	}
+
+	c.metadata.Cloud = CloudName(cfg)
+	c.metadata.TenantID = tenantID
+}
+
+// newMetadata returns metadata for a cache created now.
+func newMetadata() *Metadata {
+	return &Metadata{
+		FormatVersion: FormatVersion,
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// metadataForSave returns the metadata to write, with the counts and digest of the definitions.
+// All definitions must be decoded. The caller must hold the lock.
+func (c *Cache) metadataForSave() (*Metadata, error) {
+	md := newMetadata()
+	if c.metadata != nil {
+		md.Cloud = c.metadata.Cloud
+		md.TenantID = c.metadata.TenantID
+		md.CreatedAt = c.metadata.CreatedAt
+	}
+
+	digest, err := contentDigest(c.policyDefinitions, c.policySetDefinitions)
+	if err != nil {
+		return nil, err
+	}
+
+	md.AlzlibVersion = alzlibVersion()
+	md.PolicyDefinitionCount = c.policyDefinitionCount
+	md.PolicySetDefinitionCount = c.policySetDefinitionCount
+	md.Digest = digest
+
+	return md, nil
+}
+
+// checkMetadata returns an error if the metadata format version is not supported.
+func checkMetadata(md *Metadata) error {
+	if md == nil {
+		return nil
+	}
+
+	if md.FormatVersion < 1 || md.FormatVersion > FormatVersion {
+		return fmt.Errorf("unsupported cache format version %d, supported versions are 1 to %d",
+			md.FormatVersion, FormatVersion)
+	}
+
+	return nil
+}
+
+// verifyDigest returns an error if the digest of the definitions does not match the metadata.
+// All definitions must be decoded. The caller must hold the lock.
+func (c *Cache) verifyDigest() error {
+	if c.metadata == nil || c.metadata.Digest == "" {
+		return nil
+	}
+
+	digest, err := contentDigest(c.policyDefinitions, c.policySetDefinitions)
+	if err != nil {
+		return err
+	}
+
+	if digest != c.metadata.Digest {
+		return fmt.Errorf("content digest %s does not match metadata digest %s", digest, c.metadata.Digest)
+	}
+
+	return nil
+}
+
+// contentDigest returns the digest of the JSON representation of the definitions, in name and version order,
+// independent of the file format.
+func contentDigest(
+	pds map[string]*assets.PolicyDefinitionVersions,
+	psds map[string]*assets.PolicySetDefinitionVersions,
+) (string, error) {
+	h := sha256.New()
+
+	write := func(typ, name string, version *string, def any) error {
+		b, err := json.Marshal(def)
+		if err != nil {
+			return fmt.Errorf("computing digest for %s %s: %w", typ, name, err)
+		}
+
+		ver := ""
+		if version != nil {
+			ver = *version
+		}
+
+		fmt.Fprintf(h, "%s/%s@%s\n%s\n", typ, name, ver, b)
+
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(pds)) {
+		defs := slices.SortedFunc(pds[name].AllVersions(), func(a, b *assets.PolicyDefinition) int {
+			return strings.Compare(versionString(a.GetVersion()), versionString(b.GetVersion()))
+		})
+
+		for _, pd := range defs {
+			if err := write("policyDefinitions", name, pd.GetVersion(), pd.Definition); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(psds)) {
+		defs := slices.SortedFunc(psds[name].AllVersions(), func(a, b *assets.PolicySetDefinition) int {
+			return strings.Compare(versionString(a.GetVersion()), versionString(b.GetVersion()))
+		})
+
+		for _, psd := range defs {
+			if err := write("policySetDefinitions", name, psd.GetVersion(), psd.SetDefinition); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return digestPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// versionString returns the version, or an empty string if nil.
+func versionString(v *string) string {
+	if v == nil {
+		return ""
+	}
+
+	return *v
+}
+
+// alzlibVersion returns the version of the alzlib module from the build info, or an empty string.
+func alzlibVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	if bi.Main.Path == alzlibModulePath {
+		return bi.Main.Version
+	}
+
+	for _, dep := range bi.Deps {
+		if dep.Path == alzlibModulePath {
+			return dep.Version
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheMetadataRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	c := newMixedCache(t)
+	assert.Nil(t, c.Metadata(), "files without metadata have no metadata")
+
+	c.SetSource(cloud.AzureGovernment, "tenant")
+
+	created := c.Metadata().CreatedAt
+	assert.WithinDuration(t, time.Now(), created, time.Minute)
+
+	for name, save := range map[string]func(*Cache, *bytes.Buffer) error{
+		"json":    func(c *Cache, b *bytes.Buffer) error { return c.Save(b) },
+		"indexed": func(c *Cache, b *bytes.Buffer) error { return c.SaveIndexed(b) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			require.NoError(t, save(c, &buf))
+
+			loaded, err := NewCache(&buf)
+			require.NoError(t, err)
+
+			md := loaded.Metadata()
+			require.NotNil(t, md)
+			assert.Equal(t, FormatVersion, md.FormatVersion)
+			assert.Equal(t, "https://management.usgovcloudapi.net", md.Cloud)
+			assert.Equal(t, "tenant", md.TenantID)
+			assert.True(t, created.Equal(md.CreatedAt))
+			assert.Equal(t, 3, md.PolicyDefinitionCount)
+			assert.Equal(t, 1, md.PolicySetDefinitionCount)
+			assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, md.Digest)
+			require.NoError(t, loaded.Verify())
+		})
+	}
+}
+
+func TestCacheMetadataDigestIsFormatIndependent(t *testing.T) {
+	t.Parallel()
+
+	c := newMixedCache(t)
+
+	var jsonBuf, indexedBuf bytes.Buffer
+	require.NoError(t, c.Save(&jsonBuf))
+	require.NoError(t, c.SaveIndexed(&indexedBuf))
+
+	fromJSON, err := NewCache(&jsonBuf)
+	require.NoError(t, err)
+
+	fromIndexed, err := NewCache(&indexedBuf)
+	require.NoError(t, err)
+
+	assert.Equal(t, fromJSON.Metadata().Digest, fromIndexed.Metadata().Digest)
+}
+
+func TestCacheMetadataErrors(t *testing.T) {
+	t.Parallel()
+
+	versionless := makePolicyDefinitionJSON("pd", "PD", "A pd", nil)
+	cf := cacheFile{
+		Metadata:          &Metadata{FormatVersion: FormatVersion, Digest: "sha256:bad"},
+		PolicyDefinitions: map[string]*cacheVersionsJSON{"pd": {Versionless: &versionless}},
+	}
+
+	data, err := json.Marshal(cf)
+	require.NoError(t, err)
+
+	c, err := NewCache(gzipBytes(t, data))
+	require.NoError(t, err)
+	require.ErrorContains(t, c.Verify(), "does not match metadata digest sha256:bad")
+
+	cf.Metadata.FormatVersion = FormatVersion + 1
+	data, err = json.Marshal(cf)
+	require.NoError(t, err)
+
+	_, err = NewCache(gzipBytes(t, data))
+	require.ErrorContains(t, err, "unsupported cache format version 2")
+}
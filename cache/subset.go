@@ -0,0 +1,217 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+// DefinitionRequest is a request for a definition by name and version constraint, see Cache.Subset.
+// A nil Version requests the versionless definition, or the latest version if there is none.
+type DefinitionRequest struct {
+	Name    string
+	Version *string
+}
+
+// String returns the name, followed by `@` and the version constraint if set.
+func (r DefinitionRequest) String() string {
+	if r.Version == nil {
+		return r.Name
+	}
+
+	return r.Name + "@" + *r.Version
+}
+
+// MissingDefinitionsError is returned by Cache.Subset when requested definitions are not in the cache.
+// It lists every missing request, sorted, including the policy definitions referenced by policy set definitions.
+type MissingDefinitionsError struct {
+	PolicyDefinitions    []string
+	PolicySetDefinitions []string
+}
+
+// Error implements the error interface.
+func (e *MissingDefinitionsError) Error() string {
+	parts := make([]string, 0, 2) //nolint:mnd
+	if len(e.PolicyDefinitions) > 0 {
+		parts = append(parts, "policy definitions `"+strings.Join(e.PolicyDefinitions, "`, `")+"`")
+	}
+
+	if len(e.PolicySetDefinitions) > 0 {
+		parts = append(parts, "policy set definitions `"+strings.Join(e.PolicySetDefinitions, "`, `")+"`")
+	}
+
+	return "definitions missing from cache: " + strings.Join(parts, "; ")
+}
+
+// Subset returns a new cache with only the definition versions that satisfy the requests, resolved in the same
+// way as AlzLib resolves definitions from a cache, so that the subset can replace this cache for the same requests.
+// The policy definitions referenced by each policy set definition are included.
+// No Azure API calls are made. If any requested or referenced definition is not in the cache, a
+// *MissingDefinitionsError listing all of them is returned.
+// The metadata source and creation time are retained, the remaining metadata is set when the subset is saved.
+func (c *Cache) Subset(policyDefinitions, policySetDefinitions []DefinitionRequest) (*Cache, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pds := make(map[string]*assets.PolicyDefinitionVersions)
+	psds := make(map[string]*assets.PolicySetDefinitionVersions)
+	missingPds := make(map[string]struct{})
+	missingPsds := make(map[string]struct{})
+
+	for _, req := range policyDefinitions {
+		if err := c.subsetPolicyDefinition(pds, missingPds, req); err != nil {
+			return nil, fmt.Errorf("Cache.Subset: %w", err)
+		}
+	}
+
+	for _, req := range policySetDefinitions {
+		psdvs, err := c.policySetDefinitionVersions(req.Name)
+		if err != nil {
+			return nil, fmt.Errorf("Cache.Subset: policy set definition `%s`: %w", req, err)
+		}
+
+		psd, err := resolveSubsetRequest(psdvs, req)
+		if err != nil {
+			return nil, fmt.Errorf("Cache.Subset: policy set definition `%s`: %w", req, err)
+		}
+
+		if psd == nil {
+			missingPsds[req.String()] = struct{}{}
+			continue
+		}
+
+		if err := addSubsetDefinition(psds, assets.NewPolicySetDefinitionVersions, psd); err != nil {
+			return nil, fmt.Errorf("Cache.Subset: policy set definition `%s`: %w", req, err)
+		}
+
+		for _, ref := range psd.PolicyDefinitionReferences() {
+			if ref == nil || ref.PolicyDefinitionID == nil {
+				continue
+			}
+
+			resID, err := arm.ParseResourceID(*ref.PolicyDefinitionID)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"Cache.Subset: parsing policy definition id `%s` referenced in policy set definition `%s`: %w",
+					*ref.PolicyDefinitionID, req, err,
+				)
+			}
+
+			refReq := DefinitionRequest{Name: resID.Name, Version: ref.DefinitionVersion}
+			if err := c.subsetPolicyDefinition(pds, missingPds, refReq); err != nil {
+				return nil, fmt.Errorf("Cache.Subset: policy set definition `%s`: %w", req, err)
+			}
+		}
+	}
+
+	if len(missingPds) > 0 || len(missingPsds) > 0 {
+		return nil, fmt.Errorf("Cache.Subset: %w", &MissingDefinitionsError{
+			PolicyDefinitions:    sortedKeys(missingPds),
+			PolicySetDefinitions: sortedKeys(missingPsds),
+		})
+	}
+
+	res := NewCacheFromDefinitions(pds, psds)
+	if c.metadata != nil {
+		res.metadata.Cloud = c.metadata.Cloud
+		res.metadata.TenantID = c.metadata.TenantID
+		res.metadata.CreatedAt = c.metadata.CreatedAt
+	}
+
+	return res, nil
+}
+
+// subsetPolicyDefinition adds the policy definition version that satisfies the request to pds,
+// or records the request as missing. The caller must hold the lock.
+func (c *Cache) subsetPolicyDefinition(
+	pds map[string]*assets.PolicyDefinitionVersions,
+	missing map[string]struct{},
+	req DefinitionRequest,
+) error {
+	pdvs, err := c.policyDefinitionVersions(req.Name)
+	if err != nil {
+		return fmt.Errorf("policy definition `%s`: %w", req, err)
+	}
+
+	pd, err := resolveSubsetRequest(pdvs, req)
+	if err != nil {
+		return fmt.Errorf("policy definition `%s`: %w", req, err)
+	}
+
+	if pd == nil {
+		missing[req.String()] = struct{}{}
+		return nil
+	}
+
+	if err := addSubsetDefinition(pds, assets.NewPolicyDefinitionVersions, pd); err != nil {
+		return fmt.Errorf("policy definition `%s`: %w", req, err)
+	}
+
+	return nil
+}
+
+// resolveSubsetRequest returns the version that satisfies the request, or nil if there is none.
+func resolveSubsetRequest[T assets.Versioned](
+	c *assets.VersionedPolicyCollection[T],
+	req DefinitionRequest,
+) (T, error) {
+	var zero T
+
+	if c == nil {
+		return zero, nil
+	}
+
+	def, err := c.GetVersion(req.Version)
+	if errors.Is(err, assets.ErrNoVersionFound) {
+		return zero, nil
+	}
+
+	if err != nil {
+		return zero, err
+	}
+
+	return def, nil
+}
+
+// addSubsetDefinition adds the definition version to the collection of the same name, creating it with
+// newCollection if needed.
+// A definition can be reached more than once, e.g. requested directly and referenced by a policy set definition,
+// a versionless definition that has already been added is skipped as it is the same definition from this cache.
+func addSubsetDefinition[T assets.Versioned](
+	m map[string]*assets.VersionedPolicyCollection[T],
+	newCollection func() *assets.VersionedPolicyCollection[T],
+	def T,
+) error {
+	name := *def.GetName()
+
+	c, ok := m[name]
+	if !ok {
+		c = newCollection()
+		m[name] = c
+	}
+
+	if def.GetVersion() == nil && c.Exists(nil) {
+		return nil
+	}
+
+	return c.Add(def, false)
+}
+
+// sortedKeys returns the sorted keys of the set.
+func sortedKeys(m map[string]struct{}) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+
+	slices.Sort(res)
+
+	return res
+}
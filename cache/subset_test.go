@@ -0,0 +1,89 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheSubset(t *testing.T) {
+	t.Parallel()
+
+	psd := assets.NewPolicySetDefinition(armpolicy.SetDefinition{
+		Name: to.Ptr("psd"),
+		Properties: &armpolicy.SetDefinitionProperties{
+			PolicyDefinitions: []*armpolicy.DefinitionReference{
+				{PolicyDefinitionID: to.Ptr("/providers/Microsoft.Authorization/policyDefinitions/referenced")},
+				{
+					PolicyDefinitionID: to.Ptr("/providers/Microsoft.Authorization/policyDefinitions/pd"),
+					DefinitionVersion:  to.Ptr("1.*.*"),
+				},
+			},
+		},
+	})
+
+	c := newDiffCache(t,
+		[]*assets.PolicyDefinition{
+			newDiffPolicyDefinition("pd", to.Ptr("1.0.0"), "Audit"),
+			newDiffPolicyDefinition("pd", to.Ptr("2.0.0"), "Audit"),
+			newDiffPolicyDefinition("referenced", nil, "Audit"),
+			newDiffPolicyDefinition("unused", nil, "Audit"),
+		},
+		[]*assets.PolicySetDefinition{psd},
+	)
+	c.SetSource(cloud.AzureChina, "tenant")
+
+	sub, err := c.Subset(
+		[]DefinitionRequest{{Name: "pd"}},
+		[]DefinitionRequest{{Name: "psd"}},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, sub.PolicyDefinitionNames())
+	assert.Equal(t, 3, sub.PolicyDefinitionCount())
+	assert.Equal(t, 1, sub.PolicySetDefinitionNames())
+	assert.Equal(t,
+		[]semver.Version{*semver.MustParse("1.0.0"), *semver.MustParse("2.0.0")},
+		sub.PolicyDefinitionVersionsForName("pd"),
+		"the latest version and the version referenced by the policy set definition are included",
+	)
+	assert.Nil(t, sub.PolicyDefinitionVersionsByName("unused"))
+
+	// A versionless definition requested directly and referenced by the policy set definition is included once.
+	sub, err = c.Subset(
+		[]DefinitionRequest{{Name: "referenced"}},
+		[]DefinitionRequest{{Name: "psd"}},
+	)
+	require.NoError(t, err)
+	assert.NotNil(t, sub.PolicyDefinitionVersionsByName("referenced"))
+	assert.Equal(t, 2, sub.PolicyDefinitionCount())
+
+	sub, err = c.Subset([]DefinitionRequest{{Name: "pd"}}, []DefinitionRequest{{Name: "psd"}})
+	require.NoError(t, err)
+	assert.Equal(t, c.Metadata().CreatedAt, sub.Metadata().CreatedAt)
+	assert.Equal(t, c.Metadata().Cloud, sub.Metadata().Cloud)
+
+	_, err = c.Subset(
+		[]DefinitionRequest{{Name: "pd", Version: to.Ptr("3.*.*")}, {Name: "notexist"}},
+		[]DefinitionRequest{{Name: "psd"}, {Name: "psd-notexist"}},
+	)
+
+	var missing *MissingDefinitionsError
+
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, []string{"notexist", "pd@3.*.*"}, missing.PolicyDefinitions)
+	assert.Equal(t, []string{"psd-notexist"}, missing.PolicySetDefinitions)
+	assert.EqualError(t, errors.Unwrap(err),
+		"definitions missing from cache: policy definitions `notexist`, `pd@3.*.*`; "+
+			"policy set definitions `psd-notexist`")
+}
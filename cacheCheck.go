@@ -0,0 +1,98 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/alzlib/cache"
+)
+
+// ErrCacheCheck is returned by [AlzLib.AddCacheWithChecks] when a cache fails a check and [CacheCheck.Reject] is set.
+var ErrCacheCheck = errors.New("cache check failed")
+
+// CacheCheck configures the checks that [AlzLib.AddCache] and [AlzLib.AddCacheWithChecks] perform against
+// the cache metadata, see [cache.Metadata]. The cloud and age of caches that do not provide metadata,
+// e.g. files written before metadata was introduced, cannot be checked, Warn is called instead.
+type CacheCheck struct {
+	// Cloud is the expected cloud of the cache, see cache.CloudName. Empty skips the check.
+	Cloud string
+	// MaxAge is the maximum age of the cache, based on its creation time. Zero skips the check.
+	MaxAge time.Duration
+	// Verify decodes every definition and checks them against the content digest, see cache.Cache.Verify.
+	// This loads the whole cache, so it is best used before a cache in the indexed format is shared.
+	Verify bool
+	// Reject makes AlzLib.AddCacheWithChecks reject a cache that fails a check,
+	// otherwise the cache is added and Warn is called.
+	Reject bool
+	// Warn is called with each failed check when Reject is not set. If nil, failed checks are ignored.
+	Warn func(msg string)
+}
+
+// cacheMetadataProvider is implemented by caches that provide metadata, e.g. *cache.Cache.
+type cacheMetadataProvider interface {
+	Metadata() *cache.Metadata
+}
+
+// cacheVerifier is implemented by caches that can verify their content, e.g. *cache.Cache.
+type cacheVerifier interface {
+	Verify() error
+}
+
+// check returns a message for each failed check of the cache, and the warnings for checks that
+// could not be performed.
+func (cc *CacheCheck) check(c BuiltInCache, now time.Time) ([]string, []string) {
+	if cc == nil || c == nil {
+		return nil, nil
+	}
+
+	res := make([]string, 0, 3) //nolint:mnd
+
+	if v, ok := c.(cacheVerifier); ok && cc.Verify {
+		if err := v.Verify(); err != nil {
+			res = append(res, err.Error())
+		}
+	}
+
+	if cc.Cloud == "" && cc.MaxAge == 0 {
+		return res, nil
+	}
+
+	var md *cache.Metadata
+	if mp, ok := c.(cacheMetadataProvider); ok {
+		md = mp.Metadata()
+	}
+
+	if md == nil {
+		return res, []string{"cache has no metadata, cannot check cloud or age"}
+	}
+
+	if cc.Cloud != "" && !strings.EqualFold(strings.TrimSuffix(cc.Cloud, "/"), md.Cloud) {
+		res = append(res, fmt.Sprintf("cache was created for cloud `%s`, expected `%s`", md.Cloud, cc.Cloud))
+	}
+
+	if cc.MaxAge > 0 && now.Sub(md.CreatedAt) > cc.MaxAge {
+		res = append(res, fmt.Sprintf(
+			"cache was created at %s, older than the maximum age of %s",
+			md.CreatedAt.Format(time.RFC3339),
+			cc.MaxAge,
+		))
+	}
+
+	return res, nil
+}
+
+// warn calls Warn with each message.
+func (cc *CacheCheck) warn(msgs []string) {
+	if cc == nil || cc.Warn == nil {
+		return
+	}
+
+	for _, msg := range msgs {
+		cc.Warn(msg)
+	}
+}
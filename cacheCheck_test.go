@@ -0,0 +1,125 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/cache"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// metadataCache is a BuiltInCache with fixed metadata.
+type metadataCache struct {
+	*cache.Cache
+	md *cache.Metadata
+}
+
+func (c metadataCache) Metadata() *cache.Metadata {
+	return c.md
+}
+
+func TestAddCacheWithChecks(t *testing.T) {
+	t.Parallel()
+
+	empty := cache.NewCacheFromDefinitions(
+		map[string]*assets.PolicyDefinitionVersions{},
+		map[string]*assets.PolicySetDefinitionVersions{},
+	)
+	public := cache.CloudName(cloud.AzurePublic)
+	stale := metadataCache{empty, &cache.Metadata{Cloud: public, CreatedAt: time.Now().Add(-48 * time.Hour)}}
+	fresh := metadataCache{empty, &cache.Metadata{Cloud: public, CreatedAt: time.Now()}}
+	china := metadataCache{empty, &cache.Metadata{Cloud: cache.CloudName(cloud.AzureChina), CreatedAt: time.Now()}}
+	noMetadata := metadataCache{empty, nil}
+
+	az := NewAlzLib(nil)
+	require.NoError(t, az.AddCacheWithChecks(stale), "no checks configured")
+
+	var warnings []string
+
+	az.Options.CacheCheck = &CacheCheck{
+		Cloud:  public,
+		MaxAge: 24 * time.Hour,
+		Warn:   func(msg string) { warnings = append(warnings, msg) },
+	}
+	require.NoError(t, az.AddCacheWithChecks(stale))
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "older than the maximum age of 24h0m0s")
+
+	require.NoError(t, az.AddCacheWithChecks(fresh), "a new cache passes the checks")
+	assert.Len(t, warnings, 1)
+
+	require.NoError(t, az.AddCacheWithChecks(empty))
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[1], "cache was created for cloud ``", "a cache without a recorded cloud fails the check")
+
+	az.Options.CacheCheck.Reject = true
+	err := az.AddCacheWithChecks(china)
+	require.ErrorIs(t, err, ErrCacheCheck)
+	assert.ErrorContains(t, err, "cache was created for cloud `https://management.chinacloudapi.cn`")
+	assert.Same(t, empty, az.cache, "a rejected cache is not added")
+
+	require.NoError(t, az.AddCacheWithChecks(noMetadata), "a cache without metadata is not rejected")
+	require.Len(t, warnings, 3)
+	assert.Equal(t, "cache has no metadata, cannot check cloud or age", warnings[2])
+
+	require.NoError(t, az.AddCacheWithChecks(nil), "a nil cache is not checked")
+	assert.Len(t, warnings, 3)
+}
+
+func TestAddCacheWarns(t *testing.T) {
+	t.Parallel()
+
+	empty := cache.NewCacheFromDefinitions(
+		map[string]*assets.PolicyDefinitionVersions{},
+		map[string]*assets.PolicySetDefinitionVersions{},
+	)
+	china := metadataCache{empty, &cache.Metadata{Cloud: cache.CloudName(cloud.AzureChina), CreatedAt: time.Now()}}
+
+	var warnings []string
+
+	az := NewAlzLib(nil)
+	az.Options.CacheCheck = &CacheCheck{
+		Cloud:  cache.CloudName(cloud.AzurePublic),
+		Reject: true,
+		Warn:   func(msg string) { warnings = append(warnings, msg) },
+	}
+	az.AddCache(china)
+
+	require.Len(t, warnings, 1, "AddCache cannot reject a cache, failed checks are warnings")
+	assert.Contains(t, warnings[0], "cache was created for cloud `https://management.chinacloudapi.cn`")
+	assert.Equal(t, china, az.cache)
+}
+
+// verifyCache is a BuiltInCache that fails verification.
+type verifyCache struct {
+	metadataCache
+}
+
+func (c verifyCache) Verify() error {
+	return errors.New("content digest does not match")
+}
+
+func TestCheckCacheVerify(t *testing.T) {
+	t.Parallel()
+
+	empty := cache.NewCacheFromDefinitions(
+		map[string]*assets.PolicyDefinitionVersions{},
+		map[string]*assets.PolicySetDefinitionVersions{},
+	)
+	corrupt := verifyCache{metadataCache{empty, &cache.Metadata{CreatedAt: time.Now()}}}
+
+	az := NewAlzLib(nil)
+	az.Options.CacheCheck = &CacheCheck{Reject: true}
+	require.NoError(t, az.AddCacheWithChecks(corrupt), "verification is not enabled")
+
+	az.Options.CacheCheck.Verify = true
+	require.NoError(t, az.AddCacheWithChecks(empty))
+	require.ErrorContains(t, az.AddCacheWithChecks(corrupt), "content digest does not match")
+}
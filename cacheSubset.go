@@ -0,0 +1,170 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/cache"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+// BuiltInRequests returns the requests for the built-in policy definitions and policy set definitions that
+// are needed to deploy the architectures, sorted and without duplicates. These are the definitions referenced
+// by the policy assignments of each architecture, and by referenced policy set definitions in the library,
+// that are not provided by the library.
+// Call it after Init and before definitions are fetched, e.g. by deployment.Hierarchy.FromArchitecture, as
+// fetched definitions are treated as provided by the library.
+func (az *AlzLib) BuiltInRequests(architectures ...string) ([]BuiltInRequest, error) {
+	az.mu.RLock()
+	defer az.mu.RUnlock()
+
+	reqs := make(map[string]BuiltInRequest)
+
+	for _, name := range architectures {
+		arch, ok := az.architectures[name]
+		if !ok {
+			return nil, fmt.Errorf("Alzlib.BuiltInRequests: architecture `%s` not found", name)
+		}
+
+		for _, mg := range arch.mgs {
+			for archetype := range mg.archetypes.Iter() {
+				for pa := range archetype.PolicyAssignments.Iter() {
+					if err := az.addBuiltInRequests(reqs, pa); err != nil {
+						return nil, fmt.Errorf(
+							"Alzlib.BuiltInRequests: architecture `%s` management group `%s`: %w", name, mg.id, err,
+						)
+					}
+				}
+			}
+		}
+	}
+
+	res := slices.Collect(maps.Values(reqs))
+	slices.SortFunc(res, func(a, b BuiltInRequest) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	return res, nil
+}
+
+// addBuiltInRequests adds the request for the definition referenced by the policy assignment to reqs,
+// if it is not provided by the library. For a policy set definition provided by the library, requests are
+// added for the referenced policy definitions instead. The caller must hold the lock.
+func (az *AlzLib) addBuiltInRequests(reqs map[string]BuiltInRequest, paName string) error {
+	pa, ok := az.policyAssignments[paName]
+	if !ok {
+		return fmt.Errorf("policy assignment `%s` does not exist in the library", paName)
+	}
+
+	resID, version, err := pa.ReferencedPolicyDefinitionResourceIDAndVersion()
+	if err != nil {
+		return fmt.Errorf("policy assignment `%s`: %w", paName, err)
+	}
+
+	add := func(resID *arm.ResourceID, version *string) {
+		req := BuiltInRequest{ResourceID: resID, Version: version}
+		reqs[strings.ToLower(req.String())] = req
+	}
+
+	switch strings.ToLower(resID.ResourceType.Type) {
+	case PolicyDefinitionsType:
+		if !collectionVersionExists(az.policyDefinitions, resID.Name, version) {
+			add(resID, version)
+		}
+	case PolicySetDefinitionsType:
+		psdvs, ok := az.policySetDefinitions[resID.Name]
+		if !ok {
+			add(resID, version)
+			return nil
+		}
+
+		psd, err := psdvs.GetVersion(version)
+		if errors.Is(err, assets.ErrNoVersionFound) {
+			add(resID, version)
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("policy set definition `%s`: %w", JoinNameAndVersion(resID.Name, version), err)
+		}
+
+		for _, ref := range psd.PolicyDefinitionReferences() {
+			if ref == nil || ref.PolicyDefinitionID == nil {
+				continue
+			}
+
+			refID, err := arm.ParseResourceID(*ref.PolicyDefinitionID)
+			if err != nil {
+				return fmt.Errorf(
+					"policy set definition `%s` referenced definition: %w", JoinNameAndVersion(resID.Name, version), err,
+				)
+			}
+
+			if !collectionVersionExists(az.policyDefinitions, refID.Name, ref.DefinitionVersion) {
+				add(refID, ref.DefinitionVersion)
+			}
+		}
+	default:
+		return fmt.Errorf("policy assignment `%s`: unexpected referenced definition type `%s`",
+			paName, resID.ResourceType.Type)
+	}
+
+	return nil
+}
+
+// collectionVersionExists returns true if the named collection has a version satisfying the constraint.
+func collectionVersionExists[T assets.Versioned](
+	m map[string]*assets.VersionedPolicyCollection[T],
+	name string,
+	version *string,
+) bool {
+	c, ok := m[name]
+	if !ok {
+		return false
+	}
+
+	_, err := c.GetVersion(version)
+
+	return err == nil
+}
+
+// SubsetCache returns a cache with only the built-in definitions from c that are needed to deploy the
+// architectures, see BuiltInRequests and cache.Cache.Subset. No Azure API calls are made.
+// If any needed definition is not in c, the error wraps a *cache.MissingDefinitionsError listing all of them.
+func (az *AlzLib) SubsetCache(c *cache.Cache, architectures ...string) (*cache.Cache, error) {
+	if c == nil {
+		return nil, errors.New("Alzlib.SubsetCache: cache is nil")
+	}
+
+	reqs, err := az.BuiltInRequests(architectures...)
+	if err != nil {
+		return nil, fmt.Errorf("Alzlib.SubsetCache: %w", err)
+	}
+
+	var pds, psds []cache.DefinitionRequest
+
+	for _, req := range reqs {
+		cr := cache.DefinitionRequest{Name: req.ResourceID.Name, Version: req.Version}
+
+		if strings.ToLower(req.ResourceID.ResourceType.Type) == PolicySetDefinitionsType {
+			psds = append(psds, cr)
+			continue
+		}
+
+		pds = append(pds, cr)
+	}
+
+	res, err := c.Subset(pds, psds)
+	if err != nil {
+		return nil, fmt.Errorf("Alzlib.SubsetCache: %w", err)
+	}
+
+	return res, nil
+}
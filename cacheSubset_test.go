@@ -0,0 +1,91 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubsetCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// The assignment and the policy set definition in the library reference built-in policy definitions.
+	lib := NewCustomLibraryReferenceFromFS("simple", modifiedLibraryFS(t, "./testdata/simple", map[string][2]string{
+		"test.alz_policy_assignment.json": {
+			"policyDefinitions/test-policy-definition", "policyDefinitions/builtin-pd",
+		},
+		"test.alz_policy_set_definition.json": {
+			"/providers/Microsoft.Management/managementGroups/PLACEHOLDER/providers/Microsoft.Authorization/" +
+				"policyDefinitions/test-policy-definition",
+			"/providers/Microsoft.Authorization/policyDefinitions/builtin-ref-pd",
+		},
+	}))
+
+	az := NewAlzLib(nil)
+	require.NoError(t, az.Init(ctx, lib))
+
+	reqs, err := az.BuiltInRequests("simple")
+	require.NoError(t, err)
+
+	names := make([]string, len(reqs))
+	for i, req := range reqs {
+		names[i] = req.ResourceID.Name
+	}
+
+	assert.Equal(t, []string{"builtin-pd", "builtin-ref-pd"}, names)
+
+	_, err = az.BuiltInRequests("notexist")
+	require.ErrorContains(t, err, "architecture `notexist` not found")
+
+	pdvs := func(pds ...*assets.PolicyDefinition) *assets.PolicyDefinitionVersions {
+		res := assets.NewPolicyDefinitionVersions()
+		for _, pd := range pds {
+			require.NoError(t, res.Add(pd, false))
+		}
+
+		return res
+	}
+
+	full := cache.NewCacheFromDefinitions(
+		map[string]*assets.PolicyDefinitionVersions{
+			"builtin-pd": pdvs(
+				testPolicyDefinition(t, "builtin-pd", "1.0.0"), testPolicyDefinition(t, "builtin-pd", "2.0.0"),
+			),
+			"builtin-ref-pd": pdvs(testPolicyDefinition(t, "builtin-ref-pd", "1.0.0")),
+			"unused":         pdvs(testPolicyDefinition(t, "unused", "1.0.0")),
+		},
+		map[string]*assets.PolicySetDefinitionVersions{},
+	)
+
+	sub, err := az.SubsetCache(full, "simple")
+	require.NoError(t, err)
+	assert.Equal(t, 2, sub.PolicyDefinitionNames())
+	assert.Equal(t, 2, sub.PolicyDefinitionCount(), "only the latest version of builtin-pd is needed")
+
+	// The subset is complete: it resolves every request without a policy client.
+	verify := NewAlzLib(nil)
+	verify.AddCache(sub)
+	require.NoError(t, verify.Init(ctx, lib))
+	require.NoError(t, verify.GetDefinitionsFromAzure(ctx, reqs))
+
+	incomplete := cache.NewCacheFromDefinitions(
+		map[string]*assets.PolicyDefinitionVersions{"builtin-pd": pdvs(testPolicyDefinition(t, "builtin-pd", "1.0.0"))},
+		map[string]*assets.PolicySetDefinitionVersions{},
+	)
+
+	_, err = az.SubsetCache(incomplete, "simple")
+
+	var missing *cache.MissingDefinitionsError
+
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, []string{"builtin-ref-pd"}, missing.PolicyDefinitions)
+}
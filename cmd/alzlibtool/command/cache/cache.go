@@ -13,7 +13,7 @@ import (
 var CacheBaseCmd = cobra.Command{
 	Use:   "cache",
 	Short: "Manage built-in policy definition caches.",
-	Long:  `Create and inspect caches of built-in Azure policy definitions and policy set definitions.`,
+	Long:  `Create, inspect, compare and subset caches of built-in Azure policy definitions and policy set definitions.`,
 	Run: func(cmd *cobra.Command, _ []string) {
 		cmd.PrintErrf("%s cache command: missing required child command\n", cmd.ErrPrefix())
 		cmd.Usage() // nolint: errcheck
@@ -23,5 +23,7 @@ var CacheBaseCmd = cobra.Command{
 
 func init() {
 	CacheBaseCmd.AddCommand(&createCmd)
+	CacheBaseCmd.AddCommand(&diffCmd)
 	CacheBaseCmd.AddCommand(&infoCmd)
+	CacheBaseCmd.AddCommand(&subsetCmd)
 }
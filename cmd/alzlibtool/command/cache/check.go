@@ -0,0 +1,55 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	alzlib "github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/cache"
+	"github.com/Azure/alzlib/internal/auth"
+	"github.com/spf13/cobra"
+)
+
+// AddCacheCheckFlags adds the flags that configure the checks of the `--from-cache` file to the command,
+// see NewCacheCheck.
+func AddCacheCheckFlags(cmd *cobra.Command) {
+	cmd.Flags().
+		Duration(
+			"cache-max-age",
+			0,
+			"Warn if the `--from-cache` file was created longer ago than this duration, e.g. `720h`. "+
+				"Zero disables the check.")
+
+	cmd.Flags().
+		Bool(
+			"cache-strict",
+			false,
+			"Fail instead of warning if the `--from-cache` file was created for a different cloud, "+
+				"is older than `--cache-max-age` or fails `--cache-verify`.")
+
+	cmd.Flags().
+		Bool(
+			"cache-verify",
+			false,
+			"Decode every definition in the `--from-cache` file and check them against the content digest "+
+				"in the metadata. Warns on failure, or fails with `--cache-strict`.")
+}
+
+// NewCacheCheck returns the checks of the cache file configured by the flags added with AddCacheCheckFlags.
+// The cloud is checked against the ARM_ENVIRONMENT / AZURE_ENVIRONMENT environment variables.
+// Failed checks are printed as warnings, use alzlib.AlzLib.AddCacheWithChecks to fail with `--cache-strict`.
+func NewCacheCheck(cmd *cobra.Command, cacheFile string) *alzlib.CacheCheck {
+	maxAge, _ := cmd.Flags().GetDuration("cache-max-age")
+	strict, _ := cmd.Flags().GetBool("cache-strict")
+	verify, _ := cmd.Flags().GetBool("cache-verify")
+
+	return &alzlib.CacheCheck{
+		Cloud:  cache.CloudName(auth.GetCloudFromEnv()),
+		MaxAge: maxAge,
+		Verify: verify,
+		Reject: strict,
+		Warn: func(msg string) {
+			cmd.PrintErrf("warning: %s: %s\n", cacheFile, msg)
+		},
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	alzlib "github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/cache"
+	"github.com/Azure/alzlib/internal/auth"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCacheCheck(t *testing.T) {
+	t.Parallel()
+
+	cmd := &cobra.Command{}
+	AddCacheCheckFlags(cmd)
+
+	stderr := new(bytes.Buffer)
+	cmd.SetErr(stderr)
+	require.NoError(t, cmd.Flags().Set("cache-max-age", "1ns"))
+
+	c := cache.NewCacheFromDefinitions(
+		map[string]*assets.PolicyDefinitionVersions{},
+		map[string]*assets.PolicySetDefinitionVersions{},
+	)
+	c.SetSource(auth.GetCloudFromEnv(), "")
+
+	az := alzlib.NewAlzLib(nil)
+	az.Options.CacheCheck = NewCacheCheck(cmd, "cache.json.gz")
+	require.NoError(t, az.AddCacheWithChecks(c))
+	assert.Contains(t, stderr.String(), "warning: cache.json.gz: cache was created at ")
+
+	require.NoError(t, cmd.Flags().Set("cache-strict", "true"))
+
+	az.Options.CacheCheck = NewCacheCheck(cmd, "cache.json.gz")
+	require.ErrorIs(t, az.AddCacheWithChecks(c), alzlib.ErrCacheCheck)
+}
+
+func TestCreateCacheCheckFlags(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"cache-max-age", "cache-strict", "cache-verify"} {
+		assert.NotNil(t, createCmd.Flags().Lookup(name), name)
+	}
+}
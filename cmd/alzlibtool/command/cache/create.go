@@ -11,9 +11,6 @@ import (
 	"github.com/Azure/alzlib/cache"
 	"github.com/Azure/alzlib/deployment"
 	"github.com/Azure/alzlib/internal/auth"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
 	"github.com/spf13/cobra"
 )
 
@@ -22,6 +19,10 @@ const (
 	defaultRootMgID = "00000000-0000-0000-0000-000000000000"
 	// defaultLocation is the default Azure location for architecture processing.
 	defaultLocation = "northeurope"
+	// formatJSON is the gzip compressed JSON cache format, see cache.Cache.Save.
+	formatJSON = "json"
+	// formatIndexed is the indexed cache format, see cache.Cache.SaveIndexed.
+	formatIndexed = "indexed"
 )
 
 var createCmd = cobra.Command{
@@ -47,7 +48,14 @@ libraries. This is useful when layering a custom library on top of a base ALZ li
 Use --from-cache to seed from an existing cache file (requires --library and --architecture).
 Definitions already present in the seed cache are used directly and not re-fetched from Azure,
 reducing the number of API calls. The same file may be used for both --from-cache and --output
-to update a cache in-place.`,
+to update a cache in-place. To derive a smaller cache from an existing cache file without
+Azure credentials, use the subset command instead.
+
+Use --record to save the Azure API responses to a directory, and --replay to create the cache
+from a previous recording without Azure credentials.
+
+Use --format indexed to write a cache that is decoded lazily, reducing memory use when only
+some definitions are referenced. Both formats can be read by all commands that accept a cache.`,
 	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, _ []string) {
 		outFile, _ := cmd.Flags().GetString("output")
@@ -56,6 +64,15 @@ to update a cache in-place.`,
 		architectureName, _ := cmd.Flags().GetString("architecture")
 		fromCacheFile, _ := cmd.Flags().GetString("from-cache")
 		libraryOverwriteEnabled, _ := cmd.Flags().GetBool("library-overwrite-enabled")
+		format, _ := cmd.Flags().GetString("format")
+
+		if format != formatJSON && format != formatIndexed {
+			cmd.PrintErrf(
+				"%s unknown format `%s`, must be one of `%s` or `%s`\n",
+				cmd.ErrPrefix(), format, formatJSON, formatIndexed,
+			)
+			os.Exit(1)
+		}
 
 		// --library and --architecture must be specified together.
 		if (len(libraryRefs) == 0) != (architectureName == "") {
@@ -123,6 +140,18 @@ to update a cache in-place.`,
 			logger = slog.New(slog.DiscardHandler)
 		}
 
+		recordDir, _ := cmd.Flags().GetString("record")
+		replayDir, _ := cmd.Flags().GetString("replay")
+
+		cf, err := auth.NewPolicyClientFactory(recordDir, replayDir)
+		if err != nil {
+			cmd.PrintErrf(
+				"%s could not create Azure policy client factory: %v\n",
+				cmd.ErrPrefix(), err,
+			)
+			os.Exit(1)
+		}
+
 		var resultCache *cache.Cache
 
 		if len(libraryRefs) > 0 {
@@ -146,26 +175,11 @@ to update a cache in-place.`,
 			az.Options.AllowOverwrite = libraryOverwriteEnabled
 
 			if seedCache != nil {
-				az.AddCache(seedCache)
-			}
-
-			creds, err := auth.NewToken()
-			if err != nil {
-				cmd.PrintErrf("%s could not get Azure credential: %v\n", cmd.ErrPrefix(), err)
-				os.Exit(1)
-			}
-
-			cf, err := armpolicy.NewClientFactory("", creds, &arm.ClientOptions{
-				ClientOptions: policy.ClientOptions{
-					Cloud: auth.GetCloudFromEnv(),
-				},
-			})
-			if err != nil {
-				cmd.PrintErrf(
-					"%s could not create Azure policy client factory: %v\n",
-					cmd.ErrPrefix(), err,
-				)
-				os.Exit(1)
+				az.Options.CacheCheck = NewCacheCheck(cmd, fromCacheFile)
+				if err := az.AddCacheWithChecks(seedCache); err != nil {
+					cmd.PrintErrf("%s could not add seed cache %s: %v\n", cmd.ErrPrefix(), fromCacheFile, err)
+					os.Exit(1)
+				}
 			}
 
 			az.AddPolicyClient(cf)
@@ -187,25 +201,6 @@ to update a cache in-place.`,
 			resultCache = az.ExportBuiltInCache()
 		} else {
 			// Full-scan mode: fetch all Azure built-in definitions from the tenant.
-			creds, err := auth.NewToken()
-			if err != nil {
-				cmd.PrintErrf("%s could not get Azure credential: %v\n", cmd.ErrPrefix(), err)
-				os.Exit(1)
-			}
-
-			cf, err := armpolicy.NewClientFactory("", creds, &arm.ClientOptions{
-				ClientOptions: policy.ClientOptions{
-					Cloud: auth.GetCloudFromEnv(),
-				},
-			})
-			if err != nil {
-				cmd.PrintErrf(
-					"%s could not create Azure policy client factory: %v\n",
-					cmd.ErrPrefix(), err,
-				)
-				os.Exit(1)
-			}
-
 			cmd.Printf("Scanning Azure tenant for built-in definitions...\n")
 
 			resultCache, err = cache.NewCacheFromAzure(cmd.Context(), cf, logger)
@@ -215,29 +210,46 @@ to update a cache in-place.`,
 			}
 		}
 
-		f, err := os.Create(outFile)
-		if err != nil {
-			cmd.PrintErrf(
-				"%s could not create output file %s: %v\n",
-				cmd.ErrPrefix(), outFile, err,
-			)
-			os.Exit(1)
-		}
-		defer f.Close() //nolint:errcheck
-
-		if err := resultCache.Save(f); err != nil {
-			cmd.PrintErrf("%s could not write cache file: %v\n", cmd.ErrPrefix(), err)
-			os.Exit(1)
-		}
+		resultCache.SetSource(auth.GetCloudFromEnv(), auth.GetTenantIDFromEnv())
 
-		cmd.Printf("Cache written to %s\n", outFile)
-		cmd.Printf("  Policy definitions:     %d names, %d total versions\n",
-			resultCache.PolicyDefinitionNames(), resultCache.PolicyDefinitionCount())
-		cmd.Printf("  Policy set definitions:  %d names, %d total versions\n",
-			resultCache.PolicySetDefinitionNames(), resultCache.PolicySetDefinitionCount())
+		writeCacheFile(cmd, resultCache, outFile, format)
 	},
 }
 
+// writeCacheFile writes the cache to the output file in the format and prints a summary, exiting on error.
+func writeCacheFile(cmd *cobra.Command, c *cache.Cache, outFile, format string) {
+	f, err := os.Create(outFile)
+	if err != nil {
+		cmd.PrintErrf(
+			"%s could not create output file %s: %v\n",
+			cmd.ErrPrefix(), outFile, err,
+		)
+		os.Exit(1)
+	}
+
+	save := c.Save
+	if format == formatIndexed {
+		save = c.SaveIndexed
+	}
+
+	if err := save(f); err != nil {
+		f.Close() //nolint:errcheck,gosec // the write error is reported
+		cmd.PrintErrf("%s could not write cache file: %v\n", cmd.ErrPrefix(), err)
+		os.Exit(1)
+	}
+
+	if err := f.Close(); err != nil {
+		cmd.PrintErrf("%s could not close cache file %s: %v\n", cmd.ErrPrefix(), outFile, err)
+		os.Exit(1)
+	}
+
+	cmd.Printf("Cache written to %s\n", outFile)
+	cmd.Printf("  Policy definitions:     %d names, %d total versions\n",
+		c.PolicyDefinitionNames(), c.PolicyDefinitionCount())
+	cmd.Printf("  Policy set definitions:  %d names, %d total versions\n",
+		c.PolicySetDefinitionNames(), c.PolicySetDefinitionCount())
+}
+
 func init() {
 	createCmd.Flags().
 		StringP("output", "o", "alzlib-cache.json.gz", "Path to the output cache file.")
@@ -268,4 +280,16 @@ func init() {
 				"archetypes and architectures already provided by earlier libraries. Useful when "+
 				"layering a custom library on top of a base ALZ library. Requires --library and "+
 				"--architecture.")
+	createCmd.Flags().
+		String(
+			"format", formatJSON,
+			"The cache file format. `json` is gzip compressed JSON that is decoded in full when loaded, "+
+				"`indexed` is decoded lazily, only the definitions that are looked up.")
+	createCmd.Flags().
+		String("record", "", "Directory to record Azure API responses to, for later use with `--replay`.")
+	createCmd.Flags().
+		String("replay", "", "Directory to replay Azure API responses from, recorded with `--record`. "+
+			"No Azure credential is required and requests without a recording fail.")
+	createCmd.MarkFlagsMutuallyExclusive("record", "replay")
+	AddCacheCheckFlags(&createCmd)
 }
@@ -0,0 +1,145 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Azure/alzlib/cache"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// requiredDiffArgs is the number of required arguments for the cache diff command.
+	requiredDiffArgs = 2
+
+	outputFormatMarkdown = "markdown"
+	outputFormatJSON     = "json"
+)
+
+var diffCmd = cobra.Command{
+	Use:   "diff [flags] old new",
+	Short: "Reports the differences between two cache files.",
+	Long: `Reports the added and removed policy definitions and policy set definitions, the added and removed ` +
+		`versions, and the changed effects, parameters, role definition ids and policy set references of ` +
+		`existing versions when moving from the old to the new cache file, ` +
+		`e.g. to review new built-in definition versions.`,
+	Args: cobra.ExactArgs(requiredDiffArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+		outputFormat, _ := cmd.Flags().GetString("output-format")
+		if outputFormat != outputFormatMarkdown && outputFormat != outputFormatJSON {
+			cmd.PrintErrf("%s unknown output format %s\n", cmd.ErrPrefix(), outputFormat)
+			os.Exit(1)
+		}
+
+		caches := make([]*cache.Cache, 0, requiredDiffArgs)
+
+		for _, file := range args {
+			f, err := os.Open(file)
+			if err != nil {
+				cmd.PrintErrf("%s could not open cache file %s: %v\n", cmd.ErrPrefix(), file, err)
+				os.Exit(1)
+			}
+			defer f.Close() //nolint:errcheck
+
+			c, err := cache.NewCache(f)
+			if err != nil {
+				cmd.PrintErrf("%s could not load cache file %s: %v\n", cmd.ErrPrefix(), file, err)
+				os.Exit(1)
+			}
+
+			caches = append(caches, c)
+		}
+
+		d, err := cache.Diff(caches[0], caches[1])
+		if err != nil {
+			cmd.PrintErrf("%s could not diff caches: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		cmd.SetOut(os.Stdout)
+
+		if outputFormat == outputFormatJSON {
+			b, err := json.MarshalIndent(d, "", "  ")
+			if err != nil {
+				cmd.PrintErrf("%s could not marshal diff: %v\n", cmd.ErrPrefix(), err)
+				os.Exit(1)
+			}
+
+			cmd.Println(string(b))
+
+			return
+		}
+
+		writeMarkdownDiff(cmd.OutOrStdout(), args[0], args[1], d)
+	},
+}
+
+// writeMarkdownDiff writes a markdown representation of the cache diff.
+func writeMarkdownDiff(w io.Writer, from, to string, d *cache.CacheDiff) {
+	fmt.Fprintf(w, "# Cache diff: `%s` to `%s`\n", from, to) //nolint:errcheck
+
+	if d.IsEmpty() {
+		fmt.Fprint(w, "\nNo differences.\n") //nolint:errcheck
+		return
+	}
+
+	for _, s := range []struct {
+		title string
+		diffs []cache.DefinitionDiff
+	}{
+		{"Policy definitions", d.PolicyDefinitions},
+		{"Policy set definitions", d.PolicySetDefinitions},
+	} {
+		if len(s.diffs) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n## %s\n\n", s.title) //nolint:errcheck
+
+		for _, def := range s.diffs {
+			fmt.Fprintf(w, "- `%s` (%s)\n", def.Name, def.Kind) //nolint:errcheck
+
+			if !def.Versions.IsEmpty() {
+				fmt.Fprintf(w, "  - versions: %s\n", formatSetDiff(def.Versions)) //nolint:errcheck
+			}
+
+			for _, v := range def.ChangedVersions {
+				fmt.Fprintf(w, "  - version `%s`\n", v.Version) //nolint:errcheck
+
+				for _, c := range v.Changes {
+					before, _ := json.Marshal(c.Before)
+					after, _ := json.Marshal(c.After)
+					fmt.Fprintf(w, "    - `%s`: `%s` => `%s`\n", c.Property, before, after) //nolint:errcheck
+				}
+			}
+		}
+	}
+}
+
+func formatSetDiff(s cache.SetDiff) string {
+	parts := make([]string, 0, 2) //nolint:mnd
+	if len(s.Added) > 0 {
+		parts = append(parts, "added "+formatCodeList(s.Added))
+	}
+
+	if len(s.Removed) > 0 {
+		parts = append(parts, "removed "+formatCodeList(s.Removed))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func formatCodeList(s []string) string {
+	return "`" + strings.Join(s, "`, `") + "`"
+}
+
+func init() {
+	diffCmd.Flags().
+		String("output-format", outputFormatMarkdown, "The output format, one of `markdown` or `json`.")
+}
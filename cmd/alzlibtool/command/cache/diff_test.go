@@ -0,0 +1,46 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Azure/alzlib/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMarkdownDiff(t *testing.T) {
+	t.Parallel()
+
+	d := &cache.CacheDiff{
+		PolicyDefinitions: []cache.DefinitionDiff{
+			{Name: "added", Kind: cache.DiffKindAdded},
+			{
+				Name:     "pd",
+				Kind:     cache.DiffKindChanged,
+				Versions: cache.SetDiff{Added: []string{"1.1.0"}, Removed: []string{"0.9.0"}},
+				ChangedVersions: []cache.VersionDiff{{
+					Version: "1.0.0",
+					Changes: []cache.ValueChange{{Property: "effects", Before: []string{"Audit"}, After: []string{"Deny"}}},
+				}},
+			},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	writeMarkdownDiff(buf, "old.json.gz", "new.json.gz", d)
+
+	assert.Equal(t, "# Cache diff: `old.json.gz` to `new.json.gz`\n"+
+		"\n## Policy definitions\n\n"+
+		"- `added` (added)\n"+
+		"- `pd` (changed)\n"+
+		"  - versions: added `1.1.0`, removed `0.9.0`\n"+
+		"  - version `1.0.0`\n"+
+		"    - `effects`: `[\"Audit\"]` => `[\"Deny\"]`\n", buf.String())
+
+	buf.Reset()
+	writeMarkdownDiff(buf, "a", "b", &cache.CacheDiff{})
+	assert.Equal(t, "# Cache diff: `a` to `b`\n\nNo differences.\n", buf.String())
+}
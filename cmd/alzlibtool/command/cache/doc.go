@@ -2,5 +2,5 @@
 // Licensed under the MIT License.
 
 // Package cache implements the `alzlibtool cache` CLI commands for creating
-// and inspecting built-in policy definition caches.
+// inspecting, comparing and subsetting built-in policy definition caches.
 package cache
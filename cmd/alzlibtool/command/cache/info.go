@@ -6,6 +6,7 @@ package cache
 import (
 	"os"
 	"strings"
+	"time"
 
 	"github.com/Azure/alzlib/cache"
 	"github.com/spf13/cobra"
@@ -14,8 +15,11 @@ import (
 var infoCmd = cobra.Command{
 	Use:   "info [flags] file",
 	Short: "Display information about a cache file.",
-	Long:  `Reads a cache file and displays summary statistics about the cached definitions.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Reads a cache file and displays its metadata, such as the cloud it was created for and its age,
+and summary statistics about the cached definitions.
+
+Use --verify to decode every definition and check them against the content digest in the metadata.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		f, err := os.Open(args[0])
 		if err != nil {
@@ -31,6 +35,28 @@ var infoCmd = cobra.Command{
 		}
 
 		cmd.Printf("Cache file: %s\n", args[0])
+
+		if md := c.Metadata(); md != nil {
+			cmd.Printf("Format version:          %d\n", md.FormatVersion)
+			cmd.Printf("Cloud:                   %s\n", valueOrUnknown(md.Cloud))
+			cmd.Printf("Tenant:                  %s\n", valueOrUnknown(md.TenantID))
+			cmd.Printf("Created:                 %s (%s ago)\n",
+				md.CreatedAt.Format(time.RFC3339), time.Since(md.CreatedAt).Round(time.Minute))
+			cmd.Printf("alzlib version:          %s\n", valueOrUnknown(md.AlzlibVersion))
+			cmd.Printf("Digest:                  %s\n", md.Digest)
+		} else {
+			cmd.Println("Metadata:                none, the cache was created by an older version")
+		}
+
+		if verify, _ := cmd.Flags().GetBool("verify"); verify {
+			if err := c.Verify(); err != nil {
+				cmd.PrintErrf("%s cache file %s failed verification: %v\n", cmd.ErrPrefix(), args[0], err)
+				os.Exit(1)
+			}
+
+			cmd.Println("Verified:                ok")
+		}
+
 		cmd.Printf("Policy definitions:     %d names, %d total versions\n",
 			c.PolicyDefinitionNames(), c.PolicyDefinitionCount())
 		cmd.Printf("Policy set definitions:  %d names, %d total versions\n",
@@ -77,7 +103,18 @@ var infoCmd = cobra.Command{
 	},
 }
 
+// valueOrUnknown returns the value, or `unknown` if it is empty.
+func valueOrUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+
+	return s
+}
+
 func init() {
 	infoCmd.Flags().
 		BoolP("verbose", "v", false, "Display the name and versions of each cached definition.")
+	infoCmd.Flags().
+		Bool("verify", false, "Decode every definition and check them against the content digest in the metadata.")
 }
@@ -0,0 +1,167 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	alzlib "github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/cache"
+	"github.com/Azure/alzlib/deployment"
+	"github.com/spf13/cobra"
+)
+
+var subsetCmd = cobra.Command{
+	Use:   "subset [flags] file",
+	Short: "Create a smaller cache file from an existing one, without Azure credentials.",
+	Long: `Creates a cache containing only the built-in definitions from an existing cache file that are
+needed to deploy the architectures of the libraries. No Azure credentials are required and no Azure
+API calls are made.
+
+--library and --architecture may each be specified multiple times. A --library value may be either a
+local path (e.g. ./mylib) or an ALZ Library reference in the form <member>@<ref>, e.g.
+platform/alz@2026.01.3; their dependencies are fetched recursively.
+
+If any needed built-in definition is not in the existing cache, the command fails and lists each
+missing definition. The result is verified by processing each architecture again using only the
+new cache. The cloud, tenant and creation time of the existing cache are retained. The same file
+may be used as input and for --output to shrink a cache in-place.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		outFile, _ := cmd.Flags().GetString("output")
+		libraryRefs, _ := cmd.Flags().GetStringArray("library")
+		architectures, _ := cmd.Flags().GetStringArray("architecture")
+		libraryOverwriteEnabled, _ := cmd.Flags().GetBool("library-overwrite-enabled")
+		format, _ := cmd.Flags().GetString("format")
+
+		if format != formatJSON && format != formatIndexed {
+			cmd.PrintErrf(
+				"%s unknown format `%s`, must be one of `%s` or `%s`\n",
+				cmd.ErrPrefix(), format, formatJSON, formatIndexed,
+			)
+			os.Exit(1)
+		}
+
+		if len(libraryRefs) == 0 || len(architectures) == 0 {
+			cmd.PrintErrf("%s --library and --architecture are required\n", cmd.ErrPrefix())
+			os.Exit(1)
+		}
+
+		// Read the source cache BEFORE opening the output file, because they may be the same path.
+		f, err := os.Open(args[0])
+		if err != nil {
+			cmd.PrintErrf("%s could not open cache file %s: %v\n", cmd.ErrPrefix(), args[0], err)
+			os.Exit(1)
+		}
+
+		sourceCache, err := cache.NewCache(f)
+		f.Close() //nolint:errcheck // close immediately; do not defer so the same path can be opened for writing below
+
+		if err != nil {
+			cmd.PrintErrf("%s could not load cache file %s: %v\n", cmd.ErrPrefix(), args[0], err)
+			os.Exit(1)
+		}
+
+		refs := make(alzlib.LibraryReferences, 0, len(libraryRefs))
+		for _, r := range libraryRefs {
+			refs = append(refs, alzlib.NewLibraryReference(r))
+		}
+
+		allLibs, err := refs.FetchWithDependencies(cmd.Context())
+		if err != nil {
+			cmd.PrintErrf("%s could not fetch libraries with dependencies: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		az := alzlib.NewAlzLib(nil)
+		az.Options.AllowOverwrite = libraryOverwriteEnabled
+
+		if err := az.Init(cmd.Context(), allLibs...); err != nil {
+			cmd.PrintErrf("%s could not initialize alzlib: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		resultCache, err := az.SubsetCache(sourceCache, architectures...)
+		if missing := new(cache.MissingDefinitionsError); errors.As(err, &missing) {
+			cmd.PrintErrf("%s built-in definitions missing from cache file %s:\n", cmd.ErrPrefix(), args[0])
+
+			for _, name := range missing.PolicyDefinitions {
+				cmd.PrintErrf("  policy definition: %s\n", name)
+			}
+
+			for _, name := range missing.PolicySetDefinitions {
+				cmd.PrintErrf("  policy set definition: %s\n", name)
+			}
+
+			os.Exit(1)
+		}
+
+		if err != nil {
+			cmd.PrintErrf("%s could not create cache subset: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		if err := verifyCacheSubset(cmd, resultCache, allLibs, architectures, libraryOverwriteEnabled); err != nil {
+			cmd.PrintErrf("%s cache subset verification failed: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		writeCacheFile(cmd, resultCache, outFile, format)
+	},
+}
+
+// verifyCacheSubset processes each architecture using a new AlzLib with only the cache and no policy client,
+// so that any definition missing from the cache is an error.
+func verifyCacheSubset(
+	cmd *cobra.Command,
+	c *cache.Cache,
+	libs alzlib.LibraryReferences,
+	architectures []string,
+	allowOverwrite bool,
+) error {
+	az := alzlib.NewAlzLib(nil)
+	az.Options.AllowOverwrite = allowOverwrite
+
+	az.AddCache(c)
+
+	if err := az.Init(cmd.Context(), libs...); err != nil {
+		return fmt.Errorf("initializing alzlib: %w", err)
+	}
+
+	for _, name := range architectures {
+		h := deployment.NewHierarchy(az)
+		if err := h.FromArchitecture(cmd.Context(), name, defaultRootMgID, defaultLocation); err != nil {
+			return fmt.Errorf("architecture `%s`: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	subsetCmd.Flags().
+		StringP("output", "o", "alzlib-cache.json.gz", "Path to the output cache file.")
+	subsetCmd.Flags().
+		StringArrayP(
+			"library", "L", nil,
+			"Path or reference to a library. May be specified multiple times. Each value is "+
+				"either a local filesystem path (e.g. ./mylib) or an ALZ Library reference of "+
+				"the form <member>@<ref> (e.g. platform/alz@2026.01.3).")
+	subsetCmd.Flags().
+		StringArrayP(
+			"architecture", "a", nil,
+			"Name of an architecture within the libraries to include. May be specified multiple times.")
+	subsetCmd.Flags().
+		Bool(
+			"library-overwrite-enabled", false,
+			"Allow later libraries to overwrite definitions, policy assignments, role definitions, "+
+				"archetypes and architectures already provided by earlier libraries.")
+	subsetCmd.Flags().
+		String(
+			"format", formatJSON,
+			"The cache file format. `json` is gzip compressed JSON that is decoded in full when loaded, "+
+				"`indexed` is decoded lazily, only the definitions that are looked up.")
+}
@@ -10,9 +10,6 @@ import (
 	"github.com/Azure/alzlib/internal/auth"
 	"github.com/Azure/alzlib/internal/tools/checker"
 	"github.com/Azure/alzlib/internal/tools/checks"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
 	"github.com/spf13/cobra"
 )
 
@@ -32,17 +29,10 @@ var libraryCmd = cobra.Command{
 		}
 
 		if !offline {
-			creds, err := auth.NewToken()
-			if err != nil {
-				cmd.PrintErrf("%s could not get Azure credential: %v\n", cmd.ErrPrefix(), err)
-				os.Exit(1)
-			}
+			recordDir, _ := cmd.Flags().GetString("record")
+			replayDir, _ := cmd.Flags().GetString("replay")
 
-			cf, err := armpolicy.NewClientFactory("", creds, &arm.ClientOptions{
-				ClientOptions: policy.ClientOptions{
-					Cloud: auth.GetCloudFromEnv(),
-				},
-			})
+			cf, err := auth.NewPolicyClientFactory(recordDir, replayDir)
 			if err != nil {
 				cmd.PrintErrf("%s could not create Azure policy client factory: %v\n", cmd.ErrPrefix(), err)
 				os.Exit(1)
@@ -79,6 +69,8 @@ var libraryCmd = cobra.Command{
 			checks.CheckAllDefinitionsAreReferenced(az),
 			checks.CheckLibraryMemberPath(az),
 			checks.CheckDefaults(az),
+			checks.CheckPolicyRules(az),
+			checks.CheckParameterDefaults(az),
 			checks.CheckLibraryFileNames(args[0], &checks.CheckLibraryFileNameOptions{
 				Fix: shouldFix,
 			}),
@@ -104,4 +96,10 @@ func init() {
 			"Whether to fix any fixable issues (currently only filename issues).")
 	libraryCmd.Flags().
 		Bool("offline", false, "Whether to run the checks in offline mode (no Azure calls).")
+	libraryCmd.Flags().
+		String("record", "", "Directory to record Azure API responses to, for later use with `--replay`.")
+	libraryCmd.Flags().
+		String("replay", "", "Directory to replay Azure API responses from, recorded with `--record`. "+
+			"No Azure credential is required and requests without a recording fail.")
+	libraryCmd.MarkFlagsMutuallyExclusive("record", "replay", "offline")
 }
@@ -0,0 +1,23 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package diff
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// DiffBaseCmd represents the base diff command.
+var DiffBaseCmd = cobra.Command{
+	Use:   "diff",
+	Short: "Compare libraries.",
+	Long:  `Reports the semantic differences between libraries, e.g. when upgrading to a new library version.`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		cmd.PrintErrf("%s diff command: missing required child command\n", cmd.ErrPrefix())
+		cmd.Usage() // nolint: errcheck
+	},
+}
+
+func init() {
+	DiffBaseCmd.AddCommand(&libraryCmd)
+}
@@ -0,0 +1,5 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package diff implements the `alzlibtool diff` CLI commands, which compare library versions.
+package diff
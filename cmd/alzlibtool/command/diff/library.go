@@ -0,0 +1,203 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Azure/alzlib"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// RequiredLibraryArgs is the number of required arguments for the library diff command.
+	RequiredLibraryArgs = 2
+
+	outputFormatMarkdown = "markdown"
+	outputFormatJSON     = "json"
+)
+
+// libraryCmd represents the library diff command.
+var libraryCmd = cobra.Command{
+	Use:   "library refA refB",
+	Short: "Reports the differences between two library references.",
+	Long: `Reports the added, removed and changed archetypes, architectures, policy assignments, ` +
+		`definitions and default values when moving from refA to refB. ` +
+		`References are either an ALZ library reference in the form <path>@<ref>, e.g. platform/alz@2025.02.0, ` +
+		`a local directory or a go-getter URL. Dependencies are included and no Azure credentials are required.`,
+	Args: cobra.ExactArgs(RequiredLibraryArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+		outputFormat, _ := cmd.Flags().GetString("output-format")
+		if outputFormat != outputFormatMarkdown && outputFormat != outputFormatJSON {
+			cmd.PrintErrf("%s unknown output format %s\n", cmd.ErrPrefix(), outputFormat)
+			os.Exit(1)
+		}
+
+		d, err := alzlib.DiffLibraryReferences(
+			cmd.Context(),
+			alzlib.LibraryReferences{alzlib.NewLibraryReference(args[0])},
+			alzlib.LibraryReferences{alzlib.NewLibraryReference(args[1])},
+		)
+		if err != nil {
+			cmd.PrintErrf("%s could not diff libraries: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		cmd.SetOut(os.Stdout)
+
+		if outputFormat == outputFormatJSON {
+			b, err := json.MarshalIndent(d, "", "  ")
+			if err != nil {
+				cmd.PrintErrf("%s could not marshal diff: %v\n", cmd.ErrPrefix(), err)
+				os.Exit(1)
+			}
+
+			cmd.Println(string(b))
+
+			return
+		}
+
+		writeMarkdownDiff(cmd.OutOrStdout(), args[0], args[1], d)
+	},
+}
+
+// writeMarkdownDiff writes a markdown representation of the library diff.
+func writeMarkdownDiff(w io.Writer, from, to string, d *alzlib.LibraryDiff) {
+	fmt.Fprintf(w, "# Library diff: `%s` to `%s`\n", from, to) //nolint:errcheck
+
+	if d.IsEmpty() {
+		fmt.Fprint(w, "\nNo differences.\n") //nolint:errcheck
+		return
+	}
+
+	section := func(title string, n int) bool {
+		if n == 0 {
+			return false
+		}
+
+		fmt.Fprintf(w, "\n## %s\n\n", title) //nolint:errcheck
+
+		return true
+	}
+
+	if section("Archetypes", len(d.Archetypes)) {
+		for _, a := range d.Archetypes {
+			writeMarkdownItem(w, a.Name, a.Kind)
+			writeMarkdownSetDiff(w, "policy assignments", a.PolicyAssignments)
+			writeMarkdownSetDiff(w, "policy definitions", a.PolicyDefinitions)
+			writeMarkdownSetDiff(w, "policy exemptions", a.PolicyExemptions)
+			writeMarkdownSetDiff(w, "policy set definitions", a.PolicySetDefinitions)
+			writeMarkdownSetDiff(w, "role definitions", a.RoleDefinitions)
+		}
+	}
+
+	if section("Architectures", len(d.Architectures)) {
+		for _, a := range d.Architectures {
+			writeMarkdownItem(w, a.Name, a.Kind)
+
+			for _, mg := range a.ManagementGroups {
+				fmt.Fprintf(w, "  - management group `%s` (%s)\n", mg.ID, mg.Kind) //nolint:errcheck
+				writeMarkdownValueChanges(w, "    ", mg.Changes)
+
+				if !mg.Archetypes.IsEmpty() {
+					fmt.Fprintf(w, "    - archetypes: %s\n", formatSetDiff(mg.Archetypes)) //nolint:errcheck
+				}
+
+				if !mg.Subscriptions.IsEmpty() {
+					fmt.Fprintf(w, "    - subscriptions: %s\n", formatSetDiff(mg.Subscriptions)) //nolint:errcheck
+				}
+			}
+		}
+	}
+
+	if section("Policy assignments", len(d.PolicyAssignments)) {
+		for _, pa := range d.PolicyAssignments {
+			writeMarkdownItem(w, pa.Name, pa.Kind)
+			writeMarkdownValueChanges(w, "  ", pa.Changes)
+		}
+	}
+
+	if section("Policy exemptions", len(d.PolicyExemptions)) {
+		for _, pe := range d.PolicyExemptions {
+			writeMarkdownItem(w, pe.Name, pe.Kind)
+			writeMarkdownValueChanges(w, "  ", pe.Changes)
+		}
+	}
+
+	for _, s := range []struct {
+		title string
+		diffs []alzlib.DefinitionDiff
+	}{
+		{"Policy definitions", d.PolicyDefinitions},
+		{"Policy set definitions", d.PolicySetDefinitions},
+		{"Role definitions", d.RoleDefinitions},
+	} {
+		if !section(s.title, len(s.diffs)) {
+			continue
+		}
+
+		for _, def := range s.diffs {
+			writeMarkdownItem(w, def.Name, def.Kind)
+			writeMarkdownSetDiff(w, "versions", def.Versions)
+
+			if len(def.ChangedVersions) > 0 {
+				fmt.Fprintf(w, "  - changed versions: %s\n", formatCodeList(def.ChangedVersions)) //nolint:errcheck
+			}
+		}
+	}
+
+	if section("Default policy assignment values", len(d.DefaultPolicyAssignmentValues)) {
+		for _, dv := range d.DefaultPolicyAssignmentValues {
+			writeMarkdownItem(w, dv.Name, dv.Kind)
+			writeMarkdownValueChanges(w, "  ", dv.Changes)
+			writeMarkdownSetDiff(w, "parameters", dv.Parameters)
+		}
+	}
+}
+
+func writeMarkdownItem(w io.Writer, name string, kind alzlib.DiffKind) {
+	fmt.Fprintf(w, "- `%s` (%s)\n", name, kind) //nolint:errcheck
+}
+
+func writeMarkdownSetDiff(w io.Writer, title string, s alzlib.SetDiff) {
+	if s.IsEmpty() {
+		return
+	}
+
+	fmt.Fprintf(w, "  - %s: %s\n", title, formatSetDiff(s)) //nolint:errcheck
+}
+
+func writeMarkdownValueChanges(w io.Writer, indent string, changes []alzlib.ValueChange) {
+	for _, c := range changes {
+		before, _ := json.Marshal(c.Before)
+		after, _ := json.Marshal(c.After)
+		fmt.Fprintf(w, "%s- `%s`: `%s` => `%s`\n", indent, c.Property, before, after) //nolint:errcheck
+	}
+}
+
+func formatSetDiff(s alzlib.SetDiff) string {
+	parts := make([]string, 0, 2) //nolint:mnd
+	if len(s.Added) > 0 {
+		parts = append(parts, "added "+formatCodeList(s.Added))
+	}
+
+	if len(s.Removed) > 0 {
+		parts = append(parts, "removed "+formatCodeList(s.Removed))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func formatCodeList(s []string) string {
+	return "`" + strings.Join(s, "`, `") + "`"
+}
+
+func init() {
+	libraryCmd.Flags().
+		String("output-format", outputFormatMarkdown, "The output format, one of `markdown` or `json`.")
+}
@@ -0,0 +1,64 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Azure/alzlib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMarkdownDiff(t *testing.T) {
+	t.Parallel()
+
+	d := &alzlib.LibraryDiff{
+		Archetypes: []alzlib.ArchetypeDiff{{
+			Name:              "corp",
+			Kind:              alzlib.DiffKindChanged,
+			PolicyAssignments: alzlib.SetDiff{Added: []string{"a", "b"}, Removed: []string{"c"}},
+		}},
+		PolicyAssignments: []alzlib.PolicyAssignmentDiff{{
+			Name: "a",
+			Kind: alzlib.DiffKindChanged,
+			Changes: []alzlib.ValueChange{
+				{Property: "enforcement_mode", Before: "Default", After: "DoNotEnforce"},
+			},
+		}},
+		PolicyExemptions: []alzlib.PolicyExemptionDiff{{
+			Name: "pe",
+			Kind: alzlib.DiffKindChanged,
+			Changes: []alzlib.ValueChange{
+				{Property: "exemption_category", Before: "Waiver", After: "Mitigated"},
+			},
+		}},
+		PolicyDefinitions: []alzlib.DefinitionDiff{{
+			Name:     "pd",
+			Kind:     alzlib.DiffKindChanged,
+			Versions: alzlib.SetDiff{Added: []string{"1.1.0"}},
+		}},
+	}
+
+	buf := new(bytes.Buffer)
+	writeMarkdownDiff(buf, "platform/alz@1", "platform/alz@2", d)
+
+	assert.Equal(t, "# Library diff: `platform/alz@1` to `platform/alz@2`\n"+
+		"\n## Archetypes\n\n"+
+		"- `corp` (changed)\n"+
+		"  - policy assignments: added `a`, `b`, removed `c`\n"+
+		"\n## Policy assignments\n\n"+
+		"- `a` (changed)\n"+
+		"  - `enforcement_mode`: `\"Default\"` => `\"DoNotEnforce\"`\n"+
+		"\n## Policy exemptions\n\n"+
+		"- `pe` (changed)\n"+
+		"  - `exemption_category`: `\"Waiver\"` => `\"Mitigated\"`\n"+
+		"\n## Policy definitions\n\n"+
+		"- `pd` (changed)\n"+
+		"  - versions: added `1.1.0`\n", buf.String())
+
+	buf.Reset()
+	writeMarkdownDiff(buf, "a", "b", &alzlib.LibraryDiff{})
+	assert.Equal(t, "# Library diff: `a` to `b`\n\nNo differences.\n", buf.String())
+}
@@ -5,16 +5,18 @@ package generate
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/Azure/alzlib"
 	alzlibcache "github.com/Azure/alzlib/cache"
+	cachecmd "github.com/Azure/alzlib/cmd/alzlibtool/command/cache"
 	"github.com/Azure/alzlib/deployment"
 	"github.com/Azure/alzlib/internal/auth"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
 	"github.com/spf13/cobra"
 )
@@ -24,6 +26,15 @@ const (
 	RequiredArchitectureArgs = 2
 )
 
+const (
+	formatFS           = "fs"
+	formatARM          = "arm"
+	formatTerraform    = "terraform"
+	armParametersNone  = "none"
+	armParametersJSON  = "json"
+	armParametersBicep = "bicepparam"
+)
+
 var generateArchitectureBaseCmd = cobra.Command{
 	Use:   "architecture librarypath name",
 	Short: "Generates deployment JSON for the supplied architecture.",
@@ -61,20 +72,17 @@ var generateArchitectureBaseCmd = cobra.Command{
 				os.Exit(1)
 			}
 
-			az.AddCache(c)
+			az.Options.CacheCheck = cachecmd.NewCacheCheck(cmd, fromCacheFile)
+			if err := az.AddCacheWithChecks(c); err != nil {
+				cmd.PrintErrf("%s could not add cache file %s: %v\n", cmd.ErrPrefix(), fromCacheFile, err)
+				os.Exit(1)
+			}
 		}
 
-		creds, err := auth.NewToken()
-		if err != nil {
-			cmd.PrintErrf("%s could not get Azure credential: %v\n", cmd.ErrPrefix(), err)
-			os.Exit(1)
-		}
+		recordDir, _ := cmd.Flags().GetString("record")
+		replayDir, _ := cmd.Flags().GetString("replay")
 
-		cf, err := armpolicy.NewClientFactory("", creds, &arm.ClientOptions{
-			ClientOptions: policy.ClientOptions{
-				Cloud: auth.GetCloudFromEnv(),
-			},
-		})
+		cf, err := auth.NewPolicyClientFactory(recordDir, replayDir)
 		if err != nil {
 			cmd.PrintErrf("%s could not add client to alzlib: %v\n", cmd.ErrPrefix(), err)
 			os.Exit(1)
@@ -82,6 +90,12 @@ var generateArchitectureBaseCmd = cobra.Command{
 
 		az.AddPolicyClient(cf)
 
+		lf, err := addLockFile(cmd, az)
+		if err != nil {
+			cmd.PrintErrf("%s could not load lock file: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
 		if err := az.Init(cmd.Context(), allLibs...); err != nil {
 			cmd.PrintErrf("%s could not initialize alzlib: %v\n", cmd.ErrPrefix(), err)
 			os.Exit(1)
@@ -95,27 +109,35 @@ var generateArchitectureBaseCmd = cobra.Command{
 			cmd.PrintErrf("%s could not generate architecture: %v\n", cmd.ErrPrefix(), err)
 			os.Exit(1)
 		}
+
+		doNotEnforce, _ := cmd.Flags().GetStringArray("do-not-enforce")
+		for _, value := range doNotEnforce {
+			selectors, err := parseEnforcementModeSelectors(value)
+			if err != nil {
+				cmd.PrintErrf("%s invalid --do-not-enforce value: %v\n", cmd.ErrPrefix(), err)
+				os.Exit(1)
+			}
+
+			if _, err := h.SetEnforcementMode(armpolicy.EnforcementModeDoNotEnforce, selectors...); err != nil {
+				cmd.PrintErrf("%s could not set enforcement mode: %v\n", cmd.ErrPrefix(), err)
+				os.Exit(1)
+			}
+		}
+
+		if err := saveLockFile(cmd, lf); err != nil {
+			cmd.PrintErrf("%s could not save lock file: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
 		// If an output directory is provided, export a filesystem representation and return.
 		outDir, _ := cmd.Flags().GetString("output")
 		if outDir != "" {
-			opts := deployment.FSWriterOptions{}
-			if b, _ := cmd.Flags().GetBool("for-alz-bicep"); b {
-				opts = deployment.FSWriterOptions{
-					ArmEscapePolicyDefinitions:    1,
-					ArmEscapePolicySetDefinitions: 2, //nolint:mnd
-					ArmEscapeRoleDefinitions:      1,
-					ArmEscapePolicyAssignments:    1,
-					PolicySetOptions: deployment.FSWriterPolicySetOptions{
-						CustomPolicyDefinitionReferencesUpdate: true,
-						CustomPolicyDefinitionReferenceRegExp: regexp.MustCompile(
-							fmt.Sprintf(`(?i)^/providers/Microsoft\.Management/managementGroups/%s`, args[1]),
-						),
-						CustomPolicyDefinitionReferenceReplaceValue: "{customPolicyDefinitionScopeId}",
-					},
-				}
+			w, err := newHierarchyWriter(cmd, args[1])
+			if err != nil {
+				cmd.PrintErrf("%s could not create writer: %v\n", cmd.ErrPrefix(), err)
+				os.Exit(1)
 			}
 
-			w := deployment.NewFSWriter(opts)
 			if err := w.Write(cmd.Context(), h, outDir); err != nil {
 				cmd.PrintErrf("%s could not write filesystem output: %v\n", cmd.ErrPrefix(), err)
 				os.Exit(1)
@@ -126,6 +148,20 @@ var generateArchitectureBaseCmd = cobra.Command{
 			return
 		}
 
+		// Generate the policy role assignments so that they are included in the output,
+		// e.g. for use as a snapshot by `alzlibtool plan`.
+		if withRoleAssignments, _ := cmd.Flags().GetBool("policy-role-assignments"); withRoleAssignments {
+			if _, err := h.PolicyRoleAssignments(cmd.Context()); err != nil {
+				var praErrs *deployment.PolicyRoleAssignmentErrors
+				if !errors.As(err, &praErrs) {
+					cmd.PrintErrf("%s could not generate policy role assignments: %v\n", cmd.ErrPrefix(), err)
+					os.Exit(1)
+				}
+
+				cmd.PrintErrf("warning: some policy role assignments could not be generated: %v\n", err)
+			}
+		}
+
 		output := make([]*deployment.HierarchyManagementGroup, len(h.ManagementGroupNames()))
 		for i, mgName := range h.ManagementGroupNames() {
 			output[i] = h.ManagementGroup(mgName)
@@ -142,6 +178,161 @@ var generateArchitectureBaseCmd = cobra.Command{
 	},
 }
 
+// addLockFile reads the lock file from the `lock-file` flag, if set, and adds it to the AlzLib.
+// A missing lock file is created when not verifying.
+func addLockFile(cmd *cobra.Command, az *alzlib.AlzLib) (*alzlib.LockFile, error) {
+	path, _ := cmd.Flags().GetString("lock-file")
+	if path == "" {
+		return nil, nil
+	}
+
+	verify, _ := cmd.Flags().GetBool("lock-file-verify")
+	mode := alzlib.LockFileModeUpdate
+
+	if verify {
+		mode = alzlib.LockFileModeVerify
+	}
+
+	lf := alzlib.NewLockFile()
+
+	f, err := os.Open(path)
+
+	switch {
+	case err == nil:
+		defer f.Close() //nolint:errcheck
+
+		if lf, err = alzlib.ReadLockFile(f); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, os.ErrNotExist) || verify:
+		return nil, err
+	}
+
+	az.AddLockFile(lf, mode)
+
+	return lf, nil
+}
+
+// saveLockFile writes the lock file to the `lock-file` flag path, unless verifying.
+// Entries for requests that were not resolved in this run are removed.
+func saveLockFile(cmd *cobra.Command, lf *alzlib.LockFile) error {
+	verify, _ := cmd.Flags().GetBool("lock-file-verify")
+	if lf == nil || verify {
+		return nil
+	}
+
+	path, _ := cmd.Flags().GetString("lock-file")
+
+	for _, request := range lf.Prune() {
+		cmd.PrintErrf("removing unused lock file entry `%s`\n", request)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := lf.Write(f); err != nil {
+		f.Close() //nolint:errcheck,gosec // the write error is returned
+
+		return err
+	}
+
+	return f.Close()
+}
+
+// parseEnforcementModeSelectors parses a `--do-not-enforce` value into policy assignment selectors.
+// The value is either `all`, or comma separated `level=N`, `archetype=name` or `effect=name` terms,
+// which must all match.
+func parseEnforcementModeSelectors(value string) ([]deployment.PolicyAssignmentSelector, error) {
+	if value == "all" {
+		return nil, nil
+	}
+
+	terms := strings.Split(value, ",")
+	selectors := make([]deployment.PolicyAssignmentSelector, 0, len(terms))
+
+	for _, term := range terms {
+		key, val, ok := strings.Cut(strings.TrimSpace(term), "=")
+		if !ok || val == "" {
+			return nil, fmt.Errorf("term `%s` must be of the form key=value", term)
+		}
+
+		switch key {
+		case "level":
+			level, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("level `%s` is not a number", val)
+			}
+
+			selectors = append(selectors, deployment.SelectByManagementGroupLevel(level))
+		case "archetype":
+			selectors = append(selectors, deployment.SelectByArchetype(val))
+		case "effect":
+			selectors = append(selectors, deployment.SelectByEffect(val))
+		default:
+			return nil, fmt.Errorf("unknown key `%s`, must be one of `level`, `archetype` or `effect`", key)
+		}
+	}
+
+	return selectors, nil
+}
+
+// newHierarchyWriter returns the deployment.HierarchyWriter for the `format` flag.
+func newHierarchyWriter(cmd *cobra.Command, arch string) (deployment.HierarchyWriter, error) {
+	forAlzBicep, _ := cmd.Flags().GetBool("for-alz-bicep")
+	format, _ := cmd.Flags().GetString("format")
+
+	policySetOpts := deployment.FSWriterPolicySetOptions{}
+	if forAlzBicep {
+		policySetOpts = deployment.FSWriterPolicySetOptions{
+			CustomPolicyDefinitionReferencesUpdate: true,
+			CustomPolicyDefinitionReferenceRegExp: regexp.MustCompile(
+				fmt.Sprintf(`(?i)^/providers/Microsoft\.Management/managementGroups/%s`, arch),
+			),
+			CustomPolicyDefinitionReferenceReplaceValue: "{customPolicyDefinitionScopeId}",
+		}
+	}
+
+	switch format {
+	case formatFS:
+		opts := deployment.FSWriterOptions{}
+		if forAlzBicep {
+			opts = deployment.FSWriterOptions{
+				ArmEscapePolicyDefinitions:    1,
+				ArmEscapePolicySetDefinitions: 2, //nolint:mnd
+				ArmEscapeRoleDefinitions:      1,
+				ArmEscapePolicyAssignments:    1,
+				PolicySetOptions:              policySetOpts,
+			}
+		}
+
+		return deployment.NewFSWriter(opts), nil
+	case formatARM:
+		opts := deployment.ARMWriterOptions{
+			PolicySetOptions: policySetOpts,
+		}
+
+		armParams, _ := cmd.Flags().GetString("arm-parameters")
+		switch armParams {
+		case armParametersNone:
+			opts.ParametersFile = deployment.ARMWriterParametersFileNone
+		case armParametersJSON:
+			opts.ParametersFile = deployment.ARMWriterParametersFileJSON
+		case armParametersBicep:
+			opts.ParametersFile = deployment.ARMWriterParametersFileBicep
+		default:
+			return nil, fmt.Errorf("unknown arm-parameters value `%s`", armParams)
+		}
+
+		return deployment.NewARMWriter(opts), nil
+	case formatTerraform:
+		return deployment.NewTerraformWriter(deployment.TerraformWriterOptions{}), nil
+	default:
+		return nil, fmt.Errorf("unknown format `%s`", format)
+	}
+}
+
 func init() {
 	generateArchitectureBaseCmd.Flags().
 		StringP("rootmg", "r", "00000000-0000-0000-0000-000000000000",
@@ -162,6 +353,28 @@ func init() {
 			false,
 			"When exporting to a directory, add custom ARM escaping and other transformations specific to ALZ Bicep.")
 
+	generateArchitectureBaseCmd.Flags().
+		String(
+			"format",
+			formatFS,
+			"When exporting to a directory, the output format. "+
+				"`fs` writes per-asset JSON files, `arm` writes an ARM template per management group, "+
+				"`terraform` writes a Terraform JSON configuration using the azapi provider.")
+
+	generateArchitectureBaseCmd.Flags().
+		String(
+			"arm-parameters",
+			armParametersNone,
+			"When using `--format arm`, the parameters file to write alongside each template. "+
+				"One of `none`, `json` or `bicepparam`.")
+
+	generateArchitectureBaseCmd.Flags().
+		Bool(
+			"policy-role-assignments",
+			false,
+			"When printing JSON to stdout, include the policy role assignments of each management group, "+
+				"e.g. to use the output as a snapshot for `alzlibtool plan`.")
+
 	generateArchitectureBaseCmd.Flags().
 		String(
 			"from-cache",
@@ -169,4 +382,42 @@ func init() {
 			"Path to a cache file to seed built-in definitions from. "+
 				"Definitions found in the cache are used before falling back to Azure API calls, "+
 				"reducing the number of requests made to Azure.")
+
+	generateArchitectureBaseCmd.Flags().
+		String(
+			"lock-file",
+			"",
+			"Path to a lock file recording the resolved version and content hash of each built-in definition. "+
+				"The file is created or updated unless `--lock-file-verify` is set.")
+
+	generateArchitectureBaseCmd.Flags().
+		Bool(
+			"lock-file-verify",
+			false,
+			"Fail if a built-in definition resolves differently from the lock file, instead of updating it.")
+
+	generateArchitectureBaseCmd.Flags().
+		StringArray(
+			"do-not-enforce",
+			nil,
+			"Set the enforcement mode of the selected policy assignments to `DoNotEnforce`, for staged rollouts. "+
+				"The value is `all`, or comma separated `level=N`, `archetype=name` or `effect=name` terms "+
+				"that must all match. Repeat the flag to select the assignments matching any value.")
+
+	generateArchitectureBaseCmd.Flags().
+		String(
+			"record",
+			"",
+			"Directory to record Azure API responses to, for later use with `--replay`.")
+
+	generateArchitectureBaseCmd.Flags().
+		String(
+			"replay",
+			"",
+			"Directory to replay Azure API responses from, recorded with `--record`. "+
+				"No Azure credential is required and requests without a recording fail.")
+
+	generateArchitectureBaseCmd.MarkFlagsMutuallyExclusive("record", "replay")
+
+	cachecmd.AddCacheCheckFlags(&generateArchitectureBaseCmd)
 }
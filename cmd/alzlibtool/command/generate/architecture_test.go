@@ -5,7 +5,18 @@ package generate
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	alzlibcache "github.com/Azure/alzlib/cache"
+	cachecmd "github.com/Azure/alzlib/cmd/alzlibtool/command/cache"
+	"github.com/Azure/alzlib/deployment"
+	"github.com/Azure/alzlib/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGenerateArchitecture(t *testing.T) {
@@ -13,3 +24,77 @@ func TestGenerateArchitecture(t *testing.T) {
 	cmd.SetContext(context.Background())
 	cmd.Run(&cmd, []string{"../../../../testdata/simple", "simple"})
 }
+
+func TestGenerateArchitectureTerraform(t *testing.T) {
+	cmd := generateArchitectureBaseCmd
+	outDir := t.TempDir()
+	require.NoError(t, cmd.Flags().Set("format", formatTerraform))
+	require.NoError(t, cmd.Flags().Set("output", outDir))
+
+	t.Cleanup(func() {
+		cmd.Flags().Set("format", formatFS) //nolint:errcheck
+		cmd.Flags().Set("output", "")       //nolint:errcheck
+	})
+
+	w, err := newHierarchyWriter(&cmd, "simple")
+	require.NoError(t, err)
+	assert.IsType(t, &deployment.TerraformWriter{}, w)
+
+	cmd.SetContext(context.Background())
+	cmd.Run(&cmd, []string{"../../../../testdata/simple", "simple"})
+
+	_, err = os.Stat(filepath.Join(outDir, "terraform.tf.json"))
+	require.NoError(t, err, "the Terraform settings file is written")
+}
+
+func TestNewHierarchyWriterUnknownFormat(t *testing.T) {
+	cmd := generateArchitectureBaseCmd
+	require.NoError(t, cmd.Flags().Set("format", "bicep"))
+
+	t.Cleanup(func() {
+		cmd.Flags().Set("format", formatFS) //nolint:errcheck
+	})
+
+	_, err := newHierarchyWriter(&cmd, "simple")
+	require.ErrorContains(t, err, "unknown format `bicep`")
+}
+
+func TestParseEnforcementModeSelectors(t *testing.T) {
+	selectors, err := parseEnforcementModeSelectors("all")
+	require.NoError(t, err)
+	assert.Empty(t, selectors)
+
+	selectors, err = parseEnforcementModeSelectors("level=1, archetype=corp,effect=Deny")
+	require.NoError(t, err)
+	assert.Len(t, selectors, 3)
+
+	_, err = parseEnforcementModeSelectors("level=one")
+	require.ErrorContains(t, err, "level `one` is not a number")
+
+	_, err = parseEnforcementModeSelectors("scope=foo")
+	require.ErrorContains(t, err, "unknown key `scope`")
+
+	_, err = parseEnforcementModeSelectors("archetype")
+	require.ErrorContains(t, err, "must be of the form key=value")
+}
+
+func TestGenerateArchitectureCacheCheck(t *testing.T) {
+	cmd := generateArchitectureBaseCmd
+	require.NoError(t, cmd.Flags().Set("cache-max-age", "1ns"))
+	require.NoError(t, cmd.Flags().Set("cache-strict", "true"))
+
+	t.Cleanup(func() {
+		cmd.Flags().Set("cache-max-age", "0")    //nolint:errcheck
+		cmd.Flags().Set("cache-strict", "false") //nolint:errcheck
+	})
+
+	c := alzlibcache.NewCacheFromDefinitions(
+		map[string]*assets.PolicyDefinitionVersions{},
+		map[string]*assets.PolicySetDefinitionVersions{},
+	)
+	c.SetSource(auth.GetCloudFromEnv(), "")
+
+	az := alzlib.NewAlzLib(nil)
+	az.Options.CacheCheck = cachecmd.NewCacheCheck(&cmd, "cache.json.gz")
+	require.ErrorIs(t, az.AddCacheWithChecks(c), alzlib.ErrCacheCheck, "a stale cache is rejected with --cache-strict")
+}
@@ -0,0 +1,6 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package plan implements the `alzlibtool plan` CLI command, which compares an architecture
+// to a snapshot of existing state.
+package plan
@@ -0,0 +1,226 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Azure/alzlib"
+	alzlibcache "github.com/Azure/alzlib/cache"
+	cachecmd "github.com/Azure/alzlib/cmd/alzlibtool/command/cache"
+	"github.com/Azure/alzlib/deployment"
+	"github.com/Azure/alzlib/internal/auth"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// RequiredPlanArgs is the number of required arguments for the plan command.
+	RequiredPlanArgs = 3
+
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+// PlanCmd is the command for planning the changes of an architecture against a snapshot.
+var PlanCmd = cobra.Command{
+	Use:   "plan librarypath name snapshot",
+	Short: "Plans the changes required to deploy the supplied architecture.",
+	Long: `Compares the supplied architecture to a JSON snapshot of existing management groups, ` +
+		`policy and role assets, policy exemptions and policy role assignments, ` +
+		`and outputs the create, update and delete actions per management group. ` +
+		`The snapshot is either the JSON output of 'alzlibtool generate architecture --policy-role-assignments', ` +
+		`a serialized hierarchy, or an export of management groups and Microsoft.Authorization resources, ` +
+		`e.g. from 'az resource list' or Azure Resource Graph. ` +
+		`Role assignments are not supported in an export and must be filtered out, ` +
+		`so policy role assignments are planned for creation.`,
+	Args: cobra.ExactArgs(RequiredPlanArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+		outputFormat, _ := cmd.Flags().GetString("output-format")
+		if outputFormat != outputFormatText && outputFormat != outputFormatJSON {
+			cmd.PrintErrf("%s unknown output format %s\n", cmd.ErrPrefix(), outputFormat)
+			os.Exit(1)
+		}
+
+		sf, err := os.Open(args[2])
+		if err != nil {
+			cmd.PrintErrf("%s could not open snapshot file %s: %v\n", cmd.ErrPrefix(), args[2], err)
+			os.Exit(1)
+		}
+		defer sf.Close() //nolint:errcheck
+
+		snapshot, err := deployment.NewSnapshot(sf)
+		if err != nil {
+			cmd.PrintErrf("%s could not read snapshot file %s: %v\n", cmd.ErrPrefix(), args[2], err)
+			os.Exit(1)
+		}
+
+		thisLib := alzlib.NewCustomLibraryReference(args[0])
+
+		allLibs, err := thisLib.FetchWithDependencies(cmd.Context())
+		if err != nil {
+			cmd.PrintErrf(
+				"%s could not fetch all libraries with dependencies: %v\n",
+				cmd.ErrPrefix(),
+				err,
+			)
+			os.Exit(1)
+		}
+
+		az := alzlib.NewAlzLib(nil)
+
+		fromCacheFile, _ := cmd.Flags().GetString("from-cache")
+		if fromCacheFile != "" {
+			f, err := os.Open(fromCacheFile)
+			if err != nil {
+				cmd.PrintErrf("%s could not open cache file %s: %v\n", cmd.ErrPrefix(), fromCacheFile, err)
+				os.Exit(1)
+			}
+			defer f.Close() //nolint:errcheck
+
+			c, err := alzlibcache.NewCache(f)
+			if err != nil {
+				cmd.PrintErrf("%s could not load cache file %s: %v\n", cmd.ErrPrefix(), fromCacheFile, err)
+				os.Exit(1)
+			}
+
+			az.Options.CacheCheck = cachecmd.NewCacheCheck(cmd, fromCacheFile)
+			if err := az.AddCacheWithChecks(c); err != nil {
+				cmd.PrintErrf("%s could not add cache file %s: %v\n", cmd.ErrPrefix(), fromCacheFile, err)
+				os.Exit(1)
+			}
+		}
+
+		recordDir, _ := cmd.Flags().GetString("record")
+		replayDir, _ := cmd.Flags().GetString("replay")
+
+		cf, err := auth.NewPolicyClientFactory(recordDir, replayDir)
+		if err != nil {
+			cmd.PrintErrf("%s could not add client to alzlib: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		az.AddPolicyClient(cf)
+
+		if err := az.Init(cmd.Context(), allLibs...); err != nil {
+			cmd.PrintErrf("%s could not initialize alzlib: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		h := deployment.NewHierarchy(az)
+		rootMg, _ := cmd.Flags().GetString("rootmg")
+		location, _ := cmd.Flags().GetString("location")
+
+		if err := h.FromArchitecture(cmd.Context(), args[1], rootMg, location); err != nil {
+			cmd.PrintErrf("%s could not generate architecture: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		p, err := h.Plan(cmd.Context(), snapshot)
+		if praErrs := new(deployment.PolicyRoleAssignmentErrors); errors.As(err, &praErrs) {
+			cmd.PrintErrf("warning: some policy role assignments could not be generated: %v\n", err)
+
+			err = nil
+		}
+
+		if err != nil {
+			cmd.PrintErrf("%s could not plan architecture: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		if outputFormat == outputFormatJSON {
+			b, err := json.MarshalIndent(p, "", "  ")
+			if err != nil {
+				cmd.PrintErrf("%s could not marshal plan: %v\n", cmd.ErrPrefix(), err)
+				os.Exit(1)
+			}
+
+			cmd.SetOut(os.Stdout)
+			cmd.Println(string(b))
+
+			return
+		}
+
+		cmd.SetOut(os.Stdout)
+		writeTextPlan(cmd.OutOrStdout(), p)
+	},
+}
+
+// writeTextPlan writes a human readable representation of the plan.
+func writeTextPlan(w io.Writer, p *deployment.Plan) {
+	counts := make(map[deployment.PlanAction]int)
+
+	for _, name := range p.ManagementGroupNames() {
+		mgPlan := p.ManagementGroups[name]
+		counts[mgPlan.Action]++
+
+		fmt.Fprintf(w, "%s management group `%s` (%s)\n", actionSymbol(mgPlan.Action), name, mgPlan.Action) //nolint:errcheck
+		writeTextDiffs(w, "    ", mgPlan.Diffs)
+
+		for _, rc := range mgPlan.Resources {
+			counts[rc.Action]++
+
+			fmt.Fprintf(w, "    %s %s `%s`\n", actionSymbol(rc.Action), rc.Type, rc.Name) //nolint:errcheck
+			writeTextDiffs(w, "        ", rc.Diffs)
+		}
+	}
+
+	fmt.Fprintf( //nolint:errcheck
+		w,
+		"\nPlan: %d to create, %d to update, %d to delete.\n",
+		counts[deployment.PlanActionCreate],
+		counts[deployment.PlanActionUpdate],
+		counts[deployment.PlanActionDelete],
+	)
+}
+
+func writeTextDiffs(w io.Writer, indent string, diffs []deployment.PropertyDiff) {
+	for _, d := range diffs {
+		before, _ := json.Marshal(d.Before)
+		after, _ := json.Marshal(d.After)
+		fmt.Fprintf(w, "%s%s: %s => %s\n", indent, d.Path, before, after) //nolint:errcheck
+	}
+}
+
+func actionSymbol(a deployment.PlanAction) string {
+	switch a {
+	case deployment.PlanActionCreate:
+		return "+"
+	case deployment.PlanActionUpdate:
+		return "~"
+	case deployment.PlanActionDelete:
+		return "-"
+	case deployment.PlanActionNoOp:
+		return " "
+	default:
+		return "?"
+	}
+}
+
+func init() {
+	PlanCmd.Flags().
+		StringP("rootmg", "r", "00000000-0000-0000-0000-000000000000",
+			"The root management group id to use for the deployment.")
+	PlanCmd.Flags().
+		StringP("location", "l", "northeurope", "The location to use for the deployment.")
+	PlanCmd.Flags().
+		StringP("output-format", "f", outputFormatText, "The output format, one of `text` or `json`.")
+	PlanCmd.Flags().
+		String(
+			"from-cache",
+			"",
+			"Path to a cache file to seed built-in definitions from. "+
+				"Definitions found in the cache are used before falling back to Azure API calls, "+
+				"reducing the number of requests made to Azure.")
+	PlanCmd.Flags().
+		String("record", "", "Directory to record Azure API responses to, for later use with `--replay`.")
+	PlanCmd.Flags().
+		String("replay", "", "Directory to replay Azure API responses from, recorded with `--record`. "+
+			"No Azure credential is required and requests without a recording fail.")
+	PlanCmd.MarkFlagsMutuallyExclusive("record", "replay")
+	cachecmd.AddCacheCheckFlags(&PlanCmd)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package plan
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	alzlibcache "github.com/Azure/alzlib/cache"
+	cachecmd "github.com/Azure/alzlib/cmd/alzlibtool/command/cache"
+	"github.com/Azure/alzlib/deployment"
+	"github.com/Azure/alzlib/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTextPlan(t *testing.T) {
+	t.Parallel()
+
+	p := &deployment.Plan{
+		ManagementGroups: map[string]*deployment.ManagementGroupPlan{
+			"mg1": {
+				Action: deployment.PlanActionUpdate,
+				Diffs:  []deployment.PropertyDiff{{Path: "display_name", Before: "a", After: "b"}},
+				Resources: []deployment.ResourceChange{
+					{Type: "Microsoft.Authorization/policyAssignments", Name: "pa1", Action: deployment.PlanActionCreate},
+				},
+			},
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	writeTextPlan(buf, p)
+
+	assert.Equal(t, "~ management group `mg1` (update)\n"+
+		"    display_name: \"a\" => \"b\"\n"+
+		"    + Microsoft.Authorization/policyAssignments `pa1`\n"+
+		"\nPlan: 1 to create, 1 to update, 0 to delete.\n", buf.String())
+}
+
+func TestPlanCacheCheck(t *testing.T) {
+	cmd := PlanCmd
+	require.NoError(t, cmd.Flags().Set("cache-max-age", "1ns"))
+	require.NoError(t, cmd.Flags().Set("cache-strict", "true"))
+
+	t.Cleanup(func() {
+		cmd.Flags().Set("cache-max-age", "0")    //nolint:errcheck
+		cmd.Flags().Set("cache-strict", "false") //nolint:errcheck
+	})
+
+	c := alzlibcache.NewCacheFromDefinitions(
+		map[string]*assets.PolicyDefinitionVersions{},
+		map[string]*assets.PolicySetDefinitionVersions{},
+	)
+	c.SetSource(auth.GetCloudFromEnv(), "")
+
+	az := alzlib.NewAlzLib(nil)
+	az.Options.CacheCheck = cachecmd.NewCacheCheck(&cmd, "cache.json.gz")
+	require.ErrorIs(t, az.AddCacheWithChecks(c), alzlib.ErrCacheCheck, "a stale cache is rejected with --cache-strict")
+}
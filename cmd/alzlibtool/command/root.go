@@ -10,8 +10,11 @@ import (
 	"github.com/Azure/alzlib/cmd/alzlibtool/command/cache"
 	"github.com/Azure/alzlib/cmd/alzlibtool/command/check"
 	"github.com/Azure/alzlib/cmd/alzlibtool/command/convert"
+	"github.com/Azure/alzlib/cmd/alzlibtool/command/diff"
 	"github.com/Azure/alzlib/cmd/alzlibtool/command/document"
 	"github.com/Azure/alzlib/cmd/alzlibtool/command/generate"
+	"github.com/Azure/alzlib/cmd/alzlibtool/command/plan"
+	"github.com/Azure/alzlib/cmd/alzlibtool/command/simulate"
 	"github.com/spf13/cobra"
 )
 
@@ -51,6 +54,9 @@ func init() {
 	rootCmd.AddCommand(&cache.CacheBaseCmd)
 	rootCmd.AddCommand(&convert.ConvertBaseCmd)
 	rootCmd.AddCommand(&check.CheckCmd)
+	rootCmd.AddCommand(&diff.DiffBaseCmd)
 	rootCmd.AddCommand(&document.DocumentBaseCmd)
 	rootCmd.AddCommand(&generate.GenerateBaseCmd)
+	rootCmd.AddCommand(&plan.PlanCmd)
+	rootCmd.AddCommand(&simulate.SimulateCmd)
 }
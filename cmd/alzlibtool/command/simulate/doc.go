@@ -0,0 +1,6 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package simulate implements the `alzlibtool simulate` CLI command, which evaluates the policy assignments
+// of a management group in an architecture against sample resources.
+package simulate
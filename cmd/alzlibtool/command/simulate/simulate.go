@@ -0,0 +1,301 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package simulate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/alzlib"
+	alzlibcache "github.com/Azure/alzlib/cache"
+	cachecmd "github.com/Azure/alzlib/cmd/alzlibtool/command/cache"
+	"github.com/Azure/alzlib/deployment"
+	"github.com/Azure/alzlib/internal/auth"
+	alzlibsimulate "github.com/Azure/alzlib/simulate"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// RequiredSimulateArgs is the number of required arguments for the simulate command.
+	RequiredSimulateArgs = 4
+
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+// SimulateCmd is the command for simulating the policy assignments of a management group against sample resources.
+var SimulateCmd = cobra.Command{
+	Use:   "simulate librarypath name managementgroup resourcesdir",
+	Short: "Evaluates the policy assignments of a management group against sample resources.",
+	Long: `Generates the supplied architecture and evaluates the policy assignments in effect at the management group, ` +
+		`including those inherited from its ancestors, ` +
+		`against each resource JSON document in the resources directory, without deploying to Azure. ` +
+		`Each .json file contains a single resource or an array of resources. ` +
+		`The effects that would apply to each resource are output.`,
+	Args: cobra.ExactArgs(RequiredSimulateArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+		outputFormat, _ := cmd.Flags().GetString("output-format")
+		if outputFormat != outputFormatText && outputFormat != outputFormatJSON {
+			cmd.PrintErrf("%s unknown output format %s\n", cmd.ErrPrefix(), outputFormat)
+			os.Exit(1)
+		}
+
+		resources, err := readResources(args[3])
+		if err != nil {
+			cmd.PrintErrf("%s could not read resources: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		thisLib := alzlib.NewCustomLibraryReference(args[0])
+
+		allLibs, err := thisLib.FetchWithDependencies(cmd.Context())
+		if err != nil {
+			cmd.PrintErrf(
+				"%s could not fetch all libraries with dependencies: %v\n",
+				cmd.ErrPrefix(),
+				err,
+			)
+			os.Exit(1)
+		}
+
+		az := alzlib.NewAlzLib(nil)
+
+		fromCacheFile, _ := cmd.Flags().GetString("from-cache")
+		if fromCacheFile != "" {
+			f, err := os.Open(fromCacheFile)
+			if err != nil {
+				cmd.PrintErrf("%s could not open cache file %s: %v\n", cmd.ErrPrefix(), fromCacheFile, err)
+				os.Exit(1)
+			}
+			defer f.Close() //nolint:errcheck
+
+			c, err := alzlibcache.NewCache(f)
+			if err != nil {
+				cmd.PrintErrf("%s could not load cache file %s: %v\n", cmd.ErrPrefix(), fromCacheFile, err)
+				os.Exit(1)
+			}
+
+			az.Options.CacheCheck = cachecmd.NewCacheCheck(cmd, fromCacheFile)
+			if err := az.AddCacheWithChecks(c); err != nil {
+				cmd.PrintErrf("%s could not add cache file %s: %v\n", cmd.ErrPrefix(), fromCacheFile, err)
+				os.Exit(1)
+			}
+		}
+
+		recordDir, _ := cmd.Flags().GetString("record")
+		replayDir, _ := cmd.Flags().GetString("replay")
+
+		cf, err := auth.NewPolicyClientFactory(recordDir, replayDir)
+		if err != nil {
+			cmd.PrintErrf("%s could not add client to alzlib: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		az.AddPolicyClient(cf)
+
+		if err := az.Init(cmd.Context(), allLibs...); err != nil {
+			cmd.PrintErrf("%s could not initialize alzlib: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		h := deployment.NewHierarchy(az)
+		rootMg, _ := cmd.Flags().GetString("rootmg")
+		location, _ := cmd.Flags().GetString("location")
+
+		if err := h.FromArchitecture(cmd.Context(), args[1], rootMg, location); err != nil {
+			cmd.PrintErrf("%s could not generate architecture: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		mg := h.ManagementGroup(args[2])
+		if mg == nil {
+			cmd.PrintErrf("%s management group %s not found in architecture %s\n", cmd.ErrPrefix(), args[2], args[1])
+			os.Exit(1)
+		}
+
+		results, err := simulateResources(cmd.Context(), alzlibsimulate.NewEvaluator(az), mg, resources)
+		if err != nil {
+			cmd.PrintErrf("%s could not simulate resources: %v\n", cmd.ErrPrefix(), err)
+			os.Exit(1)
+		}
+
+		cmd.SetOut(os.Stdout)
+
+		if outputFormat == outputFormatJSON {
+			b, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				cmd.PrintErrf("%s could not marshal results: %v\n", cmd.ErrPrefix(), err)
+				os.Exit(1)
+			}
+
+			cmd.Println(string(b))
+
+			return
+		}
+
+		writeTextResults(cmd.OutOrStdout(), results)
+	},
+}
+
+// sampleResource is a resource JSON document read from the resources directory.
+type sampleResource struct {
+	file     string
+	resource map[string]any
+}
+
+// resourceResult is the outcome of evaluating the policy assignments against a sample resource.
+type resourceResult struct {
+	File    string                   `json:"file"`
+	Name    string                   `json:"name"`
+	Type    string                   `json:"type"`
+	Results []*alzlibsimulate.Result `json:"results"`
+	Errors  []string                 `json:"errors,omitempty"`
+}
+
+// readResources reads the resources from the .json files in the directory, in file name order.
+// A file contains either a single resource or an array of resources.
+func readResources(dir string) ([]sampleResource, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []sampleResource
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".json") {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var doc any
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return nil, fmt.Errorf("file %s: %w", entry.Name(), err)
+		}
+
+		switch v := doc.(type) {
+		case map[string]any:
+			resources = append(resources, sampleResource{file: entry.Name(), resource: v})
+		case []any:
+			for i, item := range v {
+				m, ok := item.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("file %s: array member %d is not an object", entry.Name(), i)
+				}
+
+				resources = append(resources, sampleResource{file: entry.Name(), resource: m})
+			}
+		default:
+			return nil, fmt.Errorf("file %s: expected an object or an array of objects", entry.Name())
+		}
+	}
+
+	return resources, nil
+}
+
+// simulateResources evaluates each policy assignment in effect at the management group against each resource.
+// This includes the assignments inherited from ancestor management groups, excluding those with the
+// management group in their not scopes.
+func simulateResources(
+	ctx context.Context,
+	e *alzlibsimulate.Evaluator,
+	mg *deployment.HierarchyManagementGroup,
+	resources []sampleResource,
+) ([]resourceResult, error) {
+	assignments, err := mg.EffectivePolicyAssignments()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]resourceResult, len(resources))
+
+	for i, r := range resources {
+		name, _ := r.resource["name"].(string)
+		typ, _ := r.resource["type"].(string)
+		results[i] = resourceResult{File: r.file, Name: name, Type: typ}
+
+		for _, epa := range assignments {
+			res, err := e.PolicyAssignment(ctx, epa.PolicyAssignment, r.resource)
+			results[i].Results = append(results[i].Results, res...)
+
+			if err != nil {
+				results[i].Errors = append(results[i].Errors, err.Error())
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// writeTextResults writes the effects that apply to each resource, and any evaluation errors.
+func writeTextResults(w io.Writer, results []resourceResult) {
+	for _, rr := range results {
+		fmt.Fprintf(w, "%s: %s `%s`\n", rr.File, rr.Type, rr.Name) //nolint:errcheck
+
+		applied := 0
+
+		for _, res := range rr.Results {
+			if !res.Applies() {
+				continue
+			}
+
+			applied++
+
+			definition := fmt.Sprintf("policy definition `%s`", res.PolicyDefinitionName)
+			if res.PolicyDefinitionReferenceID != "" {
+				definition = fmt.Sprintf("policy definition reference `%s`", res.PolicyDefinitionReferenceID)
+			}
+
+			enforcement := ""
+			if !res.Enforced {
+				enforcement = " (not enforced)"
+			}
+
+			fmt.Fprintf( //nolint:errcheck
+				w, "    %s: policy assignment `%s`, %s%s\n", res.Effect, res.PolicyAssignmentName, definition, enforcement,
+			)
+		}
+
+		if applied == 0 {
+			fmt.Fprintln(w, "    no policy effects apply") //nolint:errcheck
+		}
+
+		for _, err := range rr.Errors {
+			fmt.Fprintf(w, "    error: %s\n", err) //nolint:errcheck
+		}
+	}
+}
+
+func init() {
+	SimulateCmd.Flags().
+		StringP("rootmg", "r", "00000000-0000-0000-0000-000000000000",
+			"The root management group id to use for the deployment.")
+	SimulateCmd.Flags().
+		StringP("location", "l", "northeurope", "The location to use for the deployment.")
+	SimulateCmd.Flags().
+		StringP("output-format", "f", outputFormatText, "The output format, one of `text` or `json`.")
+	SimulateCmd.Flags().
+		String(
+			"from-cache",
+			"",
+			"Path to a cache file to seed built-in definitions from. "+
+				"Definitions found in the cache are used before falling back to Azure API calls, "+
+				"reducing the number of requests made to Azure.")
+	SimulateCmd.Flags().
+		String("record", "", "Directory to record Azure API responses to, for later use with `--replay`.")
+	SimulateCmd.Flags().
+		String("replay", "", "Directory to replay Azure API responses from, recorded with `--record`. "+
+			"No Azure credential is required and requests without a recording fail.")
+	SimulateCmd.MarkFlagsMutuallyExclusive("record", "replay")
+	cachecmd.AddCacheCheckFlags(&SimulateCmd)
+}
@@ -0,0 +1,168 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package simulate
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	alzlibcache "github.com/Azure/alzlib/cache"
+	cachecmd "github.com/Azure/alzlib/cmd/alzlibtool/command/cache"
+	"github.com/Azure/alzlib/deployment"
+	"github.com/Azure/alzlib/internal/auth"
+	alzlibsimulate "github.com/Azure/alzlib/simulate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadResources(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.json"), []byte(`[{"name": "b1"}, {"name": "b2"}]`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"name": "a"}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "readme.md"), []byte(`# ignored`), 0o600))
+
+	resources, err := readResources(dir)
+	require.NoError(t, err)
+	require.Len(t, resources, 3)
+	assert.Equal(t, "a.json", resources[0].file)
+	assert.Equal(t, "b2", resources[2].resource["name"])
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c.json"), []byte(`"foo"`), 0o600))
+
+	_, err = readResources(dir)
+	require.EqualError(t, err, "file c.json: expected an object or an array of objects")
+}
+
+func TestWriteTextResults(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	writeTextResults(buf, []resourceResult{
+		{
+			File: "storage.json",
+			Name: "sa",
+			Type: "Microsoft.Storage/storageAccounts",
+			Results: []*alzlibsimulate.Result{
+				{
+					PolicyAssignmentName: "storage", PolicyDefinitionReferenceID: "tls",
+					PolicyDefinitionName: "storage-tls", Match: true, Effect: "Deny", Enforced: true,
+				},
+				{PolicyAssignmentName: "audit", PolicyDefinitionName: "audit-pd", Match: true, Effect: "Audit"},
+				{PolicyAssignmentName: "other", PolicyDefinitionName: "other-pd", Match: false, Effect: "Deny"},
+			},
+		},
+		{
+			File:   "vnet.json",
+			Name:   "vnet",
+			Type:   "Microsoft.Network/virtualNetworks",
+			Errors: []string{"unknown function: length"},
+		},
+	})
+
+	assert.Equal(t, "storage.json: Microsoft.Storage/storageAccounts `sa`\n"+
+		"    Deny: policy assignment `storage`, policy definition reference `tls`\n"+
+		"    Audit: policy assignment `audit`, policy definition `audit-pd` (not enforced)\n"+
+		"vnet.json: Microsoft.Network/virtualNetworks `vnet`\n"+
+		"    no policy effects apply\n"+
+		"    error: unknown function: length\n", buf.String())
+}
+
+func TestSimulateResourcesInheritedAssignments(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	lib := alzlib.NewCustomLibraryReferenceFromFS("simulate", fstest.MapFS{
+		"deny-kv.alz_policy_definition.json": {Data: []byte(`{
+  "name": "deny-kv",
+  "type": "Microsoft.Authorization/policyDefinitions",
+  "properties": {
+    "displayName": "Deny key vaults",
+    "description": "Deny key vaults",
+    "mode": "All",
+    "policyRule": {
+      "if": {"field": "type", "equals": "Microsoft.KeyVault/vaults"},
+      "then": {"effect": "Deny"}
+    }
+  }
+}`)},
+		"deny-kv.alz_policy_assignment.json": {Data: []byte(`{
+  "name": "deny-kv",
+  "type": "Microsoft.Authorization/policyAssignments",
+  "properties": {
+    "displayName": "Deny key vaults",
+    "description": "Deny key vaults",
+    "policyDefinitionId": "/providers/Microsoft.Authorization/policyDefinitions/deny-kv",
+    "scope": "/providers/Microsoft.Management/managementGroups/placeholder"
+  }
+}`)},
+		"root.alz_archetype_definition.json": {Data: []byte(`{
+  "name": "root",
+  "policy_assignments": ["deny-kv"],
+  "policy_definitions": ["deny-kv"],
+  "policy_set_definitions": [],
+  "role_definitions": []
+}`)},
+		"empty.alz_archetype_definition.json": {Data: []byte(`{
+  "name": "empty",
+  "policy_assignments": [],
+  "policy_definitions": [],
+  "policy_set_definitions": [],
+  "role_definitions": []
+}`)},
+		"test.alz_architecture_definition.json": {Data: []byte(`{
+  "name": "test",
+  "management_groups": [
+    {"id": "root", "display_name": "root", "archetypes": ["root"], "parent_id": null, "exists": false},
+    {"id": "child", "display_name": "child", "archetypes": ["empty"], "parent_id": "root", "exists": false}
+  ]
+}`)},
+	})
+
+	az := alzlib.NewAlzLib(nil)
+	require.NoError(t, az.Init(ctx, lib))
+
+	h := deployment.NewHierarchy(az)
+	require.NoError(t, h.FromArchitecture(ctx, "test", "00000000-0000-0000-0000-000000000000", "northeurope"))
+
+	resources := []sampleResource{
+		{file: "kv.json", resource: map[string]any{"name": "kv", "type": "Microsoft.KeyVault/vaults"}},
+	}
+
+	results, err := simulateResources(ctx, alzlibsimulate.NewEvaluator(az), h.ManagementGroup("child"), resources)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Empty(t, results[0].Errors)
+	require.Len(t, results[0].Results, 1)
+	assert.Equal(t, "deny-kv", results[0].Results[0].PolicyAssignmentName)
+	assert.True(t, results[0].Results[0].Applies())
+}
+
+func TestSimulateCacheCheck(t *testing.T) {
+	cmd := SimulateCmd
+	require.NoError(t, cmd.Flags().Set("cache-max-age", "1ns"))
+	require.NoError(t, cmd.Flags().Set("cache-strict", "true"))
+
+	t.Cleanup(func() {
+		cmd.Flags().Set("cache-max-age", "0")    //nolint:errcheck
+		cmd.Flags().Set("cache-strict", "false") //nolint:errcheck
+	})
+
+	c := alzlibcache.NewCacheFromDefinitions(
+		map[string]*assets.PolicyDefinitionVersions{},
+		map[string]*assets.PolicySetDefinitionVersions{},
+	)
+	c.SetSource(auth.GetCloudFromEnv(), "")
+
+	az := alzlib.NewAlzLib(nil)
+	az.Options.CacheCheck = cachecmd.NewCacheCheck(&cmd, "cache.json.gz")
+	require.ErrorIs(t, az.AddCacheWithChecks(c), alzlib.ErrCacheCheck, "a stale cache is rejected with --cache-strict")
+}
@@ -0,0 +1,235 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+const (
+	// SubscriptionIDFmt is the format string for subscription resource IDs in Azure.
+	SubscriptionIDFmt = "/subscriptions/%s"
+
+	managementGroupsResourceType = "Microsoft.Management/managementGroups"
+)
+
+// EffectivePolicyAssignment is a policy assignment that is in effect at a scope,
+// either because it is assigned at the scope or because it is inherited from an ancestor management group.
+type EffectivePolicyAssignment struct {
+	// ManagementGroupID is the management group that the policy assignment is assigned at.
+	ManagementGroupID string `json:"management_group_id"`
+	// Inherited is true if the policy assignment is assigned at an ancestor of the scope.
+	Inherited bool `json:"inherited"`
+	// PolicyAssignmentName is the name of the policy assignment.
+	PolicyAssignmentName string `json:"policy_assignment_name"`
+	// PolicyAssignment is the policy assignment, it is shared with the management group and should not be modified.
+	PolicyAssignment *assets.PolicyAssignment `json:"-"`
+	// PolicyDefinitions are the policy definitions in effect through the policy assignment.
+	PolicyDefinitions []EffectivePolicyDefinition `json:"policy_definitions"`
+}
+
+// EffectivePolicyDefinition is a policy definition in effect through a policy assignment.
+type EffectivePolicyDefinition struct {
+	// PolicyDefinitionID is the resource id of the policy definition.
+	PolicyDefinitionID string `json:"policy_definition_id"`
+	// PolicyDefinitionName is the name of the policy definition.
+	PolicyDefinitionName string `json:"policy_definition_name"`
+	// PolicySetDefinitionName is set if the policy definition is assigned as a member of a policy set definition.
+	PolicySetDefinitionName string `json:"policy_set_definition_name,omitempty"`
+	// PolicyDefinitionReferenceID is the reference id of the policy definition within the policy set definition.
+	PolicyDefinitionReferenceID string `json:"policy_definition_reference_id,omitempty"`
+}
+
+// EffectivePolicyAssignments returns the policy assignments in effect at the management group.
+// These are the assignments of the management group and those inherited from its ancestors in the hierarchy,
+// excluding assignments that have the management group, or an ancestor below the assigning management group,
+// in their not scopes.
+// The result is ordered from the management group up to the root, then by policy assignment name.
+func (mg *HierarchyManagementGroup) EffectivePolicyAssignments() ([]*EffectivePolicyAssignment, error) {
+	res, err := mg.effectivePolicyAssignments(nil)
+	if err != nil {
+		return nil, fmt.Errorf("HierarchyManagementGroup.EffectivePolicyAssignments: %w", err)
+	}
+
+	return res, nil
+}
+
+// EffectivePolicyAssignmentsForSubscription returns the policy assignments that would be in effect at
+// a subscription placed under the management group.
+// All assignments are therefore inherited, and assignments with the subscription in their not scopes are excluded.
+// See EffectivePolicyAssignments for the ordering of the result.
+func (mg *HierarchyManagementGroup) EffectivePolicyAssignmentsForSubscription(
+	subscriptionID string,
+) ([]*EffectivePolicyAssignment, error) {
+	if subscriptionID == "" {
+		return nil, errors.New("HierarchyManagementGroup.EffectivePolicyAssignmentsForSubscription: " +
+			"subscription id is empty")
+	}
+
+	res, err := mg.effectivePolicyAssignments([]string{fmt.Sprintf(SubscriptionIDFmt, subscriptionID)})
+	if err != nil {
+		return nil, fmt.Errorf("HierarchyManagementGroup.EffectivePolicyAssignmentsForSubscription: %w", err)
+	}
+
+	return res, nil
+}
+
+// effectivePolicyAssignments walks up the hierarchy from the management group.
+// The scopes are the resource ids below the management group, e.g. a subscription, that
+// the effective assignments are being calculated for.
+func (mg *HierarchyManagementGroup) effectivePolicyAssignments(scopes []string) ([]*EffectivePolicyAssignment, error) {
+	if mg.hierarchy == nil || mg.hierarchy.alzlib == nil {
+		return nil, errors.New("management group is not part of a hierarchy")
+	}
+
+	mg.hierarchy.mu.RLock()
+	defer mg.hierarchy.mu.RUnlock()
+
+	var result []*EffectivePolicyAssignment
+
+	inherited := len(scopes) > 0
+
+	for current := mg; current != nil; current = current.Parent() {
+		scopes = append(scopes, current.ResourceID())
+
+		for _, paName := range slices.Sorted(maps.Keys(current.policyAssignments)) {
+			pa := current.policyAssignments[paName]
+			if pa.Properties != nil && notScopesExclude(pa.Properties.NotScopes, scopes) {
+				continue
+			}
+
+			defs, err := mg.hierarchy.effectivePolicyDefinitions(pa)
+			if err != nil {
+				return nil, fmt.Errorf("policy assignment `%s` in management group `%s`: %w", paName, current.id, err)
+			}
+
+			result = append(result, &EffectivePolicyAssignment{
+				ManagementGroupID:    current.id,
+				Inherited:            inherited,
+				PolicyAssignmentName: paName,
+				PolicyAssignment:     pa,
+				PolicyDefinitions:    defs,
+			})
+		}
+
+		inherited = true
+	}
+
+	return result, nil
+}
+
+// notScopesExclude returns true if any of the not scopes is one of the supplied scopes.
+func notScopesExclude(notScopes []*string, scopes []string) bool {
+	for _, ns := range notScopes {
+		if ns == nil {
+			continue
+		}
+
+		for _, scope := range scopes {
+			if strings.EqualFold(strings.TrimSuffix(*ns, "/"), scope) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// effectivePolicyDefinitions returns the policy definitions assigned by the policy assignment.
+// Policy set definitions are resolved from the management group in the hierarchy that they are
+// deployed to, otherwise using AlzLib.
+func (h *Hierarchy) effectivePolicyDefinitions(pa *assets.PolicyAssignment) ([]EffectivePolicyDefinition, error) {
+	if pa.Properties == nil || pa.Properties.PolicyDefinitionID == nil {
+		return nil, errors.New("policy definition id is not set")
+	}
+
+	ref, ver, err := pa.ReferencedPolicyDefinitionResourceIDAndVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(ref.ResourceType.Type) {
+	case alzlib.PolicyDefinitionsType:
+		return []EffectivePolicyDefinition{{
+			PolicyDefinitionID:   *pa.Properties.PolicyDefinitionID,
+			PolicyDefinitionName: ref.Name,
+		}}, nil
+	case alzlib.PolicySetDefinitionsType:
+		psd := h.policySetDefinition(ref, ver)
+		if psd == nil {
+			return nil, fmt.Errorf("referenced policy set definition `%s` not found", ref.Name)
+		}
+
+		refs := psd.PolicyDefinitionReferences()
+		result := make([]EffectivePolicyDefinition, 0, len(refs))
+
+		for _, pdRef := range refs {
+			if pdRef.PolicyDefinitionID == nil {
+				continue
+			}
+
+			id, err := arm.ParseResourceID(*pdRef.PolicyDefinitionID)
+			if err != nil {
+				return nil, fmt.Errorf("policy set definition `%s`: %w", ref.Name, err)
+			}
+
+			def := EffectivePolicyDefinition{
+				PolicyDefinitionID:      *pdRef.PolicyDefinitionID,
+				PolicyDefinitionName:    id.Name,
+				PolicySetDefinitionName: ref.Name,
+			}
+
+			if pdRef.PolicyDefinitionReferenceID != nil {
+				def.PolicyDefinitionReferenceID = *pdRef.PolicyDefinitionReferenceID
+			}
+
+			result = append(result, def)
+		}
+
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("unexpected referenced resource type `%s`", ref.ResourceType.Type)
+}
+
+// policyDefinition returns the policy definition with the resource id from the management group in the
+// hierarchy that it is deployed to, otherwise using AlzLib. It returns nil if the definition is not found.
+func (h *Hierarchy) policyDefinition(ref *arm.ResourceID, ver *string) *assets.PolicyDefinition {
+	if deployedTo := h.deployedTo(ref); deployedTo != nil {
+		if pd, ok := deployedTo.policyDefinitions[ref.Name]; ok {
+			return pd
+		}
+	}
+
+	return h.alzlib.PolicyDefinition(ref.Name, ver)
+}
+
+// policySetDefinition returns the policy set definition with the resource id from the management group in the
+// hierarchy that it is deployed to, otherwise using AlzLib. It returns nil if the definition is not found.
+func (h *Hierarchy) policySetDefinition(ref *arm.ResourceID, ver *string) *assets.PolicySetDefinition {
+	if deployedTo := h.deployedTo(ref); deployedTo != nil {
+		if psd, ok := deployedTo.policySetDefinitions[ref.Name]; ok {
+			return psd
+		}
+	}
+
+	return h.alzlib.PolicySetDefinition(ref.Name, ver)
+}
+
+// deployedTo returns the management group in the hierarchy that is the parent scope of the resource id, or nil.
+func (h *Hierarchy) deployedTo(ref *arm.ResourceID) *HierarchyManagementGroup {
+	if ref.Parent == nil || !strings.EqualFold(ref.Parent.ResourceType.String(), managementGroupsResourceType) {
+		return nil
+	}
+
+	return h.mgs[ref.Parent.Name]
+}
@@ -0,0 +1,186 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// effectivePolicyTestFS returns a library with the `effective` architecture, root -> child -> grandchild.
+// The root archetype deploys a policy definition and a policy set definition that are assigned at root and child.
+func effectivePolicyTestFS() fstest.MapFS {
+	return fstest.MapFS{
+		"pd.alz_policy_definition.json": {Data: []byte(`{
+  "name": "pd",
+  "type": "Microsoft.Authorization/policyDefinitions",
+  "properties": {
+    "displayName": "pd",
+    "description": "pd",
+    "mode": "All",
+    "policyType": "Custom",
+    "policyRule": {"if": {"field": "type", "equals": "foo"}, "then": {"effect": "audit"}}
+  }
+}`)},
+		"psd.alz_policy_set_definition.json": {Data: []byte(`{
+  "name": "psd",
+  "type": "Microsoft.Authorization/policySetDefinitions",
+  "properties": {
+    "displayName": "psd",
+    "description": "psd",
+    "policyType": "Custom",
+    "policyDefinitions": [
+      {
+        "policyDefinitionReferenceId": "ref",
+        "policyDefinitionId": "/providers/Microsoft.Management/managementGroups/placeholder/providers/Microsoft.Authorization/policyDefinitions/pd"
+      }
+    ]
+  }
+}`)},
+		"pa-root.alz_policy_assignment.json": {Data: []byte(`{
+  "name": "pa-root",
+  "type": "Microsoft.Authorization/policyAssignments",
+  "properties": {
+    "displayName": "pa-root",
+    "description": "pa-root",
+    "enforcementMode": "Default",
+    "policyDefinitionId": "/providers/Microsoft.Management/managementGroups/placeholder/providers/Microsoft.Authorization/policyDefinitions/pd",
+    "scope": "/providers/Microsoft.Management/managementGroups/placeholder"
+  }
+}`)},
+		"pa-child.alz_policy_assignment.json": {Data: []byte(`{
+  "name": "pa-child",
+  "type": "Microsoft.Authorization/policyAssignments",
+  "properties": {
+    "displayName": "pa-child",
+    "description": "pa-child",
+    "enforcementMode": "Default",
+    "policyDefinitionId": "/providers/Microsoft.Management/managementGroups/placeholder/providers/Microsoft.Authorization/policySetDefinitions/psd",
+    "scope": "/providers/Microsoft.Management/managementGroups/placeholder"
+  }
+}`)},
+		"root.alz_archetype_definition.json": {Data: []byte(`{
+  "name": "root",
+  "policy_assignments": ["pa-root"],
+  "policy_definitions": ["pd"],
+  "policy_set_definitions": ["psd"],
+  "role_definitions": []
+}`)},
+		"child.alz_archetype_definition.json": {Data: []byte(`{
+  "name": "child",
+  "policy_assignments": ["pa-child"],
+  "policy_definitions": [],
+  "policy_set_definitions": [],
+  "role_definitions": []
+}`)},
+		"empty.alz_archetype_definition.json": {Data: []byte(`{
+  "name": "empty",
+  "policy_assignments": [],
+  "policy_definitions": [],
+  "policy_set_definitions": [],
+  "role_definitions": []
+}`)},
+		"effective.alz_architecture_definition.json": {Data: []byte(`{
+  "name": "effective",
+  "management_groups": [
+    {"id": "root", "display_name": "root", "parent_id": null, "exists": false, "archetypes": ["root"]},
+    {"id": "child", "display_name": "child", "parent_id": "root", "exists": false, "archetypes": ["child"]},
+    {"id": "grandchild", "display_name": "grandchild", "parent_id": "child", "exists": false, "archetypes": ["empty"]}
+  ]
+}`)},
+	}
+}
+
+func newEffectivePolicyTestHierarchy(t *testing.T) *Hierarchy {
+	t.Helper()
+
+	ctx := context.Background()
+	lib := alzlib.NewCustomLibraryReferenceFromFS("effective", effectivePolicyTestFS())
+
+	az := alzlib.NewAlzLib(nil)
+	require.NoError(t, az.Init(ctx, lib))
+
+	h := NewHierarchy(az)
+	require.NoError(t, h.FromArchitecture(ctx, "effective", "00000000-0000-0000-0000-000000000000", "northeurope"))
+
+	return h
+}
+
+func TestEffectivePolicyAssignments(t *testing.T) {
+	t.Parallel()
+
+	h := newEffectivePolicyTestHierarchy(t)
+
+	eff, err := h.ManagementGroup("root").EffectivePolicyAssignments()
+	require.NoError(t, err)
+	require.Len(t, eff, 1)
+	assert.Equal(t, "pa-root", eff[0].PolicyAssignmentName)
+	assert.False(t, eff[0].Inherited)
+	assert.Equal(t, []EffectivePolicyDefinition{{
+		PolicyDefinitionID:   fmt.Sprintf(PolicyDefinitionIDFmt, "root", "pd"),
+		PolicyDefinitionName: "pd",
+	}}, eff[0].PolicyDefinitions)
+
+	eff, err = h.ManagementGroup("grandchild").EffectivePolicyAssignments()
+	require.NoError(t, err)
+	require.Len(t, eff, 2)
+	assert.Equal(t, "child", eff[0].ManagementGroupID)
+	assert.Equal(t, "pa-child", eff[0].PolicyAssignmentName)
+	assert.True(t, eff[0].Inherited)
+	assert.Equal(t, []EffectivePolicyDefinition{{
+		PolicyDefinitionID:          fmt.Sprintf(PolicyDefinitionIDFmt, "root", "pd"),
+		PolicyDefinitionName:        "pd",
+		PolicySetDefinitionName:     "psd",
+		PolicyDefinitionReferenceID: "ref",
+	}}, eff[0].PolicyDefinitions)
+	assert.Equal(t, "root", eff[1].ManagementGroupID)
+	assert.Equal(t, "pa-root", eff[1].PolicyAssignmentName)
+
+	// Excluding the child management group also excludes its descendants.
+	require.NoError(t, h.ManagementGroup("root").ModifyPolicyAssignment("pa-root", WithNotScopes(
+		[]*string{to.Ptr(fmt.Sprintf(ManagementGroupIDFmt, "child"))},
+	)))
+
+	eff, err = h.ManagementGroup("grandchild").EffectivePolicyAssignments()
+	require.NoError(t, err)
+	require.Len(t, eff, 1)
+	assert.Equal(t, "pa-child", eff[0].PolicyAssignmentName)
+
+	eff, err = h.ManagementGroup("root").EffectivePolicyAssignments()
+	require.NoError(t, err)
+	require.Len(t, eff, 1)
+}
+
+func TestEffectivePolicyAssignmentsForSubscription(t *testing.T) {
+	t.Parallel()
+
+	h := newEffectivePolicyTestHierarchy(t)
+	child := h.ManagementGroup("child")
+
+	require.NoError(t, child.ModifyPolicyAssignment("pa-child", WithNotScopes(
+		[]*string{to.Ptr(fmt.Sprintf(SubscriptionIDFmt, "excluded"))},
+	)))
+
+	eff, err := child.EffectivePolicyAssignmentsForSubscription("included")
+	require.NoError(t, err)
+	require.Len(t, eff, 2)
+	assert.Equal(t, "pa-child", eff[0].PolicyAssignmentName)
+	assert.True(t, eff[0].Inherited)
+	assert.Equal(t, "pa-root", eff[1].PolicyAssignmentName)
+
+	eff, err = child.EffectivePolicyAssignmentsForSubscription("EXCLUDED")
+	require.NoError(t, err)
+	require.Len(t, eff, 1)
+	assert.Equal(t, "pa-root", eff[0].PolicyAssignmentName)
+
+	_, err = child.EffectivePolicyAssignmentsForSubscription("")
+	require.Error(t, err)
+}
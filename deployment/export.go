@@ -0,0 +1,472 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// ArchetypeMatchKind describes how an existing policy assignment was matched to a library assignment.
+type ArchetypeMatchKind string
+
+const (
+	// ArchetypeMatchKindExact means the library assignment has the same name and references the same definition.
+	ArchetypeMatchKindExact ArchetypeMatchKind = "exact"
+	// ArchetypeMatchKindDefinition means the library assignment references the same definition,
+	// but has a different name.
+	ArchetypeMatchKindDefinition ArchetypeMatchKind = "definition"
+	// ArchetypeMatchKindName means the library assignment has the same name,
+	// but references a different definition.
+	ArchetypeMatchKindName ArchetypeMatchKind = "name"
+	// ArchetypeMatchKindNone means no library assignment matched.
+	ArchetypeMatchKindNone ArchetypeMatchKind = "none"
+)
+
+const (
+	exportTypeManagementGroup             = "microsoft.management/managementgroups"
+	exportNamespaceMicrosoftAuthorization = "microsoft.authorization/"
+)
+
+// ErrExportResourceTypeUnsupported is returned by NewHierarchyFromExport for Microsoft.Authorization resource types
+// that cannot be added to the hierarchy, e.g. role assignments.
+var ErrExportResourceTypeUnsupported = errors.New("unsupported resource type in export")
+
+// ArchetypeMatch is the result of matching an existing policy assignment to the closest archetype.
+type ArchetypeMatch struct {
+	// The management group of the existing policy assignment.
+	ManagementGroupID string `json:"management_group_id"`
+	// The name of the existing policy assignment.
+	AssignmentName string `json:"assignment_name"`
+	// How the assignment was matched.
+	Kind ArchetypeMatchKind `json:"kind"`
+	// The closest archetype containing the matched library assignment.
+	// Empty if there is no match, or the matched library assignment is not in any archetype.
+	Archetype string `json:"archetype,omitempty"`
+	// The name of the matched library assignment.
+	LibraryAssignmentName string `json:"library_assignment_name,omitempty"`
+}
+
+// exportResource is used to determine the type and scope of an exported resource.
+type exportResource struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Properties json.RawMessage `json:"properties"`
+}
+
+// exportManagementGroupProperties are the properties of an exported management group.
+type exportManagementGroupProperties struct {
+	DisplayName string `json:"displayName"`
+	Details     *struct {
+		Parent *struct {
+			ID *string `json:"id"`
+		} `json:"parent"`
+	} `json:"details"`
+}
+
+// NewHierarchyFromExport creates a hierarchy from an export of existing management groups and
+// Microsoft.Authorization resources, e.g. the output of `az resource list` or an Azure Resource Graph query.
+// The input is either a JSON array of resources, or an object with the resources in a `value` array.
+// All management groups are marked as existing. Management groups whose parent is not in the export
+// are treated as roots with an external parent.
+// Policy assets that are not deployed at management group scope, and resource types outside of the
+// Microsoft.Management and Microsoft.Authorization namespaces, are ignored.
+// Other Microsoft.Authorization resource types, such as role assignments, cannot be added to the hierarchy
+// and return ErrExportResourceTypeUnsupported, filter them from the export.
+// Policy assignments, definitions and set definitions without a description use the display name instead,
+// as the description is required by the library.
+// Custom role definitions are added to the first management group in their assignable scopes.
+// The supplied AlzLib is used for subsequent operations, such as Hierarchy.ArchetypeMatches.
+func NewHierarchyFromExport(az *alzlib.AlzLib, r io.Reader) (*Hierarchy, error) {
+	if az == nil {
+		return nil, errors.New("NewHierarchyFromExport: alzlib is nil")
+	}
+
+	raws, err := readExportResources(r)
+	if err != nil {
+		return nil, fmt.Errorf("NewHierarchyFromExport: %w", err)
+	}
+
+	h := NewHierarchy(az)
+	parents := make(map[string]string)
+	others := make([]json.RawMessage, 0, len(raws))
+
+	// First pass, create the management groups.
+	for _, raw := range raws {
+		var res exportResource
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return nil, fmt.Errorf("NewHierarchyFromExport: decoding resource: %w", err)
+		}
+
+		if strings.ToLower(res.Type) != exportTypeManagementGroup {
+			others = append(others, raw)
+			continue
+		}
+
+		var props exportManagementGroupProperties
+		if len(res.Properties) > 0 {
+			if err := json.Unmarshal(res.Properties, &props); err != nil {
+				return nil, fmt.Errorf(
+					"NewHierarchyFromExport: decoding management group `%s` properties: %w", res.Name, err,
+				)
+			}
+		}
+
+		if _, exists := h.mgs[res.Name]; exists {
+			return nil, fmt.Errorf("NewHierarchyFromExport: duplicate management group `%s`", res.Name)
+		}
+
+		mg := newManagementGroup()
+		mg.id = res.Name
+		mg.displayName = props.DisplayName
+		mg.exists = true
+		mg.children = mapset.NewSet[*HierarchyManagementGroup]()
+		mg.hierarchy = h
+		h.mgs[res.Name] = mg
+
+		if props.Details != nil && props.Details.Parent != nil && props.Details.Parent.ID != nil {
+			parentID, err := assets.NameFromResourceID(*props.Details.Parent.ID)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"NewHierarchyFromExport: parsing parent of management group `%s`: %w", res.Name, err,
+				)
+			}
+
+			parents[res.Name] = parentID
+		}
+	}
+
+	// Link parents and children.
+	for name, mg := range h.mgs {
+		parentID := parents[name]
+
+		parent, ok := h.mgs[parentID]
+		if !ok {
+			mg.parentExternal = to.Ptr(parentID)
+			continue
+		}
+
+		mg.parent = parent
+		parent.children.Add(mg)
+	}
+
+	for _, mg := range h.mgs {
+		if mg.parent == nil {
+			setExportLevels(mg, 0)
+		}
+	}
+
+	// Second pass, add the policy and role assets.
+	for _, raw := range others {
+		if err := h.addExportAsset(raw); err != nil {
+			return nil, fmt.Errorf("NewHierarchyFromExport: %w", err)
+		}
+	}
+
+	return h, nil
+}
+
+// ArchetypeMatches matches each existing policy assignment in the hierarchy to the closest archetype
+// in the AlzLib.
+// Assignments are first matched to library assignments, preferring an exact match (same name and referenced
+// definition), then the same referenced definition, then the same name.
+// Of the archetypes containing a matched library assignment, the closest is the one that contains the most
+// of the other assignment names in the management group, then the smallest, then by name.
+// Results are sorted by management group and assignment name.
+func (h *Hierarchy) ArchetypeMatches() ([]ArchetypeMatch, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	libByName := make(map[string]string)
+	libByRef := make(map[string][]string)
+
+	for _, name := range h.alzlib.PolicyAssignments() {
+		pa := h.alzlib.PolicyAssignment(name)
+
+		ref, err := assignmentReferenceKey(pa)
+		if err != nil {
+			return nil, fmt.Errorf("Hierarchy.ArchetypeMatches: library policy assignment `%s`: %w", name, err)
+		}
+
+		libByName[name] = ref
+		libByRef[ref] = append(libByRef[ref], name)
+	}
+
+	archetypes := make([]*alzlib.Archetype, 0)
+	for _, name := range h.alzlib.Archetypes() {
+		archetypes = append(archetypes, h.alzlib.Archetype(name))
+	}
+
+	res := make([]ArchetypeMatch, 0)
+
+	for _, mgName := range sortedKeys(h.mgs) {
+		mg := h.mgs[mgName]
+		mgAssignments := mapset.NewThreadUnsafeSetFromMapKeys(mg.policyAssignments)
+
+		for _, paName := range sortedKeys(mg.policyAssignments) {
+			ref, err := assignmentReferenceKey(mg.policyAssignments[paName])
+			if err != nil {
+				return nil, fmt.Errorf(
+					"Hierarchy.ArchetypeMatches: policy assignment `%s` in management group `%s`: %w", paName, mgName, err,
+				)
+			}
+
+			match := ArchetypeMatch{
+				ManagementGroupID: mgName,
+				AssignmentName:    paName,
+				Kind:              ArchetypeMatchKindNone,
+			}
+
+			var candidates []string
+
+			libRef, sameName := libByName[paName]
+
+			switch {
+			case sameName && libRef == ref:
+				match.Kind = ArchetypeMatchKindExact
+				candidates = []string{paName}
+			case len(libByRef[ref]) > 0:
+				match.Kind = ArchetypeMatchKindDefinition
+				candidates = libByRef[ref]
+			case sameName:
+				match.Kind = ArchetypeMatchKindName
+				candidates = []string{paName}
+			}
+
+			if len(candidates) > 0 {
+				match.LibraryAssignmentName = candidates[0]
+			}
+
+			bestScore, bestSize := -1, 0
+
+			for _, arch := range archetypes {
+				idx := slices.IndexFunc(candidates, arch.PolicyAssignments.ContainsOne)
+				if idx < 0 {
+					continue
+				}
+
+				score := arch.PolicyAssignments.Intersect(mgAssignments).Cardinality()
+				size := arch.PolicyAssignments.Cardinality()
+
+				if score < bestScore || (score == bestScore && size >= bestSize) {
+					continue
+				}
+
+				bestScore, bestSize = score, size
+				match.Archetype = arch.Name()
+				match.LibraryAssignmentName = candidates[idx]
+			}
+
+			res = append(res, match)
+		}
+	}
+
+	return res, nil
+}
+
+// addExportAsset adds a single exported Microsoft.Authorization resource to the hierarchy.
+func (h *Hierarchy) addExportAsset(raw json.RawMessage) error {
+	var res exportResource
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return fmt.Errorf("decoding resource: %w", err)
+	}
+
+	switch strings.ToLower(res.Type) {
+	case strings.ToLower(armTypePolicyAssignment):
+		mg := h.exportScopeManagementGroup(res.ID)
+		if mg == nil {
+			return nil
+		}
+
+		var a armpolicy.Assignment
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return fmt.Errorf("decoding policy assignment `%s`: %w", res.ID, err)
+		}
+
+		// Description is optional in Azure but required by the library,
+		// so fall back to the display name.
+		if a.Properties != nil && a.Properties.Description == nil {
+			a.Properties.Description = a.Properties.DisplayName
+		}
+
+		pa, err := assets.NewPolicyAssignmentValidate(a)
+		if err != nil {
+			return fmt.Errorf("validating policy assignment `%s`: %w", res.ID, err)
+		}
+
+		mg.policyAssignments[*pa.Name] = pa
+	case strings.ToLower(armTypePolicyDefinition):
+		mg := h.exportScopeManagementGroup(res.ID)
+		if mg == nil {
+			return nil
+		}
+
+		var d armpolicy.Definition
+		if err := json.Unmarshal(raw, &d); err != nil {
+			return fmt.Errorf("decoding policy definition `%s`: %w", res.ID, err)
+		}
+
+		if d.Properties != nil && d.Properties.Description == nil {
+			d.Properties.Description = d.Properties.DisplayName
+		}
+
+		pd, err := assets.NewPolicyDefinitionValidate(d)
+		if err != nil {
+			return fmt.Errorf("validating policy definition `%s`: %w", res.ID, err)
+		}
+
+		mg.policyDefinitions[*pd.Name] = pd
+	case strings.ToLower(armTypePolicySetDefinition):
+		mg := h.exportScopeManagementGroup(res.ID)
+		if mg == nil {
+			return nil
+		}
+
+		var sd armpolicy.SetDefinition
+		if err := json.Unmarshal(raw, &sd); err != nil {
+			return fmt.Errorf("decoding policy set definition `%s`: %w", res.ID, err)
+		}
+
+		if sd.Properties != nil && sd.Properties.Description == nil {
+			sd.Properties.Description = sd.Properties.DisplayName
+		}
+
+		psd, err := assets.NewPolicySetDefinitionValidate(sd)
+		if err != nil {
+			return fmt.Errorf("validating policy set definition `%s`: %w", res.ID, err)
+		}
+
+		mg.policySetDefinitions[*psd.Name] = psd
+	case strings.ToLower(armTypePolicyExemption):
+		mg := h.exportScopeManagementGroup(res.ID)
+		if mg == nil {
+			return nil
+		}
+
+		var e armpolicy.Exemption
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return fmt.Errorf("decoding policy exemption `%s`: %w", res.ID, err)
+		}
+
+		pe, err := assets.NewPolicyExemptionValidate(e)
+		if err != nil {
+			return fmt.Errorf("validating policy exemption `%s`: %w", res.ID, err)
+		}
+
+		mg.policyExemptions[*pe.Name] = pe
+	case strings.ToLower(armTypeRoleDefinition):
+		var r armauthorization.RoleDefinition
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return fmt.Errorf("decoding role definition `%s`: %w", res.ID, err)
+		}
+
+		rd, err := assets.NewRoleDefinitionValidate(r)
+		if err != nil {
+			return fmt.Errorf("validating role definition `%s`: %w", res.ID, err)
+		}
+
+		for _, scope := range rd.Properties.AssignableScopes {
+			if scope == nil {
+				continue
+			}
+
+			if mg := h.exportScopeManagementGroup(*scope); mg != nil {
+				// The exported role definition is already deployed, do not rename it when the hierarchy is modified.
+				mg.roleDefinitions[*rd.Name] = rd
+				mg.roleDefinitionOriginals[*rd.Name] = roleDefinitionOriginal{
+					name:     *rd.Name,
+					roleName: *rd.Properties.RoleName,
+					keep:     true,
+				}
+
+				break
+			}
+		}
+	default:
+		if strings.HasPrefix(strings.ToLower(res.Type), exportNamespaceMicrosoftAuthorization) {
+			return fmt.Errorf("%w: `%s` (`%s`)", ErrExportResourceTypeUnsupported, res.Type, res.ID)
+		}
+	}
+
+	return nil
+}
+
+// exportScopeManagementGroup returns the management group that the resource id is deployed to,
+// or is, or nil if the resource is not at management group scope or the management group is not
+// in the hierarchy.
+func (h *Hierarchy) exportScopeManagementGroup(id string) *HierarchyManagementGroup {
+	resID, err := arm.ParseResourceID(id)
+	if err != nil {
+		return nil
+	}
+
+	for r := resID; r != nil; r = r.Parent {
+		if strings.ToLower(r.ResourceType.String()) == exportTypeManagementGroup {
+			return h.mgs[r.Name]
+		}
+	}
+
+	return nil
+}
+
+// readExportResources reads the raw resources from an export,
+// either a JSON array or an object with a `value` array.
+func readExportResources(r io.Reader) ([]json.RawMessage, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading export: %w", err)
+	}
+
+	var res []json.RawMessage
+
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '{' {
+		var wrapper struct {
+			Value []json.RawMessage `json:"value"`
+		}
+
+		if err := json.Unmarshal(trimmed, &wrapper); err != nil {
+			return nil, fmt.Errorf("decoding export: %w", err)
+		}
+
+		return wrapper.Value, nil
+	}
+
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("decoding export: %w", err)
+	}
+
+	return res, nil
+}
+
+// assignmentReferenceKey returns a normalized key of the definition referenced by the assignment,
+// in the form `<resource type>/<name>`.
+func assignmentReferenceKey(pa *assets.PolicyAssignment) (string, error) {
+	ref, _, err := pa.ReferencedPolicyDefinitionResourceIDAndVersion()
+	if err != nil {
+		return "", fmt.Errorf("assignmentReferenceKey: %w", err)
+	}
+
+	return strings.ToLower(ref.ResourceType.Type + "/" + ref.Name), nil
+}
+
+func setExportLevels(mg *HierarchyManagementGroup, level int) {
+	mg.level = level
+	for child := range mg.children.Iter() {
+		setExportLevels(child, level+1)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testExport = `{"value": [
+  {
+    "id": "/providers/Microsoft.Management/managementGroups/root",
+    "name": "root",
+    "type": "Microsoft.Management/managementGroups",
+    "properties": {"displayName": "Tenant Root Group"}
+  },
+  {
+    "id": "/providers/Microsoft.Management/managementGroups/corp",
+    "name": "corp",
+    "type": "Microsoft.Management/managementGroups",
+    "properties": {
+      "displayName": "Corp",
+      "details": {"parent": {"id": "/providers/Microsoft.Management/managementGroups/root"}}
+    }
+  },
+  {
+    "id": "/providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/policyAssignments/test-pa",
+    "name": "test-pa",
+    "type": "Microsoft.Authorization/policyAssignments",
+    "properties": {
+      "displayName": "test",
+      "policyDefinitionId": "/providers/Microsoft.Management/managementGroups/root/providers/Microsoft.Authorization/policyDefinitions/test-policy-definition"
+    }
+  },
+  {
+    "id": "/providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/policyAssignments/renamed",
+    "name": "renamed",
+    "type": "Microsoft.Authorization/policyAssignments",
+    "properties": {
+      "displayName": "test",
+      "policyDefinitionId": "/providers/Microsoft.Management/managementGroups/root/providers/Microsoft.Authorization/policySetDefinitions/test-policy-set-definition"
+    }
+  },
+  {
+    "id": "/providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/policyAssignments/unknown",
+    "name": "unknown",
+    "type": "Microsoft.Authorization/policyAssignments",
+    "properties": {
+      "displayName": "test",
+      "policyDefinitionId": "/providers/Microsoft.Authorization/policyDefinitions/00000000-0000-0000-0000-000000000000"
+    }
+  },
+  {
+    "id": "/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.Authorization/policyAssignments/sub",
+    "name": "sub",
+    "type": "Microsoft.Authorization/policyAssignments",
+    "properties": {
+      "displayName": "test",
+      "policyDefinitionId": "/providers/Microsoft.Authorization/policyDefinitions/00000000-0000-0000-0000-000000000000"
+    }
+  },
+  {
+    "id": "/providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/policyExemptions/test-pe",
+    "name": "test-pe",
+    "type": "Microsoft.Authorization/policyExemptions",
+    "properties": {
+      "exemptionCategory": "Waiver",
+      "policyAssignmentId": "/providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/policyAssignments/test-pa"
+    }
+  },
+  {
+    "id": "/providers/Microsoft.Authorization/roleDefinitions/dc726155-3983-5405-b446-9bb27b94e02c",
+    "name": "dc726155-3983-5405-b446-9bb27b94e02c",
+    "type": "Microsoft.Authorization/roleDefinitions",
+    "properties": {
+      "roleName": "test",
+      "assignableScopes": ["/providers/Microsoft.Management/managementGroups/root"],
+      "permissions": [{"actions": ["*/read"]}]
+    }
+  },
+  {
+    "id": "/subscriptions/00000000-0000-0000-0000-000000000000",
+    "name": "00000000-0000-0000-0000-000000000000",
+    "type": "Microsoft.Resources/subscriptions"
+  }
+]}`
+
+func TestNewHierarchyFromExport(t *testing.T) {
+	az := buildSimpleHierarchy(t).alzlib
+
+	h, err := NewHierarchyFromExport(az, strings.NewReader(testExport))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"corp", "root"}, h.ManagementGroupNames())
+
+	root := h.ManagementGroup("root")
+	assert.True(t, root.Exists())
+	assert.Nil(t, root.Parent())
+	assert.Equal(t, 0, root.Level())
+	assert.Equal(t, "Tenant Root Group", root.DisplayName())
+	assert.Len(t, root.RoleDefinitionsMap(), 1)
+
+	corp := h.ManagementGroup("corp")
+	assert.Equal(t, root, corp.Parent())
+	assert.Equal(t, 1, corp.Level())
+	assert.Len(t, corp.PolicyAssignmentMap(), 3)
+	assert.Contains(t, corp.PolicyExemptionsMap(), "test-pe")
+
+	matches, err := h.ArchetypeMatches()
+	require.NoError(t, err)
+	assert.Equal(t, []ArchetypeMatch{
+		{
+			ManagementGroupID:     "corp",
+			AssignmentName:        "renamed",
+			Kind:                  ArchetypeMatchKindDefinition,
+			Archetype:             "simpleoverride",
+			LibraryAssignmentName: "override-pa",
+		},
+		{
+			ManagementGroupID:     "corp",
+			AssignmentName:        "test-pa",
+			Kind:                  ArchetypeMatchKindExact,
+			Archetype:             "simple",
+			LibraryAssignmentName: "test-pa",
+		},
+		{
+			ManagementGroupID: "corp",
+			AssignmentName:    "unknown",
+			Kind:              ArchetypeMatchKindNone,
+		},
+	}, matches)
+}
+
+func TestNewHierarchyFromExport_Duplicate(t *testing.T) {
+	az := buildSimpleHierarchy(t).alzlib
+
+	_, err := NewHierarchyFromExport(az, strings.NewReader(`[
+		{"id": "/providers/Microsoft.Management/managementGroups/a", "name": "a",
+		 "type": "Microsoft.Management/managementGroups"},
+		{"id": "/providers/Microsoft.Management/managementGroups/a", "name": "a",
+		 "type": "Microsoft.Management/managementGroups"}
+	]`))
+	require.ErrorContains(t, err, "duplicate management group `a`")
+}
+
+func TestNewHierarchyFromExport_Malformed(t *testing.T) {
+	az := buildSimpleHierarchy(t).alzlib
+	mg := `{"id": "/providers/Microsoft.Management/managementGroups/a", "name": "a",
+		"type": "Microsoft.Management/managementGroups"}`
+
+	for _, tc := range []struct {
+		name     string
+		resource string
+		err      string
+	}{
+		{
+			name: "policy definition without name",
+			resource: `{"id": "/providers/Microsoft.Management/managementGroups/a/providers/` +
+				`Microsoft.Authorization/policyDefinitions/pd", "type": "Microsoft.Authorization/policyDefinitions"}`,
+			err: "validating policy definition `/providers/Microsoft.Management/managementGroups/a/providers/" +
+				"Microsoft.Authorization/policyDefinitions/pd`",
+		},
+		{
+			name: "policy set definition without properties",
+			resource: `{"id": "/providers/Microsoft.Management/managementGroups/a/providers/` +
+				`Microsoft.Authorization/policySetDefinitions/psd", "name": "psd",` +
+				`"type": "Microsoft.Authorization/policySetDefinitions"}`,
+			err: "validating policy set definition `/providers/Microsoft.Management/managementGroups/a/providers/" +
+				"Microsoft.Authorization/policySetDefinitions/psd`",
+		},
+		{
+			name: "policy exemption without category",
+			resource: `{"id": "/providers/Microsoft.Management/managementGroups/a/providers/` +
+				`Microsoft.Authorization/policyExemptions/pe", "name": "pe",` +
+				`"type": "Microsoft.Authorization/policyExemptions",` +
+				`"properties": {"policyAssignmentId": "/providers/Microsoft.Management/managementGroups/a/providers/` +
+				`Microsoft.Authorization/policyAssignments/pa"}}`,
+			err: "validating policy exemption `/providers/Microsoft.Management/managementGroups/a/providers/" +
+				"Microsoft.Authorization/policyExemptions/pe`",
+		},
+		{
+			name: "role definition without properties",
+			resource: `{"id": "/providers/Microsoft.Authorization/roleDefinitions/rd", "name": "rd",` +
+				`"type": "Microsoft.Authorization/roleDefinitions"}`,
+			err: "validating role definition `/providers/Microsoft.Authorization/roleDefinitions/rd`",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewHierarchyFromExport(az, strings.NewReader("["+mg+","+tc.resource+"]"))
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestNewHierarchyFromExport_UnsupportedType(t *testing.T) {
+	az := buildSimpleHierarchy(t).alzlib
+
+	_, err := NewHierarchyFromExport(az, strings.NewReader(`[
+		{"id": "/providers/Microsoft.Management/managementGroups/a", "name": "a",
+		 "type": "Microsoft.Management/managementGroups"},
+		{"id": "/providers/Microsoft.Management/managementGroups/a/providers/Microsoft.Authorization/roleAssignments/ra",
+		 "name": "ra", "type": "Microsoft.Authorization/roleAssignments"}
+	]`))
+	require.ErrorIs(t, err, ErrExportResourceTypeUnsupported)
+	require.ErrorContains(t, err, "`Microsoft.Authorization/roleAssignments`")
+}
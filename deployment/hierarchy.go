@@ -5,8 +5,10 @@ package deployment
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"slices"
 	"strings"
 	"sync"
@@ -31,6 +33,10 @@ const (
 	PolicyDefinitionIDFmt = "/providers/Microsoft.Management/managementGroups/%s" +
 		"/providers/Microsoft.Authorization/policyDefinitions/%s"
 
+	// PolicyExemptionIDFmt is the format string for policy exemption resource IDs in Azure.
+	PolicyExemptionIDFmt = "/providers/Microsoft.Management/managementGroups/%s" +
+		"/providers/Microsoft.Authorization/policyExemptions/%s"
+
 	// PolicySetDefinitionIDFmt is the format string for policy set definition resource IDs in Azure.
 	PolicySetDefinitionIDFmt = "/providers/Microsoft.Management/managementGroups/%s" +
 		"/providers/Microsoft.Authorization/policySetDefinitions/%s"
@@ -40,6 +46,10 @@ const (
 		"/providers/Microsoft.Authorization/roleDefinitions/%s"
 
 	builtInRequestSliceCapacity = 100
+
+	// HierarchyFormatVersion is the version of the serialization format produced by Hierarchy.MarshalJSON.
+	// It is incremented on incompatible changes, Hierarchy.UnmarshalJSON rejects newer versions.
+	HierarchyFormatVersion = 1
 )
 
 // Hierarchy represents a deployment of Azure management group hierarchy.
@@ -109,25 +119,339 @@ func (h *Hierarchy) ManagementGroupsAtLevel(level int) map[string]*HierarchyMana
 }
 
 // FromArchitecture creates a hierarchy from the given architecture.
+// To compose several architectures into one hierarchy, use FromArchitectures.
 func (h *Hierarchy) FromArchitecture(
 	ctx context.Context,
 	arch, externalParentID, location string,
 ) error {
-	architecture := h.alzlib.Architecture(arch)
-	if architecture == nil {
-		return fmt.Errorf("Hierarchy.FromArchitecture: getting architecture `%s`", arch)
+	req := ArchitectureRequest{
+		Architecture:     arch,
+		ExternalParentID: externalParentID,
+		Location:         location,
+	}
+	if err := h.fromArchitectures(ctx, []ArchitectureRequest{req}); err != nil {
+		return fmt.Errorf("Hierarchy.FromArchitecture: %w", err)
+	}
+
+	return nil
+}
+
+// ArchitectureRequest is an architecture to add to the hierarchy, see Hierarchy.FromArchitectures.
+type ArchitectureRequest struct {
+	// Architecture is the name of the architecture in AlzLib.
+	Architecture string
+	// ExternalParentID is the id of the management group, outside of the hierarchy,
+	// that the root management groups of the architecture are deployed under, e.g. the tenant root group.
+	ExternalParentID string
+	// Location is the default location to use for artifacts in the architecture.
+	Location string
+}
+
+// FromArchitectures creates a hierarchy from several architectures, each with its own external parent
+// and location.
+// Management group ids must be unique across the architectures and any management groups already in the
+// hierarchy, and an external parent must not be a management group in the hierarchy.
+// The same custom definition may be deployed by more than one architecture, references are resolved to the
+// nearest management group in the ancestry of the referencing management group.
+// If an error is returned, no management groups are added to the hierarchy.
+func (h *Hierarchy) FromArchitectures(ctx context.Context, reqs ...ArchitectureRequest) error {
+	if err := h.fromArchitectures(ctx, reqs); err != nil {
+		return fmt.Errorf("Hierarchy.FromArchitectures: %w", err)
+	}
+
+	return nil
+}
+
+// fromArchitectures checks the architectures for management group id collisions before adding them
+// to the hierarchy, and removes the added management groups if any cannot be added.
+func (h *Hierarchy) fromArchitectures(ctx context.Context, reqs []ArchitectureRequest) error {
+	architectures := make([]*alzlib.Architecture, len(reqs))
+
+	// owners maps management group ids to the architecture that contains them,
+	// management groups already in the hierarchy have an empty owner.
+	owners := make(map[string]string)
+
+	for _, id := range h.ManagementGroupNames() {
+		owners[id] = ""
+	}
+
+	for i, req := range reqs {
+		architectures[i] = h.alzlib.Architecture(req.Architecture)
+		if architectures[i] == nil {
+			return fmt.Errorf("getting architecture `%s`", req.Architecture)
+		}
+
+		for _, id := range architectureManagementGroupIDs(architectures[i].RootMgs()) {
+			owner, exists := owners[id]
+
+			switch {
+			case exists && owner == "":
+				return fmt.Errorf(
+					"management group `%s` in architecture `%s` already exists in the hierarchy",
+					id,
+					req.Architecture,
+				)
+			case exists:
+				return fmt.Errorf(
+					"management group `%s` is in both architecture `%s` and architecture `%s`",
+					id,
+					owner,
+					req.Architecture,
+				)
+			}
+
+			owners[id] = req.Architecture
+		}
 	}
-	// Get the architecture root management groups.
-	for _, a := range architecture.RootMgs() {
-		if err := recurseAddManagementGroup(ctx, h, a, externalParentID, location, true, 0); err != nil {
+
+	for _, req := range reqs {
+		if _, exists := owners[req.ExternalParentID]; exists {
 			return fmt.Errorf(
-				"Hierarchy.FromArchitecture: recursion error on architecture `%s` %w",
-				arch,
-				err,
+				"external parent `%s` of architecture `%s` is a management group in the hierarchy",
+				req.ExternalParentID,
+				req.Architecture,
 			)
 		}
 	}
 
+	for i, req := range reqs {
+		for _, a := range architectures[i].RootMgs() {
+			if err := recurseAddManagementGroup(ctx, h, a, req.ExternalParentID, req.Location, true, 0); err != nil {
+				h.removeArchitectureManagementGroups(owners)
+
+				return fmt.Errorf("recursion error on architecture `%s` %w", req.Architecture, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeArchitectureManagementGroups removes the management groups that have an owning architecture.
+// As the architecture root management groups have external parents, no other management groups refer to them.
+func (h *Hierarchy) removeArchitectureManagementGroups(owners map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id, owner := range owners {
+		if owner != "" {
+			delete(h.mgs, id)
+		}
+	}
+}
+
+// architectureManagementGroupIDs returns the ids of the supplied architecture management groups
+// and their descendants.
+func architectureManagementGroupIDs(mgs []*alzlib.ArchitectureManagementGroup) []string {
+	var res []string
+
+	for _, mg := range mgs {
+		res = append(res, mg.ID())
+		res = append(res, architectureManagementGroupIDs(mg.Children())...)
+	}
+
+	return res
+}
+
+// AddManagementGroupRequest is the request to add a management group to an existing hierarchy,
+// see Hierarchy.AddManagementGroup.
+type AddManagementGroupRequest struct {
+	// ID is the name of the management group, forming the last part of the resource id.
+	ID string
+	// DisplayName is the display name of the management group.
+	DisplayName string
+	// ParentID is the id of the parent management group.
+	ParentID string
+	// ParentIsExternal is true if the parent management group is not in the hierarchy,
+	// e.g. the tenant root group.
+	ParentIsExternal bool
+	// Exists is true if the management group already exists in Azure.
+	Exists bool
+	// Archetypes are the names of the archetypes in AlzLib to apply to the management group.
+	Archetypes []string
+	// Location is the default location to use for artifacts in the management group.
+	// If empty, the location of the parent management group is used.
+	Location string
+	// Subscriptions are the subscription ids, or placeholders, to place in the management group.
+	Subscriptions []string
+}
+
+// AddManagementGroup adds a management group with the supplied archetypes to the hierarchy,
+// e.g. after FromArchitecture.
+// The resource ids and references of the new management group are updated in the same way as FromArchitecture.
+// Default policy assignment values that have already been added to the hierarchy are not applied to the new
+// management group, call AddDefaultPolicyAssignmentValue again if required.
+func (h *Hierarchy) AddManagementGroup(
+	ctx context.Context,
+	req AddManagementGroupRequest,
+) (*HierarchyManagementGroup, error) {
+	archetypes := make([]*alzlib.Archetype, len(req.Archetypes))
+
+	for i, name := range req.Archetypes {
+		archetypes[i] = h.alzlib.Archetype(name)
+		if archetypes[i] == nil {
+			return nil, fmt.Errorf("Hierarchy.AddManagementGroup: archetype `%s` not found", name)
+		}
+	}
+
+	location := req.Location
+	if location == "" && !req.ParentIsExternal {
+		if parent := h.ManagementGroup(req.ParentID); parent != nil {
+			location = parent.location
+		}
+	}
+
+	mg, err := h.addManagementGroup(ctx, managementGroupAddRequest{
+		id:               req.ID,
+		displayName:      req.DisplayName,
+		exists:           req.Exists,
+		parentID:         req.ParentID,
+		parentIsExternal: req.ParentIsExternal,
+		archetypes:       archetypes,
+		location:         location,
+		subscriptions:    req.Subscriptions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mg, nil
+}
+
+// RemoveManagementGroup removes the management group from the hierarchy.
+// The management group must not have any children or subscriptions, remove or move them first.
+func (h *Hierarchy) RemoveManagementGroup(id string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	mg, ok := h.mgs[id]
+	if !ok {
+		return fmt.Errorf("Hierarchy.RemoveManagementGroup: management group `%s` not found", id)
+	}
+
+	if mg.children.Cardinality() > 0 {
+		return fmt.Errorf(
+			"Hierarchy.RemoveManagementGroup: management group `%s` has children, remove or move them first",
+			id,
+		)
+	}
+
+	if mg.subscriptions.Cardinality() > 0 {
+		return fmt.Errorf(
+			"Hierarchy.RemoveManagementGroup: management group `%s` has subscriptions, remove them first",
+			id,
+		)
+	}
+
+	if mg.parent != nil {
+		mg.parent.children.Remove(mg)
+	}
+
+	delete(h.mgs, id)
+
+	return nil
+}
+
+// MoveManagementGroup moves the management group, and its descendants, to a new parent management group
+// in the hierarchy.
+// The moved management groups are updated so that the references to policy definitions and policy set
+// definitions deployed to their ancestors remain valid.
+// If a reference cannot be resolved from the new parent, e.g. because the definition is deployed to a former
+// ancestor, an error is returned and the hierarchy is left unchanged.
+func (h *Hierarchy) MoveManagementGroup(id, parentID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	mg, ok := h.mgs[id]
+	if !ok {
+		return fmt.Errorf("Hierarchy.MoveManagementGroup: management group `%s` not found", id)
+	}
+
+	parent, ok := h.mgs[parentID]
+	if !ok {
+		return fmt.Errorf("Hierarchy.MoveManagementGroup: parent management group `%s` not found", parentID)
+	}
+
+	if parent == mg || parent.HasParent(id) {
+		return fmt.Errorf(
+			"Hierarchy.MoveManagementGroup: cannot move management group `%s` under itself or its descendant `%s`",
+			id,
+			parentID,
+		)
+	}
+
+	if mg.parent == parent {
+		return nil
+	}
+
+	oldParent, oldParentExternal := mg.parent, mg.parentExternal
+
+	h.setParent(mg, parent, nil)
+
+	if err := h.updateManagementGroupAndDescendants(mg); err != nil {
+		h.setParent(mg, oldParent, oldParentExternal)
+
+		if rollbackErr := h.updateManagementGroupAndDescendants(mg); rollbackErr != nil {
+			err = errors.Join(err, fmt.Errorf("rolling back: %w", rollbackErr))
+		}
+
+		return fmt.Errorf(
+			"Hierarchy.MoveManagementGroup: moving management group `%s` to `%s`: %w",
+			id,
+			parentID,
+			err,
+		)
+	}
+
+	return nil
+}
+
+// setParent sets either the internal or external parent of the management group,
+// and recalculates the levels of the management group and its descendants.
+func (h *Hierarchy) setParent(mg, parent *HierarchyManagementGroup, parentExternal *string) {
+	if mg.parent != nil {
+		mg.parent.children.Remove(mg)
+	}
+
+	mg.parent = parent
+	mg.parentExternal = parentExternal
+	mg.level = 0
+
+	if parent != nil {
+		parent.children.Add(mg)
+		mg.level = parent.level + 1
+	}
+
+	var setLevels func(*HierarchyManagementGroup)
+
+	setLevels = func(m *HierarchyManagementGroup) {
+		for child := range m.children.Iter() {
+			child.level = m.level + 1
+			setLevels(child)
+		}
+	}
+
+	setLevels(mg)
+}
+
+// updateManagementGroupAndDescendants re-runs update on the management group and its descendants,
+// parents before children, so that references to definitions deployed to ancestors are rewritten.
+func (h *Hierarchy) updateManagementGroupAndDescendants(mg *HierarchyManagementGroup) error {
+	if err := mg.update(h.alzlib.Options.UniqueRoleDefinitions); err != nil {
+		return fmt.Errorf("updating management group `%s`: %w", mg.id, err)
+	}
+
+	children := mg.children.ToSlice()
+	slices.SortFunc(children, func(a, b *HierarchyManagementGroup) int {
+		return strings.Compare(a.id, b.id)
+	})
+
+	for _, child := range children {
+		if err := h.updateManagementGroupAndDescendants(child); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -217,6 +541,115 @@ func (h *Hierarchy) AddDefaultPolicyAssignmentValue(
 	return nil
 }
 
+// hierarchyJSON is the versioned JSON representation of a Hierarchy.
+type hierarchyJSON struct {
+	FormatVersion    int                            `json:"format_version"`
+	ManagementGroups []hierarchyManagementGroupJSON `json:"management_groups"`
+}
+
+// MarshalJSON implements the json.Marshaler interface for Hierarchy.
+// The output is versioned, see HierarchyFormatVersion, and can be loaded using Hierarchy.UnmarshalJSON.
+// Management groups are sorted by name.
+func (h *Hierarchy) MarshalJSON() ([]byte, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	tmp := hierarchyJSON{
+		FormatVersion:    HierarchyFormatVersion,
+		ManagementGroups: make([]hierarchyManagementGroupJSON, 0, len(h.mgs)),
+	}
+
+	for _, name := range sortedKeys(h.mgs) {
+		tmp.ManagementGroups = append(tmp.ManagementGroups, h.mgs[name].toJSON())
+	}
+
+	return json.Marshal(tmp) //nolint:wrapcheck
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for Hierarchy.
+// It loads the output of Hierarchy.MarshalJSON into an empty hierarchy, which should be created
+// using NewHierarchy so that the AlzLib is available for subsequent customization.
+// A parent that is not in the serialized hierarchy is treated as external.
+func (h *Hierarchy) UnmarshalJSON(data []byte) error {
+	var tmp hierarchyJSON
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return fmt.Errorf("Hierarchy.UnmarshalJSON: %w", err)
+	}
+
+	if tmp.FormatVersion < 1 || tmp.FormatVersion > HierarchyFormatVersion {
+		return fmt.Errorf(
+			"Hierarchy.UnmarshalJSON: unsupported format version %d, supported versions are 1 to %d",
+			tmp.FormatVersion,
+			HierarchyFormatVersion,
+		)
+	}
+
+	if h.mu == nil {
+		h.mu = new(sync.RWMutex)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.mgs) > 0 {
+		return errors.New("Hierarchy.UnmarshalJSON: hierarchy is not empty")
+	}
+
+	mgs := make(map[string]*HierarchyManagementGroup, len(tmp.ManagementGroups))
+
+	for _, in := range tmp.ManagementGroups {
+		if _, exists := mgs[in.ID]; exists || in.ID == "" {
+			return fmt.Errorf("Hierarchy.UnmarshalJSON: invalid or duplicate management group id `%s`", in.ID)
+		}
+
+		mg := newManagementGroup()
+		mg.id = in.ID
+		mg.displayName = in.DisplayName
+		mg.exists = in.Exists
+		mg.level = in.Level
+		mg.location = in.Location
+		mg.children = mapset.NewSet[*HierarchyManagementGroup]()
+		mg.hierarchy = h
+
+		maps.Copy(mg.policyAssignments, in.PolicyAssignments)
+		maps.Copy(mg.policyDefinitions, in.PolicyDefinitions)
+		maps.Copy(mg.policyExemptions, in.PolicyExemptions)
+		maps.Copy(mg.policySetDefinitions, in.PolicySetDefinitions)
+		maps.Copy(mg.roleDefinitions, in.RoleDefinitions)
+		mg.policyRoleAssignments.Append(in.PolicyRoleAssignments...)
+		mg.subscriptions.Append(in.Subscriptions...)
+		mg.archetypes.Append(in.Archetypes...)
+
+		mgs[in.ID] = mg
+	}
+
+	for _, in := range tmp.ManagementGroups {
+		mg := mgs[in.ID]
+
+		if in.Parent == nil {
+			mg.parentExternal = to.Ptr("")
+			continue
+		}
+
+		parent, ok := mgs[*in.Parent]
+		if !ok {
+			mg.parentExternal = to.Ptr(*in.Parent)
+			continue
+		}
+
+		mg.parent = parent
+		parent.children.Add(mg)
+	}
+
+	if h.mgs == nil {
+		h.mgs = make(map[string]*HierarchyManagementGroup, len(mgs))
+	}
+
+	maps.Copy(h.mgs, mgs)
+
+	return nil
+}
+
 func recurseAddManagementGroup(
 	ctx context.Context,
 	h *Hierarchy,
@@ -234,6 +667,7 @@ func recurseAddManagementGroup(
 		location:         location,
 		parentID:         parent,
 		parentIsExternal: externalParent,
+		subscriptions:    archMg.Subscriptions(),
 	}
 	if _, err := h.addManagementGroup(ctx, req); err != nil {
 		return fmt.Errorf(
@@ -259,7 +693,7 @@ func recurseAddManagementGroup(
 func (h *Hierarchy) addManagementGroup(
 	ctx context.Context,
 	req managementGroupAddRequest,
-) (*HierarchyManagementGroup, error) {
+) (_ *HierarchyManagementGroup, err error) {
 	if req.parentID == "" {
 		return nil, fmt.Errorf(
 			"Hierarchy.AddManagementGroup: parent management group not specified for `%s`",
@@ -279,6 +713,19 @@ func (h *Hierarchy) addManagementGroup(
 
 	mg := newManagementGroup()
 
+	// Leave the hierarchy unchanged if the management group cannot be added.
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if mg.parent != nil {
+			mg.parent.children.Remove(mg)
+		}
+
+		delete(h.mgs, req.id)
+	}()
+
 	mg.id = req.id
 	mg.displayName = req.displayName
 	mg.exists = req.exists
@@ -286,6 +733,33 @@ func (h *Hierarchy) addManagementGroup(
 	mg.children = mapset.NewSet[*HierarchyManagementGroup]()
 	mg.location = req.location
 
+	for _, archetype := range req.archetypes {
+		mg.archetypes.Add(archetype.Name())
+	}
+
+	for _, sub := range req.subscriptions {
+		if sub == "" {
+			return nil, fmt.Errorf("Hierarchy.AddManagementGroup: empty subscription for management group `%s`", req.id)
+		}
+
+		other := h.subscriptionManagementGroup(sub)
+		if other == nil && slices.ContainsFunc(mg.subscriptions.ToSlice(), func(s string) bool {
+			return strings.EqualFold(s, sub)
+		}) {
+			other = mg
+		}
+
+		if other != nil {
+			return nil, fmt.Errorf(
+				"Hierarchy.AddManagementGroup: subscription `%s` is already in management group `%s`",
+				sub,
+				other.id,
+			)
+		}
+
+		mg.subscriptions.Add(sub)
+	}
+
 	if req.parentIsExternal {
 		if _, ok := h.mgs[req.parentID]; ok {
 			return nil, fmt.Errorf(
@@ -307,6 +781,7 @@ func (h *Hierarchy) addManagementGroup(
 		}
 
 		mg.parent = parentMg
+		mg.level = parentMg.level + 1
 		h.mgs[req.parentID].children.Add(mg)
 	}
 
@@ -468,6 +943,26 @@ func (h *Hierarchy) addManagementGroup(
 		mg.roleDefinitions[name] = newroledef
 	}
 
+	// Combine all policy exemptions from all supplied archetypes into a single set.
+	// The referenced policy assignments are resolved when the management group is updated.
+	allPolicyExemptions := mapset.NewThreadUnsafeSet[string]()
+	for _, archetype := range req.archetypes {
+		allPolicyExemptions = allPolicyExemptions.Union(archetype.PolicyExemptions)
+	}
+
+	for _, name := range allPolicyExemptions.ToSlice() {
+		newExemption := h.alzlib.PolicyExemption(name)
+		if newExemption == nil {
+			return nil, fmt.Errorf(
+				"Hierarchy.AddManagementGroup(): policy exemption `%s` in management group `%s` does not exist in the library",
+				name,
+				req.id,
+			)
+		}
+
+		mg.policyExemptions[name] = newExemption
+	}
+
 	// set the hierarchy on the management group.
 	mg.hierarchy = h
 
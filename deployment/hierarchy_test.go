@@ -5,8 +5,11 @@ package deployment
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"reflect"
 	"testing"
+	"testing/fstest"
 
 	"github.com/Azure/alzlib"
 	"github.com/Azure/alzlib/assets"
@@ -508,3 +511,286 @@ func TestAddDefaultPolicyAssignmentValue(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func TestHierarchyJSONRoundTrip(t *testing.T) {
+	h := buildSimpleHierarchy(t)
+	_, err := h.PolicyRoleAssignments(context.Background())
+	require.NoError(t, err)
+
+	b, err := json.Marshal(h)
+	require.NoError(t, err)
+
+	loaded := NewHierarchy(h.alzlib)
+	require.NoError(t, json.Unmarshal(b, loaded))
+	assert.Equal(t, h.ManagementGroupNames(), loaded.ManagementGroupNames())
+
+	for _, name := range h.ManagementGroupNames() {
+		want, got := h.ManagementGroup(name), loaded.ManagementGroup(name)
+		assert.Equal(t, want.ParentID(), got.ParentID())
+		assert.Equal(t, want.ParentIsExternal(), got.ParentIsExternal())
+		assert.Equal(t, want.Exists(), got.Exists())
+		assert.Equal(t, want.Location(), got.Location())
+		assert.True(t, want.policyRoleAssignments.Equal(got.policyRoleAssignments))
+	}
+
+	b2, err := json.Marshal(loaded)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(b), string(b2))
+
+	// The loaded hierarchy can be customized.
+	require.NoError(t, loaded.ManagementGroup("simple").ModifyPolicyAssignment(
+		"test-pa",
+		WithEnforcementMode(to.Ptr(armpolicy.EnforcementModeDoNotEnforce)),
+	))
+}
+
+func TestHierarchyUnmarshalJSON_Errors(t *testing.T) {
+	t.Parallel()
+
+	h := NewHierarchy(nil)
+	err := json.Unmarshal([]byte(`{"format_version": 99, "management_groups": []}`), h)
+	require.ErrorContains(t, err, "unsupported format version 99")
+
+	err = json.Unmarshal([]byte(`{"management_groups": []}`), h)
+	require.ErrorContains(t, err, "unsupported format version 0")
+
+	err = json.Unmarshal([]byte(`{"format_version": 1, "management_groups": [{"id": "a"}, {"id": "a"}]}`), h)
+	require.ErrorContains(t, err, "duplicate management group id `a`")
+
+	require.NoError(t, json.Unmarshal(
+		[]byte(`{"format_version": 1, "management_groups": [{"id": "a", "parent": "ext"}, {"id": "b", "parent": "a"}]}`),
+		h,
+	))
+	assert.True(t, h.ManagementGroup("a").ParentIsExternal())
+	assert.Equal(t, h.ManagementGroup("a"), h.ManagementGroup("b").Parent())
+
+	err = json.Unmarshal([]byte(`{"format_version": 1, "management_groups": []}`), h)
+	require.ErrorContains(t, err, "hierarchy is not empty")
+}
+
+func TestAddManagementGroup(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	h := newEffectivePolicyTestHierarchy(t)
+
+	mg, err := h.AddManagementGroup(ctx, AddManagementGroupRequest{
+		ID:          "new",
+		DisplayName: "new",
+		ParentID:    "child",
+		Archetypes:  []string{"child"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, mg.Level())
+	assert.Equal(t, "northeurope", mg.Location())
+	assert.Equal(t, "child", mg.ParentID())
+	assert.Contains(t, h.ManagementGroup("child").Children(), mg)
+	assert.Equal(t,
+		fmt.Sprintf(PolicySetDefinitionIDFmt, "root", "psd"),
+		*mg.PolicyAssignmentMap()["pa-child"].Properties.PolicyDefinitionID,
+	)
+
+	mg, err = h.AddManagementGroup(ctx, AddManagementGroupRequest{
+		ID:         "located",
+		ParentID:   "root",
+		Archetypes: []string{"empty"},
+		Location:   "westeurope",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "westeurope", mg.Location())
+
+	_, err = h.AddManagementGroup(ctx, AddManagementGroupRequest{
+		ID:         "unknown",
+		ParentID:   "root",
+		Archetypes: []string{"notexist"},
+	})
+	require.ErrorContains(t, err, "archetype `notexist` not found")
+
+	_, err = h.AddManagementGroup(ctx, AddManagementGroupRequest{
+		ID:         "new",
+		ParentID:   "root",
+		Archetypes: []string{"empty"},
+	})
+	require.ErrorContains(t, err, "already exists")
+
+	// The referenced policy set definition is not deployed to an ancestor of a new root management group,
+	// the hierarchy should be left unchanged.
+	_, err = h.AddManagementGroup(ctx, AddManagementGroupRequest{
+		ID:               "orphan",
+		ParentID:         "00000000-0000-0000-0000-000000000000",
+		ParentIsExternal: true,
+		Archetypes:       []string{"child"},
+	})
+	require.Error(t, err)
+	assert.Nil(t, h.ManagementGroup("orphan"))
+	assert.Equal(t, []string{"child", "grandchild", "located", "new", "root"}, h.ManagementGroupNames())
+}
+
+func TestRemoveManagementGroup(t *testing.T) {
+	t.Parallel()
+
+	h := newEffectivePolicyTestHierarchy(t)
+
+	require.ErrorContains(t, h.RemoveManagementGroup("child"), "has children")
+	require.ErrorContains(t, h.RemoveManagementGroup("notexist"), "not found")
+
+	require.NoError(t, h.RemoveManagementGroup("grandchild"))
+	assert.Nil(t, h.ManagementGroup("grandchild"))
+	assert.Empty(t, h.ManagementGroup("child").Children())
+
+	require.NoError(t, h.RemoveManagementGroup("child"))
+	assert.Equal(t, []string{"root"}, h.ManagementGroupNames())
+}
+
+func TestMoveManagementGroup(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	h := newEffectivePolicyTestHierarchy(t)
+	root := h.ManagementGroup("root")
+	child := h.ManagementGroup("child")
+	grandchild := h.ManagementGroup("grandchild")
+
+	require.ErrorContains(t, h.MoveManagementGroup("root", "grandchild"), "cannot move")
+	require.ErrorContains(t, h.MoveManagementGroup("child", "child"), "cannot move")
+	require.ErrorContains(t, h.MoveManagementGroup("child", "notexist"), "not found")
+
+	require.NoError(t, h.MoveManagementGroup("grandchild", "root"))
+	assert.Equal(t, root, grandchild.Parent())
+	assert.Equal(t, 1, grandchild.Level())
+	assert.Empty(t, child.Children())
+	assert.ElementsMatch(t, []*HierarchyManagementGroup{child, grandchild}, root.Children())
+
+	_, err := h.AddManagementGroup(ctx, AddManagementGroupRequest{
+		ID:               "other",
+		ParentID:         "00000000-0000-0000-0000-000000000000",
+		ParentIsExternal: true,
+		Archetypes:       []string{"empty"},
+		Location:         "northeurope",
+	})
+	require.NoError(t, err)
+
+	// The child assignment references a policy set definition deployed to root,
+	// so moving it under another root management group must fail and be rolled back.
+	require.NoError(t, h.MoveManagementGroup("grandchild", "child"))
+
+	err = h.MoveManagementGroup("child", "other")
+	require.ErrorContains(t, err, "moving management group `child` to `other`")
+	assert.Equal(t, root, child.Parent())
+	assert.Equal(t, 1, child.Level())
+	assert.Equal(t, 2, grandchild.Level())
+	assert.Empty(t, h.ManagementGroup("other").Children())
+	assert.Equal(t,
+		fmt.Sprintf(PolicySetDefinitionIDFmt, "root", "psd"),
+		*child.PolicyAssignmentMap()["pa-child"].Properties.PolicyDefinitionID,
+	)
+}
+
+func TestFromArchitectures(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fs := effectivePolicyTestFS()
+	fs["labs.alz_architecture_definition.json"] = &fstest.MapFile{Data: []byte(`{
+  "name": "labs",
+  "management_groups": [
+    {"id": "labs", "display_name": "labs", "parent_id": null, "exists": false, "archetypes": ["root"]},
+    {"id": "labs-child", "display_name": "labs-child", "parent_id": "labs", "exists": false, "archetypes": ["child"]}
+  ]
+}`)}
+	fs["clash.alz_architecture_definition.json"] = &fstest.MapFile{Data: []byte(`{
+  "name": "clash",
+  "management_groups": [
+    {"id": "clash", "display_name": "clash", "parent_id": null, "exists": false, "archetypes": ["empty"]},
+    {"id": "child", "display_name": "child", "parent_id": "clash", "exists": false, "archetypes": ["empty"]}
+  ]
+}`)}
+	// The child archetype assigns a policy set definition that is not deployed in the orphan architecture.
+	fs["orphan.alz_architecture_definition.json"] = &fstest.MapFile{Data: []byte(`{
+  "name": "orphan",
+  "management_groups": [
+    {"id": "orphan", "display_name": "orphan", "parent_id": null, "exists": false, "archetypes": ["child"]}
+  ]
+}`)}
+
+	az := alzlib.NewAlzLib(nil)
+	require.NoError(t, az.Init(ctx, alzlib.NewCustomLibraryReferenceFromFS("multi", fs)))
+
+	t.Run("Composed", func(t *testing.T) {
+		t.Parallel()
+
+		h := NewHierarchy(az)
+		require.NoError(t, h.FromArchitectures(ctx,
+			ArchitectureRequest{Architecture: "effective", ExternalParentID: "tenant", Location: "northeurope"},
+			ArchitectureRequest{Architecture: "labs", ExternalParentID: "labs-parent", Location: "westeurope"},
+		))
+		assert.Equal(t,
+			[]string{"child", "grandchild", "labs", "labs-child", "root"},
+			h.ManagementGroupNames(),
+		)
+		assert.Equal(t, "labs-parent", h.ManagementGroup("labs").ParentID())
+		assert.Equal(t, "westeurope", h.ManagementGroup("labs-child").Location())
+
+		// Both architectures deploy the same definitions, each resolves references within its own ancestry.
+		assert.Equal(t,
+			fmt.Sprintf(PolicySetDefinitionIDFmt, "root", "psd"),
+			*h.ManagementGroup("child").PolicyAssignmentMap()["pa-child"].Properties.PolicyDefinitionID,
+		)
+		assert.Equal(t,
+			fmt.Sprintf(PolicySetDefinitionIDFmt, "labs", "psd"),
+			*h.ManagementGroup("labs-child").PolicyAssignmentMap()["pa-child"].Properties.PolicyDefinitionID,
+		)
+		assert.Equal(t,
+			fmt.Sprintf(PolicyDefinitionIDFmt, "labs", "pd"),
+			*h.ManagementGroup("labs").PolicySetDefinitionsMap()["psd"].Properties.PolicyDefinitions[0].PolicyDefinitionID,
+		)
+	})
+
+	t.Run("Collision", func(t *testing.T) {
+		t.Parallel()
+
+		h := NewHierarchy(az)
+		err := h.FromArchitectures(ctx,
+			ArchitectureRequest{Architecture: "effective", ExternalParentID: "tenant", Location: "northeurope"},
+			ArchitectureRequest{Architecture: "clash", ExternalParentID: "tenant", Location: "northeurope"},
+		)
+		require.ErrorContains(t, err, "management group `child` is in both architecture `effective` and architecture `clash`")
+		assert.Empty(t, h.ManagementGroupNames())
+
+		require.NoError(t, h.FromArchitecture(ctx, "effective", "tenant", "northeurope"))
+		err = h.FromArchitecture(ctx, "clash", "tenant", "northeurope")
+		require.ErrorContains(t, err, "management group `child` in architecture `clash` already exists in the hierarchy")
+		assert.Equal(t, []string{"child", "grandchild", "root"}, h.ManagementGroupNames())
+	})
+
+	t.Run("ExternalParentInHierarchy", func(t *testing.T) {
+		t.Parallel()
+
+		h := NewHierarchy(az)
+		err := h.FromArchitectures(ctx,
+			ArchitectureRequest{Architecture: "effective", ExternalParentID: "tenant", Location: "northeurope"},
+			ArchitectureRequest{Architecture: "labs", ExternalParentID: "root", Location: "northeurope"},
+		)
+		require.ErrorContains(t, err, "external parent `root` of architecture `labs` is a management group in the hierarchy")
+		assert.Empty(t, h.ManagementGroupNames())
+	})
+
+	t.Run("RolledBack", func(t *testing.T) {
+		t.Parallel()
+
+		h := NewHierarchy(az)
+		err := h.FromArchitectures(ctx,
+			ArchitectureRequest{Architecture: "effective", ExternalParentID: "tenant", Location: "northeurope"},
+			ArchitectureRequest{Architecture: "notexist", ExternalParentID: "tenant", Location: "northeurope"},
+		)
+		require.ErrorContains(t, err, "getting architecture `notexist`")
+		assert.Empty(t, h.ManagementGroupNames())
+
+		err = h.FromArchitectures(ctx,
+			ArchitectureRequest{Architecture: "effective", ExternalParentID: "tenant", Location: "northeurope"},
+			ArchitectureRequest{Architecture: "orphan", ExternalParentID: "tenant", Location: "northeurope"},
+		)
+		require.ErrorContains(t, err, "policy set definition psd that is not in the same hierarchy")
+		assert.Empty(t, h.ManagementGroupNames())
+	})
+}
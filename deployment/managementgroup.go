@@ -4,9 +4,11 @@
 package deployment
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/Azure/alzlib"
@@ -22,6 +24,7 @@ import (
 // HierarchyManagementGroup represents an Azure Management Group within a hierarchy, with links to
 // parent and children.
 type HierarchyManagementGroup struct {
+	archetypes  mapset.Set[string]                    // The names of the archetypes the management group was built from.
 	children    mapset.Set[*HierarchyManagementGroup] // The children of the management group.
 	displayName string                                // The display name of the management group.
 	// Whether the management group already exists in the hierarchy.
@@ -38,10 +41,23 @@ type HierarchyManagementGroup struct {
 	parentExternal    *string
 	policyAssignments map[string]*assets.PolicyAssignment // The policy assignments in the management group.
 	policyDefinitions map[string]*assets.PolicyDefinition // The policy definitions in the management group.
+	policyExemptions  map[string]*assets.PolicyExemption  // The policy exemptions in the management group.
 	// The additional role assignments needed for the policy assignments.
 	policyRoleAssignments mapset.Set[PolicyRoleAssignment]
 	policySetDefinitions  map[string]*assets.PolicySetDefinition // The policy set definitions in the management group.
 	roleDefinitions       map[string]*assets.RoleDefinition      // The role definitions in the management group.
+	// The original name and role name of the role definitions, keyed the same as roleDefinitions.
+	roleDefinitionOriginals map[string]roleDefinitionOriginal
+	subscriptions           mapset.Set[string] // The subscriptions placed in the management group.
+}
+
+// roleDefinitionOriginal is the name and role name of a role definition before it is made unique
+// to the management group, see updateRoleDefinitions.
+type roleDefinitionOriginal struct {
+	name     string
+	roleName string
+	// keep is true if the name and role name are used as is, e.g. when read from an export.
+	keep bool
 }
 
 // managementGroupAddRequest represents the request to add a management group to the hierarchy.
@@ -54,6 +70,7 @@ type managementGroupAddRequest struct {
 	archetypes       []*alzlib.Archetype // The archetypes to use for the management group.
 	level            int                 // The level of the management group in the hierarchy.
 	location         string              // The default location to use for artifacts in the management group.
+	subscriptions    []string            // The subscriptions to place in the management group.
 }
 
 // PolicyRoleAssignment represents the role assignments that need to be created for a management
@@ -67,6 +84,14 @@ type PolicyRoleAssignment struct {
 	ManagementGroupID string `json:"management_group_id,omitempty"`
 }
 
+// Archetypes returns the sorted names of the archetypes that the management group was built from.
+func (mg *HierarchyManagementGroup) Archetypes() []string {
+	res := mg.archetypes.ToSlice()
+	slices.Sort(res)
+
+	return res
+}
+
 // Children returns the children of the management group.
 func (mg *HierarchyManagementGroup) Children() []*HierarchyManagementGroup {
 	return mg.children.ToSlice()
@@ -96,6 +121,23 @@ func (mg *HierarchyManagementGroup) HasParent(id string) bool {
 	return mg.parent.HasParent(id)
 }
 
+// nearestDeploymentMg returns the id of the management group, or of its nearest ancestor, that is in the
+// supplied set of management groups that a definition is deployed to.
+// Management groups in other parts of the hierarchy, e.g. another architecture, are not considered.
+func (mg *HierarchyManagementGroup) nearestDeploymentMg(deploymentMgs mapset.Set[string]) (string, bool) {
+	for current := mg; current != nil; current = current.parent {
+		if deploymentMgs.Contains(current.id) {
+			return current.id, true
+		}
+
+		if current.parentExternal != nil {
+			break
+		}
+	}
+
+	return "", false
+}
+
 // ParentID returns the ID of the parent management group.
 // If the parent is external, this will be preferred.
 // If neither are set an empty string is returned (though this should never happen).
@@ -160,6 +202,11 @@ func (mg *HierarchyManagementGroup) PolicyDefinitionsMap() map[string]*assets.Po
 	return copyMap[string, *assets.PolicyDefinition](mg.policyDefinitions)
 }
 
+// PolicyExemptionsMap returns a copy of the policy exemptions map.
+func (mg *HierarchyManagementGroup) PolicyExemptionsMap() map[string]*assets.PolicyExemption {
+	return copyMap[string, *assets.PolicyExemption](mg.policyExemptions)
+}
+
 // PolicySetDefinitionsMap returns a copy of the policy definitions map.
 func (mg *HierarchyManagementGroup) PolicySetDefinitionsMap() map[string]*assets.PolicySetDefinition {
 	return copyMap[string, *assets.PolicySetDefinition](mg.policySetDefinitions)
@@ -694,6 +741,10 @@ func (mg *HierarchyManagementGroup) update(uniqueRoleDefinitions bool) error {
 		return fmt.Errorf("HierarchyManagementGroup.update: updating policy assignments: %w", err)
 	}
 
+	if err := updatePolicyExemptions(mg); err != nil {
+		return fmt.Errorf("HierarchyManagementGroup.update: updating policy exemptions: %w", err)
+	}
+
 	return nil
 }
 
@@ -701,6 +752,8 @@ func (mg *HierarchyManagementGroup) update(uniqueRoleDefinitions bool) error {
 type ModifyPolicyAssignmentOption func(*HierarchyManagementGroup, string) error
 
 // WithParameters sets the parameters for the policy assignment.
+// Each parameter must exist in the referenced policy (set) definition and its value must be valid for the
+// parameter type, allowed values and schema, see alzlib.AlzLib.ValidateAssignmentParameterValue.
 func WithParameters(parameters map[string]*armpolicy.ParameterValuesValue) ModifyPolicyAssignmentOption {
 	return func(mg *HierarchyManagementGroup, name string) error {
 		pa := mg.policyAssignments[name]
@@ -734,6 +787,21 @@ func WithParameters(parameters map[string]*armpolicy.ParameterValuesValue) Modif
 				)
 			}
 
+			var value any
+			if v != nil {
+				value = v.Value
+			}
+
+			if err := mg.hierarchy.alzlib.ValidateAssignmentParameterValue(
+				ref, policyDefinitionVersion, k, value,
+			); err != nil {
+				return fmt.Errorf(
+					"HierarchyManagementGroup.ModifyPolicyAssignment: policy assignment `%s`: %w",
+					name,
+					err,
+				)
+			}
+
 			pa.Properties.Parameters[k] = v
 		}
 
@@ -959,20 +1027,8 @@ func updatePolicySetDefinitions(
 			}
 			// if the referenced policy definition is custom, we need to update the reference
 			if definitionMgs, ok := pd2mg[pdname]; ok {
-				updated := false
-
-				for definitionMg := range definitionMgs.Iter() {
-					if definitionMg != mg.id && !mg.HasParent(definitionMg) {
-						continue
-					}
-
-					pdr.PolicyDefinitionID = to.Ptr(fmt.Sprintf(PolicyDefinitionIDFmt, definitionMg, pdname))
-					updated = true
-
-					break
-				}
-
-				if !updated {
+				definitionMg, found := mg.nearestDeploymentMg(definitionMgs)
+				if !found {
 					return fmt.Errorf(
 						"updatePolicySetDefinitions: policy set definition %s has a policy definition %s "+
 							"that is not in the same hierarchy",
@@ -980,6 +1036,8 @@ func updatePolicySetDefinitions(
 						pdname,
 					)
 				}
+
+				pdr.PolicyDefinitionID = to.Ptr(fmt.Sprintf(PolicyDefinitionIDFmt, definitionMg, pdname))
 			}
 		}
 	}
@@ -1014,53 +1072,33 @@ func updatePolicyAsignments(
 		switch strings.ToLower(pdRes.ResourceType.Type) {
 		case alzlib.PolicyDefinitionsType:
 			if deploymentMgs, ok := pd2mg[pdRes.Name]; ok {
-				updated := false
-
-				for deploymentMg := range deploymentMgs.Iter() {
-					if deploymentMg != mg.id && !mg.HasParent(deploymentMg) {
-						continue
-					}
-
-					assignment.Properties.PolicyDefinitionID = to.Ptr(
-						fmt.Sprintf(PolicyDefinitionIDFmt, deploymentMg, pdRes.Name),
-					)
-					updated = true
-
-					break
-				}
-
-				if !updated {
+				deploymentMg, found := mg.nearestDeploymentMg(deploymentMgs)
+				if !found {
 					return fmt.Errorf(
 						"updatePolicyAssignments: policy assignment %s has a policy definition %s that is not in the same hierarchy",
 						assignmentName,
 						pdRes.Name,
 					)
 				}
+
+				assignment.Properties.PolicyDefinitionID = to.Ptr(
+					fmt.Sprintf(PolicyDefinitionIDFmt, deploymentMg, pdRes.Name),
+				)
 			}
 		case alzlib.PolicySetDefinitionsType:
-			if deploymentMg, ok := psd2mg[pdRes.Name]; ok {
-				updated := false
-
-				for deploymentMg := range deploymentMg.Iter() {
-					if deploymentMg != mg.id && !mg.HasParent(deploymentMg) {
-						continue
-					}
-
-					assignment.Properties.PolicyDefinitionID = to.Ptr(
-						fmt.Sprintf(PolicySetDefinitionIDFmt, deploymentMg, pdRes.Name),
-					)
-					updated = true
-
-					break
-				}
-
-				if !updated {
+			if deploymentMgs, ok := psd2mg[pdRes.Name]; ok {
+				deploymentMg, found := mg.nearestDeploymentMg(deploymentMgs)
+				if !found {
 					return fmt.Errorf(
 						"updatePolicyAssignments: policy assignment %s has a policy set definition %s that is not in the same hierarchy",
 						assignmentName,
 						pdRes.Name,
 					)
 				}
+
+				assignment.Properties.PolicyDefinitionID = to.Ptr(
+					fmt.Sprintf(PolicySetDefinitionIDFmt, deploymentMg, pdRes.Name),
+				)
 			}
 		default:
 			return fmt.Errorf(
@@ -1074,16 +1112,141 @@ func updatePolicyAsignments(
 	return nil
 }
 
-func updateRoleDefinitions(alzmg *HierarchyManagementGroup, uniqueRoleDefinitions bool) {
-	for _, roledef := range alzmg.roleDefinitions {
-		if uniqueRoleDefinitions {
-			u := uuidV5(alzmg.id, *roledef.Name)
-			roledef.Name = to.Ptr(u.String())
-			roledef.Properties.RoleName = to.Ptr(
-				fmt.Sprintf("%s (%s)", *roledef.Properties.RoleName, alzmg.id),
+// updatePolicyExemptions re-writes the policy exemption resource IDs for the correct management group.
+// An exemption must be at or below the scope of the exempted policy assignment, so the assignment is
+// looked up by name in the management group and then its ancestors.
+// The policy definition reference ids are checked against the assigned policy set definition and
+// re-written using the casing of the set definition.
+func updatePolicyExemptions(mg *HierarchyManagementGroup) error {
+	for exemptionName, exemption := range mg.policyExemptions {
+		exemption.ID = to.Ptr(fmt.Sprintf(PolicyExemptionIDFmt, mg.id, exemptionName))
+
+		assignmentName, err := exemption.ReferencedPolicyAssignmentName()
+		if err != nil {
+			return fmt.Errorf("updatePolicyExemptions: policy exemption %s: %w", exemptionName, err)
+		}
+
+		assignmentMg, assignment := mg.nearestPolicyAssignment(assignmentName)
+		if assignment == nil {
+			return fmt.Errorf(
+				"updatePolicyExemptions: policy exemption %s references policy assignment %s "+
+					"that is not assigned at management group %s or its ancestors",
+				exemptionName,
+				assignmentName,
+				mg.id,
+			)
+		}
+
+		exemption.Properties.PolicyAssignmentID = to.Ptr(
+			fmt.Sprintf(PolicyAssignmentIDFmt, assignmentMg, assignmentName),
+		)
+
+		if err := updatePolicyExemptionReferenceIDs(mg, exemption, assignment); err != nil {
+			return fmt.Errorf("updatePolicyExemptions: policy exemption %s: %w", exemptionName, err)
+		}
+	}
+
+	return nil
+}
+
+// updatePolicyExemptionReferenceIDs checks that the policy definition reference ids of the exemption
+// exist in the policy set definition assigned by the exempted assignment.
+// Reference ids are compared case insensitively and re-written with the casing of the set definition.
+func updatePolicyExemptionReferenceIDs(
+	mg *HierarchyManagementGroup,
+	exemption *assets.PolicyExemption,
+	assignment *assets.PolicyAssignment,
+) error {
+	if len(exemption.Properties.PolicyDefinitionReferenceIDs) == 0 {
+		return nil
+	}
+
+	pdRes, version, err := assignment.ReferencedPolicyDefinitionResourceIDAndVersion()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if strings.ToLower(pdRes.ResourceType.Type) != alzlib.PolicySetDefinitionsType {
+		return fmt.Errorf(
+			"policy definition reference ids are set but policy assignment %s does not assign a policy set definition",
+			*assignment.Name,
+		)
+	}
+
+	psd := mg.hierarchy.alzlib.PolicySetDefinition(pdRes.Name, version)
+	if psd == nil {
+		return fmt.Errorf("policy set definition %s does not exist in the library", pdRes.Name)
+	}
+
+	refIDs := make([]string, 0, len(psd.PolicyDefinitionReferences()))
+	for _, ref := range psd.PolicyDefinitionReferences() {
+		if ref.PolicyDefinitionReferenceID != nil {
+			refIDs = append(refIDs, *ref.PolicyDefinitionReferenceID)
+		}
+	}
+
+	for i, refID := range exemption.Properties.PolicyDefinitionReferenceIDs {
+		idx := slices.IndexFunc(refIDs, func(s string) bool {
+			return strings.EqualFold(s, *refID)
+		})
+		if idx < 0 {
+			return fmt.Errorf(
+				"policy definition reference id %s does not exist in policy set definition %s",
+				*refID,
+				pdRes.Name,
 			)
 		}
 
+		exemption.Properties.PolicyDefinitionReferenceIDs[i] = to.Ptr(refIDs[idx])
+	}
+
+	return nil
+}
+
+// nearestPolicyAssignment returns the id of the management group, or of its nearest internal ancestor,
+// that has the named policy assignment, together with the assignment.
+// The assignment is nil if it is not found.
+func (mg *HierarchyManagementGroup) nearestPolicyAssignment(name string) (string, *assets.PolicyAssignment) {
+	for current := mg; current != nil; current = current.parent {
+		if pa, ok := current.policyAssignments[name]; ok {
+			return current.id, pa
+		}
+
+		if current.parentExternal != nil {
+			break
+		}
+	}
+
+	return "", nil
+}
+
+// updateRoleDefinitions rewrites the role definition ids and assignable scopes.
+// The original name and role name are recorded on the management group the first time it is updated,
+// and the unique name and role name are always derived from them,
+// so that updating again after the hierarchy is modified does not rename the role definitions twice.
+func updateRoleDefinitions(alzmg *HierarchyManagementGroup, uniqueRoleDefinitions bool) {
+	if alzmg.roleDefinitionOriginals == nil {
+		alzmg.roleDefinitionOriginals = make(map[string]roleDefinitionOriginal, len(alzmg.roleDefinitions))
+	}
+
+	for key, roledef := range alzmg.roleDefinitions {
+		orig, ok := alzmg.roleDefinitionOriginals[key]
+		if !ok {
+			orig = roleDefinitionOriginal{name: *roledef.Name, roleName: *roledef.Properties.RoleName}
+			alzmg.roleDefinitionOriginals[key] = orig
+		}
+
+		if !orig.keep {
+			roledef.Name = to.Ptr(orig.name)
+			roledef.Properties.RoleName = to.Ptr(orig.roleName)
+
+			if uniqueRoleDefinitions {
+				u := uuidV5(alzmg.id, orig.name)
+				roledef.Name = to.Ptr(u.String())
+				roledef.Properties.RoleName = to.Ptr(fmt.Sprintf("%s (%s)", orig.roleName, alzmg.id))
+			}
+		}
+
 		roledef.ID = to.Ptr(fmt.Sprintf(RoleDefinitionIDFmt, alzmg.id, *roledef.Name))
 
 		if len(roledef.Properties.AssignableScopes) == 0 {
@@ -1096,11 +1259,15 @@ func updateRoleDefinitions(alzmg *HierarchyManagementGroup, uniqueRoleDefinition
 
 func newManagementGroup() *HierarchyManagementGroup {
 	return &HierarchyManagementGroup{
-		policyRoleAssignments: mapset.NewThreadUnsafeSet[PolicyRoleAssignment](),
-		policyDefinitions:     make(map[string]*assets.PolicyDefinition),
-		policySetDefinitions:  make(map[string]*assets.PolicySetDefinition),
-		policyAssignments:     make(map[string]*assets.PolicyAssignment),
-		roleDefinitions:       make(map[string]*assets.RoleDefinition),
+		archetypes:              mapset.NewThreadUnsafeSet[string](),
+		policyRoleAssignments:   mapset.NewThreadUnsafeSet[PolicyRoleAssignment](),
+		policyDefinitions:       make(map[string]*assets.PolicyDefinition),
+		policyExemptions:        make(map[string]*assets.PolicyExemption),
+		policySetDefinitions:    make(map[string]*assets.PolicySetDefinition),
+		policyAssignments:       make(map[string]*assets.PolicyAssignment),
+		roleDefinitions:         make(map[string]*assets.RoleDefinition),
+		roleDefinitionOriginals: make(map[string]roleDefinitionOriginal),
+		subscriptions:           mapset.NewThreadUnsafeSet[string](),
 	}
 }
 
@@ -1114,40 +1281,55 @@ func copyMap[E comparable, T any](m map[E]T) map[E]T {
 	return m2
 }
 
+// hierarchyManagementGroupJSON is the JSON representation of a HierarchyManagementGroup.
+type hierarchyManagementGroupJSON struct {
+	// The names of the archetypes the management group was built from.
+	Archetypes []string `json:"archetypes,omitempty"`
+	// The ids of the children of the management group.
+	Children []string `json:"children,omitempty"`
+	// The display name of the management group.
+	DisplayName string `json:"display_name,omitempty"`
+	// Whether the management group already exists in the hierarchy.
+	Exists bool `json:"exists,omitempty"`
+	// The name of the management group, forming the last part of the resource id.
+	ID string `json:"id,omitempty"`
+	// The level of the management group in the hierarchy.
+	Level int `json:"level,omitempty"`
+	// The default location to use for artifacts in the management group.
+	Location string `json:"location,omitempty"`
+	// The id of the parent management group.
+	Parent *string `json:"parent,omitempty"`
+	// The policy assignments in the management group.
+	PolicyAssignments map[string]*assets.PolicyAssignment `json:"policy_assignments,omitempty"`
+	// The policy definitions in the management group.
+	PolicyDefinitions map[string]*assets.PolicyDefinition `json:"policy_definitions,omitempty"`
+	// The policy exemptions in the management group.
+	PolicyExemptions map[string]*assets.PolicyExemption `json:"policy_exemptions,omitempty"`
+	// The additional role assignments needed for the policy assignments.
+	PolicyRoleAssignments []PolicyRoleAssignment `json:"policy_role_assignments,omitempty"`
+	// The policy set definitions in the management group.
+	PolicySetDefinitions map[string]*assets.PolicySetDefinition `json:"policy_set_definitions,omitempty"`
+	// The role definitions in the management group.
+	RoleDefinitions map[string]*assets.RoleDefinition `json:"role_definitions,omitempty"`
+	// The subscriptions placed in the management group.
+	Subscriptions []string `json:"subscriptions,omitempty"`
+}
+
 // MarshalJSON implements the json.Marshaler interface for HierarchyManagementGroup.
 func (mg HierarchyManagementGroup) MarshalJSON() ([]byte, error) {
-	type marshalHierarchyManagementGroup struct {
-		// The ids of the children of the management group.
-		Children []string `json:"children,omitempty"`
-		// The display name of the management group.
-		DisplayName string `json:"display_name,omitempty"`
-		// Whether the management group already exists in the hierarchy.
-		Exists bool `json:"exists,omitempty"`
-		// The name of the management group, forming the last part of the resource id.
-		ID string `json:"id,omitempty"`
-		// The level of the management group in the hierarchy.
-		Level int `json:"level,omitempty"`
-		// The default location to use for artifacts in the management group.
-		Location string `json:"location,omitempty"`
-		// The id of the parent management group.
-		Parent *string `json:"parent,omitempty"`
-		// The policy assignments in the management group.
-		PolicyAssignments map[string]*assets.PolicyAssignment `json:"policy_assignments,omitempty"`
-		// The policy definitions in the management group.
-		PolicyDefinitions map[string]*assets.PolicyDefinition `json:"policy_definitions,omitempty"`
-		// The additional role assignments needed for the policy assignments.
-		PolicyRoleAssignments []PolicyRoleAssignment `json:"policy_role_assignments,omitempty"`
-		// The policy set definitions in the management group.
-		PolicySetDefinitions map[string]*assets.PolicySetDefinition `json:"policy_set_definitions,omitempty"`
-		// The role definitions in the management group.
-		RoleDefinitions map[string]*assets.RoleDefinition `json:"role_definitions,omitempty"`
-	}
+	return json.Marshal(mg.toJSON()) //nolint:wrapcheck
+}
 
-	childrenIDs := make([]string, mg.children.Cardinality())
-	for i, child := range mg.children.ToSlice() {
-		childrenIDs[i] = child.id
+// toJSON returns the JSON representation of the management group.
+// Children and policy role assignments are sorted to produce stable output.
+func (mg *HierarchyManagementGroup) toJSON() hierarchyManagementGroupJSON {
+	childrenIDs := make([]string, 0, mg.children.Cardinality())
+	for _, child := range mg.children.ToSlice() {
+		childrenIDs = append(childrenIDs, child.id)
 	}
 
+	slices.Sort(childrenIDs)
+
 	var parentID *string
 
 	switch {
@@ -1157,7 +1339,11 @@ func (mg HierarchyManagementGroup) MarshalJSON() ([]byte, error) {
 		parentID = &mg.parent.id
 	}
 
-	tmp := marshalHierarchyManagementGroup{
+	policyRoleAssignments := mg.policyRoleAssignments.ToSlice()
+	slices.SortFunc(policyRoleAssignments, comparePolicyRoleAssignments)
+
+	return hierarchyManagementGroupJSON{
+		Archetypes:            mg.Archetypes(),
 		Children:              childrenIDs,
 		DisplayName:           mg.displayName,
 		Exists:                mg.exists,
@@ -1167,10 +1353,20 @@ func (mg HierarchyManagementGroup) MarshalJSON() ([]byte, error) {
 		Parent:                parentID,
 		PolicyAssignments:     mg.policyAssignments,
 		PolicyDefinitions:     mg.policyDefinitions,
-		PolicyRoleAssignments: mg.policyRoleAssignments.ToSlice(),
+		PolicyExemptions:      mg.policyExemptions,
+		PolicyRoleAssignments: policyRoleAssignments,
 		PolicySetDefinitions:  mg.policySetDefinitions,
 		RoleDefinitions:       mg.roleDefinitions,
+		Subscriptions:         mg.Subscriptions(),
 	}
+}
 
-	return json.Marshal(tmp) //nolint:wrapcheck
+// comparePolicyRoleAssignments orders policy role assignments by all fields.
+func comparePolicyRoleAssignments(a, b PolicyRoleAssignment) int {
+	return cmp.Or(
+		strings.Compare(a.ManagementGroupID, b.ManagementGroupID),
+		strings.Compare(a.AssignmentName, b.AssignmentName),
+		strings.Compare(a.Scope, b.Scope),
+		strings.Compare(a.RoleDefinitionID, b.RoleDefinitionID),
+	)
 }
@@ -4,9 +4,12 @@
 package deployment
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/Azure/alzlib"
 	"github.com/Azure/alzlib/assets"
@@ -525,6 +528,12 @@ func TestManagementGroupUpdateWithUniqueRoleDefinitions(t *testing.T) {
 	assert.Equal(t, *mgRoot.roleDefinitions["rdRoot01"].ID, fmt.Sprintf("/providers/Microsoft.Management/managementGroups/mgRoot/providers/Microsoft.Authorization/roleDefinitions/%s", *mgRoot.roleDefinitions["rdRoot01"].Name), "Role definitions should have the same ID after update")
 	assert.NotEqual(t, "8a60c97f-9cb6-536b-b5db-9c997ee1de03", *mgRoot.roleDefinitions["rdRoot01"].Name, "Role definitions should have the same Name after update")
 	assert.Equal(t, *mgRoot.roleDefinitions["rdRoot01"].Properties.RoleName, fmt.Sprintf("[ALZ] Application-Owners (%s)", mgRoot.id), "Role definitions should have the same RoleName after update")
+
+	// Updating again, e.g. after the hierarchy is modified, should not change the unique names.
+	name := *mgRoot.roleDefinitions["rdRoot01"].Name
+	require.NoError(t, mgRoot.update(true))
+	assert.Equal(t, name, *mgRoot.roleDefinitions["rdRoot01"].Name)
+	assert.Equal(t, fmt.Sprintf("[ALZ] Application-Owners (%s)", mgRoot.id), *mgRoot.roleDefinitions["rdRoot01"].Properties.RoleName)
 }
 
 func TestManagementGroupUpdateWithNonUniqueRoleDefinitions(t *testing.T) {
@@ -774,6 +783,45 @@ func TestModifyRoleDefinitions(t *testing.T) {
 	assert.Empty(t, alzmg.roleDefinitions)
 }
 
+func TestUpdateRoleDefinitionsFromOriginals(t *testing.T) {
+	t.Parallel()
+
+	// The library role name already ends with the management group suffix.
+	alzmg := &HierarchyManagementGroup{
+		id: "mg1",
+		roleDefinitions: map[string]*assets.RoleDefinition{
+			"rd1": assets.NewRoleDefinition(armauthorization.RoleDefinition{
+				Name: to.Ptr("role1"),
+				Properties: &armauthorization.RoleDefinitionProperties{
+					RoleName: to.Ptr("role1 (mg1)"),
+				},
+			}),
+			"rd2": assets.NewRoleDefinition(armauthorization.RoleDefinition{
+				Name: to.Ptr("deployed"),
+				Properties: &armauthorization.RoleDefinitionProperties{
+					RoleName: to.Ptr("deployed (mg0)"),
+				},
+			}),
+		},
+		roleDefinitionOriginals: map[string]roleDefinitionOriginal{
+			"rd2": {name: "deployed", roleName: "deployed (mg0)", keep: true},
+		},
+	}
+
+	for range 2 {
+		updateRoleDefinitions(alzmg, true)
+
+		assert.Equal(t, uuidV5("mg1", "role1").String(), *alzmg.roleDefinitions["rd1"].Name)
+		assert.Equal(t, "role1 (mg1) (mg1)", *alzmg.roleDefinitions["rd1"].Properties.RoleName)
+		assert.Equal(t, fmt.Sprintf(RoleDefinitionIDFmt, "mg1", "deployed"), *alzmg.roleDefinitions["rd2"].ID)
+		assert.Equal(t, "deployed (mg0)", *alzmg.roleDefinitions["rd2"].Properties.RoleName)
+	}
+
+	updateRoleDefinitions(alzmg, false)
+	assert.Equal(t, "role1", *alzmg.roleDefinitions["rd1"].Name)
+	assert.Equal(t, "role1 (mg1)", *alzmg.roleDefinitions["rd1"].Properties.RoleName)
+}
+
 func TestModifyPolicyAssignment(t *testing.T) {
 	// Create a new AlzManagementGroup instance
 	alzmg := &HierarchyManagementGroup{
@@ -874,6 +922,60 @@ func TestModifyPolicyAssignment(t *testing.T) {
 	assert.Equal(t, expected, alzmg.policyAssignments["test-policy-assignment"])
 }
 
+func TestModifyPolicyAssignment_InvalidParameterValue(t *testing.T) {
+	alzmg := &HierarchyManagementGroup{
+		id:                "mg1",
+		policyAssignments: make(map[string]*assets.PolicyAssignment),
+	}
+
+	pa := assets.NewPolicyAssignment(armpolicy.Assignment{
+		Name: to.Ptr("test-policy-assignment"),
+		Properties: &armpolicy.AssignmentProperties{
+			PolicyDefinitionID: to.Ptr("/providers/Microsoft.Authorization/policyDefinitions/test-policy-definition"),
+		},
+	})
+	pd := assets.NewPolicyDefinition(armpolicy.Definition{
+		Name: to.Ptr("test-policy-definition"),
+		Properties: &armpolicy.DefinitionProperties{
+			Parameters: map[string]*armpolicy.ParameterDefinitionsValue{
+				"effect": {
+					Type:          to.Ptr(armpolicy.ParameterTypeString),
+					AllowedValues: []any{"Audit", "Deny"},
+				},
+				"count": {
+					Type: to.Ptr(armpolicy.ParameterTypeInteger),
+				},
+			},
+		},
+	})
+	az := alzlib.NewAlzLib(nil)
+	require.NoError(t, az.AddPolicyDefinitions(pd))
+
+	h := NewHierarchy(az)
+	h.mgs["mg1"] = alzmg
+	alzmg.hierarchy = h
+	alzmg.policyAssignments["test-policy-assignment"] = pa
+
+	err := alzmg.ModifyPolicyAssignment("test-policy-assignment", WithParameters(
+		map[string]*armpolicy.ParameterValuesValue{"effect": {Value: "Block"}},
+	))
+	require.ErrorContains(t, err, "invalid value for parameter 'effect'")
+	assert.Nil(t, pa.Properties.Parameters["effect"])
+
+	err = alzmg.ModifyPolicyAssignment("test-policy-assignment", WithParameters(
+		map[string]*armpolicy.ParameterValuesValue{"count": {Value: "ten"}},
+	))
+	require.ErrorContains(t, err, `value "ten" is not of type Integer`)
+
+	require.NoError(t, alzmg.ModifyPolicyAssignment("test-policy-assignment", WithParameters(
+		map[string]*armpolicy.ParameterValuesValue{
+			"effect": {Value: "deny"},
+			"count":  {Value: 10},
+		},
+	)))
+	assert.Equal(t, "deny", pa.Properties.Parameters["effect"].Value)
+}
+
 func TestModifyPolicyAssignment_WithPartialOptions(t *testing.T) {
 	// Test that we can call ModifyPolicyAssignment with only some options
 	alzmg := &HierarchyManagementGroup{
@@ -3376,3 +3478,114 @@ func deployPrivateDnsZonesPolicyAssignment() *assets.PolicyAssignment {
 
 	return result
 }
+
+// policyExemptionTestFS returns the effective policy test library with policy exemptions and an
+// `exempt` architecture: ex-root (root) -> ex-child (child) -> ex-grandchild (exempt).
+func policyExemptionTestFS() fstest.MapFS {
+	fs := effectivePolicyTestFS()
+	exemption := func(name, assignment, refs string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(`{
+  "name": "` + name + `",
+  "properties": {
+    "policyAssignmentId": "/providers/Microsoft.Management/managementGroups/placeholder/providers/Microsoft.Authorization/policyAssignments/` + assignment + `",
+    "exemptionCategory": "Waiver",
+    "policyDefinitionReferenceIds": [` + refs + `]
+  }
+}`)}
+	}
+	fs["pe-root.alz_policy_exemption.json"] = exemption("pe-root", "pa-root", "")
+	fs["pe-child.alz_policy_exemption.json"] = exemption("pe-child", "pa-child", `"REF"`)
+	fs["pe-bad-ref.alz_policy_exemption.json"] = exemption("pe-bad-ref", "pa-child", `"nope"`)
+	fs["pe-not-set.alz_policy_exemption.json"] = exemption("pe-not-set", "pa-root", `"ref"`)
+	fs["exempt.alz_archetype_definition.json"] = &fstest.MapFile{Data: []byte(`{
+  "name": "exempt",
+  "policy_exemptions": ["pe-root", "pe-child"]
+}`)}
+	fs["exempt-bad-ref.alz_archetype_definition.json"] = &fstest.MapFile{Data: []byte(`{
+  "name": "exempt-bad-ref",
+  "policy_exemptions": ["pe-bad-ref"]
+}`)}
+	fs["exempt-not-set.alz_archetype_definition.json"] = &fstest.MapFile{Data: []byte(`{
+  "name": "exempt-not-set",
+  "policy_exemptions": ["pe-not-set"]
+}`)}
+	fs["exempt.alz_architecture_definition.json"] = &fstest.MapFile{Data: []byte(`{
+  "name": "exempt",
+  "management_groups": [
+    {"id": "ex-root", "display_name": "root", "parent_id": null, "exists": false, "archetypes": ["root"]},
+    {"id": "ex-child", "display_name": "child", "parent_id": "ex-root", "exists": false, "archetypes": ["child"]},
+    {"id": "ex-grandchild", "display_name": "grandchild", "parent_id": "ex-child", "exists": false, "archetypes": ["exempt"]}
+  ]
+}`)}
+
+	return fs
+}
+
+func newPolicyExemptionTestHierarchy(t *testing.T) *Hierarchy {
+	t.Helper()
+
+	ctx := context.Background()
+	az := alzlib.NewAlzLib(nil)
+	require.NoError(t, az.Init(ctx, alzlib.NewCustomLibraryReferenceFromFS("exempt", policyExemptionTestFS())))
+
+	h := NewHierarchy(az)
+	require.NoError(t, h.FromArchitecture(ctx, "exempt", "00000000-0000-0000-0000-000000000000", "northeurope"))
+
+	return h
+}
+
+func TestManagementGroupUpdatePolicyExemptions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	h := newPolicyExemptionTestHierarchy(t)
+
+	pes := h.ManagementGroup("ex-grandchild").PolicyExemptionsMap()
+	require.Len(t, pes, 2)
+	assert.Equal(t, fmt.Sprintf(PolicyExemptionIDFmt, "ex-grandchild", "pe-root"), *pes["pe-root"].ID)
+	assert.Equal(
+		t,
+		fmt.Sprintf(PolicyAssignmentIDFmt, "ex-root", "pa-root"),
+		*pes["pe-root"].Properties.PolicyAssignmentID,
+	)
+	assert.Equal(
+		t,
+		fmt.Sprintf(PolicyAssignmentIDFmt, "ex-child", "pa-child"),
+		*pes["pe-child"].Properties.PolicyAssignmentID,
+	)
+	assert.Equal(t, []*string{to.Ptr("ref")}, pes["pe-child"].Properties.PolicyDefinitionReferenceIDs)
+
+	// the exempted assignment must be assigned at the management group or an ancestor.
+	_, err := h.AddManagementGroup(ctx, AddManagementGroupRequest{
+		ID:         "ex-sibling",
+		ParentID:   "ex-root",
+		Archetypes: []string{"exempt"},
+	})
+	require.ErrorContains(t, err, "references policy assignment pa-child that is not assigned at management group ex-sibling")
+	assert.Nil(t, h.ManagementGroup("ex-sibling"))
+
+	_, err = h.AddManagementGroup(ctx, AddManagementGroupRequest{
+		ID:         "ex-bad-ref",
+		ParentID:   "ex-child",
+		Archetypes: []string{"exempt-bad-ref"},
+	})
+	require.ErrorContains(t, err, "policy definition reference id nope does not exist in policy set definition psd")
+
+	_, err = h.AddManagementGroup(ctx, AddManagementGroupRequest{
+		ID:         "ex-not-set",
+		ParentID:   "ex-child",
+		Archetypes: []string{"exempt-not-set"},
+	})
+	require.ErrorContains(t, err, "policy assignment pa-root does not assign a policy set definition")
+
+	// moving the management group re-resolves the exempted assignments.
+	require.ErrorContains(t, h.MoveManagementGroup("ex-grandchild", "ex-root"), "pa-child")
+	assert.Equal(t, "ex-child", h.ManagementGroup("ex-grandchild").ParentID())
+
+	b, err := json.Marshal(h)
+	require.NoError(t, err)
+
+	loaded := NewHierarchy(nil)
+	require.NoError(t, json.Unmarshal(b, loaded))
+	assert.Equal(t, pes, loaded.ManagementGroup("ex-grandchild").PolicyExemptionsMap())
+}
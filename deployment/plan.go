@@ -0,0 +1,487 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+// PlanAction is the action required to reconcile a resource with the desired state.
+type PlanAction string
+
+const (
+	// PlanActionCreate means the resource does not exist and will be created.
+	PlanActionCreate PlanAction = "create"
+	// PlanActionUpdate means the resource exists and has property differences.
+	PlanActionUpdate PlanAction = "update"
+	// PlanActionDelete means the resource exists but is not in the desired state.
+	PlanActionDelete PlanAction = "delete"
+	// PlanActionNoOp means the resource exists and has no differences.
+	PlanActionNoOp PlanAction = "no-op"
+)
+
+// Plan is the set of changes required to reconcile a Snapshot with a Hierarchy.
+// Only management groups with changes are included.
+type Plan struct {
+	ManagementGroups map[string]*ManagementGroupPlan `json:"management_groups"`
+}
+
+// ManagementGroupPlan is the set of changes for a single management group.
+type ManagementGroupPlan struct {
+	// The action for the management group itself.
+	Action PlanAction `json:"action"`
+	// The property differences of the management group itself, e.g. display name or parent.
+	Diffs []PropertyDiff `json:"diffs,omitempty"`
+	// The changes to the assets in the management group, ordered by type and name.
+	Resources []ResourceChange `json:"resources,omitempty"`
+}
+
+// ResourceChange is the change to a single asset in a management group.
+type ResourceChange struct {
+	// The resource type, e.g. `Microsoft.Authorization/policyAssignments`.
+	Type string `json:"type"`
+	// The name of the resource.
+	Name string `json:"name"`
+	// The action required.
+	Action PlanAction `json:"action"`
+	// The property differences, only populated for updates.
+	Diffs []PropertyDiff `json:"diffs,omitempty"`
+}
+
+// PropertyDiff is a difference in a single property.
+// Path is a dot separated path to the property, array elements are denoted by `[index]`.
+// Before or After is nil if the property is absent.
+type PropertyDiff struct {
+	Path   string `json:"path"`
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+// planComparedFields are the top level asset fields that are compared when planning.
+// Other fields, e.g. `id` or `systemData`, are either derived or managed by Azure.
+var planComparedFields = []string{"identity", "location", "properties"}
+
+// planIgnoredPaths are property paths that are populated by Azure and ignored when planning.
+var planIgnoredPaths = map[string]bool{
+	"properties.metadata.createdBy": true,
+	"properties.metadata.createdOn": true,
+	"properties.metadata.updatedBy": true,
+	"properties.metadata.updatedOn": true,
+}
+
+// HasChanges reports whether the plan contains any changes.
+func (p *Plan) HasChanges() bool {
+	return len(p.ManagementGroups) > 0
+}
+
+// ManagementGroupNames returns the sorted names of the management groups with changes.
+func (p *Plan) ManagementGroupNames() []string {
+	res := make([]string, 0, len(p.ManagementGroups))
+	for name := range p.ManagementGroups {
+		res = append(res, name)
+	}
+
+	slices.Sort(res)
+
+	return res
+}
+
+// ResourcesByAction returns the resource changes with the given action.
+func (mgp *ManagementGroupPlan) ResourcesByAction(action PlanAction) []ResourceChange {
+	res := make([]ResourceChange, 0, len(mgp.Resources))
+
+	for _, rc := range mgp.Resources {
+		if rc.Action == action {
+			res = append(res, rc)
+		}
+	}
+
+	return res
+}
+
+// Plan compares the hierarchy to the supplied snapshot of existing state and returns the changes
+// required, per management group.
+// Management groups in the snapshot that are not in the hierarchy are only planned for deletion
+// if they are descendants of a management group in the hierarchy, other management groups are ignored.
+// Management groups in the hierarchy that are marked as existing are never planned for creation.
+// Policy role assignments are generated using Hierarchy.PolicyRoleAssignments, they are matched by all of their
+// fields so are only ever created or deleted.
+// Management groups, asset names, resource ids and locations are matched ignoring case, as Azure does not
+// preserve their casing.
+// If some policy role assignments could not be generated, the plan is returned with the valid ones,
+// together with an error wrapping a *PolicyRoleAssignmentErrors, so that callers can choose to issue a warning.
+func (h *Hierarchy) Plan(ctx context.Context, snapshot *Snapshot) (*Plan, error) {
+	if snapshot == nil {
+		return nil, errors.New("Hierarchy.Plan: snapshot is nil")
+	}
+
+	_, praErr := h.PolicyRoleAssignments(ctx)
+	if praErr != nil {
+		var praErrs *PolicyRoleAssignmentErrors
+		if !errors.As(praErr, &praErrs) {
+			return nil, fmt.Errorf("Hierarchy.Plan: %w", praErr)
+		}
+
+		praErr = fmt.Errorf("Hierarchy.Plan: %w", praErrs)
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	plan := &Plan{
+		ManagementGroups: make(map[string]*ManagementGroupPlan),
+	}
+
+	for name, mg := range h.mgs {
+		if err := ctxErr(ctx); err != nil {
+			return nil, err
+		}
+
+		mgPlan, err := planManagementGroup(mg, snapshot.ManagementGroup(name))
+		if err != nil {
+			return nil, fmt.Errorf("Hierarchy.Plan: management group `%s`: %w", name, err)
+		}
+
+		if mgPlan.Action != PlanActionNoOp || len(mgPlan.Resources) > 0 {
+			plan.ManagementGroups[name] = mgPlan
+		}
+	}
+
+	desired := make(map[string]*HierarchyManagementGroup, len(h.mgs))
+	for name, mg := range h.mgs {
+		desired[strings.ToLower(name)] = mg
+	}
+
+	for _, name := range snapshot.ManagementGroupNames() {
+		if _, ok := desired[strings.ToLower(name)]; ok || !snapshot.hasAncestor(name, desired) {
+			continue
+		}
+
+		existing := snapshot.ManagementGroup(name)
+
+		resources, err := planResources(nil, existing)
+		if err != nil {
+			return nil, fmt.Errorf("Hierarchy.Plan: management group `%s`: %w", name, err)
+		}
+
+		plan.ManagementGroups[name] = &ManagementGroupPlan{
+			Action:    PlanActionDelete,
+			Resources: resources,
+		}
+	}
+
+	return plan, praErr
+}
+
+// planManagementGroup compares the desired management group to the existing one,
+// which may be nil.
+func planManagementGroup(
+	mg *HierarchyManagementGroup,
+	existing *SnapshotManagementGroup,
+) (*ManagementGroupPlan, error) {
+	mgPlan := &ManagementGroupPlan{
+		Action: PlanActionNoOp,
+	}
+
+	switch {
+	case existing == nil && !mg.exists:
+		mgPlan.Action = PlanActionCreate
+	case existing != nil:
+		if existing.DisplayName != mg.displayName {
+			mgPlan.Diffs = append(mgPlan.Diffs, PropertyDiff{
+				Path:   "display_name",
+				Before: existing.DisplayName,
+				After:  mg.displayName,
+			})
+		}
+
+		if parentID := mg.ParentID(); existing.Parent == nil || !strings.EqualFold(*existing.Parent, parentID) {
+			var before any
+			if existing.Parent != nil {
+				before = *existing.Parent
+			}
+
+			mgPlan.Diffs = append(mgPlan.Diffs, PropertyDiff{
+				Path:   "parent",
+				Before: before,
+				After:  parentID,
+			})
+		}
+
+		if len(mgPlan.Diffs) > 0 {
+			mgPlan.Action = PlanActionUpdate
+		}
+	}
+
+	resources, err := planResources(mg, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	mgPlan.Resources = resources
+
+	return mgPlan, nil
+}
+
+// planResources compares the assets of the desired management group to the existing one.
+// Either may be nil.
+func planResources(mg *HierarchyManagementGroup, existing *SnapshotManagementGroup) ([]ResourceChange, error) {
+	desired := make(map[string]map[string]any)
+	current := make(map[string]map[string]json.RawMessage)
+
+	if mg != nil {
+		desired[armTypePolicyAssignment] = toAnyMap(mg.policyAssignments)
+		desired[armTypePolicyDefinition] = toAnyMap(mg.policyDefinitions)
+		desired[armTypePolicyExemption] = toAnyMap(mg.policyExemptions)
+		desired[armTypePolicySetDefinition] = toAnyMap(mg.policySetDefinitions)
+		desired[armTypeRoleDefinition] = toAnyMap(mg.roleDefinitions)
+		desired[armTypeRoleAssignment] = policyRoleAssignmentPlanAssets(mg.policyRoleAssignments.ToSlice())
+	}
+
+	if existing != nil {
+		current[armTypePolicyAssignment] = existing.PolicyAssignments
+		current[armTypePolicyDefinition] = existing.PolicyDefinitions
+		current[armTypePolicyExemption] = existing.PolicyExemptions
+		current[armTypePolicySetDefinition] = existing.PolicySetDefinitions
+		current[armTypeRoleDefinition] = existing.RoleDefinitions
+
+		ras := make(map[string]json.RawMessage, len(existing.PolicyRoleAssignments))
+
+		for k, v := range policyRoleAssignmentPlanAssets(existing.PolicyRoleAssignments) {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("planResources: snapshot policy role assignment `%s`: %w", k, err)
+			}
+
+			ras[k] = b
+		}
+
+		current[armTypeRoleAssignment] = ras
+	}
+
+	res := make([]ResourceChange, 0)
+
+	for _, typ := range []string{
+		armTypePolicyDefinition,
+		armTypePolicySetDefinition,
+		armTypeRoleDefinition,
+		armTypePolicyAssignment,
+		armTypeRoleAssignment,
+		armTypePolicyExemption,
+	} {
+		changes, err := planResourceType(typ, desired[typ], current[typ])
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, changes...)
+	}
+
+	return res, nil
+}
+
+// planResourceType compares the desired and current assets of a single type.
+// Assets are matched using the `name` property, falling back to the map key.
+func planResourceType(
+	typ string,
+	desired map[string]any,
+	current map[string]json.RawMessage,
+) ([]ResourceChange, error) {
+	desiredGeneric := make(map[string]map[string]any, len(desired))
+
+	for k, v := range desired {
+		g, err := genericJSONObject(v)
+		if err != nil {
+			return nil, fmt.Errorf("planResourceType: %s `%s`: %w", typ, k, err)
+		}
+
+		desiredGeneric[assetNameOrKey(g, k)] = g
+	}
+
+	// Azure does not preserve the casing of names, so assets are matched ignoring case.
+	currentNames := make(map[string]string, len(current))
+
+	currentGeneric := make(map[string]map[string]any, len(current))
+
+	for k, v := range current {
+		g := make(map[string]any)
+		if err := json.Unmarshal(v, &g); err != nil {
+			return nil, fmt.Errorf("planResourceType: snapshot %s `%s`: %w", typ, k, err)
+		}
+
+		name := assetNameOrKey(g, k)
+		currentGeneric[name] = g
+		currentNames[strings.ToLower(name)] = name
+	}
+
+	desiredNames := make(map[string]bool, len(desiredGeneric))
+
+	res := make([]ResourceChange, 0)
+
+	for _, name := range sortedKeys(desiredGeneric) {
+		desiredNames[strings.ToLower(name)] = true
+
+		cur, ok := currentGeneric[currentNames[strings.ToLower(name)]]
+		if !ok {
+			res = append(res, ResourceChange{Type: typ, Name: name, Action: PlanActionCreate})
+			continue
+		}
+
+		diffs := make([]PropertyDiff, 0)
+		for _, field := range planComparedFields {
+			diffJSON(field, cur[field], desiredGeneric[name][field], &diffs)
+		}
+
+		if len(diffs) > 0 {
+			res = append(res, ResourceChange{Type: typ, Name: name, Action: PlanActionUpdate, Diffs: diffs})
+		}
+	}
+
+	for _, name := range sortedKeys(currentGeneric) {
+		if !desiredNames[strings.ToLower(name)] {
+			res = append(res, ResourceChange{Type: typ, Name: name, Action: PlanActionDelete})
+		}
+	}
+
+	return res, nil
+}
+
+// diffJSON appends the differences between the generic JSON values before and after to diffs.
+// Arrays of differing length are reported as a single difference.
+func diffJSON(path string, before, after any, diffs *[]PropertyDiff) {
+	if planIgnoredPaths[path] {
+		return
+	}
+
+	switch b := before.(type) {
+	case map[string]any:
+		a, ok := after.(map[string]any)
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(a)+len(b))
+		for k := range a {
+			keys = append(keys, k)
+		}
+
+		for k := range b {
+			keys = append(keys, k)
+		}
+
+		slices.Sort(keys)
+
+		for _, k := range slices.Compact(keys) {
+			diffJSON(path+"."+k, b[k], a[k], diffs)
+		}
+
+		return
+	case []any:
+		a, ok := after.([]any)
+		if !ok || len(a) != len(b) {
+			break
+		}
+
+		for i := range b {
+			diffJSON(path+"["+strconv.Itoa(i)+"]", b[i], a[i], diffs)
+		}
+
+		return
+	}
+
+	if !planValuesEqual(path, before, after) {
+		*diffs = append(*diffs, PropertyDiff{Path: path, Before: before, After: after})
+	}
+}
+
+// planValuesEqual compares two generic JSON values.
+// Locations and resource ids are compared ignoring case, as Azure does not preserve their casing.
+func planValuesEqual(path string, before, after any) bool {
+	b, bok := before.(string)
+	a, aok := after.(string)
+
+	if bok && aok && (path == "location" || strings.HasSuffix(path, ".location") || isResourceID(b) && isResourceID(a)) {
+		return strings.EqualFold(b, a)
+	}
+
+	return reflect.DeepEqual(before, after)
+}
+
+// isResourceID reports whether the string is an Azure resource id.
+func isResourceID(s string) bool {
+	if !strings.HasPrefix(s, "/") {
+		return false
+	}
+
+	_, err := arm.ParseResourceID(s)
+
+	return err == nil
+}
+
+// genericJSONObject converts v into a generic JSON object.
+func genericJSONObject(v any) (map[string]any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	res := make(map[string]any)
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	return res, nil
+}
+
+func assetNameOrKey(asset map[string]any, key string) string {
+	if name, ok := asset["name"].(string); ok && name != "" {
+		return name
+	}
+
+	return strings.TrimSpace(key)
+}
+
+// policyRoleAssignmentPlanAssets returns the policy role assignments keyed by their deterministic name,
+// with the fields as properties.
+func policyRoleAssignmentPlanAssets(ras []PolicyRoleAssignment) map[string]any {
+	res := make(map[string]any, len(ras))
+	for _, ra := range ras {
+		name := policyRoleAssignmentPlanName(ra)
+		res[name] = map[string]any{
+			"name":       name,
+			"properties": ra,
+		}
+	}
+
+	return res
+}
+
+// policyRoleAssignmentPlanName returns the name of the policy role assignment in a plan, derived from
+// its lowercase fields so that assignments match ignoring the casing of the ids.
+func policyRoleAssignmentPlanName(ra PolicyRoleAssignment) string {
+	return policyRoleAssignmentName(PolicyRoleAssignment{
+		RoleDefinitionID:  strings.ToLower(ra.RoleDefinitionID),
+		Scope:             strings.ToLower(ra.Scope),
+		AssignmentName:    strings.ToLower(ra.AssignmentName),
+		ManagementGroupID: strings.ToLower(ra.ManagementGroupID),
+	})
+}
+
+func toAnyMap[T any](m map[string]T) map[string]any {
+	res := make(map[string]any, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+
+	return res
+}
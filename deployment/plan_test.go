@@ -0,0 +1,237 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Azure/alzlib/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// snapshotFromHierarchy creates a snapshot from the JSON representation of the hierarchy.
+func snapshotFromHierarchy(t *testing.T, h *Hierarchy) []SnapshotManagementGroup {
+	t.Helper()
+
+	mgs := make([]*HierarchyManagementGroup, 0)
+	for _, name := range h.ManagementGroupNames() {
+		mgs = append(mgs, h.ManagementGroup(name))
+	}
+
+	b, err := json.Marshal(mgs)
+	require.NoError(t, err)
+
+	var res []SnapshotManagementGroup
+	require.NoError(t, json.Unmarshal(b, &res))
+
+	return res
+}
+
+func TestPlan_NoChanges(t *testing.T) {
+	h := buildSimpleHierarchy(t)
+
+	b, err := json.Marshal(snapshotFromHierarchy(t, h))
+	require.NoError(t, err)
+
+	snapshot, err := NewSnapshot(bytes.NewReader(b))
+	require.NoError(t, err)
+
+	plan, err := h.Plan(context.Background(), snapshot)
+	require.NoError(t, err)
+	assert.False(t, plan.HasChanges())
+}
+
+func TestPlan_EmptySnapshot(t *testing.T) {
+	h := buildSimpleHierarchy(t)
+
+	snapshot, err := NewSnapshotFromManagementGroups()
+	require.NoError(t, err)
+
+	plan, err := h.Plan(context.Background(), snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"simple", "simpleoverride"}, plan.ManagementGroupNames())
+
+	mgPlan := plan.ManagementGroups["simple"]
+	assert.Equal(t, PlanActionCreate, mgPlan.Action)
+	assert.Len(t, mgPlan.ResourcesByAction(PlanActionCreate), len(mgPlan.Resources))
+	assert.Empty(t, mgPlan.ResourcesByAction(PlanActionDelete))
+}
+
+func TestPlan_Changes(t *testing.T) {
+	h := buildSimpleHierarchy(t)
+	mgs := snapshotFromHierarchy(t, h)
+
+	for i := range mgs {
+		if mgs[i].ID != "simple" {
+			continue
+		}
+
+		mgs[i].DisplayName = "old display name"
+
+		// change the effect parameter default value
+		pd := mgs[i].PolicyDefinitions["test-policy-definition"]
+		mgs[i].PolicyDefinitions["test-policy-definition"] = json.RawMessage(
+			strings.Replace(string(pd), `"defaultValue":"Deny"`, `"defaultValue":"Audit"`, 1),
+		)
+
+		// add an assignment that is not in the hierarchy
+		mgs[i].PolicyAssignments["stale-pa"] = json.RawMessage(`{"name":"stale-pa","properties":{}}`)
+	}
+
+	// add a child management group that is not in the hierarchy, and one that is unrelated
+	mgs = append(mgs,
+		SnapshotManagementGroup{ID: "stale", Parent: to.Ptr("simple")},
+		SnapshotManagementGroup{ID: "unrelated", Parent: to.Ptr("00000000-0000-0000-0000-000000000000")},
+	)
+
+	snapshot, err := NewSnapshotFromManagementGroups(mgs...)
+	require.NoError(t, err)
+
+	plan, err := h.Plan(context.Background(), snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"simple", "stale"}, plan.ManagementGroupNames())
+	assert.Equal(t, PlanActionDelete, plan.ManagementGroups["stale"].Action)
+
+	mgPlan := plan.ManagementGroups["simple"]
+	assert.Equal(t, PlanActionUpdate, mgPlan.Action)
+	assert.Equal(t, []PropertyDiff{{Path: "display_name", Before: "old display name", After: "simple"}}, mgPlan.Diffs)
+
+	assert.Equal(t, []ResourceChange{{
+		Type:   armTypePolicyAssignment,
+		Name:   "stale-pa",
+		Action: PlanActionDelete,
+	}}, mgPlan.ResourcesByAction(PlanActionDelete))
+
+	updates := mgPlan.ResourcesByAction(PlanActionUpdate)
+	require.Len(t, updates, 1)
+	assert.Equal(t, "test-policy-definition", updates[0].Name)
+	assert.Equal(t, []PropertyDiff{{
+		Path:   "properties.parameters.effect.defaultValue",
+		Before: "Audit",
+		After:  "Deny",
+	}}, updates[0].Diffs)
+}
+
+func TestNewSnapshotFromManagementGroups_Duplicate(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewSnapshotFromManagementGroups(
+		SnapshotManagementGroup{ID: "a"},
+		SnapshotManagementGroup{ID: "a"},
+	)
+	require.ErrorContains(t, err, "duplicate management group `a`")
+}
+
+func TestPlan_PolicyRoleAssignmentsAndExemptions(t *testing.T) {
+	h := newPolicyExemptionTestHierarchy(t)
+	_, err := h.PolicyRoleAssignments(context.Background())
+	require.NoError(t, err)
+
+	mgs := snapshotFromHierarchy(t, h)
+	stale := PolicyRoleAssignment{
+		RoleDefinitionID:  "/providers/Microsoft.Authorization/roleDefinitions/00000000-0000-0000-0000-000000000000",
+		Scope:             "/providers/Microsoft.Management/managementGroups/ex-grandchild",
+		AssignmentName:    "stale-pa",
+		ManagementGroupID: "ex-grandchild",
+	}
+
+	for i := range mgs {
+		if mgs[i].ID != "ex-grandchild" {
+			continue
+		}
+
+		require.Contains(t, mgs[i].PolicyExemptions, "pe-child")
+		delete(mgs[i].PolicyExemptions, "pe-child")
+		mgs[i].PolicyRoleAssignments = append(mgs[i].PolicyRoleAssignments, stale)
+	}
+
+	snapshot, err := NewSnapshotFromManagementGroups(mgs...)
+	require.NoError(t, err)
+
+	plan, err := h.Plan(context.Background(), snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ex-grandchild"}, plan.ManagementGroupNames())
+
+	mgPlan := plan.ManagementGroups["ex-grandchild"]
+	assert.Equal(t, []ResourceChange{{
+		Type:   armTypePolicyExemption,
+		Name:   "pe-child",
+		Action: PlanActionCreate,
+	}}, mgPlan.ResourcesByAction(PlanActionCreate))
+	assert.Equal(t, []ResourceChange{{
+		Type:   armTypeRoleAssignment,
+		Name:   policyRoleAssignmentPlanName(stale),
+		Action: PlanActionDelete,
+	}}, mgPlan.ResourcesByAction(PlanActionDelete))
+}
+
+func TestNewSnapshot_HierarchyFormat(t *testing.T) {
+	h := buildSimpleHierarchy(t)
+
+	b, err := json.Marshal(h)
+	require.NoError(t, err)
+
+	snapshot, err := NewSnapshot(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, h.ManagementGroupNames(), snapshot.ManagementGroupNames())
+
+	plan, err := h.Plan(context.Background(), snapshot)
+	require.NoError(t, err)
+	assert.False(t, plan.HasChanges())
+
+	_, err = NewSnapshot(strings.NewReader(`{"format_version": 99, "management_groups": []}`))
+	require.ErrorContains(t, err, "unsupported hierarchy format version 99")
+}
+
+func TestNewSnapshot_ExportFormat(t *testing.T) {
+	snapshot, err := NewSnapshot(strings.NewReader(testExport))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"corp", "root"}, snapshot.ManagementGroupNames())
+	assert.Len(t, snapshot.ManagementGroup("corp").PolicyAssignments, 3)
+	assert.Equal(t, to.Ptr("root"), snapshot.ManagementGroup("corp").Parent)
+
+	var export struct {
+		Value json.RawMessage `json:"value"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(testExport), &export))
+
+	array, err := NewSnapshot(bytes.NewReader(export.Value))
+	require.NoError(t, err, "an export can also be a JSON array of resources")
+	assert.Equal(t, snapshot.ManagementGroupNames(), array.ManagementGroupNames())
+}
+
+func TestPlan_IgnoresCase(t *testing.T) {
+	h := buildSimpleHierarchy(t)
+	mgs := snapshotFromHierarchy(t, h)
+
+	for i := range mgs {
+		mgs[i].ID = strings.ToUpper(mgs[i].ID)
+
+		for _, name := range sortedKeys(mgs[i].PolicyAssignments) {
+			pa := mgs[i].PolicyAssignments[name]
+			s := strings.ReplaceAll(string(pa), `"location":"northeurope"`, `"location":"NorthEurope"`)
+			s = strings.ReplaceAll(s, "/providers/Microsoft.Management/managementGroups/",
+				"/providers/microsoft.management/managementgroups/")
+			require.NotEqual(t, string(pa), s, "the snapshot assignment is changed")
+
+			mgs[i].PolicyAssignments[strings.ToUpper(name)] = json.RawMessage(strings.Replace(
+				s, `"name":"`+name+`"`, `"name":"`+strings.ToUpper(name)+`"`, 1,
+			))
+			delete(mgs[i].PolicyAssignments, name)
+		}
+	}
+
+	snapshot, err := NewSnapshotFromManagementGroups(mgs...)
+	require.NoError(t, err)
+
+	plan, err := h.Plan(context.Background(), snapshot)
+	require.NoError(t, err)
+	assert.False(t, plan.HasChanges(), "ids, names and locations are compared ignoring case")
+}
@@ -0,0 +1,395 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/brunoga/deep"
+)
+
+// PolicyAssignmentSelector selects policy assignments in a hierarchy, e.g. for Hierarchy.ModifyPolicyAssignments.
+// It is called with the management group and the name of a policy assignment in the management group.
+// The hierarchy lock is held when the selector is called, so it must not call methods of the Hierarchy.
+type PolicyAssignmentSelector func(mg *HierarchyManagementGroup, name string) (bool, error)
+
+// PolicyAssignmentRef identifies a policy assignment in a management group of a hierarchy.
+type PolicyAssignmentRef struct {
+	ManagementGroupID    string `json:"management_group_id"`
+	PolicyAssignmentName string `json:"policy_assignment_name"`
+}
+
+// PolicyAssignmentChange is a policy assignment that was changed by Hierarchy.ModifyPolicyAssignments,
+// with the differences in its properties.
+type PolicyAssignmentChange struct {
+	PolicyAssignmentRef
+	Diffs []PropertyDiff `json:"diffs"`
+}
+
+// SelectByPolicyAssignmentName selects the policy assignments whose name matches any of the glob patterns,
+// compared case insensitively. See path.Match for the pattern syntax.
+func SelectByPolicyAssignmentName(patterns ...string) PolicyAssignmentSelector {
+	return func(_ *HierarchyManagementGroup, name string) (bool, error) {
+		for _, pattern := range patterns {
+			ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+			if err != nil {
+				return false, fmt.Errorf("policy assignment name pattern `%s`: %w", pattern, err)
+			}
+
+			if ok {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+}
+
+// SelectByReferencedDefinition selects the policy assignments that directly reference a policy definition or
+// policy set definition with any of the names, compared case insensitively.
+// Policy definitions that are only referenced through a policy set definition are not matched.
+func SelectByReferencedDefinition(names ...string) PolicyAssignmentSelector {
+	return func(mg *HierarchyManagementGroup, name string) (bool, error) {
+		ref, _, err := mg.policyAssignments[name].ReferencedPolicyDefinitionResourceIDAndVersion()
+		if err != nil {
+			return false, fmt.Errorf("policy assignment `%s` in management group `%s`: %w", name, mg.id, err)
+		}
+
+		return slices.ContainsFunc(names, func(n string) bool {
+			return strings.EqualFold(n, ref.Name)
+		}), nil
+	}
+}
+
+// SelectByManagementGroupSubtree selects the policy assignments in the management group with the id,
+// or in any of its descendants.
+func SelectByManagementGroupSubtree(id string) PolicyAssignmentSelector {
+	return func(mg *HierarchyManagementGroup, _ string) (bool, error) {
+		for m := mg; m != nil; m = m.parent {
+			if m.id == id {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+}
+
+// SelectByManagementGroupLevel selects the policy assignments in management groups at any of the levels,
+// see HierarchyManagementGroup.Level.
+func SelectByManagementGroupLevel(levels ...int) PolicyAssignmentSelector {
+	return func(mg *HierarchyManagementGroup, _ string) (bool, error) {
+		return slices.Contains(levels, mg.level), nil
+	}
+}
+
+// SelectByArchetype selects the policy assignments in management groups that were built from any of the
+// archetypes, see HierarchyManagementGroup.Archetypes.
+func SelectByArchetype(names ...string) PolicyAssignmentSelector {
+	return func(mg *HierarchyManagementGroup, _ string) (bool, error) {
+		return mg.archetypes.ContainsAny(names...), nil
+	}
+}
+
+// SelectByEffect selects the policy assignments where any of the assigned policy definitions has one of the
+// effects, compared case insensitively.
+// Effects that are parameter references are resolved using the parameter values of the assignment and,
+// for policy set definitions, of the policy definition reference, falling back to the default values.
+func SelectByEffect(effects ...string) PolicyAssignmentSelector {
+	return func(mg *HierarchyManagementGroup, name string) (bool, error) {
+		assigned, err := mg.hierarchy.policyAssignmentEffects(mg.policyAssignments[name])
+		if err != nil {
+			return false, fmt.Errorf("policy assignment `%s` in management group `%s`: %w", name, mg.id, err)
+		}
+
+		return slices.ContainsFunc(assigned, func(effect string) bool {
+			return slices.ContainsFunc(effects, func(e string) bool {
+				return strings.EqualFold(e, effect)
+			})
+		}), nil
+	}
+}
+
+// SelectPolicyAssignments returns the policy assignments in the hierarchy that match all of the selectors,
+// or all policy assignments if no selectors are supplied.
+// The result is sorted by management group id, then by policy assignment name.
+func (h *Hierarchy) SelectPolicyAssignments(selectors ...PolicyAssignmentSelector) ([]PolicyAssignmentRef, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	res, err := h.selectPolicyAssignments(selectors)
+	if err != nil {
+		return nil, fmt.Errorf("Hierarchy.SelectPolicyAssignments: %w", err)
+	}
+
+	return res, nil
+}
+
+// SetEnforcementMode sets the enforcement mode of the policy assignments in the hierarchy that match all of
+// the selectors, or of all policy assignments if no selectors are supplied.
+// This supports staged rollouts, e.g. first deploy all assignments as `DoNotEnforce`, then set `Default`
+// one management group level at a time.
+// It returns the policy assignments that were changed, sorted as SelectPolicyAssignments.
+// If a selector returns an error, no policy assignments are changed.
+func (h *Hierarchy) SetEnforcementMode(
+	mode armpolicy.EnforcementMode,
+	selectors ...PolicyAssignmentSelector,
+) ([]PolicyAssignmentRef, error) {
+	if !slices.Contains(armpolicy.PossibleEnforcementModeValues(), mode) {
+		return nil, fmt.Errorf(
+			"Hierarchy.SetEnforcementMode: enforcement mode `%s` is invalid, must be one of %v",
+			mode,
+			armpolicy.PossibleEnforcementModeValues(),
+		)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	changes, err := h.modifyPolicyAssignments(selectors, []ModifyPolicyAssignmentOption{
+		func(mg *HierarchyManagementGroup, name string) error {
+			return WithEnforcementMode(to.Ptr(mode))(mg, name)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Hierarchy.SetEnforcementMode: %w", err)
+	}
+
+	res := make([]PolicyAssignmentRef, len(changes))
+	for i, c := range changes {
+		res[i] = c.PolicyAssignmentRef
+	}
+
+	return res, nil
+}
+
+// ModifyPolicyAssignments applies the options to the policy assignments in the hierarchy that match all of the
+// selectors, or to all policy assignments if no selectors are supplied, see
+// HierarchyManagementGroup.ModifyPolicyAssignment.
+// It returns the policy assignments that were changed, with their property differences, sorted as
+// SelectPolicyAssignments. Selected policy assignments that are unchanged by the options are omitted.
+// If a selector or an option returns an error, no policy assignments are changed.
+func (h *Hierarchy) ModifyPolicyAssignments(
+	selectors []PolicyAssignmentSelector,
+	opts ...ModifyPolicyAssignmentOption,
+) ([]PolicyAssignmentChange, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	res, err := h.modifyPolicyAssignments(selectors, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Hierarchy.ModifyPolicyAssignments: %w", err)
+	}
+
+	return res, nil
+}
+
+// modifyPolicyAssignments applies the options to the selected policy assignments and returns the changes.
+// On error, the modified policy assignments are restored. The caller must hold the hierarchy lock.
+func (h *Hierarchy) modifyPolicyAssignments(
+	selectors []PolicyAssignmentSelector,
+	opts []ModifyPolicyAssignmentOption,
+) ([]PolicyAssignmentChange, error) {
+	selected, err := h.selectPolicyAssignments(selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	originals := make(map[PolicyAssignmentRef]assets.PolicyAssignment, len(selected))
+	restore := func() {
+		for ref, pa := range originals {
+			*h.mgs[ref.ManagementGroupID].policyAssignments[ref.PolicyAssignmentName] = pa
+		}
+	}
+
+	res := make([]PolicyAssignmentChange, 0, len(selected))
+
+	for _, ref := range selected {
+		mg := h.mgs[ref.ManagementGroupID]
+		pa := mg.policyAssignments[ref.PolicyAssignmentName]
+
+		before, err := genericJSONObject(pa)
+		if err != nil {
+			restore()
+
+			return nil, fmt.Errorf("policy assignment `%s` in management group `%s`: %w", ref.PolicyAssignmentName, mg.id, err)
+		}
+
+		originals[ref] = deep.MustCopy(*pa)
+
+		if err := mg.ModifyPolicyAssignment(ref.PolicyAssignmentName, opts...); err != nil {
+			restore()
+
+			return nil, err
+		}
+
+		after, err := genericJSONObject(pa)
+		if err != nil {
+			restore()
+
+			return nil, fmt.Errorf("policy assignment `%s` in management group `%s`: %w", ref.PolicyAssignmentName, mg.id, err)
+		}
+
+		diffs := make([]PropertyDiff, 0)
+		for _, field := range planComparedFields {
+			diffJSON(field, before[field], after[field], &diffs)
+		}
+
+		if len(diffs) > 0 {
+			res = append(res, PolicyAssignmentChange{PolicyAssignmentRef: ref, Diffs: diffs})
+		}
+	}
+
+	return res, nil
+}
+
+// selectPolicyAssignments returns the policy assignments that match all of the selectors.
+// The caller must hold the hierarchy lock.
+func (h *Hierarchy) selectPolicyAssignments(selectors []PolicyAssignmentSelector) ([]PolicyAssignmentRef, error) {
+	res := make([]PolicyAssignmentRef, 0)
+
+	for _, mgID := range slices.Sorted(maps.Keys(h.mgs)) {
+		mg := h.mgs[mgID]
+
+		for _, name := range slices.Sorted(maps.Keys(mg.policyAssignments)) {
+			selected := true
+
+			for _, selector := range selectors {
+				ok, err := selector(mg, name)
+				if err != nil {
+					return nil, err
+				}
+
+				if !ok {
+					selected = false
+
+					break
+				}
+			}
+
+			if selected {
+				res = append(res, PolicyAssignmentRef{ManagementGroupID: mgID, PolicyAssignmentName: name})
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// policyAssignmentEffects returns the sorted, unique, effects of the policy definitions assigned by the
+// policy assignment. The caller must hold the hierarchy lock.
+func (h *Hierarchy) policyAssignmentEffects(pa *assets.PolicyAssignment) ([]string, error) {
+	if h.alzlib == nil {
+		return nil, errors.New("hierarchy has no AlzLib to resolve policy definitions")
+	}
+
+	ref, ver, err := pa.ReferencedPolicyDefinitionResourceIDAndVersion()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	switch strings.ToLower(ref.ResourceType.Type) {
+	case alzlib.PolicyDefinitionsType:
+		pd := h.policyDefinition(ref, ver)
+		if pd == nil {
+			return nil, fmt.Errorf("referenced policy definition `%s` not found", ref.Name)
+		}
+
+		effect, err := pd.Effect(pa.Properties.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("policy definition `%s`: %w", ref.Name, err)
+		}
+
+		return []string{effect}, nil
+	case alzlib.PolicySetDefinitionsType:
+		psd := h.policySetDefinition(ref, ver)
+		if psd == nil {
+			return nil, fmt.Errorf("referenced policy set definition `%s` not found", ref.Name)
+		}
+
+		effects := make([]string, 0, len(psd.PolicyDefinitionReferences()))
+
+		for _, pdRef := range psd.PolicyDefinitionReferences() {
+			if pdRef.PolicyDefinitionID == nil {
+				continue
+			}
+
+			id, err := arm.ParseResourceID(*pdRef.PolicyDefinitionID)
+			if err != nil {
+				return nil, fmt.Errorf("policy set definition `%s`: %w", ref.Name, err)
+			}
+
+			pd := h.policyDefinition(id, pdRef.DefinitionVersion)
+			if pd == nil {
+				return nil, fmt.Errorf("policy set definition `%s`: policy definition `%s` not found", ref.Name, id.Name)
+			}
+
+			effect, err := pd.Effect(policySetReferenceParameters(psd, pdRef, pa.Properties.Parameters))
+			if err != nil {
+				return nil, fmt.Errorf("policy set definition `%s`: policy definition `%s`: %w", ref.Name, id.Name, err)
+			}
+
+			effects = append(effects, effect)
+		}
+
+		slices.SortFunc(effects, func(a, b string) int {
+			return cmp.Compare(strings.ToLower(a), strings.ToLower(b))
+		})
+
+		return slices.CompactFunc(effects, strings.EqualFold), nil
+	}
+
+	return nil, fmt.Errorf("unexpected referenced resource type `%s`", ref.ResourceType.Type)
+}
+
+// policySetReferenceParameters returns the parameter values passed to the referenced policy definition.
+// Values that are references to a policy set definition parameter are replaced with the value of the parameter
+// in the assignment, or its default value. References that have neither are omitted.
+func policySetReferenceParameters(
+	psd *assets.PolicySetDefinition,
+	pdRef *armpolicy.DefinitionReference,
+	assignmentParams map[string]*armpolicy.ParameterValuesValue,
+) map[string]*armpolicy.ParameterValuesValue {
+	res := make(map[string]*armpolicy.ParameterValuesValue, len(pdRef.Parameters))
+
+	for name, pv := range pdRef.Parameters {
+		if pv == nil {
+			continue
+		}
+
+		s, ok := pv.Value.(string)
+		if !ok {
+			res[name] = pv
+			continue
+		}
+
+		setParam, ok := assets.ParameterReference(s)
+		if !ok {
+			res[name] = pv
+			continue
+		}
+
+		if apv, ok := assignmentParams[setParam]; ok && apv != nil && apv.Value != nil {
+			res[name] = apv
+			continue
+		}
+
+		if def := psd.Parameter(setParam); def != nil && def.DefaultValue != nil {
+			res[name] = &armpolicy.ParameterValuesValue{Value: def.DefaultValue}
+		}
+	}
+
+	return res
+}
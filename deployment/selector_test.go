@@ -0,0 +1,139 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHierarchySelectPolicyAssignments(t *testing.T) {
+	t.Parallel()
+
+	h := newEffectivePolicyTestHierarchy(t)
+	root := PolicyAssignmentRef{ManagementGroupID: "root", PolicyAssignmentName: "pa-root"}
+	child := PolicyAssignmentRef{ManagementGroupID: "child", PolicyAssignmentName: "pa-child"}
+
+	testCases := []struct {
+		name      string
+		selectors []PolicyAssignmentSelector
+		want      []PolicyAssignmentRef
+	}{
+		{name: "all", want: []PolicyAssignmentRef{child, root}},
+		{name: "level", selectors: []PolicyAssignmentSelector{SelectByManagementGroupLevel(1)}, want: []PolicyAssignmentRef{child}},
+		{name: "archetype", selectors: []PolicyAssignmentSelector{SelectByArchetype("root")}, want: []PolicyAssignmentRef{root}},
+		{name: "effect", selectors: []PolicyAssignmentSelector{SelectByEffect("Audit")}, want: []PolicyAssignmentRef{child, root}},
+		{name: "no effect", selectors: []PolicyAssignmentSelector{SelectByEffect("Deny")}, want: []PolicyAssignmentRef{}},
+		{
+			name:      "and",
+			selectors: []PolicyAssignmentSelector{SelectByEffect("audit"), SelectByManagementGroupLevel(0)},
+			want:      []PolicyAssignmentRef{root},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := h.SelectPolicyAssignments(tc.selectors...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestHierarchySetEnforcementMode(t *testing.T) {
+	t.Parallel()
+
+	h := newEffectivePolicyTestHierarchy(t)
+
+	_, err := h.SetEnforcementMode("Sometimes")
+	require.ErrorContains(t, err, "enforcement mode `Sometimes` is invalid")
+
+	_, err = h.SetEnforcementMode(armpolicy.EnforcementModeDoNotEnforce,
+		func(_ *HierarchyManagementGroup, _ string) (bool, error) {
+			return false, errors.New("boom")
+		})
+	require.ErrorContains(t, err, "boom")
+
+	changed, err := h.SetEnforcementMode(armpolicy.EnforcementModeDoNotEnforce, SelectByArchetype("child"))
+	require.NoError(t, err)
+	assert.Equal(t, []PolicyAssignmentRef{{ManagementGroupID: "child", PolicyAssignmentName: "pa-child"}}, changed)
+	assert.Equal(t,
+		armpolicy.EnforcementModeDoNotEnforce,
+		*h.ManagementGroup("child").PolicyAssignmentMap()["pa-child"].Properties.EnforcementMode,
+	)
+	assert.Equal(t,
+		armpolicy.EnforcementModeDefault,
+		*h.ManagementGroup("root").PolicyAssignmentMap()["pa-root"].Properties.EnforcementMode,
+	)
+
+	changed, err = h.SetEnforcementMode(armpolicy.EnforcementModeDoNotEnforce)
+	require.NoError(t, err)
+	assert.Equal(t, []PolicyAssignmentRef{{ManagementGroupID: "root", PolicyAssignmentName: "pa-root"}}, changed)
+}
+
+func TestHierarchyManagementGroupArchetypes(t *testing.T) {
+	t.Parallel()
+
+	h := newEffectivePolicyTestHierarchy(t)
+	assert.Equal(t, []string{"child"}, h.ManagementGroup("child").Archetypes())
+
+	b, err := json.Marshal(h)
+	require.NoError(t, err)
+
+	loaded := NewHierarchy(nil)
+	require.NoError(t, json.Unmarshal(b, loaded))
+	assert.Equal(t, []string{"child"}, loaded.ManagementGroup("child").Archetypes())
+}
+
+func TestHierarchyModifyPolicyAssignments(t *testing.T) {
+	t.Parallel()
+
+	h := newEffectivePolicyTestHierarchy(t)
+	notScope := "/subscriptions/00000000-0000-0000-0000-000000000001"
+
+	changes, err := h.ModifyPolicyAssignments(
+		[]PolicyAssignmentSelector{SelectByPolicyAssignmentName("PA-*"), SelectByManagementGroupSubtree("child")},
+		WithNotScopes([]*string{&notScope}),
+	)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, PolicyAssignmentRef{ManagementGroupID: "child", PolicyAssignmentName: "pa-child"}, changes[0].PolicyAssignmentRef)
+	require.Len(t, changes[0].Diffs, 1)
+	assert.Equal(t, "properties.notScopes", changes[0].Diffs[0].Path)
+
+	changes, err = h.ModifyPolicyAssignments(
+		[]PolicyAssignmentSelector{SelectByReferencedDefinition("PSD")},
+		WithNotScopes([]*string{&notScope}),
+	)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	_, err = h.ModifyPolicyAssignments([]PolicyAssignmentSelector{SelectByPolicyAssignmentName("[")})
+	require.ErrorContains(t, err, "policy assignment name pattern `[`")
+
+	_, err = h.ModifyPolicyAssignments(nil,
+		WithEnforcementMode(to.Ptr(armpolicy.EnforcementModeDoNotEnforce)),
+		func(_ *HierarchyManagementGroup, name string) error {
+			if name == "pa-root" {
+				return errors.New("boom")
+			}
+
+			return nil
+		},
+	)
+	require.ErrorContains(t, err, "boom")
+	assert.Equal(t,
+		armpolicy.EnforcementModeDefault,
+		*h.ManagementGroup("child").PolicyAssignmentMap()["pa-child"].Properties.EnforcementMode,
+		"modified policy assignments are restored on error",
+	)
+}
@@ -0,0 +1,245 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/Azure/alzlib"
+)
+
+// Snapshot represents the existing state of a management group hierarchy, e.g. exported from Azure.
+// It is used as the baseline when planning the changes of a Hierarchy, see Hierarchy.Plan.
+// Do not create this struct directly, use NewSnapshot or NewSnapshotFromManagementGroups instead.
+type Snapshot struct {
+	mgs map[string]*SnapshotManagementGroup
+}
+
+// SnapshotManagementGroup represents an existing management group and the assets deployed at its scope.
+// The JSON representation matches that of HierarchyManagementGroup, so the output of a previous
+// `alzlibtool generate architecture` run can be used as a snapshot.
+// Assets are stored as raw JSON and are keyed by name.
+type SnapshotManagementGroup struct {
+	// The name of the management group, forming the last part of the resource id.
+	ID string `json:"id"`
+	// The display name of the management group.
+	DisplayName string `json:"display_name,omitempty"`
+	// The id of the parent management group.
+	Parent *string `json:"parent,omitempty"`
+	// The policy assignments in the management group.
+	PolicyAssignments map[string]json.RawMessage `json:"policy_assignments,omitempty"`
+	// The policy definitions in the management group.
+	PolicyDefinitions map[string]json.RawMessage `json:"policy_definitions,omitempty"`
+	// The policy exemptions in the management group.
+	PolicyExemptions map[string]json.RawMessage `json:"policy_exemptions,omitempty"`
+	// The additional role assignments for the policy assignments in the management group.
+	PolicyRoleAssignments []PolicyRoleAssignment `json:"policy_role_assignments,omitempty"`
+	// The policy set definitions in the management group.
+	PolicySetDefinitions map[string]json.RawMessage `json:"policy_set_definitions,omitempty"`
+	// The role definitions in the management group.
+	RoleDefinitions map[string]json.RawMessage `json:"role_definitions,omitempty"`
+}
+
+// NewSnapshot reads a snapshot from r. The input is one of:
+//
+//   - a JSON array of management groups, see SnapshotManagementGroup,
+//     e.g. the JSON output of `alzlibtool generate architecture`;
+//   - the versioned serialization of a Hierarchy, see Hierarchy.MarshalJSON;
+//   - an export of existing management groups and Microsoft.Authorization resources, see NewHierarchyFromExport.
+//     Role assignments are not read from an export, so policy role assignments are planned for creation.
+func NewSnapshot(r io.Reader) (*Snapshot, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("NewSnapshot: reading snapshot: %w", err)
+	}
+
+	var mgs []SnapshotManagementGroup
+
+	switch snapshotFormat(b) {
+	case snapshotFormatHierarchy:
+		var tmp struct {
+			FormatVersion    int                       `json:"format_version"`
+			ManagementGroups []SnapshotManagementGroup `json:"management_groups"`
+		}
+
+		if err := json.Unmarshal(b, &tmp); err != nil {
+			return nil, fmt.Errorf("NewSnapshot: decoding hierarchy: %w", err)
+		}
+
+		if tmp.FormatVersion < 1 || tmp.FormatVersion > HierarchyFormatVersion {
+			return nil, fmt.Errorf(
+				"NewSnapshot: unsupported hierarchy format version %d, supported versions are 1 to %d",
+				tmp.FormatVersion,
+				HierarchyFormatVersion,
+			)
+		}
+
+		mgs = tmp.ManagementGroups
+	case snapshotFormatExport:
+		h, err := NewHierarchyFromExport(alzlib.NewAlzLib(nil), bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("NewSnapshot: %w", err)
+		}
+
+		s, err := NewSnapshotFromHierarchy(h)
+		if err != nil {
+			return nil, fmt.Errorf("NewSnapshot: %w", err)
+		}
+
+		return s, nil
+	default:
+		if err := json.Unmarshal(b, &mgs); err != nil {
+			return nil, fmt.Errorf("NewSnapshot: decoding snapshot: %w", err)
+		}
+	}
+
+	s, err := NewSnapshotFromManagementGroups(mgs...)
+	if err != nil {
+		return nil, fmt.Errorf("NewSnapshot: %w", err)
+	}
+
+	return s, nil
+}
+
+// NewSnapshotFromHierarchy creates a snapshot of the management groups in the hierarchy,
+// e.g. one loaded with Hierarchy.UnmarshalJSON or NewHierarchyFromExport.
+func NewSnapshotFromHierarchy(h *Hierarchy) (*Snapshot, error) {
+	if h == nil {
+		return nil, errors.New("NewSnapshotFromHierarchy: hierarchy is nil")
+	}
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("NewSnapshotFromHierarchy: marshaling hierarchy: %w", err)
+	}
+
+	var tmp struct {
+		ManagementGroups []SnapshotManagementGroup `json:"management_groups"`
+	}
+
+	if err := json.Unmarshal(b, &tmp); err != nil {
+		return nil, fmt.Errorf("NewSnapshotFromHierarchy: decoding hierarchy: %w", err)
+	}
+
+	s, err := NewSnapshotFromManagementGroups(tmp.ManagementGroups...)
+	if err != nil {
+		return nil, fmt.Errorf("NewSnapshotFromHierarchy: %w", err)
+	}
+
+	return s, nil
+}
+
+const (
+	snapshotFormatManagementGroups = iota
+	snapshotFormatHierarchy
+	snapshotFormatExport
+)
+
+// snapshotFormat detects the format of the snapshot, see NewSnapshot.
+// Objects with a `format_version` are hierarchies and objects with a `value` array are exports.
+// Arrays are exports if their first member has a resource `type`, otherwise management groups.
+func snapshotFormat(b []byte) int {
+	var probe struct {
+		FormatVersion *int            `json:"format_version"`
+		Value         json.RawMessage `json:"value"`
+		Type          string          `json:"type"`
+	}
+
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 {
+		return snapshotFormatManagementGroups
+	}
+
+	switch trimmed[0] {
+	case '{':
+		if json.Unmarshal(trimmed, &probe) != nil {
+			return snapshotFormatManagementGroups
+		}
+
+		if probe.FormatVersion != nil {
+			return snapshotFormatHierarchy
+		}
+
+		if probe.Value != nil {
+			return snapshotFormatExport
+		}
+	case '[':
+		var members []json.RawMessage
+		if json.Unmarshal(trimmed, &members) != nil || len(members) == 0 {
+			return snapshotFormatManagementGroups
+		}
+
+		if json.Unmarshal(members[0], &probe) == nil && probe.Type != "" {
+			return snapshotFormatExport
+		}
+	}
+
+	return snapshotFormatManagementGroups
+}
+
+// NewSnapshotFromManagementGroups creates a snapshot from the supplied management groups.
+// Management group ids must be unique, ignoring case.
+func NewSnapshotFromManagementGroups(mgs ...SnapshotManagementGroup) (*Snapshot, error) {
+	s := &Snapshot{
+		mgs: make(map[string]*SnapshotManagementGroup, len(mgs)),
+	}
+
+	for i := range mgs {
+		mg := mgs[i]
+		if mg.ID == "" {
+			return nil, fmt.Errorf("NewSnapshotFromManagementGroups: management group at index %d has no id", i)
+		}
+
+		if _, exists := s.mgs[strings.ToLower(mg.ID)]; exists {
+			return nil, fmt.Errorf("NewSnapshotFromManagementGroups: duplicate management group `%s`", mg.ID)
+		}
+
+		s.mgs[strings.ToLower(mg.ID)] = &mg
+	}
+
+	return s, nil
+}
+
+// ManagementGroup returns the management group with the given name, ignoring case, or nil if it does not exist.
+func (s *Snapshot) ManagementGroup(name string) *SnapshotManagementGroup {
+	return s.mgs[strings.ToLower(name)]
+}
+
+// ManagementGroupNames returns the sorted management group names in the snapshot.
+func (s *Snapshot) ManagementGroupNames() []string {
+	res := make([]string, 0, len(s.mgs))
+	for _, mg := range s.mgs {
+		res = append(res, mg.ID)
+	}
+
+	slices.Sort(res)
+
+	return res
+}
+
+// hasAncestor reports whether the management group has any of the supplied management groups
+// as an ancestor, using the parent links in the snapshot. The ancestors are keyed by lowercase id.
+func (s *Snapshot) hasAncestor(name string, ancestors map[string]*HierarchyManagementGroup) bool {
+	seen := make(map[string]bool)
+
+	for mg := s.ManagementGroup(name); mg != nil && mg.Parent != nil; mg = s.ManagementGroup(*mg.Parent) {
+		if seen[strings.ToLower(mg.ID)] {
+			return false
+		}
+
+		seen[strings.ToLower(mg.ID)] = true
+
+		if _, ok := ancestors[strings.ToLower(*mg.Parent)]; ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Subscriptions returns the sorted subscription ids, or placeholders, placed in the management group.
+func (mg *HierarchyManagementGroup) Subscriptions() []string {
+	res := mg.subscriptions.ToSlice()
+	slices.Sort(res)
+
+	return res
+}
+
+// AddSubscription places the subscription in the management group.
+// The subscription can be an id or a placeholder that is replaced later, e.g. by the consumer of a writer's output.
+// A subscription can only be placed in one management group, remove it first to move it.
+func (h *Hierarchy) AddSubscription(subscriptionID, managementGroupID string) error {
+	if subscriptionID == "" {
+		return errors.New("Hierarchy.AddSubscription: subscription id is empty")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	mg, ok := h.mgs[managementGroupID]
+	if !ok {
+		return fmt.Errorf("Hierarchy.AddSubscription: management group `%s` not found", managementGroupID)
+	}
+
+	if other := h.subscriptionManagementGroup(subscriptionID); other != nil {
+		return fmt.Errorf(
+			"Hierarchy.AddSubscription: subscription `%s` is already in management group `%s`",
+			subscriptionID,
+			other.id,
+		)
+	}
+
+	mg.subscriptions.Add(subscriptionID)
+
+	return nil
+}
+
+// RemoveSubscription removes the subscription from the management group that it is placed in.
+func (h *Hierarchy) RemoveSubscription(subscriptionID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	mg := h.subscriptionManagementGroup(subscriptionID)
+	if mg == nil {
+		return fmt.Errorf("Hierarchy.RemoveSubscription: subscription `%s` not found", subscriptionID)
+	}
+
+	for _, sub := range mg.subscriptions.ToSlice() {
+		if strings.EqualFold(sub, subscriptionID) {
+			mg.subscriptions.Remove(sub)
+		}
+	}
+
+	return nil
+}
+
+// SubscriptionManagementGroup returns the management group that the subscription is placed in,
+// or nil if the subscription is not in the hierarchy.
+func (h *Hierarchy) SubscriptionManagementGroup(subscriptionID string) *HierarchyManagementGroup {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.subscriptionManagementGroup(subscriptionID)
+}
+
+// EffectivePolicyAssignmentsForSubscription returns the policy assignments in effect at the subscription,
+// based on the management group that it is placed in.
+// See HierarchyManagementGroup.EffectivePolicyAssignmentsForSubscription for details.
+func (h *Hierarchy) EffectivePolicyAssignmentsForSubscription(
+	subscriptionID string,
+) ([]*EffectivePolicyAssignment, error) {
+	mg := h.SubscriptionManagementGroup(subscriptionID)
+	if mg == nil {
+		return nil, fmt.Errorf(
+			"Hierarchy.EffectivePolicyAssignmentsForSubscription: subscription `%s` not found",
+			subscriptionID,
+		)
+	}
+
+	res, err := mg.EffectivePolicyAssignmentsForSubscription(subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("Hierarchy.EffectivePolicyAssignmentsForSubscription: %w", err)
+	}
+
+	return res, nil
+}
+
+// subscriptionManagementGroup returns the management group that the subscription is placed in, or nil.
+// Subscription ids are compared case insensitively. The caller must hold the hierarchy lock.
+func (h *Hierarchy) subscriptionManagementGroup(subscriptionID string) *HierarchyManagementGroup {
+	for _, mg := range h.mgs {
+		if slices.ContainsFunc(mg.subscriptions.ToSlice(), func(sub string) bool {
+			return strings.EqualFold(sub, subscriptionID)
+		}) {
+			return mg
+		}
+	}
+
+	return nil
+}
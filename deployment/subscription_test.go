@@ -0,0 +1,120 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/to"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionsFromArchitecture(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fs := effectivePolicyTestFS()
+	fs["subs.alz_architecture_definition.json"] = &fstest.MapFile{Data: []byte(`{
+  "name": "subs",
+  "management_groups": [
+    {"id": "subs-root", "display_name": "root", "parent_id": null, "exists": false, "archetypes": ["root"]},
+    {
+      "id": "subs-child",
+      "display_name": "child",
+      "parent_id": "subs-root",
+      "exists": false,
+      "archetypes": ["child"],
+      "subscriptions": ["connectivity", "00000000-0000-0000-0000-000000000001"]
+    }
+  ]
+}`)}
+	fs["subs-clash.alz_architecture_definition.json"] = &fstest.MapFile{Data: []byte(`{
+  "name": "subs-clash",
+  "management_groups": [
+    {
+      "id": "clash",
+      "display_name": "clash",
+      "parent_id": null,
+      "exists": false,
+      "archetypes": ["empty"],
+      "subscriptions": ["CONNECTIVITY"]
+    }
+  ]
+}`)}
+
+	az := alzlib.NewAlzLib(nil)
+	require.NoError(t, az.Init(ctx, alzlib.NewCustomLibraryReferenceFromFS("subs", fs)))
+
+	assert.Equal(t,
+		[]string{"00000000-0000-0000-0000-000000000001", "connectivity"},
+		az.Architecture("subs").RootMgs()[0].Children()[0].Subscriptions(),
+	)
+
+	h := NewHierarchy(az)
+	require.NoError(t, h.FromArchitecture(ctx, "subs", "tenant", "northeurope"))
+	assert.Equal(t,
+		[]string{"00000000-0000-0000-0000-000000000001", "connectivity"},
+		h.ManagementGroup("subs-child").Subscriptions(),
+	)
+	assert.Empty(t, h.ManagementGroup("subs-root").Subscriptions())
+
+	err := h.FromArchitecture(ctx, "subs-clash", "tenant", "northeurope")
+	require.ErrorContains(t, err, "subscription `CONNECTIVITY` is already in management group `subs-child`")
+	assert.Nil(t, h.ManagementGroup("clash"))
+}
+
+func TestHierarchySubscriptions(t *testing.T) {
+	t.Parallel()
+
+	h := newEffectivePolicyTestHierarchy(t)
+
+	require.NoError(t, h.AddSubscription("sub1", "child"))
+	require.ErrorContains(t, h.AddSubscription("SUB1", "grandchild"), "already in management group `child`")
+	require.ErrorContains(t, h.AddSubscription("sub2", "notexist"), "management group `notexist` not found")
+	require.ErrorContains(t, h.AddSubscription("", "child"), "subscription id is empty")
+
+	assert.Equal(t, "child", h.SubscriptionManagementGroup("Sub1").Name())
+	assert.Nil(t, h.SubscriptionManagementGroup("sub2"))
+	assert.Equal(t, []string{"sub1"}, h.ManagementGroup("child").Subscriptions())
+
+	require.NoError(t, h.AddSubscription("sub2", "grandchild"))
+	require.ErrorContains(t, h.RemoveManagementGroup("grandchild"), "has subscriptions")
+
+	require.NoError(t, h.RemoveSubscription("SUB2"))
+	assert.Empty(t, h.ManagementGroup("grandchild").Subscriptions())
+	require.ErrorContains(t, h.RemoveSubscription("sub2"), "subscription `sub2` not found")
+	require.NoError(t, h.RemoveManagementGroup("grandchild"))
+
+	b, err := json.Marshal(h)
+	require.NoError(t, err)
+
+	loaded := NewHierarchy(nil)
+	require.NoError(t, json.Unmarshal(b, loaded))
+	assert.Equal(t, []string{"sub1"}, loaded.ManagementGroup("child").Subscriptions())
+}
+
+func TestHierarchyEffectivePolicyAssignmentsForSubscription(t *testing.T) {
+	t.Parallel()
+
+	h := newEffectivePolicyTestHierarchy(t)
+	require.NoError(t, h.AddSubscription("sub1", "child"))
+	require.NoError(t, h.ManagementGroup("root").ModifyPolicyAssignment("pa-root", WithNotScopes(
+		[]*string{to.Ptr(fmt.Sprintf(SubscriptionIDFmt, "sub1"))},
+	)))
+
+	eff, err := h.EffectivePolicyAssignmentsForSubscription("sub1")
+	require.NoError(t, err)
+	require.Len(t, eff, 1)
+	assert.Equal(t, "pa-child", eff[0].PolicyAssignmentName)
+	assert.True(t, eff[0].Inherited)
+
+	_, err = h.EffectivePolicyAssignmentsForSubscription("notexist")
+	require.ErrorContains(t, err, "subscription `notexist` not found")
+}
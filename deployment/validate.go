@@ -0,0 +1,181 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+var _ error = &MissingParameterErrors{}
+
+// MissingParameter is a policy assignment parameter that is required by the referenced policy (set) definition,
+// because it has no default value, but has not been given a value in the assignment.
+type MissingParameter struct {
+	ManagementGroupID    string `json:"management_group_id"`
+	PolicyAssignmentName string `json:"policy_assignment_name"`
+	ParameterName        string `json:"parameter_name"`
+}
+
+// MissingParameterErrors is returned by Hierarchy.Validate when required policy assignment parameters are unset.
+// The missing parameters are grouped by the name of the default policy assignment value that sets them,
+// so that they can be resolved using Hierarchy.AddDefaultPolicyAssignmentValue.
+// Missing parameters that are not set by any default must be set using
+// HierarchyManagementGroup.ModifyPolicyAssignment.
+type MissingParameterErrors struct {
+	// ByDefaultName maps the default name to the missing parameters that the default sets.
+	ByDefaultName map[string][]MissingParameter `json:"by_default_name,omitempty"`
+	// NoDefault are the missing parameters that are not set by any default.
+	NoDefault []MissingParameter `json:"no_default,omitempty"`
+}
+
+// Error implements the error interface.
+func (e *MissingParameterErrors) Error() string {
+	lines := make([]string, 0, len(e.ByDefaultName)+len(e.NoDefault))
+
+	for _, defaultName := range slices.Sorted(maps.Keys(e.ByDefaultName)) {
+		for _, mp := range e.ByDefaultName[defaultName] {
+			lines = append(lines, fmt.Sprintf("%s (set by default `%s`)", mp, defaultName))
+		}
+	}
+
+	for _, mp := range e.NoDefault {
+		lines = append(lines, mp.String())
+	}
+
+	return "missing required policy assignment parameters:\n" + strings.Join(lines, "\n")
+}
+
+// String returns a human readable representation of the missing parameter.
+func (mp MissingParameter) String() string {
+	return fmt.Sprintf(
+		"management group `%s`, policy assignment `%s`, parameter `%s`",
+		mp.ManagementGroupID,
+		mp.PolicyAssignmentName,
+		mp.ParameterName,
+	)
+}
+
+// Validate checks every policy assignment in the hierarchy for parameters that are required by the referenced
+// policy (set) definition, i.e. parameters without a default value, that have not been given a value.
+// It should be called after FromArchitecture and AddDefaultPolicyAssignmentValue.
+// If any are found, the returned error is of type *MissingParameterErrors.
+// Other errors are returned if a referenced definition cannot be resolved through AlzLib.
+func (h *Hierarchy) Validate() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	// Build a lookup of assignment and parameter name to default name.
+	defaults := make(map[[2]string]string)
+
+	for _, defaultName := range h.alzlib.PolicyDefaultValues() {
+		def := h.alzlib.PolicyDefaultValue(defaultName)
+		for assignment, params := range def.PolicyAssignment2ParameterMap() {
+			for param := range params.Iter() {
+				defaults[[2]string{assignment, param}] = defaultName
+			}
+		}
+	}
+
+	var result MissingParameterErrors
+
+	for _, mgName := range slices.Sorted(maps.Keys(h.mgs)) {
+		mg := h.mgs[mgName]
+
+		for _, paName := range slices.Sorted(maps.Keys(mg.policyAssignments)) {
+			missing, err := h.missingAssignmentParameters(mg.policyAssignments[paName].Properties)
+			if err != nil {
+				return fmt.Errorf(
+					"Hierarchy.Validate: policy assignment `%s` in management group `%s`: %w",
+					paName,
+					mgName,
+					err,
+				)
+			}
+
+			for _, param := range missing {
+				mp := MissingParameter{
+					ManagementGroupID:    mgName,
+					PolicyAssignmentName: paName,
+					ParameterName:        param,
+				}
+
+				defaultName, ok := defaults[[2]string{paName, param}]
+				if !ok {
+					result.NoDefault = append(result.NoDefault, mp)
+					continue
+				}
+
+				if result.ByDefaultName == nil {
+					result.ByDefaultName = make(map[string][]MissingParameter)
+				}
+
+				result.ByDefaultName[defaultName] = append(result.ByDefaultName[defaultName], mp)
+			}
+		}
+	}
+
+	if len(result.ByDefaultName) == 0 && len(result.NoDefault) == 0 {
+		return nil
+	}
+
+	return &result
+}
+
+// missingAssignmentParameters returns the sorted names of the required parameters of the referenced
+// policy (set) definition that are not set in the assignment.
+func (h *Hierarchy) missingAssignmentParameters(props *armpolicy.AssignmentProperties) ([]string, error) {
+	if props == nil || props.PolicyDefinitionID == nil {
+		return nil, errors.New("policy definition id is not set")
+	}
+
+	ref, err := arm.ParseResourceID(*props.PolicyDefinitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var params map[string]*armpolicy.ParameterDefinitionsValue
+
+	switch strings.ToLower(ref.ResourceType.Type) {
+	case alzlib.PolicyDefinitionsType:
+		pd := h.alzlib.PolicyDefinition(ref.Name, props.DefinitionVersion)
+		if pd == nil || pd.Properties == nil {
+			return nil, fmt.Errorf("referenced policy definition `%s` not found", ref.Name)
+		}
+
+		params = pd.Properties.Parameters
+	case alzlib.PolicySetDefinitionsType:
+		psd := h.alzlib.PolicySetDefinition(ref.Name, props.DefinitionVersion)
+		if psd == nil || psd.Properties == nil {
+			return nil, fmt.Errorf("referenced policy set definition `%s` not found", ref.Name)
+		}
+
+		params = psd.Properties.Parameters
+	default:
+		return nil, fmt.Errorf("unexpected referenced resource type `%s`", ref.ResourceType.Type)
+	}
+
+	var missing []string
+
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		if params[name] == nil || params[name].DefaultValue != nil {
+			continue
+		}
+
+		if v, ok := props.Parameters[name]; ok && v != nil && v.Value != nil {
+			continue
+		}
+
+		missing = append(missing, name)
+	}
+
+	return missing, nil
+}
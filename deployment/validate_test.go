@@ -0,0 +1,119 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validateTestPolicyDefinition = `{
+  "name": "required-pd",
+  "type": "Microsoft.Authorization/policyDefinitions",
+  "properties": {
+    "displayName": "Required parameters",
+    "description": "Policy definition with required parameters",
+    "mode": "All",
+    "policyType": "Custom",
+    "parameters": {
+      "optional": {"type": "String", "defaultValue": "foo"},
+      "required1": {"type": "String"},
+      "required2": {"type": "String"},
+      "required3": {"type": "String"}
+    },
+    "policyRule": {"if": {"field": "type", "equals": "foo"}, "then": {"effect": "audit"}}
+  }
+}`
+
+const validateTestPolicyAssignment = `{
+  "name": "required-pa",
+  "type": "Microsoft.Authorization/policyAssignments",
+  "properties": {
+    "displayName": "Required parameters",
+    "description": "Policy assignment with required parameters",
+    "enforcementMode": "Default",
+    "policyDefinitionId": "/providers/Microsoft.Authorization/policyDefinitions/required-pd",
+    "parameters": {"required3": {"value": "bar"}},
+    "scope": "/providers/Microsoft.Management/managementGroups/placeholder"
+  }
+}`
+
+func TestHierarchyValidate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	lib := alzlib.NewCustomLibraryReferenceFromFS("validate", fstest.MapFS{
+		"required.alz_policy_definition.json": {Data: []byte(validateTestPolicyDefinition)},
+		"required.alz_policy_assignment.json": {Data: []byte(validateTestPolicyAssignment)},
+		"required.alz_archetype_definition.json": {Data: []byte(`{
+  "name": "required",
+  "policy_assignments": ["required-pa"],
+  "policy_definitions": ["required-pd"],
+  "policy_set_definitions": [],
+  "role_definitions": []
+}`)},
+		"required.alz_architecture_definition.json": {Data: []byte(`{
+  "name": "required",
+  "management_groups": [
+    {"id": "root", "display_name": "root", "parent_id": null, "exists": false, "archetypes": ["required"]},
+    {"id": "child", "display_name": "child", "parent_id": "root", "exists": false, "archetypes": ["required"]}
+  ]
+}`)},
+		"alz_policy_default_values.json": {Data: []byte(`{
+  "defaults": [
+    {
+      "default_name": "required_one",
+      "policy_assignments": [{"policy_assignment_name": "required-pa", "parameter_names": ["required1"]}]
+    }
+  ]
+}`)},
+	})
+
+	az := alzlib.NewAlzLib(nil)
+	require.NoError(t, az.Init(ctx, lib))
+
+	h := NewHierarchy(az)
+	require.NoError(t, h.FromArchitecture(ctx, "required", "00000000-0000-0000-0000-000000000000", "northeurope"))
+
+	err := h.Validate()
+
+	var mpErr *MissingParameterErrors
+
+	require.ErrorAs(t, err, &mpErr)
+	assert.Equal(t, map[string][]MissingParameter{
+		"required_one": {
+			{ManagementGroupID: "child", PolicyAssignmentName: "required-pa", ParameterName: "required1"},
+			{ManagementGroupID: "root", PolicyAssignmentName: "required-pa", ParameterName: "required1"},
+		},
+	}, mpErr.ByDefaultName)
+	assert.Equal(t, []MissingParameter{
+		{ManagementGroupID: "child", PolicyAssignmentName: "required-pa", ParameterName: "required2"},
+		{ManagementGroupID: "root", PolicyAssignmentName: "required-pa", ParameterName: "required2"},
+	}, mpErr.NoDefault)
+	assert.ErrorContains(t, err, "management group `root`, policy assignment `required-pa`, parameter `required1` "+
+		"(set by default `required_one`)")
+
+	require.NoError(t, h.AddDefaultPolicyAssignmentValue(ctx, "required_one", &armpolicy.ParameterValuesValue{
+		Value: "one",
+	}))
+
+	err = h.Validate()
+	require.ErrorAs(t, err, &mpErr)
+	assert.Empty(t, mpErr.ByDefaultName)
+	assert.Len(t, mpErr.NoDefault, 2)
+
+	for _, mg := range []string{"root", "child"} {
+		require.NoError(t, h.ManagementGroup(mg).ModifyPolicyAssignment("required-pa", WithParameters(
+			map[string]*armpolicy.ParameterValuesValue{"required2": {Value: "two"}},
+		)))
+	}
+
+	require.NoError(t, h.Validate())
+}
@@ -0,0 +1,458 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+// ARMWriter writes a Hierarchy as ARM templates, one per management group.
+// Each template is deployed at the scope of its management group, e.g. using `az deployment mg create`.
+// The output directory mirrors the management group hierarchy, templates must be deployed
+// top-down as child templates may reference definitions deployed by their parents.
+// The management groups themselves are not part of the templates and must exist prior to deployment,
+// the subscriptions placed in a management group are.
+type ARMWriter struct {
+	opts ARMWriterOptions
+}
+
+// ARMWriterOptions defines options for the ARM template writer.
+type ARMWriterOptions struct {
+	// if true, errors generating policy role assignments are ignored and the valid ones are written
+	IgnorePolicyRoleAssignmentErrors bool
+	// the type of parameters file to write alongside each template
+	ParametersFile ARMWriterParametersFile
+	// options for customization of policy set definitions
+	PolicySetOptions FSWriterPolicySetOptions
+}
+
+// ARMWriterParametersFile is the type of parameters file written by the ARMWriter.
+type ARMWriterParametersFile int
+
+const (
+	// ARMWriterParametersFileNone does not write a parameters file.
+	ARMWriterParametersFileNone ARMWriterParametersFile = iota
+	// ARMWriterParametersFileJSON writes an ARM JSON parameters file.
+	ARMWriterParametersFileJSON
+	// ARMWriterParametersFileBicep writes a `.bicepparam` file that references the template.
+	ARMWriterParametersFileBicep
+)
+
+// NewARMWriter creates a new ARM template writer with optional configuration.
+func NewARMWriter(opt ARMWriterOptions) *ARMWriter {
+	w := &ARMWriter{
+		opts: opt,
+	}
+
+	return w
+}
+
+const (
+	armTemplateFileName           = "azuredeploy.json"
+	armParametersFileName         = "azuredeploy.parameters.json"
+	armBicepParametersFileName    = "azuredeploy.bicepparam"
+	armTemplateSchema             = armSchemaBaseURL + "2019-08-01/managementGroupDeploymentTemplate.json#"
+	armParametersSchema           = armSchemaBaseURL + "2019-04-01/deploymentParameters.json#"
+	armSchemaBaseURL              = "https://schema.management.azure.com/schemas/"
+	armContentVersion             = "1.0.0.0"
+	armLocationParameterName      = "location"
+	armPrincipalTypeServicePrinc  = "ServicePrincipal"
+	armAPIVersionPolicy           = "2023-04-01"
+	armAPIVersionAuthorization    = "2022-04-01"
+	armAPIVersionManagementGroups = "2023-04-01"
+	armTypePolicyAssignment       = "Microsoft.Authorization/policyAssignments"
+	armTypePolicyDefinition       = "Microsoft.Authorization/policyDefinitions"
+	armTypePolicyExemption        = "Microsoft.Authorization/policyExemptions"
+	armTypePolicySetDefinition    = "Microsoft.Authorization/policySetDefinitions"
+	armTypeRoleAssignment         = "Microsoft.Authorization/roleAssignments"
+	armTypeRoleDefinition         = "Microsoft.Authorization/roleDefinitions"
+	armTypeSubscription           = "Microsoft.Management/managementGroups/subscriptions"
+	armAPIVersionManagedIdentity  = "2023-01-31"
+	armResourceEscapingIterations = 1
+)
+
+// Write implements HierarchyWriter.
+func (w *ARMWriter) Write(ctx context.Context, h *Hierarchy, outDir string) error {
+	if h == nil {
+		return errors.New("armwriter.write: hierarchy is nil")
+	}
+
+	if strings.TrimSpace(outDir) == "" {
+		return errors.New("armwriter.write: outDir is empty")
+	}
+
+	if err := os.MkdirAll(outDir, dirPerm); err != nil {
+		return fmt.Errorf("armwriter.write: creating outDir: %w", err)
+	}
+
+	roleAssignments, err := h.PolicyRoleAssignments(ctx)
+	if err != nil {
+		var praErrs *PolicyRoleAssignmentErrors
+		if !errors.As(err, &praErrs) || !w.opts.IgnorePolicyRoleAssignmentErrors {
+			return fmt.Errorf("armwriter.write: generating policy role assignments: %w", err)
+		}
+	}
+
+	raByMg := make(map[string][]PolicyRoleAssignment)
+	for ra := range roleAssignments.Iter() {
+		raByMg[ra.ManagementGroupID] = append(raByMg[ra.ManagementGroupID], ra)
+	}
+
+	rootNames := make([]string, 0)
+
+	for _, name := range h.ManagementGroupNames() {
+		mg := h.ManagementGroup(name)
+		if mg == nil {
+			continue
+		}
+
+		if mg.Parent() == nil {
+			rootNames = append(rootNames, mg.Name())
+		}
+	}
+
+	for _, root := range rootNames {
+		if err := w.writeMgmtGroupRecursive(ctx, h, root, outDir, raByMg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *ARMWriter) writeMgmtGroupRecursive(
+	ctx context.Context,
+	h *Hierarchy,
+	mgName, base string,
+	raByMg map[string][]PolicyRoleAssignment,
+) error {
+	if err := ctxErr(ctx); err != nil {
+		return err
+	}
+
+	mg := h.ManagementGroup(mgName)
+	if mg == nil {
+		return fmt.Errorf("armwriter.writeMgmtGroupRecursive: management group %q not found", mgName)
+	}
+
+	dir := filepath.Join(base, sanitizeFilename(mg.Name()))
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return fmt.Errorf("armwriter.writeMgmtGroupRecursive: creating dir %q: %w", dir, err)
+	}
+
+	template, err := w.managementGroupTemplate(mg, raByMg[mg.Name()])
+	if err != nil {
+		return err
+	}
+
+	if err := writeJSONFile(filepath.Join(dir, armTemplateFileName), template); err != nil {
+		return fmt.Errorf("armwriter.writeMgmtGroupRecursive: writing template for %q: %w", mgName, err)
+	}
+
+	if err := w.writeParametersFile(dir, mg); err != nil {
+		return err
+	}
+
+	children := mg.Children()
+	slices.SortFunc(children, func(a, b *HierarchyManagementGroup) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	for _, child := range children {
+		if err := w.writeMgmtGroupRecursive(ctx, h, child.Name(), dir, raByMg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *ARMWriter) writeParametersFile(dir string, mg *HierarchyManagementGroup) error {
+	switch w.opts.ParametersFile {
+	case ARMWriterParametersFileNone:
+		return nil
+	case ARMWriterParametersFileJSON:
+		params := map[string]any{
+			"$schema":        armParametersSchema,
+			"contentVersion": armContentVersion,
+			"parameters": map[string]any{
+				armLocationParameterName: map[string]any{"value": mg.Location()},
+			},
+		}
+
+		if err := writeJSONFile(filepath.Join(dir, armParametersFileName), params); err != nil {
+			return fmt.Errorf("armwriter.writeParametersFile: writing parameters for %q: %w", mg.Name(), err)
+		}
+	case ARMWriterParametersFileBicep:
+		content := fmt.Sprintf(
+			"using './%s'\n\nparam %s = '%s'\n",
+			armTemplateFileName,
+			armLocationParameterName,
+			strings.ReplaceAll(mg.Location(), "'", `\'`),
+		)
+
+		file := filepath.Join(dir, armBicepParametersFileName)
+		if err := os.WriteFile(file, []byte(content), filePerm); err != nil {
+			return fmt.Errorf("armwriter.writeParametersFile: writing parameters for %q: %w", mg.Name(), err)
+		}
+	default:
+		return fmt.Errorf("armwriter.writeParametersFile: unknown parameters file type %d", w.opts.ParametersFile)
+	}
+
+	return nil
+}
+
+// managementGroupTemplate generates the ARM template for a single management group.
+// Resources are ordered by type and name to produce stable output.
+func (w *ARMWriter) managementGroupTemplate(
+	mg *HierarchyManagementGroup,
+	roleAssignments []PolicyRoleAssignment,
+) (map[string]any, error) {
+	resources := make([]any, 0)
+
+	// local resource ids are used to generate dependsOn for resources deployed by this template.
+	localIDs := make(map[string]string)
+
+	pds := mg.PolicyDefinitionsMap()
+	for _, k := range sortedKeys(pds) {
+		pd := pds[k]
+		localIDs[strings.ToLower(fmt.Sprintf(PolicyDefinitionIDFmt, mg.Name(), *pd.Name))] = armExtensionResourceID(
+			armTypePolicyDefinition, *pd.Name,
+		)
+
+		res, err := armResource(armTypePolicyDefinition, armAPIVersionPolicy, *pd.Name, pd.Properties, nil)
+		if err != nil {
+			return nil, fmt.Errorf("armwriter.managementGroupTemplate: policy definition %q: %w", *pd.Name, err)
+		}
+
+		resources = append(resources, res)
+	}
+
+	psds := mg.PolicySetDefinitionsMap()
+	for _, k := range sortedKeys(psds) {
+		psd := psds[k]
+		localIDs[strings.ToLower(fmt.Sprintf(PolicySetDefinitionIDFmt, mg.Name(), *psd.Name))] = armExtensionResourceID(
+			armTypePolicySetDefinition, *psd.Name,
+		)
+
+		deps := make([]string, 0)
+
+		for _, ref := range psd.PolicyDefinitionReferences() {
+			if ref.PolicyDefinitionID == nil {
+				continue
+			}
+
+			if dep, ok := localIDs[strings.ToLower(*ref.PolicyDefinitionID)]; ok {
+				deps = append(deps, dep)
+			}
+		}
+
+		if w.opts.PolicySetOptions.CustomPolicyDefinitionReferencesUpdate {
+			updatePolicyDefinitionReferences(
+				psd.Properties.PolicyDefinitions,
+				w.opts.PolicySetOptions.CustomPolicyDefinitionReferenceRegExp,
+				w.opts.PolicySetOptions.CustomPolicyDefinitionReferenceReplaceValue,
+			)
+		}
+
+		res, err := armResource(armTypePolicySetDefinition, armAPIVersionPolicy, *psd.Name, psd.Properties, deps)
+		if err != nil {
+			return nil, fmt.Errorf("armwriter.managementGroupTemplate: policy set definition %q: %w", *psd.Name, err)
+		}
+
+		resources = append(resources, res)
+	}
+
+	rds := mg.RoleDefinitionsMap()
+	for _, k := range sortedKeys(rds) {
+		rd := rds[k]
+		localIDs[strings.ToLower(*rd.Name)] = armExtensionResourceID(armTypeRoleDefinition, *rd.Name)
+
+		res, err := armResource(armTypeRoleDefinition, armAPIVersionAuthorization, *rd.Name, rd.Properties, nil)
+		if err != nil {
+			return nil, fmt.Errorf("armwriter.managementGroupTemplate: role definition %q: %w", *rd.Name, err)
+		}
+
+		resources = append(resources, res)
+	}
+
+	pas := mg.PolicyAssignmentMap()
+	for _, k := range sortedKeys(pas) {
+		pa := pas[k]
+		deps := make([]string, 0, 1)
+
+		if pa.Properties.PolicyDefinitionID != nil {
+			if dep, ok := localIDs[strings.ToLower(*pa.Properties.PolicyDefinitionID)]; ok {
+				deps = append(deps, dep)
+			}
+		}
+
+		res, err := armResource(armTypePolicyAssignment, armAPIVersionPolicy, *pa.Name, pa.Properties, deps)
+		if err != nil {
+			return nil, fmt.Errorf("armwriter.managementGroupTemplate: policy assignment %q: %w", *pa.Name, err)
+		}
+
+		if pa.Location != nil {
+			res["location"] = fmt.Sprintf("[parameters('%s')]", armLocationParameterName)
+		}
+
+		if pa.Identity != nil {
+			identity, err := armEscapedValue(pa.Identity, armResourceEscapingIterations)
+			if err != nil {
+				return nil, fmt.Errorf("armwriter.managementGroupTemplate: policy assignment %q identity: %w", *pa.Name, err)
+			}
+
+			res["identity"] = identity
+		}
+
+		resources = append(resources, res)
+	}
+
+	slices.SortFunc(roleAssignments, func(a, b PolicyRoleAssignment) int {
+		return strings.Compare(policyRoleAssignmentName(a), policyRoleAssignmentName(b))
+	})
+
+	for _, ra := range roleAssignments {
+		paID := armExtensionResourceID(armTypePolicyAssignment, ra.AssignmentName)
+		deps := []string{paID}
+
+		rdName := ra.RoleDefinitionID[strings.LastIndex(ra.RoleDefinitionID, "/")+1:]
+		if dep, ok := localIDs[strings.ToLower(rdName)]; ok {
+			deps = append(deps, dep)
+		}
+
+		principalID, err := armPrincipalID(mg.policyAssignments[ra.AssignmentName], paID)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"armwriter.managementGroupTemplate: role assignment for policy assignment %q: %w", ra.AssignmentName, err,
+			)
+		}
+
+		res := map[string]any{
+			"type":       armTypeRoleAssignment,
+			"apiVersion": armAPIVersionAuthorization,
+			"name":       policyRoleAssignmentName(ra),
+			"properties": map[string]any{
+				"principalId":      principalID,
+				"principalType":    armPrincipalTypeServicePrinc,
+				"roleDefinitionId": ra.RoleDefinitionID,
+			},
+			"dependsOn": deps,
+		}
+
+		if !strings.EqualFold(ra.Scope, mg.ResourceID()) {
+			res["scope"] = ra.Scope
+		}
+
+		resources = append(resources, res)
+	}
+
+	// subscription placement is a tenant level resource, so is deployed using the root scope.
+	for _, sub := range mg.Subscriptions() {
+		resources = append(resources, map[string]any{
+			"type":       armTypeSubscription,
+			"apiVersion": armAPIVersionManagementGroups,
+			"name":       fmt.Sprintf("%s/%s", mg.Name(), sub),
+			"scope":      "/",
+		})
+	}
+
+	template := map[string]any{
+		"$schema":        armTemplateSchema,
+		"contentVersion": armContentVersion,
+		"parameters": map[string]any{
+			armLocationParameterName: map[string]any{
+				"type":         "string",
+				"defaultValue": mg.Location(),
+			},
+		},
+		"resources": resources,
+	}
+
+	return template, nil
+}
+
+// armResource returns an ARM template resource with the supplied properties,
+// ARM functions in the properties are escaped so that they are deployed verbatim.
+func armResource(typ, apiVersion, name string, properties any, dependsOn []string) (map[string]any, error) {
+	props, err := armEscapedValue(properties, armResourceEscapingIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]any{
+		"type":       typ,
+		"apiVersion": apiVersion,
+		"name":       name,
+		"properties": props,
+	}
+
+	if len(dependsOn) > 0 {
+		deps := slices.Clone(dependsOn)
+		slices.Sort(deps)
+		res["dependsOn"] = slices.Compact(deps)
+	}
+
+	return res, nil
+}
+
+// armPrincipalID returns an ARM expression for the principal id of the policy assignment identity, paID is the
+// expression for the resource id of the policy assignment.
+// The principal id of a user assigned identity is not returned for the policy assignment, so it is referenced
+// from the identity resource instead.
+func armPrincipalID(pa *assets.PolicyAssignment, paID string) (string, error) {
+	if pa == nil || pa.Identity == nil || pa.Identity.Type == nil ||
+		*pa.Identity.Type != armpolicy.ResourceIdentityTypeUserAssigned {
+		return fmt.Sprintf(
+			"[reference(%s, '%s', 'full').identity.principalId]", strings.Trim(paID, "[]"), armAPIVersionPolicy,
+		), nil
+	}
+
+	if len(pa.Identity.UserAssignedIdentities) != 1 {
+		return "", fmt.Errorf(
+			"user assigned identity: expected exactly one identity, found %d", len(pa.Identity.UserAssignedIdentities),
+		)
+	}
+
+	var id string
+	for k := range pa.Identity.UserAssignedIdentities {
+		id = k
+	}
+
+	return fmt.Sprintf(
+		"[reference('%s', '%s').principalId]", strings.ReplaceAll(id, "'", "''"), armAPIVersionManagedIdentity,
+	), nil
+}
+
+// armExtensionResourceID returns an ARM expression for the resource id of an extension resource
+// deployed at the management group scope of the template.
+func armExtensionResourceID(typ, name string) string {
+	return fmt.Sprintf("[extensionResourceId(managementGroup().id, '%s', '%s')]", typ, name)
+}
+
+// policyRoleAssignmentName returns a deterministic name (guid) for the role assignment.
+func policyRoleAssignmentName(ra PolicyRoleAssignment) string {
+	return uuidV5(ra.ManagementGroupID, ra.AssignmentName, ra.RoleDefinitionID, ra.Scope).String()
+}
+
+// sortedKeys returns the sorted keys of the map.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
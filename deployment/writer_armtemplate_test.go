@@ -0,0 +1,137 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestARMWriter_ExportsSimple(t *testing.T) {
+	h := buildSimpleHierarchy(t)
+	require.NoError(t, h.AddSubscription("sub1", "simple"))
+
+	outDir := t.TempDir()
+	w := NewARMWriter(ARMWriterOptions{
+		ParametersFile: ARMWriterParametersFileBicep,
+	})
+	require.NoError(t, w.Write(context.Background(), h, outDir))
+
+	for _, mg := range []string{"simple", "simpleoverride"} {
+		_, err := os.Stat(filepath.Join(outDir, mg, armTemplateFileName))
+		require.NoError(t, err)
+
+		b, err := os.ReadFile(filepath.Join(outDir, mg, armBicepParametersFileName))
+		require.NoError(t, err)
+		assert.Contains(t, string(b), "using './"+armTemplateFileName+"'")
+		assert.Contains(t, string(b), "param location = 'northeurope'")
+	}
+
+	b, err := os.ReadFile(filepath.Join(outDir, "simple", armTemplateFileName))
+	require.NoError(t, err)
+
+	var template struct {
+		Schema    string           `json:"$schema"`
+		Resources []map[string]any `json:"resources"`
+	}
+	require.NoError(t, json.Unmarshal(b, &template))
+	assert.Equal(t, armTemplateSchema, template.Schema)
+
+	byType := make(map[string]map[string]any)
+	for _, res := range template.Resources {
+		byType[res["type"].(string)] = res
+	}
+
+	pd := byType[armTypePolicyDefinition]
+	require.NotNil(t, pd)
+	effect := pd["properties"].(map[string]any)["policyRule"].(map[string]any)["then"].(map[string]any)["effect"]
+	assert.Equal(t, "[[parameters('effect')]", effect, "policy rule expressions should be escaped")
+
+	pdID := armExtensionResourceID(armTypePolicyDefinition, "test-policy-definition")
+
+	psd := byType[armTypePolicySetDefinition]
+	require.NotNil(t, psd)
+	assert.Equal(t, []any{pdID}, psd["dependsOn"])
+
+	pa := byType[armTypePolicyAssignment]
+	require.NotNil(t, pa)
+	assert.Equal(t, []any{pdID}, pa["dependsOn"])
+	assert.Equal(t, "[parameters('location')]", pa["location"])
+
+	sub := byType[armTypeSubscription]
+	require.NotNil(t, sub)
+	assert.Equal(t, "simple/sub1", sub["name"])
+	assert.Equal(t, "/", sub["scope"])
+}
+
+func TestARMWriter_PolicySetOptions(t *testing.T) {
+	h := buildSimpleHierarchy(t)
+
+	outDir := t.TempDir()
+	w := NewARMWriter(ARMWriterOptions{
+		ParametersFile: ARMWriterParametersFileJSON,
+		PolicySetOptions: FSWriterPolicySetOptions{
+			CustomPolicyDefinitionReferencesUpdate: true,
+			CustomPolicyDefinitionReferenceRegExp: regexp.MustCompile(
+				`(?i)^/providers/Microsoft\.Management/managementGroups/simple`,
+			),
+			CustomPolicyDefinitionReferenceReplaceValue: "{customPolicyDefinitionScopeId}",
+		},
+	})
+	require.NoError(t, w.Write(context.Background(), h, outDir))
+
+	_, err := os.Stat(filepath.Join(outDir, "simple", armParametersFileName))
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(filepath.Join(outDir, "simple", armTemplateFileName))
+	require.NoError(t, err)
+	assert.Contains(
+		t,
+		string(b),
+		"{customPolicyDefinitionScopeId}/providers/Microsoft.Authorization/policyDefinitions/test-policy-definition",
+	)
+}
+
+func TestArmPrincipalID(t *testing.T) {
+	t.Parallel()
+
+	uaiID := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/" +
+		"Microsoft.ManagedIdentity/userAssignedIdentities/uai"
+	paID := armExtensionResourceID(armTypePolicyAssignment, "pa")
+
+	id, err := armPrincipalID(assets.NewPolicyAssignment(armpolicy.Assignment{
+		Identity: &armpolicy.Identity{Type: toPtr(armpolicy.ResourceIdentityTypeSystemAssigned)},
+	}), paID)
+	require.NoError(t, err)
+	assert.Equal(t,
+		"[reference(extensionResourceId(managementGroup().id, 'Microsoft.Authorization/policyAssignments', 'pa'), "+
+			"'2023-04-01', 'full').identity.principalId]",
+		id,
+	)
+
+	id, err = armPrincipalID(assets.NewPolicyAssignment(armpolicy.Assignment{
+		Identity: &armpolicy.Identity{
+			Type: toPtr(armpolicy.ResourceIdentityTypeUserAssigned),
+			UserAssignedIdentities: map[string]*armpolicy.UserAssignedIdentitiesValue{
+				uaiID: {},
+			},
+		},
+	}), paID)
+	require.NoError(t, err)
+	assert.Equal(t, "[reference('"+uaiID+"', '2023-01-31').principalId]", id)
+
+	_, err = armPrincipalID(assets.NewPolicyAssignment(armpolicy.Assignment{
+		Identity: &armpolicy.Identity{Type: toPtr(armpolicy.ResourceIdentityTypeUserAssigned)},
+	}), paID)
+	require.ErrorContains(t, err, "expected exactly one identity, found 0")
+}
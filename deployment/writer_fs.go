@@ -23,13 +23,14 @@ import (
 // Implementations should mirror the management group hierarchy on the target.
 type HierarchyWriter interface {
 	// Write exports the hierarchy to outDir. Each management group becomes a directory
-	// (nested according to parent/child), and each asset (policy assignment/definition,
+	// (nested according to parent/child), and each asset (policy assignment/definition/exemption,
 	// policy set definition, role definition) is written as a separate JSON file named
 	// using the asset JSON .name plus a type-specific suffix.
 	Write(ctx context.Context, h *Hierarchy, outDir string) error
 }
 
 // FSWriter writes a Hierarchy to the local filesystem.
+// The subscriptions placed in a management group are written to `subscriptions.json` in its directory.
 type FSWriter struct {
 	opts FSWriterOptions
 }
@@ -70,8 +71,10 @@ func NewFSWriter(opt FSWriterOptions) *FSWriter {
 const (
 	fileSuffixPolicyAssignment    = "." + processor.PolicyAssignmentFileType + ".json"
 	fileSuffixPolicyDefinition    = "." + processor.PolicyDefinitionFileType + ".json"
+	fileSuffixPolicyExemption     = "." + processor.PolicyExemptionFileType + ".json"
 	fileSuffixPolicySetDefinition = "." + processor.PolicySetDefinitionFileType + ".json"
 	fileSuffixRoleDefinition      = "." + processor.RoleDefinitionFileType + ".json"
+	fileNameSubscriptions         = "subscriptions.json"
 )
 
 const (
@@ -148,10 +151,18 @@ func (w *FSWriter) writeMgmtGroupRecursive(ctx context.Context, h *Hierarchy, mg
 		return err
 	}
 
+	if err := w.writePolicyExemptions(ctx, dir, mg); err != nil {
+		return err
+	}
+
 	if err := w.writeRoleDefinitions(ctx, dir, mg); err != nil {
 		return err
 	}
 
+	if err := w.writeSubscriptions(ctx, dir, mg); err != nil {
+		return err
+	}
+
 	// Recurse into children: stable order by child name
 	children := mg.Children()
 	slices.SortFunc(children, func(a, b *HierarchyManagementGroup) int {
@@ -237,6 +248,19 @@ func (w *FSWriter) writePolicySetDefinitions(ctx context.Context, dir string, mg
 	return nil
 }
 
+func (w *FSWriter) writePolicyExemptions(ctx context.Context, dir string, mg *HierarchyManagementGroup) error {
+	m := mg.PolicyExemptionsMap()
+
+	for _, pe := range m {
+		// we don't need to safely dereference the name because the assets package does this for us
+		if err := writeAsset(ctx, *pe.Name, dir, fileSuffixPolicyExemption, pe, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (w *FSWriter) writeRoleDefinitions(ctx context.Context, dir string, mg *HierarchyManagementGroup) error {
 	m := mg.RoleDefinitionsMap()
 
@@ -257,6 +281,25 @@ func (w *FSWriter) writeRoleDefinitions(ctx context.Context, dir string, mg *Hie
 	return nil
 }
 
+// writeSubscriptions writes the sorted ids of the subscriptions placed in the management group
+// as a JSON array, if there are any.
+func (w *FSWriter) writeSubscriptions(ctx context.Context, dir string, mg *HierarchyManagementGroup) error {
+	if err := ctxErr(ctx); err != nil {
+		return err
+	}
+
+	subs := mg.Subscriptions()
+	if len(subs) == 0 {
+		return nil
+	}
+
+	if err := writeJSONFile(filepath.Join(dir, fileNameSubscriptions), subs); err != nil {
+		return fmt.Errorf("writing subscriptions: %w", err)
+	}
+
+	return nil
+}
+
 // Helpers
 
 func updatePolicyDefinitionReferences(pdrefs []*armpolicy.DefinitionReference, re *regexp.Regexp, replace string) {
@@ -380,24 +423,35 @@ func writeJSONFileEscaped(ctx context.Context, finalPath string, v any, iteratio
 		return err
 	}
 
+	m, err := armEscapedValue(v, iterations)
+	if err != nil {
+		return err
+	}
+
+	return writeJSONFile(finalPath, m)
+}
+
+// armEscapedValue materializes v into generic JSON types (map[string]any/[]any) and applies
+// addArmFunctionEscaping the supplied number of times.
+func armEscapedValue(v any, iterations uint) (any, error) {
 	// Marshal to JSON then unmarshal into interface{} to obtain maps/slices for traversal.
 	b, err := json.Marshal(v)
 	if err != nil {
-		return fmt.Errorf("marshal for escaping: %w", err)
+		return nil, fmt.Errorf("marshal for escaping: %w", err)
 	}
 
 	var m any
 	if err := json.Unmarshal(b, &m); err != nil {
-		return fmt.Errorf("unmarshal for escaping: %w", err)
+		return nil, fmt.Errorf("unmarshal for escaping: %w", err)
 	}
 
 	for i := range iterations {
 		if err := addArmFunctionEscaping(m); err != nil {
-			return fmt.Errorf("escape ARM functions (iteration %d): %w", i, err)
+			return nil, fmt.Errorf("escape ARM functions (iteration %d): %w", i, err)
 		}
 	}
 
-	return writeJSONFile(finalPath, m)
+	return m, nil
 }
 
 func addArmFunctionEscaping(v any) error {
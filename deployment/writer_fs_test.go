@@ -6,6 +6,7 @@ package deployment
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -50,6 +51,8 @@ func buildSimpleHierarchy(t *testing.T) *Hierarchy {
 
 func TestFSWriter_ExportsSimple(t *testing.T) {
 	h := buildSimpleHierarchy(t)
+	require.NoError(t, h.AddSubscription("sub2", "simple"))
+	require.NoError(t, h.AddSubscription("sub1", "simple"))
 
 	outDir := t.TempDir()
 	w := NewFSWriter(FSWriterOptions{})
@@ -87,6 +90,34 @@ func TestFSWriter_ExportsSimple(t *testing.T) {
 	require.NoError(t, json.Unmarshal(b, &pa))
 	require.NotNil(t, pa.Name)
 	require.Equal(t, "test-pa", *pa.Name)
+
+	b, err = os.ReadFile(filepath.Join(simpleDir, fileNameSubscriptions))
+	require.NoError(t, err)
+
+	var subs []string
+	require.NoError(t, json.Unmarshal(b, &subs))
+	require.Equal(t, []string{"sub1", "sub2"}, subs)
+
+	_, err = os.Stat(filepath.Join(outDir, "simpleoverride", fileNameSubscriptions))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestFSWriter_PolicyExemptions(t *testing.T) {
+	h := newPolicyExemptionTestHierarchy(t)
+
+	outDir := t.TempDir()
+	require.NoError(t, NewFSWriter(FSWriterOptions{}).Write(context.Background(), h, outDir))
+
+	b, err := os.ReadFile(filepath.Join(outDir, "ex-root", "ex-child", "ex-grandchild", "pe-child"+fileSuffixPolicyExemption))
+	require.NoError(t, err)
+
+	var pe assets.PolicyExemption
+	require.NoError(t, json.Unmarshal(b, &pe))
+	require.Equal(t, "pe-child", *pe.Name)
+	require.Equal(t, fmt.Sprintf(PolicyAssignmentIDFmt, "ex-child", "pa-child"), *pe.Properties.PolicyAssignmentID)
+
+	_, err = os.Stat(filepath.Join(outDir, "ex-root", "pe-child"+fileSuffixPolicyExemption))
+	require.ErrorIs(t, err, os.ErrNotExist)
 }
 
 func TestFSWriter_WithEscapeARM_Toggle(t *testing.T) {
@@ -0,0 +1,585 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// TerraformWriter writes a Hierarchy as Terraform JSON configuration (`*.tf.json`) using the
+// azapi provider.
+// All files are written flat into the output directory so that they form a single Terraform module.
+// Each management group is written to its own file, the hierarchy is expressed using `depends_on`.
+type TerraformWriter struct {
+	opts TerraformWriterOptions
+}
+
+// TerraformWriterOptions defines options for the Terraform writer.
+type TerraformWriterOptions struct {
+	// version constraint for the azapi provider, defaults to defaultAzapiVersionConstraint
+	AzapiVersionConstraint string
+	// if true, errors generating policy role assignments are ignored and the valid ones are written
+	IgnorePolicyRoleAssignmentErrors bool
+}
+
+// NewTerraformWriter creates a new Terraform writer with optional configuration.
+func NewTerraformWriter(opt TerraformWriterOptions) *TerraformWriter {
+	w := &TerraformWriter{
+		opts: opt,
+	}
+
+	return w
+}
+
+const (
+	fileSuffixTerraformJSON       = ".tf.json"
+	terraformSettingsFileName     = "terraform" + fileSuffixTerraformJSON
+	defaultAzapiVersionConstraint = "~> 2.0"
+	azapiProviderSource           = "Azure/azapi"
+	azapiResourceType             = "azapi_resource"
+	azapiDataSourcePrefix         = "data." + azapiResourceType + "."
+)
+
+const (
+	azapiTypeManagementGroup      = "Microsoft.Management/managementGroups@" + armAPIVersionManagementGroups
+	azapiTypeSubscription         = armTypeSubscription + "@" + armAPIVersionManagementGroups
+	azapiTypePolicyAssignment     = armTypePolicyAssignment + "@" + armAPIVersionPolicy
+	azapiTypePolicyDefinition     = armTypePolicyDefinition + "@" + armAPIVersionPolicy
+	azapiTypePolicySetDefinition  = armTypePolicySetDefinition + "@" + armAPIVersionPolicy
+	azapiTypeRoleAssignment       = armTypeRoleAssignment + "@" + armAPIVersionAuthorization
+	azapiTypeRoleDefinition       = armTypeRoleDefinition + "@" + armAPIVersionAuthorization
+	azapiTypeUserAssignedIdentity = "Microsoft.ManagedIdentity/userAssignedIdentities@" + armAPIVersionManagedIdentity
+)
+
+const (
+	tfLabelPrefixManagementGroup      = "mg"
+	tfLabelPrefixPolicyAssignment     = "pa"
+	tfLabelPrefixPolicyDefinition     = "pd"
+	tfLabelPrefixPolicySetDefinition  = "psd"
+	tfLabelPrefixRoleAssignment       = "ra"
+	tfLabelPrefixRoleDefinition       = "rd"
+	tfLabelPrefixSubscription         = "sub"
+	tfLabelPrefixUserAssignedIdentity = "uai"
+)
+
+// tfLabelInvalidChars matches characters that are not valid in a Terraform identifier.
+var tfLabelInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// tfResourceBlocks is a map of resource label to resource body for a single resource type.
+type tfResourceBlocks map[string]map[string]any
+
+// tfAddresses is used to resolve the Terraform addresses of resources in the hierarchy.
+type tfAddresses struct {
+	// map of lower case resource id to address
+	byResourceID map[string]string
+	// map of lower case role definition name (guid) to address
+	roleDefinitionByName map[string]string
+	// map of management group name and policy assignment name to address
+	policyAssignmentByMg map[string]map[string]string
+	// labels in use, to detect collisions after sanitization
+	labels mapset.Set[string]
+}
+
+// Write implements HierarchyWriter.
+func (w *TerraformWriter) Write(ctx context.Context, h *Hierarchy, outDir string) error {
+	if h == nil {
+		return errors.New("terraformwriter.write: hierarchy is nil")
+	}
+
+	if strings.TrimSpace(outDir) == "" {
+		return errors.New("terraformwriter.write: outDir is empty")
+	}
+
+	if err := os.MkdirAll(outDir, dirPerm); err != nil {
+		return fmt.Errorf("terraformwriter.write: creating outDir: %w", err)
+	}
+
+	roleAssignments, err := h.PolicyRoleAssignments(ctx)
+	if err != nil {
+		var praErrs *PolicyRoleAssignmentErrors
+		if !errors.As(err, &praErrs) || !w.opts.IgnorePolicyRoleAssignmentErrors {
+			return fmt.Errorf("terraformwriter.write: generating policy role assignments: %w", err)
+		}
+	}
+
+	addrs, err := newTfAddresses(h)
+	if err != nil {
+		return err
+	}
+
+	raByMg := make(map[string][]PolicyRoleAssignment)
+	for ra := range roleAssignments.Iter() {
+		raByMg[ra.ManagementGroupID] = append(raByMg[ra.ManagementGroupID], ra)
+	}
+
+	for _, name := range h.ManagementGroupNames() {
+		if err := ctxErr(ctx); err != nil {
+			return err
+		}
+
+		mg := h.ManagementGroup(name)
+		if mg == nil {
+			continue
+		}
+
+		blocks, dataBlocks, err := w.managementGroupResources(mg, addrs, raByMg[name])
+		if err != nil {
+			return err
+		}
+
+		file := filepath.Join(outDir, sanitizeFilename(mg.Name())+fileSuffixTerraformJSON)
+		content := map[string]any{
+			"resource": map[string]any{
+				azapiResourceType: blocks,
+			},
+		}
+
+		if len(dataBlocks) > 0 {
+			content["data"] = map[string]any{
+				azapiResourceType: dataBlocks,
+			}
+		}
+
+		if err := writeJSONFile(file, content); err != nil {
+			return fmt.Errorf("terraformwriter.write: writing management group %q: %w", name, err)
+		}
+	}
+
+	versionConstraint := w.opts.AzapiVersionConstraint
+	if versionConstraint == "" {
+		versionConstraint = defaultAzapiVersionConstraint
+	}
+
+	settings := map[string]any{
+		"terraform": map[string]any{
+			"required_providers": map[string]any{
+				"azapi": map[string]any{
+					"source":  azapiProviderSource,
+					"version": versionConstraint,
+				},
+			},
+		},
+	}
+
+	if err := writeJSONFile(filepath.Join(outDir, terraformSettingsFileName), settings); err != nil {
+		return fmt.Errorf("terraformwriter.write: writing terraform settings: %w", err)
+	}
+
+	return nil
+}
+
+// managementGroupResources generates the azapi resources and data sources for a single management group.
+func (w *TerraformWriter) managementGroupResources(
+	mg *HierarchyManagementGroup,
+	addrs *tfAddresses,
+	roleAssignments []PolicyRoleAssignment,
+) (tfResourceBlocks, tfResourceBlocks, error) {
+	blocks := make(tfResourceBlocks)
+	dataBlocks := make(tfResourceBlocks)
+
+	mgDeps := make([]string, 0, 1)
+	if addr, ok := addrs.byResourceID[strings.ToLower(mg.ResourceID())]; ok {
+		mgDeps = append(mgDeps, addr)
+	}
+
+	if !mg.Exists() {
+		parentDeps := make([]string, 0, 1)
+		if addr, ok := addrs.byResourceID[strings.ToLower(fmt.Sprintf(ManagementGroupIDFmt, mg.ParentID()))]; ok {
+			parentDeps = append(parentDeps, addr)
+		}
+
+		blocks[tfLabel(tfLabelPrefixManagementGroup, mg.Name())] = tfAzapiResource(
+			azapiTypeManagementGroup,
+			"/",
+			mg.Name(),
+			map[string]any{
+				"properties": map[string]any{
+					"displayName": mg.DisplayName(),
+					"details": map[string]any{
+						"parent": map[string]any{
+							"id": fmt.Sprintf(ManagementGroupIDFmt, mg.ParentID()),
+						},
+					},
+				},
+			},
+			parentDeps,
+		)
+	}
+
+	for _, pd := range mg.PolicyDefinitionsMap() {
+		props, err := tfBodyValue(pd.Properties)
+		if err != nil {
+			return nil, nil, fmt.Errorf("terraformwriter.managementGroupResources: policy definition %q: %w", *pd.Name, err)
+		}
+
+		blocks[tfLabel(tfLabelPrefixPolicyDefinition, mg.Name(), *pd.Name)] = tfAzapiResource(
+			azapiTypePolicyDefinition,
+			mg.ResourceID(),
+			*pd.Name,
+			map[string]any{"properties": props},
+			mgDeps,
+		)
+	}
+
+	for _, psd := range mg.PolicySetDefinitionsMap() {
+		deps := slices.Clone(mgDeps)
+
+		for _, ref := range psd.PolicyDefinitionReferences() {
+			if ref.PolicyDefinitionID == nil {
+				continue
+			}
+
+			if addr, ok := addrs.byResourceID[strings.ToLower(*ref.PolicyDefinitionID)]; ok {
+				deps = append(deps, addr)
+			}
+		}
+
+		props, err := tfBodyValue(psd.Properties)
+		if err != nil {
+			return nil, nil, fmt.Errorf(
+				"terraformwriter.managementGroupResources: policy set definition %q: %w", *psd.Name, err,
+			)
+		}
+
+		blocks[tfLabel(tfLabelPrefixPolicySetDefinition, mg.Name(), *psd.Name)] = tfAzapiResource(
+			azapiTypePolicySetDefinition,
+			mg.ResourceID(),
+			*psd.Name,
+			map[string]any{"properties": props},
+			deps,
+		)
+	}
+
+	for _, pa := range mg.PolicyAssignmentMap() {
+		deps := slices.Clone(mgDeps)
+		if pa.Properties.PolicyDefinitionID != nil {
+			if addr, ok := addrs.byResourceID[strings.ToLower(*pa.Properties.PolicyDefinitionID)]; ok {
+				deps = append(deps, addr)
+			}
+		}
+
+		props, err := tfBodyValue(pa.Properties)
+		if err != nil {
+			return nil, nil, fmt.Errorf("terraformwriter.managementGroupResources: policy assignment %q: %w", *pa.Name, err)
+		}
+
+		res := tfAzapiResource(
+			azapiTypePolicyAssignment,
+			mg.ResourceID(),
+			*pa.Name,
+			map[string]any{"properties": props},
+			deps,
+		)
+
+		if pa.Location != nil {
+			res["location"] = *pa.Location
+		}
+
+		if identity := tfIdentity(pa.Identity); identity != nil {
+			res["identity"] = identity
+		}
+
+		blocks[tfLabel(tfLabelPrefixPolicyAssignment, mg.Name(), *pa.Name)] = res
+	}
+
+	for _, rd := range mg.RoleDefinitionsMap() {
+		props, err := tfBodyValue(rd.Properties)
+		if err != nil {
+			return nil, nil, fmt.Errorf("terraformwriter.managementGroupResources: role definition %q: %w", *rd.Name, err)
+		}
+
+		blocks[tfLabel(tfLabelPrefixRoleDefinition, mg.Name(), *rd.Name)] = tfAzapiResource(
+			azapiTypeRoleDefinition,
+			mg.ResourceID(),
+			*rd.Name,
+			map[string]any{"properties": props},
+			mgDeps,
+		)
+	}
+
+	for _, ra := range roleAssignments {
+		paAddr, ok := addrs.policyAssignmentByMg[ra.ManagementGroupID][ra.AssignmentName]
+		if !ok {
+			return nil, nil, fmt.Errorf(
+				"terraformwriter.managementGroupResources: policy assignment %q not found in management group %q",
+				ra.AssignmentName,
+				ra.ManagementGroupID,
+			)
+		}
+
+		// the policy assignment dependency is implicit through the principal id reference.
+		deps := make([]string, 0, 2) //nolint:mnd
+		if addr, ok := addrs.byResourceID[strings.ToLower(ra.Scope)]; ok {
+			deps = append(deps, addr)
+		}
+
+		rdName := ra.RoleDefinitionID[strings.LastIndex(ra.RoleDefinitionID, "/")+1:]
+		if addr, ok := addrs.roleDefinitionByName[strings.ToLower(rdName)]; ok {
+			deps = append(deps, addr)
+		}
+
+		principalID, err := tfPrincipalID(mg.policyAssignments[ra.AssignmentName], paAddr, dataBlocks)
+		if err != nil {
+			return nil, nil, fmt.Errorf(
+				"terraformwriter.managementGroupResources: role assignment for policy assignment %q: %w",
+				ra.AssignmentName,
+				err,
+			)
+		}
+
+		name := policyRoleAssignmentName(ra)
+
+		blocks[tfLabel(tfLabelPrefixRoleAssignment, mg.Name(), name)] = tfAzapiResource(
+			azapiTypeRoleAssignment,
+			ra.Scope,
+			name,
+			map[string]any{
+				"properties": map[string]any{
+					"principalId":      principalID,
+					"principalType":    armPrincipalTypeServicePrinc,
+					"roleDefinitionId": ra.RoleDefinitionID,
+				},
+			},
+			deps,
+		)
+	}
+
+	for _, sub := range mg.Subscriptions() {
+		blocks[tfLabel(tfLabelPrefixSubscription, mg.Name(), sub)] = tfAzapiResource(
+			azapiTypeSubscription,
+			mg.ResourceID(),
+			sub,
+			map[string]any{},
+			mgDeps,
+		)
+	}
+
+	return blocks, dataBlocks, nil
+}
+
+// newTfAddresses builds the address lookups for all resources in the hierarchy.
+// Labels are checked for uniqueness as sanitization could cause collisions.
+func newTfAddresses(h *Hierarchy) (*tfAddresses, error) {
+	addrs := &tfAddresses{
+		byResourceID:         make(map[string]string),
+		roleDefinitionByName: make(map[string]string),
+		policyAssignmentByMg: make(map[string]map[string]string),
+		labels:               mapset.NewThreadUnsafeSet[string](),
+	}
+
+	add := func(label string) (string, error) {
+		if !addrs.labels.Add(label) {
+			return "", fmt.Errorf("terraformwriter.newTfAddresses: duplicate resource label %q", label)
+		}
+
+		return azapiResourceType + "." + label, nil
+	}
+
+	for _, name := range h.ManagementGroupNames() {
+		mg := h.ManagementGroup(name)
+		if mg == nil {
+			continue
+		}
+
+		if !mg.Exists() {
+			addr, err := add(tfLabel(tfLabelPrefixManagementGroup, mg.Name()))
+			if err != nil {
+				return nil, err
+			}
+
+			addrs.byResourceID[strings.ToLower(mg.ResourceID())] = addr
+		}
+
+		for _, pd := range mg.policyDefinitions {
+			addr, err := add(tfLabel(tfLabelPrefixPolicyDefinition, mg.Name(), *pd.Name))
+			if err != nil {
+				return nil, err
+			}
+
+			addrs.byResourceID[strings.ToLower(fmt.Sprintf(PolicyDefinitionIDFmt, mg.Name(), *pd.Name))] = addr
+		}
+
+		for _, psd := range mg.policySetDefinitions {
+			addr, err := add(tfLabel(tfLabelPrefixPolicySetDefinition, mg.Name(), *psd.Name))
+			if err != nil {
+				return nil, err
+			}
+
+			addrs.byResourceID[strings.ToLower(fmt.Sprintf(PolicySetDefinitionIDFmt, mg.Name(), *psd.Name))] = addr
+		}
+
+		addrs.policyAssignmentByMg[mg.Name()] = make(map[string]string, len(mg.policyAssignments))
+
+		for paName, pa := range mg.policyAssignments {
+			addr, err := add(tfLabel(tfLabelPrefixPolicyAssignment, mg.Name(), *pa.Name))
+			if err != nil {
+				return nil, err
+			}
+
+			addrs.byResourceID[strings.ToLower(fmt.Sprintf(PolicyAssignmentIDFmt, mg.Name(), *pa.Name))] = addr
+			addrs.policyAssignmentByMg[mg.Name()][paName] = addr
+		}
+
+		for _, rd := range mg.roleDefinitions {
+			addr, err := add(tfLabel(tfLabelPrefixRoleDefinition, mg.Name(), *rd.Name))
+			if err != nil {
+				return nil, err
+			}
+
+			addrs.byResourceID[strings.ToLower(fmt.Sprintf(RoleDefinitionIDFmt, mg.Name(), *rd.Name))] = addr
+			addrs.roleDefinitionByName[strings.ToLower(*rd.Name)] = addr
+		}
+
+		for _, sub := range mg.Subscriptions() {
+			if _, err := add(tfLabel(tfLabelPrefixSubscription, mg.Name(), sub)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return addrs, nil
+}
+
+// tfAzapiResource returns an azapi_resource block.
+// The depends_on list is de-duplicated and sorted to produce stable output.
+func tfAzapiResource(typ, parentID, name string, body map[string]any, dependsOn []string) map[string]any {
+	res := map[string]any{
+		"type":      typ,
+		"parent_id": parentID,
+		"name":      name,
+		"body":      body,
+	}
+
+	if len(dependsOn) == 0 {
+		return res
+	}
+
+	deps := slices.Clone(dependsOn)
+	slices.Sort(deps)
+	res["depends_on"] = slices.Compact(deps)
+
+	return res
+}
+
+// tfIdentity returns the azapi identity block for the policy assignment identity,
+// or nil if no identity is required.
+func tfIdentity(identity *armpolicy.Identity) map[string]any {
+	if identity == nil || identity.Type == nil || *identity.Type == armpolicy.ResourceIdentityTypeNone {
+		return nil
+	}
+
+	res := map[string]any{
+		"type": string(*identity.Type),
+	}
+
+	if len(identity.UserAssignedIdentities) == 0 {
+		return res
+	}
+
+	ids := make([]string, 0, len(identity.UserAssignedIdentities))
+	for id := range identity.UserAssignedIdentities {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+	res["identity_ids"] = ids
+
+	return res
+}
+
+// tfPrincipalID returns the principal id expression of the policy assignment identity, for use in a role
+// assignment. The principal id of a user assigned identity is not exported by the policy assignment, so it is read
+// using an azapi_resource data source, which is added to dataBlocks.
+func tfPrincipalID(pa *assets.PolicyAssignment, paAddr string, dataBlocks tfResourceBlocks) (string, error) {
+	if pa == nil || pa.Identity == nil || pa.Identity.Type == nil ||
+		*pa.Identity.Type != armpolicy.ResourceIdentityTypeUserAssigned {
+		return fmt.Sprintf("${%s.identity[0].principal_id}", paAddr), nil
+	}
+
+	if len(pa.Identity.UserAssignedIdentities) != 1 {
+		return "", fmt.Errorf(
+			"user assigned identity: expected exactly one identity, found %d", len(pa.Identity.UserAssignedIdentities),
+		)
+	}
+
+	var id string
+	for k := range pa.Identity.UserAssignedIdentities {
+		id = k
+	}
+
+	label := tfLabel(tfLabelPrefixUserAssignedIdentity, strings.TrimPrefix(paAddr, azapiResourceType+"."))
+	dataBlocks[label] = map[string]any{
+		"type":                   azapiTypeUserAssignedIdentity,
+		"resource_id":            id,
+		"response_export_values": []string{"properties.principalId"},
+	}
+
+	return fmt.Sprintf("${%s%s.output.properties.principalId}", azapiDataSourcePrefix, label), nil
+}
+
+// tfLabel generates a valid Terraform resource label from the supplied parts.
+func tfLabel(prefix string, parts ...string) string {
+	all := append([]string{prefix}, parts...)
+
+	return tfLabelInvalidChars.ReplaceAllString(strings.Join(all, "_"), "_")
+}
+
+// tfBodyValue converts v into generic JSON types and escapes any Terraform template sequences,
+// so that values are passed to the provider verbatim.
+func tfBodyValue(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshal for terraform: %w", err)
+	}
+
+	var m any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("unmarshal for terraform: %w", err)
+	}
+
+	return escapeTerraformTemplates(m), nil
+}
+
+// escapeTerraformTemplates escapes the `${` and `%{` template sequences in all strings,
+// including object keys, as Terraform JSON syntax would otherwise interpret them.
+func escapeTerraformTemplates(v any) any {
+	switch t := v.(type) {
+	case string:
+		return escapeTerraformTemplateString(t)
+	case map[string]any:
+		res := make(map[string]any, len(t))
+		for k, val := range t {
+			res[escapeTerraformTemplateString(k)] = escapeTerraformTemplates(val)
+		}
+
+		return res
+	case []any:
+		for i, elem := range t {
+			t[i] = escapeTerraformTemplates(elem)
+		}
+
+		return t
+	default:
+		// other scalar types (bool, float64, nil, etc.) are returned unchanged
+		return v
+	}
+}
+
+func escapeTerraformTemplateString(s string) string {
+	s = strings.ReplaceAll(s, "${", "$${")
+
+	return strings.ReplaceAll(s, "%{", "%%{")
+}
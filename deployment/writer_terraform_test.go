@@ -0,0 +1,129 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerraformWriter_ExportsSimple(t *testing.T) {
+	h := buildSimpleHierarchy(t)
+	require.NoError(t, h.AddSubscription("sub1", "simple"))
+
+	outDir := t.TempDir()
+	w := NewTerraformWriter(TerraformWriterOptions{})
+	require.NoError(t, w.Write(context.Background(), h, outDir))
+
+	_, err := os.Stat(filepath.Join(outDir, terraformSettingsFileName))
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(filepath.Join(outDir, "simple"+fileSuffixTerraformJSON))
+	require.NoError(t, err)
+
+	var content struct {
+		Resource map[string]map[string]map[string]any `json:"resource"`
+	}
+	require.NoError(t, json.Unmarshal(b, &content))
+
+	resources := content.Resource[azapiResourceType]
+	require.NotNil(t, resources)
+
+	mg, ok := resources["mg_simple"]
+	require.True(t, ok)
+	assert.Equal(t, azapiTypeManagementGroup, mg["type"])
+	assert.NotContains(t, mg, "depends_on", "root management group should not depend on anything")
+
+	pd, ok := resources["pd_simple_test-policy-definition"]
+	require.True(t, ok)
+	assert.Equal(t, "/providers/Microsoft.Management/managementGroups/simple", pd["parent_id"])
+	assert.ElementsMatch(t, []any{"azapi_resource.mg_simple"}, pd["depends_on"])
+
+	psd, ok := resources["psd_simple_test-policy-set-definition"]
+	require.True(t, ok)
+	assert.ElementsMatch(
+		t,
+		[]any{"azapi_resource.mg_simple", "azapi_resource.pd_simple_test-policy-definition"},
+		psd["depends_on"],
+	)
+
+	pa, ok := resources["pa_simple_test-pa"]
+	require.True(t, ok)
+	assert.ElementsMatch(
+		t,
+		[]any{"azapi_resource.mg_simple", "azapi_resource.pd_simple_test-policy-definition"},
+		pa["depends_on"],
+	)
+	assert.NotContains(t, pa, "identity")
+
+	sub, ok := resources["sub_simple_sub1"]
+	require.True(t, ok)
+	assert.Equal(t, azapiTypeSubscription, sub["type"])
+	assert.Equal(t, "/providers/Microsoft.Management/managementGroups/simple", sub["parent_id"])
+	assert.Equal(t, "sub1", sub["name"])
+	assert.ElementsMatch(t, []any{"azapi_resource.mg_simple"}, sub["depends_on"])
+}
+
+func TestTfLabel(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "pa_mg1_Deploy-ASC_Monitoring", tfLabel("pa", "mg1", "Deploy-ASC Monitoring"))
+	assert.Equal(t, "ra_a_b_c", tfLabel("ra", "a.b", "c"))
+}
+
+func TestEscapeTerraformTemplates(t *testing.T) {
+	t.Parallel()
+
+	in := map[string]any{
+		"a":      "${var.x}",
+		"${key}": []any{"%{if}", "plain", true, nil},
+	}
+	out := escapeTerraformTemplates(in)
+	assert.Equal(t, map[string]any{
+		"a":       "$${var.x}",
+		"$${key}": []any{"%%{if}", "plain", true, nil},
+	}, out)
+}
+
+func TestTfPrincipalID(t *testing.T) {
+	t.Parallel()
+
+	uaiID := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/" +
+		"Microsoft.ManagedIdentity/userAssignedIdentities/uai"
+
+	newPa := func(typ armpolicy.ResourceIdentityType, ids ...string) *assets.PolicyAssignment {
+		uais := make(map[string]*armpolicy.UserAssignedIdentitiesValue, len(ids))
+		for _, id := range ids {
+			uais[id] = &armpolicy.UserAssignedIdentitiesValue{}
+		}
+
+		return assets.NewPolicyAssignment(armpolicy.Assignment{
+			Name:     toPtr("pa"),
+			Identity: &armpolicy.Identity{Type: toPtr(typ), UserAssignedIdentities: uais},
+		})
+	}
+
+	data := make(tfResourceBlocks)
+	id, err := tfPrincipalID(newPa(armpolicy.ResourceIdentityTypeSystemAssigned), "azapi_resource.pa_mg_pa", data)
+	require.NoError(t, err)
+	assert.Equal(t, "${azapi_resource.pa_mg_pa.identity[0].principal_id}", id)
+	assert.Empty(t, data)
+
+	id, err = tfPrincipalID(newPa(armpolicy.ResourceIdentityTypeUserAssigned, uaiID), "azapi_resource.pa_mg_pa", data)
+	require.NoError(t, err)
+	assert.Equal(t, "${data.azapi_resource.uai_pa_mg_pa.output.properties.principalId}", id)
+	require.Contains(t, data, "uai_pa_mg_pa")
+	assert.Equal(t, uaiID, data["uai_pa_mg_pa"]["resource_id"])
+	assert.Equal(t, azapiTypeUserAssignedIdentity, data["uai_pa_mg_pa"]["type"])
+
+	_, err = tfPrincipalID(newPa(armpolicy.ResourceIdentityTypeUserAssigned), "azapi_resource.pa_mg_pa", data)
+	require.ErrorContains(t, err, "expected exactly one identity, found 0")
+}
@@ -34,6 +34,12 @@ func GetCloudFromEnv() cloud.Configuration {
 	return cld
 }
 
+// GetTenantIDFromEnv returns the tenant id from the ARM_TENANT_ID or AZURE_TENANT_ID environment variables,
+// or an empty string if neither is set.
+func GetTenantIDFromEnv() string {
+	return getFirstSetEnvVar("ARM_TENANT_ID", "AZURE_TENANT_ID")
+}
+
 // NewToken creates a new Entra token credential.
 // It uses well-known Terraform ARM environment variables to configure the token acquisition.
 func NewToken() (azcore.TokenCredential, error) {
@@ -56,7 +62,7 @@ func NewToken() (azcore.TokenCredential, error) {
 	opts.ClientIdFile = getFirstSetEnvVar("ARM_CLIENT_ID_FILE_PATH")
 	opts.ClientSecret = getFirstSetEnvVar("ARM_CLIENT_SECRET", "AZURE_CLIENT_SECRET")
 	opts.ClientSecretFile = getFirstSetEnvVar("ARM_CLIENT_SECRET_FILE_PATH")
-	opts.TenantId = getFirstSetEnvVar("ARM_TENANT_ID", "AZURE_TENANT_ID")
+	opts.TenantId = GetTenantIDFromEnv()
 	opts.ClientCertBase64 = getFirstSetEnvVar("ARM_CLIENT_CERTIFICATE")
 	opts.ClientCertPassword = []byte(getFirstSetEnvVar("ARM_CLIENT_CERTIFICATE_PASSWORD"))
 	opts.ClientCertPfxFile = getFirstSetEnvVar("ARM_CLIENT_CERTIFICATE_PATH")
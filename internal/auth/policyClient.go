@@ -0,0 +1,45 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Azure/alzlib/recording"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+// NewPolicyClientFactory creates an Azure policy client factory for the cloud from the environment.
+// If replayDir is set, responses are replayed from the fixture directory and no credential is required.
+// If recordDir is set, responses are recorded to the fixture directory.
+// See the recording package for details.
+func NewPolicyClientFactory(recordDir, replayDir string) (*armpolicy.ClientFactory, error) {
+	opts := &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Cloud: GetCloudFromEnv(),
+		},
+	}
+
+	if recordDir != "" && replayDir != "" {
+		return nil, errors.New("cannot both record and replay")
+	}
+
+	if replayDir != "" {
+		return recording.NewReplayClientFactory(replayDir, opts) //nolint:wrapcheck
+	}
+
+	creds, err := NewToken()
+	if err != nil {
+		return nil, fmt.Errorf("could not get Azure credential: %w", err)
+	}
+
+	if recordDir != "" {
+		return recording.NewRecordingClientFactory(recordDir, creds, opts) //nolint:wrapcheck
+	}
+
+	return armpolicy.NewClientFactory("", creds, opts) //nolint:wrapcheck
+}
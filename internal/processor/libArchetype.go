@@ -17,6 +17,7 @@ type LibArchetype struct {
 	Name                 string             `json:"name"                   yaml:"name"`
 	PolicyAssignments    mapset.Set[string] `json:"policy_assignments"     yaml:"policy_assignments"`
 	PolicyDefinitions    mapset.Set[string] `json:"policy_definitions"     yaml:"policy_definitions"`
+	PolicyExemptions     mapset.Set[string] `json:"policy_exemptions"      yaml:"policy_exemptions"`
 	PolicySetDefinitions mapset.Set[string] `json:"policy_set_definitions" yaml:"policy_set_definitions"`
 	RoleDefinitions      mapset.Set[string] `json:"role_definitions"       yaml:"role_definitions"`
 }
@@ -25,6 +26,7 @@ type libArchetypeUnmarshaler struct {
 	Name                 string   `json:"name"                   yaml:"name"`
 	PolicyAssignments    []string `json:"policy_assignments"     yaml:"policy_assignments"`
 	PolicyDefinitions    []string `json:"policy_definitions"     yaml:"policy_definitions"`
+	PolicyExemptions     []string `json:"policy_exemptions"      yaml:"policy_exemptions"`
 	PolicySetDefinitions []string `json:"policy_set_definitions" yaml:"policy_set_definitions"`
 	RoleDefinitions      []string `json:"role_definitions"       yaml:"role_definitions"`
 }
@@ -39,6 +41,7 @@ func (la *LibArchetype) UnmarshalJSON(data []byte) error {
 	la.Name = tmp.Name
 	la.PolicyAssignments = mapset.NewSet[string](tmp.PolicyAssignments...)
 	la.PolicyDefinitions = mapset.NewSet[string](tmp.PolicyDefinitions...)
+	la.PolicyExemptions = mapset.NewSet[string](tmp.PolicyExemptions...)
 	la.PolicySetDefinitions = mapset.NewSet[string](tmp.PolicySetDefinitions...)
 	la.RoleDefinitions = mapset.NewSet[string](tmp.RoleDefinitions...)
 
@@ -55,6 +58,7 @@ func (la *LibArchetype) UnmarshalYAML(n *yaml.Node) error {
 	la.Name = tmp.Name
 	la.PolicyAssignments = mapset.NewSet[string](tmp.PolicyAssignments...)
 	la.PolicyDefinitions = mapset.NewSet[string](tmp.PolicyDefinitions...)
+	la.PolicyExemptions = mapset.NewSet[string](tmp.PolicyExemptions...)
 	la.PolicySetDefinitions = mapset.NewSet[string](tmp.PolicySetDefinitions...)
 	la.RoleDefinitions = mapset.NewSet[string](tmp.RoleDefinitions...)
 
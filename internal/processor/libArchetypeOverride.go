@@ -20,7 +20,9 @@ type LibArchetypeOverride struct {
 	PolicyAssignmentsToAdd       mapset.Set[string] `json:"policy_assignments_to_add" yaml:"policy_assignments_to_add"`
 	PolicyAssignmentsToRemove    mapset.Set[string] `json:"policy_assignments_to_remove" yaml:"policy_assignments_to_remove"` //nolint:lll
 	PolicyDefinitionsToAdd       mapset.Set[string] `json:"policy_definitions_to_add" yaml:"policy_definitions_to_add"`
-	PolicyDefinitionsToRemove    mapset.Set[string] `json:"policy_definitions_to_remove" yaml:"policy_definitions_to_remove"`         //nolint:lll
+	PolicyDefinitionsToRemove    mapset.Set[string] `json:"policy_definitions_to_remove" yaml:"policy_definitions_to_remove"` //nolint:lll
+	PolicyExemptionsToAdd        mapset.Set[string] `json:"policy_exemptions_to_add" yaml:"policy_exemptions_to_add"`
+	PolicyExemptionsToRemove     mapset.Set[string] `json:"policy_exemptions_to_remove" yaml:"policy_exemptions_to_remove"`           //nolint:lll
 	PolicySetDefinitionsToAdd    mapset.Set[string] `json:"policy_set_definitions_to_add" yaml:"policy_set_definitions_to_add"`       //nolint:lll
 	PolicySetDefinitionsToRemove mapset.Set[string] `json:"policy_set_definitions_to_remove" yaml:"policy_set_definitions_to_remove"` //nolint:lll
 	RoleDefinitionsToAdd         mapset.Set[string] `json:"role_definitions_to_add" yaml:"role_definitions_to_add"`
@@ -34,6 +36,8 @@ type libArchetypeOverrideUnmarshaler struct {
 	PolicyAssignmentsToRemove    []string `json:"policy_assignments_to_remove"     yaml:"policy_assignments_to_remove"`
 	PolicyDefinitionsToAdd       []string `json:"policy_definitions_to_add"        yaml:"policy_definitions_to_add"`
 	PolicyDefinitionsToRemove    []string `json:"policy_definitions_to_remove"     yaml:"policy_definitions_to_remove"`
+	PolicyExemptionsToAdd        []string `json:"policy_exemptions_to_add"         yaml:"policy_exemptions_to_add"`
+	PolicyExemptionsToRemove     []string `json:"policy_exemptions_to_remove"      yaml:"policy_exemptions_to_remove"`
 	PolicySetDefinitionsToAdd    []string `json:"policy_set_definitions_to_add"    yaml:"policy_set_definitions_to_add"`
 	PolicySetDefinitionsToRemove []string `json:"policy_set_definitions_to_remove" yaml:"policy_set_definitions_to_remove"`
 	RoleDefinitionsToAdd         []string `json:"role_definitions_to_add"          yaml:"role_definitions_to_add"`
@@ -55,6 +59,9 @@ func (lao *LibArchetypeOverride) UnmarshalJSON(data []byte) error {
 	lao.PolicyDefinitionsToAdd = mapset.NewThreadUnsafeSet[string](tmp.PolicyDefinitionsToAdd...)
 	lao.PolicyDefinitionsToRemove = mapset.NewThreadUnsafeSet[string](
 		tmp.PolicyDefinitionsToRemove...)
+	lao.PolicyExemptionsToAdd = mapset.NewThreadUnsafeSet[string](tmp.PolicyExemptionsToAdd...)
+	lao.PolicyExemptionsToRemove = mapset.NewThreadUnsafeSet[string](
+		tmp.PolicyExemptionsToRemove...)
 	lao.PolicySetDefinitionsToAdd = mapset.NewThreadUnsafeSet[string](
 		tmp.PolicySetDefinitionsToAdd...)
 	lao.PolicySetDefinitionsToRemove = mapset.NewThreadUnsafeSet[string](
@@ -80,6 +87,9 @@ func (lao *LibArchetypeOverride) UnmarshalYAML(n *yaml.Node) error {
 	lao.PolicyDefinitionsToAdd = mapset.NewThreadUnsafeSet[string](tmp.PolicyDefinitionsToAdd...)
 	lao.PolicyDefinitionsToRemove = mapset.NewThreadUnsafeSet[string](
 		tmp.PolicyDefinitionsToRemove...)
+	lao.PolicyExemptionsToAdd = mapset.NewThreadUnsafeSet[string](tmp.PolicyExemptionsToAdd...)
+	lao.PolicyExemptionsToRemove = mapset.NewThreadUnsafeSet[string](
+		tmp.PolicyExemptionsToRemove...)
 	lao.PolicySetDefinitionsToAdd = mapset.NewThreadUnsafeSet[string](
 		tmp.PolicySetDefinitionsToAdd...)
 	lao.PolicySetDefinitionsToRemove = mapset.NewThreadUnsafeSet[string](
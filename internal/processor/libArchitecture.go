@@ -18,22 +18,25 @@ type LibArchitecture struct {
 }
 
 // LibArchitectureManagementGroup represents a management group in the library.
+// Subscriptions are the subscription ids, or placeholders, that are placed in the management group.
 type LibArchitectureManagementGroup struct {
-	ID          string             `json:"id"           yaml:"id"`
-	DisplayName string             `json:"display_name" yaml:"display_name"`
-	Archetypes  mapset.Set[string] `json:"archetypes"   yaml:"archetypes"`
-	ParentID    *string            `json:"parent_id"    yaml:"parent_id"`
-	Exists      bool               `json:"exists"       yaml:"exists"`
+	ID            string             `json:"id"            yaml:"id"`
+	DisplayName   string             `json:"display_name"  yaml:"display_name"`
+	Archetypes    mapset.Set[string] `json:"archetypes"    yaml:"archetypes"`
+	ParentID      *string            `json:"parent_id"     yaml:"parent_id"`
+	Exists        bool               `json:"exists"        yaml:"exists"`
+	Subscriptions mapset.Set[string] `json:"subscriptions" yaml:"subscriptions"`
 }
 
 type libArchitectureUnmarshaler struct {
 	Name             string `json:"name"              yaml:"name"`
 	ManagementGroups []struct {
-		ID          string   `json:"id" yaml:"id"`
-		DisplayName string   `json:"display_name" yaml:"display_name"`
-		Archetypes  []string `json:"archetypes" yaml:"archetypes"`
-		ParentID    *string  `json:"parent_id" yaml:"parent_id"`
-		Exists      bool     `json:"exists" yaml:"exists"`
+		ID            string   `json:"id" yaml:"id"`
+		DisplayName   string   `json:"display_name" yaml:"display_name"`
+		Archetypes    []string `json:"archetypes" yaml:"archetypes"`
+		ParentID      *string  `json:"parent_id" yaml:"parent_id"`
+		Exists        bool     `json:"exists" yaml:"exists"`
+		Subscriptions []string `json:"subscriptions" yaml:"subscriptions"`
 	} `json:"management_groups" yaml:"management_groups"`
 }
 
@@ -53,6 +56,7 @@ func (la *LibArchitecture) UnmarshalJSON(data []byte) error {
 		la.ManagementGroups[i].Archetypes = mapset.NewSet[string](mg.Archetypes...)
 		la.ManagementGroups[i].ParentID = mg.ParentID
 		la.ManagementGroups[i].Exists = mg.Exists
+		la.ManagementGroups[i].Subscriptions = mapset.NewSet[string](mg.Subscriptions...)
 	}
 
 	return nil
@@ -74,6 +78,7 @@ func (la *LibArchitecture) UnmarshalYAML(n *yaml.Node) error {
 		la.ManagementGroups[i].Archetypes = mapset.NewSet[string](mg.Archetypes...)
 		la.ManagementGroups[i].ParentID = mg.ParentID
 		la.ManagementGroups[i].Exists = mg.Exists
+		la.ManagementGroups[i].Subscriptions = mapset.NewSet[string](mg.Subscriptions...)
 	}
 
 	return nil
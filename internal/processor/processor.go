@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"path"
 	"path/filepath"
 	"regexp"
 	"slices"
@@ -21,6 +22,7 @@ import (
 const (
 	PolicyAssignmentFileType       = "alz_policy_assignment"
 	PolicyDefinitionFileType       = "alz_policy_definition"
+	PolicyExemptionFileType        = "alz_policy_exemption"
 	PolicySetDefinitionFileType    = "alz_policy_set_definition"
 	RoleDefinitionFileType         = "alz_role_definition"
 	ArchitectureDefinitionFileType = "alz_architecture_definition"
@@ -32,6 +34,7 @@ const (
 	archetypeOverrideSuffix        = ".+\\." + ArchetypeOverrideFileType + "\\.(?:json|yaml|yml)$"
 	policyAssignmentSuffix         = ".+\\." + PolicyAssignmentFileType + "\\.(?:json|yaml|yml)$"
 	policyDefinitionSuffix         = ".+\\." + PolicyDefinitionFileType + "\\.(?:json|yaml|yml)$"
+	policyExemptionSuffix          = ".+\\." + PolicyExemptionFileType + "\\.(?:json|yaml|yml)$"
 	policySetDefinitionSuffix      = ".+\\." + PolicySetDefinitionFileType + "\\.(?:json|yaml|yml)$"
 	roleDefinitionSuffix           = ".+\\." + RoleDefinitionFileType + "\\.(?:json|yaml|yml)$"
 	policyDefaultValueFileName     = "^" + PolicyDefaultValuesFileType + "\\.(?:json|yaml|yml)$"
@@ -54,6 +57,8 @@ var (
 	PolicyAssignmentRegex = regexp.MustCompile(policyAssignmentSuffix)
 	// PolicyDefinitionRegex matches policy definition files.
 	PolicyDefinitionRegex = regexp.MustCompile(policyDefinitionSuffix)
+	// PolicyExemptionRegex matches policy exemption files.
+	PolicyExemptionRegex = regexp.MustCompile(policyExemptionSuffix)
 	// PolicySetDefinitionRegex matches policy set definition files.
 	PolicySetDefinitionRegex = regexp.MustCompile(policySetDefinitionSuffix)
 	// RoleDefinitionRegex matches role definition files.
@@ -95,16 +100,21 @@ func NewErrorUnmarshaling(detail string) error {
 }
 
 // Result is the structure that gets built by scanning the library files.
+// Sources maps the file type, e.g. PolicyAssignmentFileType, and resource name to the path of the file,
+// within the library filesystem, that the resource was read from.
+// Versioned policy (set) definitions are keyed by `name@version`.
 type Result struct {
 	PolicyDefinitions                   map[string]*assets.PolicyDefinitionVersions
 	PolicySetDefinitions                map[string]*assets.PolicySetDefinitionVersions
 	PolicyAssignments                   map[string]*assets.PolicyAssignment
+	PolicyExemptions                    map[string]*assets.PolicyExemption
 	RoleDefinitions                     map[string]*assets.RoleDefinition
 	LibArchetypes                       map[string]*LibArchetype
 	LibArchetypeOverrides               map[string]*LibArchetypeOverride
 	LibDefaultPolicyValues              map[string]*LibDefaultPolicyValuesDefaults
 	LibArchitectures                    map[string]*LibArchitecture
 	Metadata                            *LibMetadata
+	Sources                             map[string]map[string]string
 	libDefaultPolicyValuesFileProcessed bool
 }
 
@@ -114,18 +124,43 @@ func NewResult() *Result {
 		PolicyDefinitions:                   make(map[string]*assets.PolicyDefinitionVersions),
 		PolicySetDefinitions:                make(map[string]*assets.PolicySetDefinitionVersions),
 		PolicyAssignments:                   make(map[string]*assets.PolicyAssignment),
+		PolicyExemptions:                    make(map[string]*assets.PolicyExemption),
 		RoleDefinitions:                     make(map[string]*assets.RoleDefinition),
 		LibArchetypes:                       make(map[string]*LibArchetype),
 		LibArchetypeOverrides:               make(map[string]*LibArchetypeOverride),
 		LibDefaultPolicyValues:              make(map[string]*LibDefaultPolicyValuesDefaults),
 		LibArchitectures:                    make(map[string]*LibArchitecture),
 		Metadata:                            nil,
+		Sources:                             make(map[string]map[string]string),
 		libDefaultPolicyValuesFileProcessed: false,
 	}
 }
 
+// addSource records the path of the file as the source of the named resource.
+func (res *Result) addSource(fileType, name, path string) {
+	if res.Sources == nil {
+		res.Sources = make(map[string]map[string]string)
+	}
+
+	if _, ok := res.Sources[fileType]; !ok {
+		res.Sources[fileType] = make(map[string]string)
+	}
+
+	res.Sources[fileType][name] = path
+}
+
+// versionedSourceName returns the Sources key for a versioned policy (set) definition.
+func versionedSourceName(name string, version *string) string {
+	if version == nil {
+		return name
+	}
+
+	return name + "@" + *version
+}
+
 // processFunc is the function signature that is used to process different types of lib file.
-type processFunc func(result *Result, data Unmarshaler) error
+// The path is that of the file within the library filesystem, recorded as the source of the resources.
+type processFunc func(result *Result, data Unmarshaler, path string) error
 
 // Client is the client that is used to process the library files.
 type Client struct {
@@ -227,7 +262,7 @@ func (client *Client) Process(res *Result) error {
 			return fmt.Errorf("ProcessorClient.Process: opening file %s: %w", path, err)
 		}
 
-		return classifyLibFile(res, file, d.Name())
+		return classifyLibFile(res, file, path)
 	}); err != nil {
 		return err //nolint:wrapcheck
 	}
@@ -236,42 +271,47 @@ func (client *Client) Process(res *Result) error {
 }
 
 // classifyLibFile identifies the supplied file and adds calls the appropriate processFunc.
-func classifyLibFile(res *Result, file fs.File, name string) error {
+// The path is relative to the root of the library filesystem.
+func classifyLibFile(res *Result, file fs.File, libPath string) error {
 	err := error(nil)
 
 	// process by file type
-	switch n := strings.ToLower(name); {
+	switch n := strings.ToLower(path.Base(libPath)); {
 	// if the file is a policy definition
 	case PolicyDefinitionRegex.MatchString(n):
-		err = readAndProcessFile(res, file, processPolicyDefinition)
+		err = readAndProcessFile(res, file, libPath, processPolicyDefinition)
 
 	// if the file is a policy set definition
 	case PolicySetDefinitionRegex.MatchString(n):
-		err = readAndProcessFile(res, file, processPolicySetDefinition)
+		err = readAndProcessFile(res, file, libPath, processPolicySetDefinition)
 
 	// if the file is a policy assignment
 	case PolicyAssignmentRegex.MatchString(n):
-		err = readAndProcessFile(res, file, processPolicyAssignment)
+		err = readAndProcessFile(res, file, libPath, processPolicyAssignment)
+
+	// if the file is a policy exemption
+	case PolicyExemptionRegex.MatchString(n):
+		err = readAndProcessFile(res, file, libPath, processPolicyExemption)
 
 	// if the file is a role definition
 	case RoleDefinitionRegex.MatchString(n):
-		err = readAndProcessFile(res, file, processRoleDefinition)
+		err = readAndProcessFile(res, file, libPath, processRoleDefinition)
 
 	// if the file is an archetype definition
 	case ArchetypeDefinitionRegex.MatchString(n):
-		err = readAndProcessFile(res, file, processArchetype)
+		err = readAndProcessFile(res, file, libPath, processArchetype)
 
 	// if the file is an archetype override
 	case ArchetypeOverrideRegex.MatchString(n):
-		err = readAndProcessFile(res, file, processArchetypeOverride)
+		err = readAndProcessFile(res, file, libPath, processArchetypeOverride)
 
 	// if the file is an policy default values file
 	case PolicyDefaultValuesRegex.MatchString(n):
-		err = readAndProcessFile(res, file, processDefaultPolicyValue)
+		err = readAndProcessFile(res, file, libPath, processDefaultPolicyValue)
 
 		// if the file is an architecture definition
 	case ArchitectureDefinitionRegex.MatchString(n):
-		err = readAndProcessFile(res, file, processArchitecture)
+		err = readAndProcessFile(res, file, libPath, processArchitecture)
 	}
 
 	if err != nil {
@@ -285,7 +325,7 @@ func classifyLibFile(res *Result, file fs.File, name string) error {
 
 // processArchitecture is a processFunc that reads the default_policy_values
 // bytes, processes, then adds the created processArchitecture to the result.
-func processArchitecture(res *Result, unmar Unmarshaler) error {
+func processArchitecture(res *Result, unmar Unmarshaler, path string) error {
 	arch := new(LibArchitecture)
 	if err := unmar.Unmarshal(arch); err != nil {
 		return errors.Join(NewErrorUnmarshaling("architecture definition"), err)
@@ -300,13 +340,14 @@ func processArchitecture(res *Result, unmar Unmarshaler) error {
 	}
 
 	res.LibArchitectures[arch.Name] = arch
+	res.addSource(ArchitectureDefinitionFileType, arch.Name, path)
 
 	return nil
 }
 
 // processDefaultPolicyValue is a processFunc that reads the default_policy_value
 // bytes, processes, then adds the created LibDefaultPolicyValues to the result.
-func processDefaultPolicyValue(res *Result, unmar Unmarshaler) error {
+func processDefaultPolicyValue(res *Result, unmar Unmarshaler, path string) error {
 	if res.libDefaultPolicyValuesFileProcessed {
 		return ErrMultipleDefaultPolicyValuesFileFound
 	}
@@ -322,6 +363,7 @@ func processDefaultPolicyValue(res *Result, unmar Unmarshaler) error {
 		}
 
 		res.LibDefaultPolicyValues[def.DefaultName] = &def
+		res.addSource(PolicyDefaultValuesFileType, def.DefaultName, path)
 	}
 
 	res.libDefaultPolicyValuesFileProcessed = true
@@ -331,7 +373,7 @@ func processDefaultPolicyValue(res *Result, unmar Unmarshaler) error {
 
 // processArchetype is a processFunc that reads the archetype_definition
 // bytes, processes, then adds the created LibArchetype to the result.
-func processArchetype(res *Result, unmar Unmarshaler) error {
+func processArchetype(res *Result, unmar Unmarshaler, path string) error {
 	la := new(LibArchetype)
 	if err := unmar.Unmarshal(la); err != nil {
 		return errors.Join(NewErrorUnmarshaling("archetype definition"), err)
@@ -342,13 +384,14 @@ func processArchetype(res *Result, unmar Unmarshaler) error {
 	}
 
 	res.LibArchetypes[la.Name] = la
+	res.addSource(ArchetypeDefinitionFileType, la.Name, path)
 
 	return nil
 }
 
 // processArchetypeOverride is a processFunc that reads the archetype_override
 // bytes, processes, then adds the created LibArchetypeOverride to the result.
-func processArchetypeOverride(res *Result, unmar Unmarshaler) error {
+func processArchetypeOverride(res *Result, unmar Unmarshaler, path string) error {
 	lao := new(LibArchetypeOverride)
 	if err := unmar.Unmarshal(lao); err != nil {
 		return errors.Join(NewErrorUnmarshaling("archetype override"), err)
@@ -359,13 +402,14 @@ func processArchetypeOverride(res *Result, unmar Unmarshaler) error {
 	}
 
 	res.LibArchetypeOverrides[lao.Name] = lao
+	res.addSource(ArchetypeOverrideFileType, lao.Name, path)
 
 	return nil
 }
 
 // processPolicyAssignment is a processFunc that reads the policy_assignment
 // bytes, processes, then adds the created assets.PolicyAssignment to the result.
-func processPolicyAssignment(res *Result, unmar Unmarshaler) error {
+func processPolicyAssignment(res *Result, unmar Unmarshaler, path string) error {
 	pa := new(assets.PolicyAssignment)
 	if err := unmar.Unmarshal(pa); err != nil {
 		return errors.Join(NewErrorUnmarshaling("policy assignment"), err)
@@ -380,13 +424,36 @@ func processPolicyAssignment(res *Result, unmar Unmarshaler) error {
 	}
 
 	res.PolicyAssignments[*pa.Name] = pa
+	res.addSource(PolicyAssignmentFileType, *pa.Name, path)
+
+	return nil
+}
+
+// processPolicyExemption is a processFunc that reads the policy_exemption
+// bytes, processes, then adds the created assets.PolicyExemption to the result.
+func processPolicyExemption(res *Result, unmar Unmarshaler, path string) error {
+	pe := new(assets.PolicyExemption)
+	if err := unmar.Unmarshal(pe); err != nil {
+		return errors.Join(NewErrorUnmarshaling("policy exemption"), err)
+	}
+
+	if pe.Name == nil || *pe.Name == "" {
+		return NewErrNoNameProvided("policy exemption")
+	}
+
+	if _, exists := res.PolicyExemptions[*pe.Name]; exists {
+		return NewErrResourceAlreadyExists("policy exemption", *pe.Name)
+	}
+
+	res.PolicyExemptions[*pe.Name] = pe
+	res.addSource(PolicyExemptionFileType, *pe.Name, path)
 
 	return nil
 }
 
 // processPolicyAssignment is a processFunc that reads the policy_definition
 // bytes, processes, then adds the created assets.PolicyDefinition to the result.
-func processPolicyDefinition(res *Result, unmar Unmarshaler) error {
+func processPolicyDefinition(res *Result, unmar Unmarshaler, path string) error {
 	pd := new(assets.PolicyDefinition)
 	if err := unmar.Unmarshal(pd); err != nil {
 		return errors.Join(NewErrorUnmarshaling("policy definition"), err)
@@ -423,12 +490,14 @@ func processPolicyDefinition(res *Result, unmar Unmarshaler) error {
 		)
 	}
 
+	res.addSource(PolicyDefinitionFileType, versionedSourceName(*pd.Name, pd.GetVersion()), path)
+
 	return nil
 }
 
 // processPolicyAssignment is a processFunc that reads the policy_set_definition
 // bytes, processes, then adds the created assets.PolicySetDefinition to the result.
-func processPolicySetDefinition(res *Result, unmar Unmarshaler) error {
+func processPolicySetDefinition(res *Result, unmar Unmarshaler, path string) error {
 	psd := new(assets.PolicySetDefinition)
 	if err := unmar.Unmarshal(psd); err != nil {
 		return errors.Join(NewErrorUnmarshaling("policy set definition"), err)
@@ -464,6 +533,8 @@ func processPolicySetDefinition(res *Result, unmar Unmarshaler) error {
 		)
 	}
 
+	res.addSource(PolicySetDefinitionFileType, versionedSourceName(*psd.Name, psd.GetVersion()), path)
+
 	return nil
 }
 
@@ -472,7 +543,7 @@ func processPolicySetDefinition(res *Result, unmar Unmarshaler) error {
 // We use Properties.RoleName as the key in the result map, as the GUID must be unique and a role
 // definition may be
 // deployed at multiple scopes.
-func processRoleDefinition(res *Result, unmar Unmarshaler) error {
+func processRoleDefinition(res *Result, unmar Unmarshaler, path string) error {
 	rd := new(assets.RoleDefinition)
 	if err := unmar.Unmarshal(rd); err != nil {
 		return errors.Join(NewErrorUnmarshaling("role definition"), err)
@@ -487,13 +558,14 @@ func processRoleDefinition(res *Result, unmar Unmarshaler) error {
 	}
 	// Use roleName here not the name, which is a GUID
 	res.RoleDefinitions[*rd.Properties.RoleName] = rd
+	res.addSource(RoleDefinitionFileType, *rd.Properties.RoleName, path)
 
 	return nil
 }
 
 // readAndProcessFile reads the file bytes at the supplied path and processes it using the supplied
 // processFunc.
-func readAndProcessFile(res *Result, file fs.File, processFn processFunc) error {
+func readAndProcessFile(res *Result, file fs.File, path string, processFn processFunc) error {
 	s, err := file.Stat()
 	if err != nil {
 		return err //nolint:wrapcheck
@@ -512,7 +584,7 @@ func readAndProcessFile(res *Result, file fs.File, processFn processFunc) error
 	unmar := NewUnmarshaler(data, ext)
 
 	// pass the  data to the supplied process function
-	if err := processFn(res, unmar); err != nil {
+	if err := processFn(res, unmar, path); err != nil {
 		return err //nolint:wrapcheck
 	}
 
@@ -32,6 +32,11 @@ func TestFullLibrary(t *testing.T) {
 	assert.Len(t, res.LibArchetypeOverrides, 1)
 	assert.Len(t, res.LibDefaultPolicyValues, 1)
 	assert.Len(t, res.LibArchitectures["alz"].ManagementGroups, 9)
+	assert.Equal(t, "archetype_definitions/root.alz_archetype_definition.json",
+		res.Sources[ArchetypeDefinitionFileType]["root"])
+	assert.Equal(t, "architecture_definitions/alz.alz_architecture_definition.json",
+		res.Sources[ArchitectureDefinitionFileType]["alz"])
+	assert.Len(t, res.Sources[PolicyAssignmentFileType], len(res.PolicyAssignments))
 	assert.Equal(t, "test", res.Metadata.Name)
 	assert.Equal(t, "test display name.", res.Metadata.DisplayName)
 	assert.Equal(t, "test description", res.Metadata.Description)
@@ -67,7 +72,7 @@ func TestProcessArchetypeOverrideValid(t *testing.T) {
 		LibArchetypeOverrides: make(map[string]*LibArchetypeOverride, 0),
 	}
 	unmar := NewUnmarshaler(sampleData, ".json")
-	require.NoError(t, processArchetypeOverride(res, unmar))
+	require.NoError(t, processArchetypeOverride(res, unmar, "test.json"))
 	assert.Len(t, res.LibArchetypeOverrides, 1)
 	assert.Equal(t, 1, res.LibArchetypeOverrides["test"].PolicyAssignmentsToAdd.Cardinality())
 	assert.Equal(t, 1, res.LibArchetypeOverrides["test"].PolicyAssignmentsToRemove.Cardinality())
@@ -84,7 +89,7 @@ func TestProcessArchetypeOverrideInvalid(t *testing.T) {
 		LibArchetypeOverrides: make(map[string]*LibArchetypeOverride, 0),
 	}
 	unmar := NewUnmarshaler(sampleData, ".json")
-	err := processArchetypeOverride(res, unmar)
+	err := processArchetypeOverride(res, unmar, "test.json")
 	require.ErrorContains(t, err, "invalid character ']' after object key:value pair")
 }
 
@@ -97,7 +102,7 @@ func TestProcessArchetypeDefinitionValid(t *testing.T) {
 		LibArchetypes: make(map[string]*LibArchetype, 0),
 	}
 	unmar := NewUnmarshaler(sampleData, ".json")
-	require.NoError(t, processArchetype(res, unmar))
+	require.NoError(t, processArchetype(res, unmar, "test.json"))
 	assert.Len(t, res.LibArchetypes, 1)
 	assert.Equal(t, 1, res.LibArchetypes["test"].PolicyAssignments.Cardinality())
 	assert.Equal(t, 1, res.LibArchetypes["test"].PolicyDefinitions.Cardinality())
@@ -115,7 +120,7 @@ func Test_processArchetypeDefinition_invalidJson(t *testing.T) {
 		LibArchetypes: make(map[string]*LibArchetype, 0),
 	}
 	unmar := NewUnmarshaler(sampleData, ".json")
-	require.ErrorContains(t, processArchetype(res, unmar), "invalid character '[' after object key")
+	require.ErrorContains(t, processArchetype(res, unmar, "test.json"), "invalid character '[' after object key")
 }
 
 // TestProcessPolicyAssignmentValid tests the processing of a valid policy assignment.
@@ -127,7 +132,7 @@ func TestProcessPolicyAssignmentValid(t *testing.T) {
 		PolicyAssignments: make(map[string]*assets.PolicyAssignment),
 	}
 	unmar := NewUnmarshaler(sampleData, ".json")
-	require.NoError(t, processPolicyAssignment(res, unmar))
+	require.NoError(t, processPolicyAssignment(res, unmar, "test.json"))
 	assert.Len(t, res.PolicyAssignments, 1)
 	assert.Equal(t, "Deny-Storage-http", *res.PolicyAssignments["Deny-Storage-http"].Name)
 	assert.Equal(
@@ -148,7 +153,36 @@ func TestProcessPolicyAssignmentNoName(t *testing.T) {
 	}
 	unmar := NewUnmarshaler(sampleData, ".json")
 	target := &assets.ErrPropertyMustNotBeNil{}
-	require.ErrorAs(t, processPolicyAssignment(res, unmar), &target)
+	require.ErrorAs(t, processPolicyAssignment(res, unmar, "test.json"), &target)
+}
+
+// TestProcessPolicyExemption tests the processing of policy exemptions.
+func TestProcessPolicyExemption(t *testing.T) {
+	t.Parallel()
+
+	sampleData := []byte(`{
+  "name": "Exempt-Storage-http",
+  "properties": {
+    "policyAssignmentId": "/providers/Microsoft.Management/managementGroups/placeholder/providers/Microsoft.Authorization/policyAssignments/Deny-Storage-http",
+    "exemptionCategory": "Waiver"
+  }
+}`)
+	res := NewResult()
+	require.NoError(t, processPolicyExemption(res, NewUnmarshaler(sampleData, ".json"), "test.json"))
+	assert.Len(t, res.PolicyExemptions, 1)
+	assert.Equal(t, "Exempt-Storage-http", *res.PolicyExemptions["Exempt-Storage-http"].Name)
+	require.ErrorIs(
+		t,
+		processPolicyExemption(res, NewUnmarshaler(sampleData, ".json"), "test.json"),
+		ErrResourceAlreadyExists,
+	)
+
+	target := &assets.ErrPropertyMustNotBeNil{}
+	require.ErrorAs(
+		t,
+		processPolicyExemption(res, NewUnmarshaler([]byte(`{"properties": {}}`), ".json"), "test.json"),
+		&target,
+	)
 }
 
 // TestProcessPolicyDefinitionValid tests the processing of a valid policy definition.
@@ -160,7 +194,7 @@ func TestProcessPolicyDefinitionValid(t *testing.T) {
 		PolicyDefinitions: make(map[string]*assets.PolicyDefinitionVersions),
 	}
 	unmar := NewUnmarshaler(sampleData, ".json")
-	require.NoError(t, processPolicyDefinition(res, unmar))
+	require.NoError(t, processPolicyDefinition(res, unmar, "test.json"))
 	assert.Len(t, res.PolicyDefinitions, 1)
 	pdv, err := res.PolicyDefinitions["Append-AppService-httpsonly"].GetVersion(nil)
 	require.NoError(t, err)
@@ -189,7 +223,7 @@ func TestProcessPolicyDefinitionNoName(t *testing.T) {
 	target := &assets.ErrPropertyLength{}
 	require.ErrorAs(
 		t,
-		processPolicyDefinition(res, unmar),
+		processPolicyDefinition(res, unmar, "test.json"),
 		&target,
 	)
 }
@@ -203,7 +237,7 @@ func TestProcessPolicySetDefinitionValid(t *testing.T) {
 		PolicySetDefinitions: make(map[string]*assets.PolicySetDefinitionVersions),
 	}
 	unmar := NewUnmarshaler(sampleData, ".json")
-	require.NoError(t, processPolicySetDefinition(res, unmar))
+	require.NoError(t, processPolicySetDefinition(res, unmar, "test.json"))
 	assert.Len(t, res.PolicySetDefinitions, 1)
 	psdv, err := res.PolicySetDefinitions["Deploy-MDFC-Config"].GetVersion(nil)
 	require.NoError(t, err)
@@ -227,7 +261,7 @@ func TestProcessPolicySetDefinitionsValid(t *testing.T) {
 
 	for _, data := range [][]byte{sampleData, sampleData2} {
 		unmar := NewUnmarshaler(data, ".json")
-		require.NoError(t, processPolicySetDefinition(res, unmar))
+		require.NoError(t, processPolicySetDefinition(res, unmar, "test.json"))
 	}
 
 	assert.Len(t, res.PolicySetDefinitions, 1)
@@ -269,7 +303,7 @@ func TestProcessPolicyDefinitionsValid(t *testing.T) {
 
 	for _, data := range [][]byte{sampleData, sampleData2} {
 		unmar := NewUnmarshaler(data, ".json")
-		require.NoError(t, processPolicyDefinition(res, unmar))
+		require.NoError(t, processPolicyDefinition(res, unmar, "test.json"))
 	}
 
 	assert.Len(t, res.PolicyDefinitions, 1)
@@ -312,7 +346,7 @@ func TestProcessPolicySetDefinitionNoName(t *testing.T) {
 	target := &assets.ErrPropertyMustNotBeNil{}
 	require.ErrorAs(
 		t,
-		processPolicySetDefinition(res, unmar),
+		processPolicySetDefinition(res, unmar, "test.json"),
 		&target,
 	)
 }
@@ -324,7 +358,7 @@ func TestProcessPolicyAssignmentNoData(t *testing.T) {
 
 	res := &Result{}
 	unmar := NewUnmarshaler([]byte{}, ".json")
-	require.ErrorContains(t, processPolicyAssignment(res, unmar), "unexpected end of JSON input")
+	require.ErrorContains(t, processPolicyAssignment(res, unmar, "test.json"), "unexpected end of JSON input")
 }
 
 // TestProcessPolicyDefinitionNoData tests the processing of an invalid policy definition with no
@@ -334,7 +368,7 @@ func TestProcessPolicyDefinitionNoData(t *testing.T) {
 
 	res := &Result{}
 	unmar := NewUnmarshaler([]byte{}, ".json")
-	require.ErrorContains(t, processPolicyDefinition(res, unmar), "unexpected end of JSON input")
+	require.ErrorContains(t, processPolicyDefinition(res, unmar, "test.json"), "unexpected end of JSON input")
 }
 
 // TestProcessSetPolicyDefinitionNoData tests the processing of an invalid policy set definition
@@ -344,7 +378,7 @@ func TestProcessPolicySetDefinitionNoData(t *testing.T) {
 
 	res := &Result{}
 	unmar := NewUnmarshaler([]byte{}, ".json")
-	require.ErrorContains(t, processPolicySetDefinition(res, unmar), "unexpected end of JSON input")
+	require.ErrorContains(t, processPolicySetDefinition(res, unmar, "test.json"), "unexpected end of JSON input")
 }
 
 // TestProcessRoleDefinitionWithDataActions tests the processing of a role definition with data
@@ -357,7 +391,7 @@ func TestProcessRoleDefinitionWithDataActions(t *testing.T) {
 		RoleDefinitions: make(map[string]*assets.RoleDefinition),
 	}
 	unmar := NewUnmarshaler(sampleData, ".json")
-	require.NoError(t, processRoleDefinition(res, unmar))
+	require.NoError(t, processRoleDefinition(res, unmar, "test.json"))
 	assert.Len(t, res.RoleDefinitions, 1)
 	assert.Equal(
 		t,
@@ -1485,6 +1519,7 @@ func TestProcessorRegex(t *testing.T) {
 		"alz_archetype_override":      ArchetypeOverrideRegex,
 		"alz_policy_definition":       PolicyDefinitionRegex,
 		"alz_policy_assignment":       PolicyAssignmentRegex,
+		"alz_policy_exemption":        PolicyExemptionRegex,
 		"alz_policy_set_definition":   PolicySetDefinitionRegex,
 		"alz_role_definition":         RoleDefinitionRegex,
 	}
@@ -5,10 +5,10 @@ package checks
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/Azure/alzlib"
 	"github.com/Azure/alzlib/internal/tools/checker"
-	mapset "github.com/deckarep/golang-set/v2"
 )
 
 // CheckAllDefinitionsAreReferenced is a validator check that ensures all policy definitions, policy set definitions,
@@ -23,26 +23,10 @@ func CheckAllDefinitionsAreReferenced(az *alzlib.AlzLib) checker.ValidatorCheck
 func checkAllDefinitionsAreReferenced(az *alzlib.AlzLib) func() error {
 	return func() error {
 		// Test if we have policy (set) definitions that are not referenced by any archetype
-		referencedPds := mapset.NewThreadUnsafeSet[string]()
-		referencedPsds := mapset.NewThreadUnsafeSet[string]()
-		referencedRds := mapset.NewThreadUnsafeSet[string]()
-
-		for _, archetypeName := range az.Archetypes() {
-			archetype := az.Archetype(archetypeName) // nolint: errcheck
-			referencedPds = referencedPds.Union(archetype.PolicyDefinitions)
-			referencedPsds = referencedPsds.Union(archetype.PolicySetDefinitions)
-			referencedRds = referencedRds.Union(archetype.RoleDefinitions)
-		}
-
-		unreferencedPds := mapset.NewThreadUnsafeSet(az.PolicyDefinitions()...).
-			Difference(referencedPds).
-			ToSlice()
-		unreferencedPsds := mapset.NewThreadUnsafeSet(az.PolicySetDefinitions()...).
-			Difference(referencedPsds).
-			ToSlice()
-		unreferencedRds := mapset.NewThreadUnsafeSet(az.RoleDefinitions()...).
-			Difference(referencedRds).
-			ToSlice()
+		g := az.ReferenceGraph()
+		unreferencedPds := unreferencedByArchetypes(g, alzlib.AssetTypePolicyDefinition, az.PolicyDefinitions())
+		unreferencedPsds := unreferencedByArchetypes(g, alzlib.AssetTypePolicySetDefinition, az.PolicySetDefinitions())
+		unreferencedRds := unreferencedByArchetypes(g, alzlib.AssetTypeRoleDefinition, az.RoleDefinitions())
 
 		if len(unreferencedPds) > 0 || len(unreferencedPsds) > 0 || len(unreferencedRds) > 0 {
 			return fmt.Errorf(
@@ -57,3 +41,19 @@ func checkAllDefinitionsAreReferenced(az *alzlib.AlzLib) func() error {
 		return nil
 	}
 }
+
+// unreferencedByArchetypes returns the names of the assets that are not referenced by any archetype.
+func unreferencedByArchetypes(g *alzlib.ReferenceGraph, typ alzlib.AssetType, names []string) []string {
+	res := make([]string, 0)
+
+	for _, name := range names {
+		referenced := slices.ContainsFunc(g.ReferencedBy(typ, name), func(ref alzlib.AssetReference) bool {
+			return ref.Type == alzlib.AssetTypeArchetype
+		})
+		if !referenced {
+			res = append(res, name)
+		}
+	}
+
+	return res
+}
@@ -103,6 +103,7 @@ func checkLibraryFileNames(path string, opts *CheckLibraryFileNameOptions) func(
 		processor.ArchitectureDefinitionRegex,
 		processor.PolicyAssignmentRegex,
 		processor.PolicyDefinitionRegex,
+		processor.PolicyExemptionRegex,
 		processor.PolicySetDefinitionRegex,
 		processor.RoleDefinitionRegex,
 	}
@@ -214,6 +215,7 @@ var armType2FileNameType = map[string]string{
 	"microsoft.authorization/policydefinitions":    processor.PolicyDefinitionFileType,
 	"microsoft.authorization/policysetdefinitions": processor.PolicySetDefinitionFileType,
 	"microsoft.authorization/policyassignments":    processor.PolicyAssignmentFileType,
+	"microsoft.authorization/policyexemptions":     processor.PolicyExemptionFileType,
 }
 
 func checkType(model *libraryFileNameCheckModel, parts libraryFileNameParts) checker.ValidatorCheck {
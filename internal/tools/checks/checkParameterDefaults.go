@@ -0,0 +1,90 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package checks
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/internal/tools/checker"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/hashicorp/go-multierror"
+)
+
+// CheckParameterDefaults is a validator check that ensures the parameter default values of all policy definitions
+// and policy set definitions are valid for the parameter type, allowed values and schema.
+func CheckParameterDefaults(az *alzlib.AlzLib) checker.ValidatorCheck {
+	return checker.NewValidatorCheck(
+		"All definition parameter default values are valid",
+		checkParameterDefaults(az),
+	)
+}
+
+func checkParameterDefaults(az *alzlib.AlzLib) func() error {
+	return func() error {
+		var merr error
+
+		for _, name := range az.PolicyDefinitions() {
+			pdvs := az.PolicyDefinitionVersions(name)
+			if pdvs == nil {
+				continue
+			}
+
+			for pd := range pdvs.AllVersions() {
+				if pd.Properties == nil {
+					continue
+				}
+
+				if err := validateParameterDefaultValues(pd.Properties.Parameters); err != nil {
+					merr = multierror.Append(merr, fmt.Errorf(
+						"policy definition `%s`: %w", alzlib.JoinNameAndVersion(name, pd.GetVersion()), err,
+					))
+				}
+			}
+		}
+
+		for _, name := range az.PolicySetDefinitions() {
+			psdvs := az.PolicySetDefinitionVersions(name)
+			if psdvs == nil {
+				continue
+			}
+
+			for psd := range psdvs.AllVersions() {
+				if psd.Properties == nil {
+					continue
+				}
+
+				if err := validateParameterDefaultValues(psd.Properties.Parameters); err != nil {
+					merr = multierror.Append(merr, fmt.Errorf(
+						"policy set definition `%s`: %w", alzlib.JoinNameAndVersion(name, psd.GetVersion()), err,
+					))
+				}
+			}
+		}
+
+		if merr != nil {
+			return fmt.Errorf("checkParameterDefaults: found invalid parameter default values: %w", merr)
+		}
+
+		return nil
+	}
+}
+
+// validateParameterDefaultValues validates the default values of the parameter definitions.
+func validateParameterDefaultValues(params map[string]*armpolicy.ParameterDefinitionsValue) error {
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		if params[name] == nil {
+			continue
+		}
+
+		if err := assets.ValidateParameterValue(name, params[name], params[name].DefaultValue); err != nil {
+			return fmt.Errorf("default value: %w", err)
+		}
+	}
+
+	return nil
+}
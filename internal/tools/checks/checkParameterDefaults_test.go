@@ -0,0 +1,55 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package checks
+
+import (
+	"testing"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckParameterDefaults(t *testing.T) {
+	az := alzlib.NewAlzLib(nil)
+
+	newDefinition := func(name string, version *string, defaultValue any) *assets.PolicyDefinition {
+		return &assets.PolicyDefinition{
+			Definition: armpolicy.Definition{
+				Name: to.Ptr(name),
+				Properties: &armpolicy.DefinitionProperties{
+					Version: version,
+					Parameters: map[string]*armpolicy.ParameterDefinitionsValue{
+						"effect": {
+							Type:          to.Ptr(armpolicy.ParameterTypeString),
+							AllowedValues: []any{"Audit", "Deny"},
+							DefaultValue:  defaultValue,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	require.NoError(t, az.AddPolicyDefinitions(
+		newDefinition("good", nil, "Audit"),
+		newDefinition("nodefault", nil, nil),
+	))
+	require.NoError(t, checkParameterDefaults(az)())
+
+	require.NoError(t, az.AddPolicyDefinitions(newDefinition("bad", nil, "Block")))
+	require.ErrorContains(t, checkParameterDefaults(az)(),
+		"policy definition `bad`: default value: invalid value for parameter 'effect': "+
+			`value "Block" is not one of the allowed values`)
+
+	az = alzlib.NewAlzLib(nil)
+	require.NoError(t, az.AddPolicyDefinitions(
+		newDefinition("versioned", to.Ptr("1.0.0"), "Block"),
+		newDefinition("versioned", to.Ptr("2.0.0"), "Audit"),
+	))
+	require.ErrorContains(t, checkParameterDefaults(az)(), "policy definition `versioned@1.0.0`: default value:",
+		"all versions are checked, not only the latest")
+}
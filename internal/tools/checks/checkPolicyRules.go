@@ -0,0 +1,43 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package checks
+
+import (
+	"fmt"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/internal/tools/checker"
+	"github.com/hashicorp/go-multierror"
+)
+
+// CheckPolicyRules is a validator check that ensures the policy rules of all policy definitions are well formed.
+func CheckPolicyRules(az *alzlib.AlzLib) checker.ValidatorCheck {
+	return checker.NewValidatorCheck(
+		"All policy rules are well formed",
+		checkPolicyRules(az),
+	)
+}
+
+func checkPolicyRules(az *alzlib.AlzLib) func() error {
+	return func() error {
+		var merr error
+
+		for _, name := range az.PolicyDefinitions() {
+			pd := az.PolicyDefinition(name, nil)
+			if pd == nil {
+				continue
+			}
+
+			if _, err := pd.ParsePolicyRule(); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("policy definition `%s`: %w", name, err))
+			}
+		}
+
+		if merr != nil {
+			return fmt.Errorf("checkPolicyRules: found malformed policy rules: %w", merr)
+		}
+
+		return nil
+	}
+}
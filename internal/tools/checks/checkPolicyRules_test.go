@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package checks
+
+import (
+	"testing"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPolicyRules(t *testing.T) {
+	az := alzlib.NewAlzLib(nil)
+
+	az.AddPolicyDefinitions( // nolint: errcheck
+		&assets.PolicyDefinition{
+			Definition: armpolicy.Definition{
+				Name: to.Ptr("good"),
+				Properties: &armpolicy.DefinitionProperties{
+					PolicyRule: map[string]any{
+						"if":   map[string]any{"field": "type", "equals": "Microsoft.Network/virtualNetworks"},
+						"then": map[string]any{"effect": "deny"},
+					},
+				},
+			},
+		},
+	)
+
+	require.NoError(t, checkPolicyRules(az)())
+
+	az.AddPolicyDefinitions( // nolint: errcheck
+		&assets.PolicyDefinition{
+			Definition: armpolicy.Definition{
+				Name: to.Ptr("bad"),
+				Properties: &armpolicy.DefinitionProperties{
+					PolicyRule: map[string]any{
+						"if":   map[string]any{"field": "type", "equal": "Microsoft.Network/virtualNetworks"},
+						"then": map[string]any{"effect": "deny"},
+					},
+				},
+			},
+		},
+	)
+
+	require.ErrorContains(t, checkPolicyRules(az)(), "policy definition `bad`: policy rule `if`: unknown property `equal`")
+}
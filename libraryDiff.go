@@ -0,0 +1,610 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// versionlessDiffKey is used in place of a version for versionless definitions.
+const versionlessDiffKey = "versionless"
+
+// DiffKind is the kind of a difference between two libraries.
+type DiffKind string
+
+const (
+	// DiffKindAdded means the item is only in the new library.
+	DiffKindAdded DiffKind = "added"
+	// DiffKindRemoved means the item is only in the old library.
+	DiffKindRemoved DiffKind = "removed"
+	// DiffKindChanged means the item is in both libraries, with differences.
+	DiffKindChanged DiffKind = "changed"
+)
+
+// LibraryDiff is the semantic difference between two initialized AlzLib instances,
+// see DiffAlzLibs. Each slice is sorted by name and only contains items with differences.
+type LibraryDiff struct {
+	Archetypes                    []ArchetypeDiff                    `json:"archetypes,omitempty"`
+	Architectures                 []ArchitectureDiff                 `json:"architectures,omitempty"`
+	PolicyAssignments             []PolicyAssignmentDiff             `json:"policy_assignments,omitempty"`
+	PolicyDefinitions             []DefinitionDiff                   `json:"policy_definitions,omitempty"`
+	PolicyExemptions              []PolicyExemptionDiff              `json:"policy_exemptions,omitempty"`
+	PolicySetDefinitions          []DefinitionDiff                   `json:"policy_set_definitions,omitempty"`
+	RoleDefinitions               []DefinitionDiff                   `json:"role_definitions,omitempty"`
+	DefaultPolicyAssignmentValues []DefaultPolicyAssignmentValueDiff `json:"default_policy_assignment_values,omitempty"`
+}
+
+// SetDiff is the difference between two sets of strings.
+type SetDiff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// ValueChange is a change to a single property value.
+// Before or After is nil if the property is unset.
+type ValueChange struct {
+	Property string `json:"property"`
+	Before   any    `json:"before,omitempty"`
+	After    any    `json:"after,omitempty"`
+}
+
+// ArchetypeDiff is the difference in the assets of an archetype.
+type ArchetypeDiff struct {
+	Name                 string   `json:"name"`
+	Kind                 DiffKind `json:"kind"`
+	PolicyAssignments    SetDiff  `json:"policy_assignments,omitzero"`
+	PolicyDefinitions    SetDiff  `json:"policy_definitions,omitzero"`
+	PolicyExemptions     SetDiff  `json:"policy_exemptions,omitzero"`
+	PolicySetDefinitions SetDiff  `json:"policy_set_definitions,omitzero"`
+	RoleDefinitions      SetDiff  `json:"role_definitions,omitzero"`
+}
+
+// ArchitectureDiff is the difference in the management groups of an architecture.
+type ArchitectureDiff struct {
+	Name             string                            `json:"name"`
+	Kind             DiffKind                          `json:"kind"`
+	ManagementGroups []ArchitectureManagementGroupDiff `json:"management_groups,omitempty"`
+}
+
+// ArchitectureManagementGroupDiff is the difference in a management group of an architecture.
+// Changes covers the display name, parent id and exists properties.
+type ArchitectureManagementGroupDiff struct {
+	ID            string        `json:"id"`
+	Kind          DiffKind      `json:"kind"`
+	Changes       []ValueChange `json:"changes,omitempty"`
+	Archetypes    SetDiff       `json:"archetypes,omitzero"`
+	Subscriptions SetDiff       `json:"subscriptions,omitzero"`
+}
+
+// PolicyAssignmentDiff is the difference in a policy assignment.
+// Changes covers the referenced definition, the enforcement mode and each parameter value,
+// parameter changes have a property of `parameters.<name>`.
+type PolicyAssignmentDiff struct {
+	Name    string        `json:"name"`
+	Kind    DiffKind      `json:"kind"`
+	Changes []ValueChange `json:"changes,omitempty"`
+}
+
+// PolicyExemptionDiff is the difference in a policy exemption.
+// Changes covers the exempted assignment, the exemption category, the expiry, the exempted policy definition
+// references, the assignment scope validation and the resource selectors.
+type PolicyExemptionDiff struct {
+	Name    string        `json:"name"`
+	Kind    DiffKind      `json:"kind"`
+	Changes []ValueChange `json:"changes,omitempty"`
+}
+
+// DefinitionDiff is the difference in a policy definition, policy set definition or role definition.
+// Versions contains the added and removed versions, ChangedVersions the versions with changed content.
+// Versionless definitions use a version of `versionless`. Role definitions are not versioned.
+type DefinitionDiff struct {
+	Name            string   `json:"name"`
+	Kind            DiffKind `json:"kind"`
+	Versions        SetDiff  `json:"versions,omitzero"`
+	ChangedVersions []string `json:"changed_versions,omitempty"`
+}
+
+// DefaultPolicyAssignmentValueDiff is the difference in a default policy assignment value.
+// Parameters contains the added and removed `<assignment>.<parameter>` pairs.
+type DefaultPolicyAssignmentValueDiff struct {
+	Name       string        `json:"name"`
+	Kind       DiffKind      `json:"kind"`
+	Changes    []ValueChange `json:"changes,omitempty"`
+	Parameters SetDiff       `json:"parameters,omitzero"`
+}
+
+// IsEmpty reports whether the set diff has no additions or removals.
+func (s SetDiff) IsEmpty() bool {
+	return len(s.Added) == 0 && len(s.Removed) == 0
+}
+
+// IsEmpty reports whether the libraries are semantically equal.
+func (d *LibraryDiff) IsEmpty() bool {
+	return len(d.Archetypes) == 0 &&
+		len(d.Architectures) == 0 &&
+		len(d.PolicyAssignments) == 0 &&
+		len(d.PolicyDefinitions) == 0 &&
+		len(d.PolicyExemptions) == 0 &&
+		len(d.PolicySetDefinitions) == 0 &&
+		len(d.RoleDefinitions) == 0 &&
+		len(d.DefaultPolicyAssignmentValues) == 0
+}
+
+// DiffLibraryReferences fetches and initializes each set of library references, including dependencies,
+// into a new AlzLib and returns the difference between them, see DiffAlzLibs.
+// Built-in definitions are not resolved, so no Azure credentials are required.
+func DiffLibraryReferences(ctx context.Context, from, to LibraryReferences) (*LibraryDiff, error) {
+	azs := make([]*AlzLib, 0, 2) //nolint:mnd
+
+	for _, refs := range []LibraryReferences{from, to} {
+		libs, err := refs.FetchWithDependencies(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("DiffLibraryReferences: fetching libraries %v: %w", refs, err)
+		}
+
+		az := NewAlzLib(nil)
+		if err := az.Init(ctx, libs...); err != nil {
+			return nil, fmt.Errorf("DiffLibraryReferences: initializing libraries %v: %w", refs, err)
+		}
+
+		azs = append(azs, az)
+	}
+
+	return DiffAlzLibs(azs[0], azs[1])
+}
+
+// DiffAlzLibs returns the semantic difference between two initialized AlzLib instances,
+// from the perspective of upgrading from `from` to `to`.
+func DiffAlzLibs(from, to *AlzLib) (*LibraryDiff, error) {
+	if from == nil || to == nil {
+		return nil, errors.New("DiffAlzLibs: AlzLib is nil")
+	}
+
+	from.mu.RLock()
+	defer from.mu.RUnlock()
+
+	if from != to {
+		to.mu.RLock()
+		defer to.mu.RUnlock()
+	}
+
+	var err error
+
+	res := &LibraryDiff{
+		Archetypes:        diffMaps(from.archetypes, to.archetypes, diffArchetype),
+		Architectures:     diffMaps(from.architectures, to.architectures, diffArchitecture),
+		PolicyAssignments: diffMaps(from.policyAssignments, to.policyAssignments, diffPolicyAssignment),
+		PolicyExemptions:  diffMaps(from.policyExemptions, to.policyExemptions, diffPolicyExemption),
+		DefaultPolicyAssignmentValues: diffMaps(
+			from.defaultPolicyAssignmentValues, to.defaultPolicyAssignmentValues, diffDefaultValue,
+		),
+	}
+
+	if res.PolicyDefinitions, err = diffDefinitionMaps(from.policyDefinitions, to.policyDefinitions); err != nil {
+		return nil, fmt.Errorf("DiffAlzLibs: policy definitions: %w", err)
+	}
+
+	if res.PolicySetDefinitions, err = diffDefinitionMaps(from.policySetDefinitions, to.policySetDefinitions); err != nil {
+		return nil, fmt.Errorf("DiffAlzLibs: policy set definitions: %w", err)
+	}
+
+	if res.RoleDefinitions, err = diffRoleDefinitions(from.roleDefinitions, to.roleDefinitions); err != nil {
+		return nil, fmt.Errorf("DiffAlzLibs: role definitions: %w", err)
+	}
+
+	return res, nil
+}
+
+// diffMaps compares two maps by key, using diffFn for keys present in both.
+// diffFn is called with a nil before or after value for added and removed keys and returns
+// the diff and whether it should be included.
+func diffMaps[V any, D any](
+	before, after map[string]V,
+	diffFn func(name string, kind DiffKind, before, after V) (D, bool),
+) []D {
+	res := make([]D, 0)
+
+	for _, name := range sortedUnionKeys(before, after) {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+
+		kind := DiffKindChanged
+
+		switch {
+		case !inBefore:
+			kind = DiffKindAdded
+		case !inAfter:
+			kind = DiffKindRemoved
+		}
+
+		if d, ok := diffFn(name, kind, b, a); ok {
+			res = append(res, d)
+		}
+	}
+
+	return res
+}
+
+func diffArchetype(name string, kind DiffKind, before, after *Archetype) (ArchetypeDiff, bool) {
+	d := ArchetypeDiff{Name: name, Kind: kind}
+	if kind != DiffKindChanged {
+		return d, true
+	}
+
+	d.PolicyAssignments = diffSets(before.PolicyAssignments, after.PolicyAssignments)
+	d.PolicyDefinitions = diffSets(before.PolicyDefinitions, after.PolicyDefinitions)
+	d.PolicyExemptions = diffSets(before.PolicyExemptions, after.PolicyExemptions)
+	d.PolicySetDefinitions = diffSets(before.PolicySetDefinitions, after.PolicySetDefinitions)
+	d.RoleDefinitions = diffSets(before.RoleDefinitions, after.RoleDefinitions)
+
+	changed := !d.PolicyAssignments.IsEmpty() ||
+		!d.PolicyDefinitions.IsEmpty() ||
+		!d.PolicyExemptions.IsEmpty() ||
+		!d.PolicySetDefinitions.IsEmpty() ||
+		!d.RoleDefinitions.IsEmpty()
+
+	return d, changed
+}
+
+func diffArchitecture(name string, kind DiffKind, before, after *Architecture) (ArchitectureDiff, bool) {
+	d := ArchitectureDiff{Name: name, Kind: kind}
+	if kind != DiffKindChanged {
+		return d, true
+	}
+
+	d.ManagementGroups = diffMaps(before.mgs, after.mgs, diffArchitectureManagementGroup)
+
+	return d, len(d.ManagementGroups) > 0
+}
+
+func diffArchitectureManagementGroup(
+	id string, kind DiffKind, before, after *ArchitectureManagementGroup,
+) (ArchitectureManagementGroupDiff, bool) {
+	d := ArchitectureManagementGroupDiff{ID: id, Kind: kind}
+	if kind != DiffKindChanged {
+		return d, true
+	}
+
+	appendValueChange(&d.Changes, "display_name", before.displayName, after.displayName)
+	appendValueChange(&d.Changes, "parent_id", architectureParentID(before), architectureParentID(after))
+	appendValueChange(&d.Changes, "exists", before.exists, after.exists)
+
+	archetypeNames := func(mg *ArchitectureManagementGroup) mapset.Set[string] {
+		res := mapset.NewThreadUnsafeSet[string]()
+		for arch := range mg.archetypes.Iter() {
+			res.Add(arch.name)
+		}
+
+		return res
+	}
+
+	d.Archetypes = diffSets(archetypeNames(before), archetypeNames(after))
+	d.Subscriptions = diffSets(before.subscriptions, after.subscriptions)
+
+	return d, len(d.Changes) > 0 || !d.Archetypes.IsEmpty() || !d.Subscriptions.IsEmpty()
+}
+
+func architectureParentID(mg *ArchitectureManagementGroup) any {
+	if mg.parent == nil {
+		return nil
+	}
+
+	return mg.parent.id
+}
+
+func diffPolicyAssignment(
+	name string, kind DiffKind, before, after *assets.PolicyAssignment,
+) (PolicyAssignmentDiff, bool) {
+	d := PolicyAssignmentDiff{Name: name, Kind: kind}
+	if kind != DiffKindChanged {
+		return d, true
+	}
+
+	bp, ap := before.Properties, after.Properties
+	if bp == nil {
+		bp = new(armpolicy.AssignmentProperties)
+	}
+
+	if ap == nil {
+		ap = new(armpolicy.AssignmentProperties)
+	}
+
+	appendValueChange(&d.Changes, "policy_definition_id",
+		derefOrNil(bp.PolicyDefinitionID), derefOrNil(ap.PolicyDefinitionID))
+	appendValueChange(&d.Changes, "definition_version",
+		derefOrNil(bp.DefinitionVersion), derefOrNil(ap.DefinitionVersion))
+	appendValueChange(&d.Changes, "enforcement_mode",
+		enforcementModeOrDefault(bp.EnforcementMode), enforcementModeOrDefault(ap.EnforcementMode))
+
+	for _, param := range sortedUnionKeys(bp.Parameters, ap.Parameters) {
+		var b, a any
+		if v := bp.Parameters[param]; v != nil {
+			b = v.Value
+		}
+
+		if v := ap.Parameters[param]; v != nil {
+			a = v.Value
+		}
+
+		appendValueChange(&d.Changes, "parameters."+param, b, a)
+	}
+
+	return d, len(d.Changes) > 0
+}
+
+func diffPolicyExemption(
+	name string, kind DiffKind, before, after *assets.PolicyExemption,
+) (PolicyExemptionDiff, bool) {
+	d := PolicyExemptionDiff{Name: name, Kind: kind}
+	if kind != DiffKindChanged {
+		return d, true
+	}
+
+	bp, ap := before.Properties, after.Properties
+	if bp == nil {
+		bp = new(armpolicy.ExemptionProperties)
+	}
+
+	if ap == nil {
+		ap = new(armpolicy.ExemptionProperties)
+	}
+
+	appendValueChange(&d.Changes, "policy_assignment_id",
+		derefOrNil(bp.PolicyAssignmentID), derefOrNil(ap.PolicyAssignmentID))
+	appendValueChange(&d.Changes, "exemption_category",
+		enumOrNil(bp.ExemptionCategory), enumOrNil(ap.ExemptionCategory))
+	appendValueChange(&d.Changes, "expires_on", timeOrNil(bp.ExpiresOn), timeOrNil(ap.ExpiresOn))
+	appendValueChange(&d.Changes, "policy_definition_reference_ids",
+		stringsOrNil(bp.PolicyDefinitionReferenceIDs), stringsOrNil(ap.PolicyDefinitionReferenceIDs))
+	appendValueChange(&d.Changes, "assignment_scope_validation",
+		enumOrNil(bp.AssignmentScopeValidation), enumOrNil(ap.AssignmentScopeValidation))
+
+	var bs, as any
+	if len(bp.ResourceSelectors) > 0 {
+		bs = bp.ResourceSelectors
+	}
+
+	if len(ap.ResourceSelectors) > 0 {
+		as = ap.ResourceSelectors
+	}
+
+	appendValueChange(&d.Changes, "resource_selectors", bs, as)
+
+	return d, len(d.Changes) > 0
+}
+
+func enforcementModeOrDefault(mode *armpolicy.EnforcementMode) any {
+	if mode == nil {
+		return string(armpolicy.EnforcementModeDefault)
+	}
+
+	return string(*mode)
+}
+
+func diffDefaultValue(
+	name string, kind DiffKind, before, after DefaultPolicyAssignmentValuesValue,
+) (DefaultPolicyAssignmentValueDiff, bool) {
+	d := DefaultPolicyAssignmentValueDiff{Name: name, Kind: kind}
+	if kind != DiffKindChanged {
+		return d, true
+	}
+
+	appendValueChange(&d.Changes, "description", before.description, after.description)
+
+	pairs := func(v DefaultPolicyAssignmentValuesValue) mapset.Set[string] {
+		res := mapset.NewThreadUnsafeSet[string]()
+		for assignment, params := range v.assignment2Parameters {
+			for param := range params.Iter() {
+				res.Add(assignment + "." + param)
+			}
+		}
+
+		return res
+	}
+
+	d.Parameters = diffSets(pairs(before), pairs(after))
+
+	return d, len(d.Changes) > 0 || !d.Parameters.IsEmpty()
+}
+
+// definitionVersionsContent returns the JSON representation of each version in the collection,
+// keyed by version.
+func definitionVersionsContent[T assets.Versioned](
+	c *assets.VersionedPolicyCollection[T],
+) (map[string][]byte, error) {
+	res := make(map[string][]byte)
+
+	for def := range c.AllVersions() {
+		b, err := json.Marshal(def)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling `%s`: %w", JoinNameAndVersion(*def.GetName(), def.GetVersion()), err)
+		}
+
+		key := versionlessDiffKey
+		if v := def.GetVersion(); v != nil {
+			key = *v
+		}
+
+		res[key] = b
+	}
+
+	return res, nil
+}
+
+func diffDefinitionMaps[T assets.Versioned](
+	before, after map[string]*assets.VersionedPolicyCollection[T],
+) ([]DefinitionDiff, error) {
+	res := make([]DefinitionDiff, 0)
+
+	for _, name := range sortedUnionKeys(before, after) {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+
+		switch {
+		case !inBefore:
+			res = append(res, DefinitionDiff{Name: name, Kind: DiffKindAdded})
+			continue
+		case !inAfter:
+			res = append(res, DefinitionDiff{Name: name, Kind: DiffKindRemoved})
+			continue
+		}
+
+		bc, err := definitionVersionsContent(b)
+		if err != nil {
+			return nil, err
+		}
+
+		ac, err := definitionVersionsContent(a)
+		if err != nil {
+			return nil, err
+		}
+
+		d := DefinitionDiff{Name: name, Kind: DiffKindChanged}
+
+		for _, ver := range sortedUnionKeys(bc, ac) {
+			bv, inB := bc[ver]
+			av, inA := ac[ver]
+
+			switch {
+			case !inB:
+				d.Versions.Added = append(d.Versions.Added, ver)
+			case !inA:
+				d.Versions.Removed = append(d.Versions.Removed, ver)
+			case string(bv) != string(av):
+				d.ChangedVersions = append(d.ChangedVersions, ver)
+			}
+		}
+
+		if !d.Versions.IsEmpty() || len(d.ChangedVersions) > 0 {
+			res = append(res, d)
+		}
+	}
+
+	return res, nil
+}
+
+func diffRoleDefinitions(before, after map[string]*assets.RoleDefinition) ([]DefinitionDiff, error) {
+	res := make([]DefinitionDiff, 0)
+
+	for _, name := range sortedUnionKeys(before, after) {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+
+		switch {
+		case !inBefore:
+			res = append(res, DefinitionDiff{Name: name, Kind: DiffKindAdded})
+			continue
+		case !inAfter:
+			res = append(res, DefinitionDiff{Name: name, Kind: DiffKindRemoved})
+			continue
+		}
+
+		bb, err := json.Marshal(b)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling `%s`: %w", name, err)
+		}
+
+		ab, err := json.Marshal(a)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling `%s`: %w", name, err)
+		}
+
+		if string(bb) != string(ab) {
+			res = append(res, DefinitionDiff{Name: name, Kind: DiffKindChanged})
+		}
+	}
+
+	return res, nil
+}
+
+// diffSets returns the sorted additions and removals, empty slices are nil.
+func diffSets(before, after mapset.Set[string]) SetDiff {
+	var res SetDiff
+
+	if added := after.Difference(before); added.Cardinality() > 0 {
+		res.Added = added.ToSlice()
+		slices.Sort(res.Added)
+	}
+
+	if removed := before.Difference(after); removed.Cardinality() > 0 {
+		res.Removed = removed.ToSlice()
+		slices.Sort(res.Removed)
+	}
+
+	return res
+}
+
+func appendValueChange(changes *[]ValueChange, property string, before, after any) {
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+
+	*changes = append(*changes, ValueChange{Property: property, Before: before, After: after})
+}
+
+func derefOrNil(s *string) any {
+	if s == nil {
+		return nil
+	}
+
+	return *s
+}
+
+func enumOrNil[T ~string](v *T) any {
+	if v == nil {
+		return nil
+	}
+
+	return string(*v)
+}
+
+func timeOrNil(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// stringsOrNil dereferences the slice, an empty slice is nil.
+func stringsOrNil(s []*string) any {
+	if len(s) == 0 {
+		return nil
+	}
+
+	res := make([]string, 0, len(s))
+	for _, v := range s {
+		if v != nil {
+			res = append(res, *v)
+		}
+	}
+
+	return res
+}
+
+// sortedUnionKeys returns the sorted union of the keys of the two maps.
+func sortedUnionKeys[V any](a, b map[string]V) []string {
+	res := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		res = append(res, k)
+	}
+
+	for k := range b {
+		res = append(res, k)
+	}
+
+	slices.Sort(res)
+
+	return slices.Compact(res)
+}
@@ -0,0 +1,166 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// modifiedLibraryFS returns a copy of the library in dir, with the supplied string replacements
+// applied to the named files.
+func modifiedLibraryFS(t *testing.T, dir string, replacements map[string][2]string) fs.FS {
+	t.Helper()
+
+	res := make(fstest.MapFS)
+	dirFS := os.DirFS(dir)
+
+	entries, err := fs.ReadDir(dirFS, ".")
+	require.NoError(t, err)
+
+	for _, entry := range entries {
+		b, err := fs.ReadFile(dirFS, entry.Name())
+		require.NoError(t, err)
+
+		if r, ok := replacements[entry.Name()]; ok {
+			require.Contains(t, string(b), r[0])
+			b = []byte(strings.Replace(string(b), r[0], r[1], 1))
+		}
+
+		res[entry.Name()] = &fstest.MapFile{Data: b}
+	}
+
+	return res
+}
+
+func TestDiffAlzLibs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	from := NewAlzLib(nil)
+	require.NoError(t, from.Init(ctx, NewCustomLibraryReferenceFromFS("from", os.DirFS("./testdata/simple"))))
+
+	toFS := modifiedLibraryFS(t, "./testdata/simple", map[string][2]string{
+		"test.alz_policy_assignment.json": {`"enforcementMode": null`, `"enforcementMode": "DoNotEnforce"`},
+		"test.alz_policy_definition.json": {`"mode": "Indexed",`, `"mode": "Indexed", "version": "1.1.0",`},
+		"simpleo.alz_archetype_override.yaml": {
+			"policy_assignments_to_remove:\n  - test-pa\n",
+			"policy_assignments_to_remove: []\n",
+		},
+		"simple.alz_architecture_definition.yaml": {
+			"display_name: simple overide",
+			"display_name: simple override\n    subscriptions:\n      - sub1",
+		},
+		"alz_policy_default_values.yml": {"- effect", "- effect\n          - other"},
+	})
+
+	to := NewAlzLib(nil)
+	require.NoError(t, to.Init(ctx, NewCustomLibraryReferenceFromFS("to", toFS)))
+
+	d, err := DiffAlzLibs(from, to)
+	require.NoError(t, err)
+
+	assert.Equal(t, []ArchetypeDiff{{
+		Name:              "simpleoverride",
+		Kind:              DiffKindChanged,
+		PolicyAssignments: SetDiff{Added: []string{"test-pa"}},
+	}}, d.Archetypes)
+
+	require.Len(t, d.Architectures, 1)
+	assert.Equal(t, []ArchitectureManagementGroupDiff{{
+		ID:   "simpleoverride",
+		Kind: DiffKindChanged,
+		Changes: []ValueChange{{
+			Property: "display_name",
+			Before:   "simple overide",
+			After:    "simple override",
+		}},
+		Subscriptions: SetDiff{Added: []string{"sub1"}},
+	}}, d.Architectures[0].ManagementGroups)
+
+	assert.Equal(t, []PolicyAssignmentDiff{{
+		Name: "test-pa",
+		Kind: DiffKindChanged,
+		Changes: []ValueChange{{
+			Property: "enforcement_mode",
+			Before:   "Default",
+			After:    "DoNotEnforce",
+		}},
+	}}, d.PolicyAssignments)
+
+	assert.Equal(t, []DefinitionDiff{{
+		Name:     "test-policy-definition",
+		Kind:     DiffKindChanged,
+		Versions: SetDiff{Added: []string{"1.1.0"}, Removed: []string{versionlessDiffKey}},
+	}}, d.PolicyDefinitions)
+
+	assert.Empty(t, d.PolicySetDefinitions)
+	assert.Empty(t, d.RoleDefinitions)
+
+	require.Len(t, d.DefaultPolicyAssignmentValues, 1)
+	assert.Equal(t, []string{"test-policy-assignment.other"}, d.DefaultPolicyAssignmentValues[0].Parameters.Added)
+
+	// A library does not differ from itself.
+	d, err = DiffAlzLibs(from, from)
+	require.NoError(t, err)
+	assert.True(t, d.IsEmpty())
+}
+
+func TestDiffAlzLibs_PolicyExemptions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	exemption := func(name, category, refs string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(`{
+  "name": "` + name + `",
+  "properties": {
+    "policyAssignmentId": "/providers/Microsoft.Management/managementGroups/placeholder/providers/` +
+			`Microsoft.Authorization/policyAssignments/test-pa",
+    "exemptionCategory": "` + category + `",
+    "policyDefinitionReferenceIds": [` + refs + `]
+  }
+}`)}
+	}
+
+	fromFS := modifiedLibraryFS(t, "./testdata/simple", nil).(fstest.MapFS)
+	fromFS["changed.alz_policy_exemption.json"] = exemption("changed", "Waiver", "")
+	fromFS["removed.alz_policy_exemption.json"] = exemption("removed", "Waiver", "")
+	fromFS["same.alz_policy_exemption.json"] = exemption("same", "Waiver", `"ref"`)
+
+	toFS := modifiedLibraryFS(t, "./testdata/simple", nil).(fstest.MapFS)
+	toFS["added.alz_policy_exemption.json"] = exemption("added", "Waiver", "")
+	toFS["changed.alz_policy_exemption.json"] = exemption("changed", "Mitigated", `"ref"`)
+	toFS["same.alz_policy_exemption.json"] = exemption("same", "Waiver", `"ref"`)
+
+	from := NewAlzLib(nil)
+	require.NoError(t, from.Init(ctx, NewCustomLibraryReferenceFromFS("from", fromFS)))
+
+	to := NewAlzLib(nil)
+	require.NoError(t, to.Init(ctx, NewCustomLibraryReferenceFromFS("to", toFS)))
+
+	d, err := DiffAlzLibs(from, to)
+	require.NoError(t, err)
+
+	assert.Equal(t, []PolicyExemptionDiff{
+		{Name: "added", Kind: DiffKindAdded},
+		{
+			Name: "changed",
+			Kind: DiffKindChanged,
+			Changes: []ValueChange{
+				{Property: "exemption_category", Before: "Waiver", After: "Mitigated"},
+				{Property: "policy_definition_reference_ids", Before: nil, After: []string{"ref"}},
+			},
+		},
+		{Name: "removed", Kind: DiffKindRemoved},
+	}, d.PolicyExemptions)
+	assert.False(t, d.IsEmpty())
+}
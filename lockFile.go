@@ -0,0 +1,366 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+const (
+	// lockFileHashPrefix is the prefix of the content hashes in a lock file.
+	lockFileHashPrefix = "sha256:"
+	// lockFileNoVersion is written in place of the resolved version for versionless definitions.
+	lockFileNoVersion = "-"
+	// lockFileFieldCount is the number of space separated fields on each lock file line.
+	lockFileFieldCount = 3
+)
+
+// ErrLockFileMismatch is returned when a built-in definition resolves differently from the lock file.
+var ErrLockFileMismatch = errors.New("built-in definition resolution does not match lock file")
+
+// LockFileMode controls how AlzLib uses a [LockFile], see [AlzLib.AddLockFile].
+type LockFileMode int
+
+const (
+	// LockFileModeUpdate records the resolved built-in definitions in the lock file,
+	// replacing any existing entries.
+	LockFileModeUpdate LockFileMode = iota
+	// LockFileModeVerify returns an error wrapping [ErrLockFileMismatch] when a built-in definition
+	// resolves to a different version or content than is recorded in the lock file,
+	// or when the request is not in the lock file.
+	LockFileModeVerify
+)
+
+// LockFileEntry records how a single built-in request was resolved.
+type LockFileEntry struct {
+	// Request is the type, name and optional version constraint of the request,
+	// e.g. `policyDefinitions/name@1.*.*`.
+	Request string
+	// Version is the resolved version, empty if the definition is versionless.
+	Version string
+	// Hash is the hash of the resolved definition properties, prefixed with the algorithm.
+	Hash string
+}
+
+// LockFile records the resolved version and content hash of built-in policy (set) definitions,
+// keyed by request, so that resolution is reproducible across runs.
+// The text format has one entry per line, sorted by request:
+//
+//	<request> <version> <hash>
+//
+// Versionless definitions have a version of `-`.
+// Do not create this struct directly, use NewLockFile or ReadLockFile instead.
+type LockFile struct {
+	entries map[string]LockFileEntry
+	// requests recorded or verified since the lock file was created or read, see LockFile.Prune
+	seen map[string]struct{}
+	mu   sync.RWMutex
+}
+
+// NewLockFile returns an empty lock file.
+func NewLockFile() *LockFile {
+	return &LockFile{
+		entries: make(map[string]LockFileEntry),
+		seen:    make(map[string]struct{}),
+	}
+}
+
+// ReadLockFile reads a lock file previously written by [LockFile.Write].
+// Blank lines are ignored.
+func ReadLockFile(r io.Reader) (*LockFile, error) {
+	lf := NewLockFile()
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != lockFileFieldCount || !strings.HasPrefix(fields[2], lockFileHashPrefix) {
+			return nil, fmt.Errorf("ReadLockFile: line %d: malformed entry `%s`", lineNo, line)
+		}
+
+		if _, exists := lf.entries[fields[0]]; exists {
+			return nil, fmt.Errorf("ReadLockFile: line %d: duplicate entry for `%s`", lineNo, fields[0])
+		}
+
+		entry := LockFileEntry{
+			Request: fields[0],
+			Version: fields[1],
+			Hash:    fields[2],
+		}
+
+		if entry.Version == lockFileNoVersion {
+			entry.Version = ""
+		}
+
+		lf.entries[entry.Request] = entry
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ReadLockFile: reading lock file: %w", err)
+	}
+
+	return lf, nil
+}
+
+// Write writes the lock file to w, sorted by request.
+func (lf *LockFile) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for _, entry := range lf.Entries() {
+		version := entry.Version
+		if version == "" {
+			version = lockFileNoVersion
+		}
+
+		if _, err := fmt.Fprintf(bw, "%s %s %s\n", entry.Request, version, entry.Hash); err != nil {
+			return fmt.Errorf("LockFile.Write: %w", err)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("LockFile.Write: %w", err)
+	}
+
+	return nil
+}
+
+// Entries returns the entries in the lock file, sorted by request.
+func (lf *LockFile) Entries() []LockFileEntry {
+	lf.mu.RLock()
+	defer lf.mu.RUnlock()
+
+	res := make([]LockFileEntry, 0, len(lf.entries))
+	for _, entry := range lf.entries {
+		res = append(res, entry)
+	}
+
+	slices.SortFunc(res, func(a, b LockFileEntry) int {
+		return strings.Compare(a.Request, b.Request)
+	})
+
+	return res
+}
+
+// Entry returns the entry for the given request, and whether it exists.
+func (lf *LockFile) Entry(request string) (LockFileEntry, bool) {
+	lf.mu.RLock()
+	defer lf.mu.RUnlock()
+
+	entry, ok := lf.entries[request]
+
+	return entry, ok
+}
+
+// Prune removes the entries for requests that have not been recorded since the lock file was created or read,
+// e.g. because they were removed from the library, and returns the removed requests, sorted.
+// Call it in LockFileModeUpdate once all definitions have been resolved, before writing the lock file.
+func (lf *LockFile) Prune() []string {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	res := make([]string, 0)
+
+	for request := range lf.entries {
+		if _, ok := lf.seen[request]; !ok {
+			delete(lf.entries, request)
+
+			res = append(res, request)
+		}
+	}
+
+	slices.Sort(res)
+
+	return res
+}
+
+// record adds or verifies the entry, depending on mode.
+func (lf *LockFile) record(entry LockFileEntry, mode LockFileMode) error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	lf.seen[entry.Request] = struct{}{}
+
+	if mode == LockFileModeUpdate {
+		lf.entries[entry.Request] = entry
+		return nil
+	}
+
+	locked, ok := lf.entries[entry.Request]
+	if !ok {
+		return fmt.Errorf("%w: `%s` is not in the lock file", ErrLockFileMismatch, entry.Request)
+	}
+
+	if locked.Version != entry.Version {
+		return fmt.Errorf(
+			"%w: `%s` resolved to version `%s`, lock file has `%s`",
+			ErrLockFileMismatch,
+			entry.Request,
+			entry.Version,
+			locked.Version,
+		)
+	}
+
+	if locked.Hash != entry.Hash {
+		return fmt.Errorf(
+			"%w: `%s` version `%s` has hash `%s`, lock file has `%s`",
+			ErrLockFileMismatch,
+			entry.Request,
+			entry.Version,
+			entry.Hash,
+			locked.Hash,
+		)
+	}
+
+	return nil
+}
+
+// AddLockFile stores a [LockFile] that is used by [AlzLib.GetDefinitionsFromAzure] to record or verify
+// the resolution of each built-in request, depending on mode.
+// Call AddLockFile(nil, ...) to stop using the lock file.
+func (az *AlzLib) AddLockFile(lf *LockFile, mode LockFileMode) {
+	az.mu.Lock()
+	defer az.mu.Unlock()
+
+	az.lockFile = lf
+	az.lockFileMode = mode
+}
+
+// lockBuiltInRequests records or verifies the resolution of the requests, and the policy definitions
+// referenced by requested policy set definitions, in the lock file.
+// Only built-in and static definitions are locked, the requests also include the custom definitions
+// assigned in the library, which change with the library rather than with Azure.
+// It is a no-op if no lock file is set.
+func (az *AlzLib) lockBuiltInRequests(reqs []BuiltInRequest) error {
+	az.mu.RLock()
+	lf, mode := az.lockFile, az.lockFileMode
+	az.mu.RUnlock()
+
+	if lf == nil {
+		return nil
+	}
+
+	for _, req := range reqs {
+		switch strings.ToLower(req.ResourceID.ResourceType.Type) {
+		case PolicyDefinitionsType:
+			if err := az.lockPolicyDefinition(lf, mode, req.ResourceID.Name, req.Version); err != nil {
+				return err
+			}
+		case PolicySetDefinitionsType:
+			if err := az.lockPolicySetDefinition(lf, mode, req.ResourceID.Name, req.Version); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// lockPolicySetDefinition records or verifies the policy set definition and its referenced policy definitions.
+// The built-in policy definitions referenced by a custom policy set definition are locked.
+func (az *AlzLib) lockPolicySetDefinition(lf *LockFile, mode LockFileMode, name string, version *string) error {
+	psd := az.PolicySetDefinition(name, version)
+	if psd == nil {
+		return fmt.Errorf("policy set definition `%s` not found", JoinNameAndVersion(name, version))
+	}
+
+	if psd.Properties != nil && isBuiltInPolicyType(psd.Properties.PolicyType) {
+		entry, err := newLockFileEntry(PolicySetDefinitionsType, name, version, psd.GetVersion(), psd.Properties)
+		if err != nil {
+			return err
+		}
+
+		if err := lf.record(entry, mode); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range psd.PolicyDefinitionReferences() {
+		if ref == nil || ref.PolicyDefinitionID == nil {
+			continue
+		}
+
+		refName, err := assets.NameFromResourceID(*ref.PolicyDefinitionID)
+		if err != nil {
+			return fmt.Errorf("policy set definition `%s`: %w", name, err)
+		}
+
+		if err := az.lockPolicyDefinition(lf, mode, refName, ref.DefinitionVersion); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (az *AlzLib) lockPolicyDefinition(lf *LockFile, mode LockFileMode, name string, version *string) error {
+	pd := az.PolicyDefinition(name, version)
+	if pd == nil {
+		return fmt.Errorf("policy definition `%s` not found", JoinNameAndVersion(name, version))
+	}
+
+	if pd.Properties == nil || !isBuiltInPolicyType(pd.Properties.PolicyType) {
+		return nil
+	}
+
+	entry, err := newLockFileEntry(PolicyDefinitionsType, name, version, pd.GetVersion(), pd.Properties)
+	if err != nil {
+		return err
+	}
+
+	return lf.record(entry, mode)
+}
+
+// isBuiltInPolicyType returns true if the policy type is built-in or static.
+func isBuiltInPolicyType(pt *armpolicy.PolicyType) bool {
+	return pt != nil && (*pt == armpolicy.PolicyTypeBuiltIn || *pt == armpolicy.PolicyTypeStatic)
+}
+
+// newLockFileEntry creates a lock file entry for the request, hashing the JSON representation
+// of the resolved definition properties.
+func newLockFileEntry(typ, name string, constraint, resolved *string, properties any) (LockFileEntry, error) {
+	b, err := json.Marshal(properties)
+	if err != nil {
+		return LockFileEntry{}, fmt.Errorf("hashing %s `%s`: %w", typ, JoinNameAndVersion(name, constraint), err)
+	}
+
+	sum := sha256.Sum256(b)
+	entry := LockFileEntry{
+		Request: lockFileRequestType(typ) + "/" + JoinNameAndVersion(name, constraint),
+		Hash:    lockFileHashPrefix + hex.EncodeToString(sum[:]),
+	}
+
+	if resolved != nil {
+		entry.Version = *resolved
+	}
+
+	return entry, nil
+}
+
+// lockFileRequestType returns the resource type name used in lock file requests.
+func lockFileRequestType(typ string) string {
+	if typ == PolicySetDefinitionsType {
+		return "policySetDefinitions"
+	}
+
+	return "policyDefinitions"
+}
@@ -0,0 +1,184 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lockFileTestCache returns a cache containing a policy set definition that references a policy definition,
+// with the supplied versions of the policy definition.
+func lockFileTestCache(t *testing.T, pdVersions ...string) *mockBuiltInCache {
+	t.Helper()
+
+	pdvs := assets.NewPolicyDefinitionVersions()
+	for _, v := range pdVersions {
+		pd := testPolicyDefinition(t, "lock-pd", v)
+		pd.Properties.PolicyType = to.Ptr(armpolicy.PolicyTypeBuiltIn)
+		require.NoError(t, pdvs.Add(pd, false))
+	}
+
+	psdvs := assets.NewPolicySetDefinitionVersions()
+	require.NoError(t, psdvs.Add(testPolicySetDefinitionWithRefs(t, "lock-psd", "1.0.0", []*armpolicy.DefinitionReference{
+		{
+			PolicyDefinitionID:          to.Ptr("/providers/Microsoft.Authorization/policyDefinitions/lock-pd"),
+			PolicyDefinitionReferenceID: to.Ptr("lock-pd-ref"),
+			DefinitionVersion:           to.Ptr("1.*.*"),
+		},
+	}), false))
+
+	return &mockBuiltInCache{
+		policyDefs:    map[string]*assets.PolicyDefinitionVersions{"lock-pd": pdvs},
+		policySetDefs: map[string]*assets.PolicySetDefinitionVersions{"lock-psd": psdvs},
+	}
+}
+
+func lockFileTestRequests(t *testing.T) []BuiltInRequest {
+	t.Helper()
+
+	resID, err := arm.ParseResourceID("/providers/Microsoft.Authorization/policySetDefinitions/lock-psd")
+	require.NoError(t, err)
+
+	return []BuiltInRequest{{ResourceID: resID, Version: to.Ptr("1.*.*")}}
+}
+
+func TestLockFile_UpdateAndVerify(t *testing.T) {
+	t.Parallel()
+
+	// Record the resolution.
+	lf := NewLockFile()
+	az := NewAlzLib(nil)
+	az.AddCache(lockFileTestCache(t, "1.0.0"))
+	az.AddLockFile(lf, LockFileModeUpdate)
+	require.NoError(t, az.GetDefinitionsFromAzure(context.Background(), lockFileTestRequests(t)))
+
+	entries := lf.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "policyDefinitions/lock-pd@1.*.*", entries[0].Request)
+	assert.Equal(t, "1.0.0", entries[0].Version)
+	assert.True(t, strings.HasPrefix(entries[0].Hash, lockFileHashPrefix))
+	assert.Equal(t, "policySetDefinitions/lock-psd@1.*.*", entries[1].Request)
+
+	// Round trip the lock file.
+	buf := new(bytes.Buffer)
+	require.NoError(t, lf.Write(buf))
+
+	loaded, err := ReadLockFile(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, entries, loaded.Entries())
+
+	// The same resolution verifies.
+	az = NewAlzLib(nil)
+	az.AddCache(lockFileTestCache(t, "1.0.0"))
+	az.AddLockFile(loaded, LockFileModeVerify)
+	require.NoError(t, az.GetDefinitionsFromAzure(context.Background(), lockFileTestRequests(t)))
+
+	// A newer version in the cache does not.
+	az = NewAlzLib(nil)
+	az.AddCache(lockFileTestCache(t, "1.0.0", "1.1.0"))
+	az.AddLockFile(loaded, LockFileModeVerify)
+	err = az.GetDefinitionsFromAzure(context.Background(), lockFileTestRequests(t))
+	require.ErrorIs(t, err, ErrLockFileMismatch)
+	assert.ErrorContains(t, err, "resolved to version `1.1.0`, lock file has `1.0.0`")
+
+	// Neither does a request that is not in the lock file.
+	az = NewAlzLib(nil)
+	az.AddCache(lockFileTestCache(t, "1.0.0"))
+	az.AddLockFile(NewLockFile(), LockFileModeVerify)
+	err = az.GetDefinitionsFromAzure(context.Background(), lockFileTestRequests(t))
+	require.ErrorIs(t, err, ErrLockFileMismatch)
+}
+
+func TestLockFile_CustomDefinitionsNotLocked(t *testing.T) {
+	t.Parallel()
+
+	customPd := testPolicyDefinition(t, "custom-pd", "1.0.0")
+	customPd.Properties.PolicyType = to.Ptr(armpolicy.PolicyTypeCustom)
+	customPsd := testPolicySetDefinitionWithRefs(t, "custom-psd", "1.0.0", []*armpolicy.DefinitionReference{
+		{
+			PolicyDefinitionID:          to.Ptr("/providers/Microsoft.Authorization/policyDefinitions/lock-pd"),
+			PolicyDefinitionReferenceID: to.Ptr("lock-pd-ref"),
+			DefinitionVersion:           to.Ptr("1.*.*"),
+		},
+		{
+			PolicyDefinitionID: to.Ptr(
+				"/providers/Microsoft.Management/managementGroups/alz/providers/Microsoft.Authorization/policyDefinitions/custom-pd",
+			),
+			PolicyDefinitionReferenceID: to.Ptr("custom-pd-ref"),
+		},
+	})
+	customPsd.Properties.PolicyType = to.Ptr(armpolicy.PolicyTypeCustom)
+
+	lf := NewLockFile()
+	az := NewAlzLib(nil)
+	require.NoError(t, az.AddPolicyDefinitions(customPd))
+	require.NoError(t, az.AddPolicySetDefinitions(customPsd))
+	az.AddCache(lockFileTestCache(t, "1.0.0"))
+	az.AddLockFile(lf, LockFileModeUpdate)
+
+	reqs := lockFileTestRequests(t)
+	for _, id := range []string{
+		"/providers/Microsoft.Management/managementGroups/alz/providers/Microsoft.Authorization/policyDefinitions/custom-pd",
+		"/providers/Microsoft.Management/managementGroups/alz/providers/Microsoft.Authorization/policySetDefinitions/custom-psd",
+	} {
+		resID, err := arm.ParseResourceID(id)
+		require.NoError(t, err)
+
+		reqs = append(reqs, BuiltInRequest{ResourceID: resID})
+	}
+
+	require.NoError(t, az.GetDefinitionsFromAzure(context.Background(), reqs))
+
+	requests := make([]string, 0, len(lf.Entries()))
+	for _, entry := range lf.Entries() {
+		requests = append(requests, entry.Request)
+	}
+
+	assert.Equal(t, []string{"policyDefinitions/lock-pd@1.*.*", "policySetDefinitions/lock-psd@1.*.*"}, requests,
+		"only the built-in definitions are locked, including those referenced by a custom policy set definition")
+}
+
+func TestLockFile_Prune(t *testing.T) {
+	t.Parallel()
+
+	lf, err := ReadLockFile(strings.NewReader("policyDefinitions/removed - sha256:00\n"))
+	require.NoError(t, err)
+
+	az := NewAlzLib(nil)
+	az.AddCache(lockFileTestCache(t, "1.0.0"))
+	az.AddLockFile(lf, LockFileModeUpdate)
+	require.NoError(t, az.GetDefinitionsFromAzure(context.Background(), lockFileTestRequests(t)))
+	require.Len(t, lf.Entries(), 3)
+
+	assert.Equal(t, []string{"policyDefinitions/removed"}, lf.Prune())
+	assert.Len(t, lf.Entries(), 2)
+	assert.Empty(t, lf.Prune())
+}
+
+func TestReadLockFile_Errors(t *testing.T) {
+	t.Parallel()
+
+	_, err := ReadLockFile(strings.NewReader("policyDefinitions/a 1.0.0\n"))
+	require.ErrorContains(t, err, "line 1: malformed entry")
+
+	_, err = ReadLockFile(strings.NewReader("policyDefinitions/a - sha256:00\n\npolicyDefinitions/a - sha256:00\n"))
+	require.ErrorContains(t, err, "line 3: duplicate entry")
+
+	lf, err := ReadLockFile(strings.NewReader("policyDefinitions/a - sha256:00\n"))
+	require.NoError(t, err)
+
+	entry, ok := lf.Entry("policyDefinitions/a")
+	require.True(t, ok)
+	assert.Empty(t, entry.Version)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"slices"
+
+	"github.com/Azure/alzlib/internal/processor"
+)
+
+// AssetType is the type of a library asset, used to look up its provenance.
+type AssetType string
+
+const (
+	// AssetTypePolicyAssignment is a policy assignment.
+	AssetTypePolicyAssignment AssetType = "policy_assignment"
+	// AssetTypePolicyDefinition is a policy definition.
+	AssetTypePolicyDefinition AssetType = "policy_definition"
+	// AssetTypePolicyExemption is a policy exemption.
+	AssetTypePolicyExemption AssetType = "policy_exemption"
+	// AssetTypePolicySetDefinition is a policy set definition.
+	AssetTypePolicySetDefinition AssetType = "policy_set_definition"
+	// AssetTypeRoleDefinition is a role definition.
+	AssetTypeRoleDefinition AssetType = "role_definition"
+	// AssetTypeArchetype is an archetype, including archetype overrides.
+	AssetTypeArchetype AssetType = "archetype"
+	// AssetTypeArchitecture is an architecture.
+	AssetTypeArchitecture AssetType = "architecture"
+	// AssetTypeDefaultPolicyAssignmentValue is a default policy assignment value.
+	AssetTypeDefaultPolicyAssignmentValue AssetType = "default_policy_assignment_value"
+)
+
+// provenanceFileTypes maps the processor file types to asset types.
+var provenanceFileTypes = map[string]AssetType{
+	processor.PolicyAssignmentFileType:       AssetTypePolicyAssignment,
+	processor.PolicyDefinitionFileType:       AssetTypePolicyDefinition,
+	processor.PolicyExemptionFileType:        AssetTypePolicyExemption,
+	processor.PolicySetDefinitionFileType:    AssetTypePolicySetDefinition,
+	processor.RoleDefinitionFileType:         AssetTypeRoleDefinition,
+	processor.ArchetypeDefinitionFileType:    AssetTypeArchetype,
+	processor.ArchetypeOverrideFileType:      AssetTypeArchetype,
+	processor.ArchitectureDefinitionFileType: AssetTypeArchitecture,
+	processor.PolicyDefaultValuesFileType:    AssetTypeDefaultPolicyAssignmentValue,
+}
+
+// Provenance records where a library asset was defined.
+type Provenance struct {
+	// Library is the metadata of the library member that the asset was read from.
+	Library *Metadata
+	// Path is the path of the file within the library member.
+	Path string
+	// Shadowed is the provenance of earlier definitions of the asset that were overwritten,
+	// see Options.AllowOverwrite, most recent first.
+	Shadowed []*Provenance
+}
+
+// Provenance returns where the asset of the given type and name was defined, or nil if it was not
+// read from a library, e.g. built-in definitions or assets added using AddPolicyAssignments.
+// Versioned policy (set) definitions are looked up using `name@version`, see JoinNameAndVersion.
+// Role definitions are looked up using the role name.
+func (az *AlzLib) Provenance(typ AssetType, name string) *Provenance {
+	az.mu.RLock()
+	defer az.mu.RUnlock()
+
+	p, ok := az.provenance[typ][name]
+	if !ok {
+		return nil
+	}
+
+	res := *p
+	res.Shadowed = slices.Clone(p.Shadowed)
+
+	return &res
+}
+
+// addProvenance records the provenance of the assets in the processed library result.
+// It must be called after the result has been added to the AlzLib, so that assets that
+// were not added, e.g. policy definition versions merged into an existing collection, are skipped.
+func (az *AlzLib) addProvenance(res *processor.Result, md *Metadata) {
+	if az.provenance == nil {
+		az.provenance = make(map[AssetType]map[string]*Provenance)
+	}
+
+	for fileType, sources := range res.Sources {
+		typ, ok := provenanceFileTypes[fileType]
+		if !ok {
+			continue
+		}
+
+		if _, ok := az.provenance[typ]; !ok {
+			az.provenance[typ] = make(map[string]*Provenance)
+		}
+
+		for name, path := range sources {
+			if !az.provenanceAddedFromResult(typ, name, res) {
+				continue
+			}
+
+			p := &Provenance{
+				Library: md,
+				Path:    path,
+			}
+
+			if prev, exists := az.provenance[typ][name]; exists {
+				p.Shadowed = append([]*Provenance{{Library: prev.Library, Path: prev.Path}}, prev.Shadowed...)
+			}
+
+			az.provenance[typ][name] = p
+		}
+	}
+}
+
+// provenanceAddedFromResult reports whether the AlzLib holds the definition from the processed result.
+// Policy (set) definition collections are only added if no collection of the same name already exists.
+func (az *AlzLib) provenanceAddedFromResult(typ AssetType, name string, res *processor.Result) bool {
+	defName, _ := SplitNameAndVersion(name)
+
+	switch typ {
+	case AssetTypePolicyDefinition:
+		return az.policyDefinitions[defName] == res.PolicyDefinitions[defName]
+	case AssetTypePolicySetDefinition:
+		return az.policySetDefinitions[defName] == res.PolicySetDefinitions[defName]
+	default:
+		return true
+	}
+}
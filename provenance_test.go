@@ -0,0 +1,59 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+	t.Parallel()
+
+	pa, err := os.ReadFile("./testdata/simple/test.alz_policy_assignment.json")
+	require.NoError(t, err)
+
+	base := NewCustomLibraryReferenceFromFS("base", os.DirFS("./testdata/simple"))
+	overlay := NewCustomLibraryReferenceFromFS("overlay", fstest.MapFS{
+		"alz_library_metadata.json":                   {Data: []byte(`{"name": "overlay", "dependencies": []}`)},
+		"assignments/test.alz_policy_assignment.json": {Data: pa},
+	})
+
+	az := NewAlzLib(&Options{AllowOverwrite: true, Parallelism: defaultParallelism})
+	require.NoError(t, az.Init(context.Background(), base, overlay))
+
+	p := az.Provenance(AssetTypePolicyAssignment, "test-pa")
+	require.NotNil(t, p)
+	assert.Equal(t, "assignments/test.alz_policy_assignment.json", p.Path)
+	assert.Equal(t, "overlay", p.Library.Name())
+	assert.Equal(t, overlay, p.Library.Ref())
+	require.Len(t, p.Shadowed, 1)
+	assert.Equal(t, "test.alz_policy_assignment.json", p.Shadowed[0].Path)
+	assert.Equal(t, base, p.Shadowed[0].Library.Ref())
+
+	p = az.Provenance(AssetTypeArchetype, "simpleoverride")
+	require.NotNil(t, p)
+	assert.Equal(t, "simpleo.alz_archetype_override.yaml", p.Path)
+	assert.Empty(t, p.Shadowed)
+
+	p = az.Provenance(AssetTypePolicyDefinition, "test-policy-definition")
+	require.NotNil(t, p)
+	assert.Equal(t, "test.alz_policy_definition.json", p.Path)
+
+	p = az.Provenance(AssetTypeArchitecture, "simple")
+	require.NotNil(t, p)
+	assert.Equal(t, "simple.alz_architecture_definition.yaml", p.Path)
+
+	p = az.Provenance(AssetTypeDefaultPolicyAssignmentValue, "test")
+	require.NotNil(t, p)
+	assert.Equal(t, "alz_policy_default_values.yml", p.Path)
+
+	assert.Nil(t, az.Provenance(AssetTypePolicyAssignment, "does-not-exist"))
+	assert.Nil(t, az.Provenance(AssetTypeArchetype, "empty"))
+}
@@ -0,0 +1,17 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package recording records Azure API responses to a fixture directory and replays them,
+// enabling offline builds and tests that would otherwise require Azure.
+//
+// The typical workflow is:
+//
+//  1. Create a client factory using [NewRecordingClientFactory] and use it with AlzLib.AddPolicyClient
+//     or cache.NewCacheFromAzure, with access to Azure. Each response is written to the fixture directory.
+//  2. Commit the fixture directory.
+//  3. Create a client factory using [NewReplayClientFactory] in the environment without Azure access.
+//     Responses are served from the fixture directory and no credential is required.
+//
+// Requests are matched by method, path and query, so fixtures can be replayed regardless of the cloud endpoint.
+// A request without a fixture fails with an [ErrNoRecording] error.
+package recording
@@ -0,0 +1,260 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package recording
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+const (
+	// fixtureFileSuffix is the file suffix of a recorded response in the fixture directory.
+	fixtureFileSuffix = ".json"
+	// fixtureDirPerm is the permission of the fixture directory.
+	fixtureDirPerm = 0o755
+	// fixtureFilePerm is the permission of the recorded response files.
+	fixtureFilePerm = 0o644
+)
+
+// Fixture is a recorded response, stored as JSON in the fixture directory.
+type Fixture struct {
+	// The HTTP method of the request.
+	Method string `json:"method"`
+	// The path and canonical query of the request, see RequestKey.
+	Request string `json:"request"`
+	// The HTTP status code of the response.
+	StatusCode int `json:"status_code"`
+	// The content type of the response.
+	ContentType string `json:"content_type,omitempty"`
+	// The body of the response.
+	Body string `json:"body"`
+}
+
+// ErrNoRecording is returned by the replay transport when the fixture directory has no recording for a request.
+// It is not retried by the Azure SDK pipeline.
+type ErrNoRecording struct {
+	Method  string
+	Request string
+	Dir     string
+}
+
+// Error implements the error interface.
+func (e *ErrNoRecording) Error() string {
+	return fmt.Sprintf("recording: no recording for %s %s in %s", e.Method, e.Request, e.Dir)
+}
+
+// NonRetriable marks the error as non-transient for the Azure SDK retry policy.
+func (e *ErrNoRecording) NonRetriable() {}
+
+// RequestKey returns the key that a request is recorded and replayed by: the path and the query with
+// sorted parameters. The scheme and host are omitted so that fixtures can be replayed against any cloud.
+func RequestKey(req *http.Request) string {
+	key := req.URL.EscapedPath()
+	if q := req.URL.Query(); len(q) > 0 {
+		key += "?" + q.Encode()
+	}
+
+	return key
+}
+
+// RecordingTransport is a policy.Transporter that sends requests using the next transporter and
+// writes each response to the fixture directory.
+type RecordingTransport struct {
+	dir  string
+	mu   sync.Mutex
+	next policy.Transporter
+}
+
+// NewRecordingTransport creates a RecordingTransport that writes responses to the fixture directory,
+// creating it if needed. If next is nil, http.DefaultClient is used.
+func NewRecordingTransport(dir string, next policy.Transporter) *RecordingTransport {
+	if next == nil {
+		next = http.DefaultClient
+	}
+
+	return &RecordingTransport{
+		dir:  dir,
+		next: next,
+	}
+}
+
+// Do implements the policy.Transporter interface.
+// An existing recording of the same request is overwritten.
+func (t *RecordingTransport) Do(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.Do(req)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close() //nolint:errcheck
+
+	if err != nil {
+		return nil, fmt.Errorf("RecordingTransport.Do: reading response body: %w", err)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	fixture := Fixture{
+		Method:      req.Method,
+		Request:     RequestKey(req),
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(body),
+	}
+
+	if err := t.write(&fixture); err != nil {
+		return nil, fmt.Errorf("RecordingTransport.Do: %w", err)
+	}
+
+	return resp, nil
+}
+
+// write writes the fixture to the fixture directory.
+func (t *RecordingTransport) write(fixture *Fixture) error {
+	b, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling recording: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := os.MkdirAll(t.dir, fixtureDirPerm); err != nil {
+		return fmt.Errorf("creating fixture directory: %w", err)
+	}
+
+	name := fixtureFileName(fixture.Method, fixture.Request)
+	if err := os.WriteFile(filepath.Join(t.dir, name), b, fixtureFilePerm); err != nil {
+		return fmt.Errorf("writing recording: %w", err)
+	}
+
+	return nil
+}
+
+// ReplayTransport is a policy.Transporter that serves responses from the fixture directory,
+// without sending requests.
+type ReplayTransport struct {
+	dir string
+}
+
+// NewReplayTransport creates a ReplayTransport that serves responses from the fixture directory.
+func NewReplayTransport(dir string) *ReplayTransport {
+	return &ReplayTransport{
+		dir: dir,
+	}
+}
+
+// Do implements the policy.Transporter interface.
+// It returns an *ErrNoRecording error if the request has not been recorded.
+func (t *ReplayTransport) Do(req *http.Request) (*http.Response, error) {
+	key := RequestKey(req)
+
+	b, err := os.ReadFile(filepath.Join(t.dir, fixtureFileName(req.Method, key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &ErrNoRecording{Method: req.Method, Request: key, Dir: t.dir}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("ReplayTransport.Do: reading recording: %w", err)
+	}
+
+	fixture := new(Fixture)
+	if err := json.Unmarshal(b, fixture); err != nil {
+		return nil, fmt.Errorf("ReplayTransport.Do: unmarshaling recording for %s %s: %w", req.Method, key, err)
+	}
+
+	header := make(http.Header)
+	if fixture.ContentType != "" {
+		header.Set("Content-Type", fixture.ContentType)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.StatusCode, http.StatusText(fixture.StatusCode)),
+		StatusCode:    fixture.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(fixture.Body))),
+		ContentLength: int64(len(fixture.Body)),
+		Request:       req,
+	}, nil
+}
+
+// NewRecordingClientFactory creates an armpolicy.ClientFactory that records all responses to the fixture
+// directory. The transport in options, if any, is used to send the requests.
+func NewRecordingClientFactory(
+	dir string,
+	cred azcore.TokenCredential,
+	options *arm.ClientOptions,
+) (*armpolicy.ClientFactory, error) {
+	opts := arm.ClientOptions{}
+	if options != nil {
+		opts = *options
+	}
+
+	opts.Transport = NewRecordingTransport(dir, opts.Transport)
+
+	cf, err := armpolicy.NewClientFactory("", cred, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("recording.NewRecordingClientFactory: %w", err)
+	}
+
+	return cf, nil
+}
+
+// NewReplayClientFactory creates an armpolicy.ClientFactory that serves all responses from the fixture
+// directory. No credential is required. Any transport in options is replaced.
+func NewReplayClientFactory(dir string, options *arm.ClientOptions) (*armpolicy.ClientFactory, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("recording.NewReplayClientFactory: fixture directory: %w", err)
+	}
+
+	opts := arm.ClientOptions{}
+	if options != nil {
+		opts = *options
+	}
+
+	opts.Transport = NewReplayTransport(dir)
+
+	cf, err := armpolicy.NewClientFactory("", replayCredential{}, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("recording.NewReplayClientFactory: %w", err)
+	}
+
+	return cf, nil
+}
+
+// replayCredential is a static azcore.TokenCredential, the token is never sent to Azure.
+type replayCredential struct{}
+
+// GetToken implements the azcore.TokenCredential interface.
+func (replayCredential) GetToken(_ context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "replay", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// fixtureFileName returns the file name of the recording for the request, a hash of the method and
+// request key.
+func fixtureFileName(method, key string) string {
+	sum := sha256.Sum256([]byte(method + " " + key))
+
+	return hex.EncodeToString(sum[:]) + fixtureFileSuffix
+}
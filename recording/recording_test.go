@@ -0,0 +1,89 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package recording
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// transporterFunc is a policy.Transporter that calls the function.
+type transporterFunc func(*http.Request) (*http.Response, error)
+
+func (f transporterFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	calls := 0
+
+	azure := transporterFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body: io.NopCloser(strings.NewReader(
+				`{"name": "pd", "properties": {"displayName": "recorded", "policyType": "BuiltIn"}}`,
+			)),
+			Request: req,
+		}, nil
+	})
+
+	cf, err := NewRecordingClientFactory(dir, replayCredential{}, &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{Transport: azure},
+	})
+	require.NoError(t, err)
+
+	resp, err := cf.NewDefinitionsClient().GetBuiltIn(ctx, "pd", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "recorded", *resp.Properties.DisplayName)
+	assert.Equal(t, 1, calls)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	cf, err = NewReplayClientFactory(dir, nil)
+	require.NoError(t, err)
+
+	resp, err = cf.NewDefinitionsClient().GetBuiltIn(ctx, "pd", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "recorded", *resp.Properties.DisplayName)
+	assert.Equal(t, 1, calls, "replay must not send requests")
+
+	_, err = cf.NewDefinitionsClient().GetBuiltIn(ctx, "other", nil)
+
+	var noRec *ErrNoRecording
+	require.ErrorAs(t, err, &noRec)
+	assert.Contains(t, noRec.Request, "/providers/Microsoft.Authorization/policyDefinitions/other?api-version=")
+}
+
+func TestNewReplayClientFactoryMissingDir(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewReplayClientFactory(t.TempDir()+"/notexist", nil)
+	require.ErrorContains(t, err, "fixture directory")
+}
+
+func TestRequestKey(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest(http.MethodGet, "https://management.azure.com/a/b?z=1&a=2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/a/b?a=2&z=1", RequestKey(req))
+}
@@ -0,0 +1,195 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	mapset "github.com/deckarep/golang-set/v2"
+)
+
+// AssetTypeArchitectureManagementGroup is a management group within an architecture.
+// It is only used in the reference graph, the asset name is `architecture/managementGroupID`.
+const AssetTypeArchitectureManagementGroup AssetType = "architecture_management_group"
+
+// AssetReference identifies an asset in the reference graph.
+type AssetReference struct {
+	Type AssetType `json:"type"`
+	Name string    `json:"name"`
+}
+
+// ReferenceGraph is a reverse dependency index of the assets in an AlzLib.
+// It answers the question "what uses this asset?", e.g. for impact analysis before removing or changing
+// a custom definition. It is a snapshot, changes to the AlzLib after it was created are not reflected.
+//
+// The following references are recorded:
+//
+//   - policy set definitions reference the policy definitions they include (all versions).
+//   - policy assignments reference the policy definition or policy set definition they assign.
+//   - policy exemptions reference the policy assignment they exempt.
+//   - archetypes reference their policy assignments, policy definitions, policy exemptions,
+//     policy set definitions and role definitions.
+//   - architecture management groups reference their archetypes.
+//
+// Definitions are referenced by name, regardless of version.
+type ReferenceGraph struct {
+	referencedBy map[AssetReference]mapset.Set[AssetReference]
+}
+
+// ReferenceGraph builds the reverse dependency index of the assets in the AlzLib.
+func (az *AlzLib) ReferenceGraph() *ReferenceGraph {
+	az.mu.RLock()
+	defer az.mu.RUnlock()
+
+	g := &ReferenceGraph{
+		referencedBy: make(map[AssetReference]mapset.Set[AssetReference]),
+	}
+
+	for name, psdvs := range az.policySetDefinitions {
+		from := AssetReference{Type: AssetTypePolicySetDefinition, Name: name}
+
+		for psd := range psdvs.AllVersions() {
+			for _, ref := range psd.PolicyDefinitionReferences() {
+				if ref == nil || ref.PolicyDefinitionID == nil {
+					continue
+				}
+
+				resID, err := arm.ParseResourceID(*ref.PolicyDefinitionID)
+				if err != nil {
+					continue
+				}
+
+				g.add(from, AssetReference{Type: AssetTypePolicyDefinition, Name: resID.Name})
+			}
+		}
+	}
+
+	for name, pa := range az.policyAssignments {
+		resID, _, err := pa.ReferencedPolicyDefinitionResourceIDAndVersion()
+		if err != nil {
+			continue
+		}
+
+		to := AssetReference{Type: AssetTypePolicyDefinition, Name: resID.Name}
+		if strings.ToLower(resID.ResourceType.Type) == PolicySetDefinitionsType {
+			to.Type = AssetTypePolicySetDefinition
+		}
+
+		g.add(AssetReference{Type: AssetTypePolicyAssignment, Name: name}, to)
+	}
+
+	for name, pe := range az.policyExemptions {
+		paName, err := pe.ReferencedPolicyAssignmentName()
+		if err != nil {
+			continue
+		}
+
+		g.add(
+			AssetReference{Type: AssetTypePolicyExemption, Name: name},
+			AssetReference{Type: AssetTypePolicyAssignment, Name: paName},
+		)
+	}
+
+	for name, arch := range az.archetypes {
+		from := AssetReference{Type: AssetTypeArchetype, Name: name}
+		g.addAll(from, AssetTypePolicyAssignment, arch.PolicyAssignments)
+		g.addAll(from, AssetTypePolicyDefinition, arch.PolicyDefinitions)
+		g.addAll(from, AssetTypePolicyExemption, arch.PolicyExemptions)
+		g.addAll(from, AssetTypePolicySetDefinition, arch.PolicySetDefinitions)
+		g.addAll(from, AssetTypeRoleDefinition, arch.RoleDefinitions)
+	}
+
+	for name, arch := range az.architectures {
+		for mgID, mg := range arch.mgs {
+			from := AssetReference{Type: AssetTypeArchitectureManagementGroup, Name: name + "/" + mgID}
+			for archetype := range mg.archetypes.Iter() {
+				g.add(from, AssetReference{Type: AssetTypeArchetype, Name: archetype.name})
+			}
+		}
+	}
+
+	return g
+}
+
+// ReferencedBy returns the assets that directly reference the asset of the given type and name, sorted by type
+// and name. An empty result means that nothing in the library uses the asset.
+func (g *ReferenceGraph) ReferencedBy(typ AssetType, name string) []AssetReference {
+	refs, ok := g.referencedBy[AssetReference{Type: typ, Name: name}]
+	if !ok {
+		return nil
+	}
+
+	return sortedAssetReferences(refs)
+}
+
+// ReferencedByTransitive returns all assets that directly or indirectly reference the asset of the given type and name,
+// sorted by type and name. For example, for a policy definition this includes the policy set definitions that include
+// it, the assignments of the definition and those sets, the archetypes that include any of these and the architecture
+// management groups that use those archetypes.
+func (g *ReferenceGraph) ReferencedByTransitive(typ AssetType, name string) []AssetReference {
+	start := AssetReference{Type: typ, Name: name}
+	seen := mapset.NewThreadUnsafeSet[AssetReference]()
+	queue := []AssetReference{start}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		refs, ok := g.referencedBy[current]
+		if !ok {
+			continue
+		}
+
+		for ref := range refs.Iter() {
+			if ref == start || !seen.Add(ref) {
+				continue
+			}
+
+			queue = append(queue, ref)
+		}
+	}
+
+	if seen.Cardinality() == 0 {
+		return nil
+	}
+
+	return sortedAssetReferences(seen)
+}
+
+// IsReferenced reports whether any asset directly references the asset of the given type and name.
+func (g *ReferenceGraph) IsReferenced(typ AssetType, name string) bool {
+	refs, ok := g.referencedBy[AssetReference{Type: typ, Name: name}]
+
+	return ok && refs.Cardinality() > 0
+}
+
+func (g *ReferenceGraph) add(from, to AssetReference) {
+	if _, ok := g.referencedBy[to]; !ok {
+		g.referencedBy[to] = mapset.NewThreadUnsafeSet[AssetReference]()
+	}
+
+	g.referencedBy[to].Add(from)
+}
+
+func (g *ReferenceGraph) addAll(from AssetReference, typ AssetType, names mapset.Set[string]) {
+	if names == nil {
+		return
+	}
+
+	for name := range names.Iter() {
+		g.add(from, AssetReference{Type: typ, Name: name})
+	}
+}
+
+func sortedAssetReferences(refs mapset.Set[AssetReference]) []AssetReference {
+	res := refs.ToSlice()
+	slices.SortFunc(res, func(a, b AssetReference) int {
+		return cmp.Or(cmp.Compare(a.Type, b.Type), cmp.Compare(a.Name, b.Name))
+	})
+
+	return res
+}
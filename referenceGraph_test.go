@@ -0,0 +1,59 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package alzlib
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferenceGraph(t *testing.T) {
+	t.Parallel()
+
+	az := NewAlzLib(nil)
+	require.NoError(t, az.Init(context.Background(), NewCustomLibraryReferenceFromFS("simple", os.DirFS("./testdata/simple"))))
+
+	g := az.ReferenceGraph()
+
+	assert.Equal(t, []AssetReference{
+		{Type: AssetTypeArchetype, Name: "simple"},
+		{Type: AssetTypeArchetype, Name: "simpleoverride"},
+		{Type: AssetTypePolicyAssignment, Name: "test-pa"},
+		{Type: AssetTypePolicySetDefinition, Name: "test-policy-set-definition"},
+	}, g.ReferencedBy(AssetTypePolicyDefinition, "test-policy-definition"))
+
+	assert.Equal(t, []AssetReference{
+		{Type: AssetTypeArchetype, Name: "simple"},
+		{Type: AssetTypeArchetype, Name: "simpleoverride"},
+		{Type: AssetTypePolicyAssignment, Name: "override-pa"},
+	}, g.ReferencedBy(AssetTypePolicySetDefinition, "test-policy-set-definition"))
+
+	// The simpleoverride archetype removes test-pa.
+	assert.Equal(t, []AssetReference{
+		{Type: AssetTypeArchetype, Name: "simple"},
+	}, g.ReferencedBy(AssetTypePolicyAssignment, "test-pa"))
+
+	assert.Equal(t, []AssetReference{
+		{Type: AssetTypeArchitectureManagementGroup, Name: "simple/simple"},
+	}, g.ReferencedBy(AssetTypeArchetype, "simple"))
+
+	assert.Equal(t, []AssetReference{
+		{Type: AssetTypeArchetype, Name: "simple"},
+		{Type: AssetTypeArchetype, Name: "simpleoverride"},
+		{Type: AssetTypeArchitectureManagementGroup, Name: "simple/simple"},
+		{Type: AssetTypeArchitectureManagementGroup, Name: "simple/simpleoverride"},
+		{Type: AssetTypePolicyAssignment, Name: "override-pa"},
+		{Type: AssetTypePolicyAssignment, Name: "test-pa"},
+		{Type: AssetTypePolicySetDefinition, Name: "test-policy-set-definition"},
+	}, g.ReferencedByTransitive(AssetTypePolicyDefinition, "test-policy-definition"))
+
+	assert.True(t, g.IsReferenced(AssetTypeRoleDefinition, "test-role-definition"))
+	assert.False(t, g.IsReferenced(AssetTypeArchitectureManagementGroup, "simple/simple"))
+	assert.Nil(t, g.ReferencedBy(AssetTypePolicyDefinition, "does-not-exist"))
+	assert.Nil(t, g.ReferencedByTransitive(AssetTypePolicyDefinition, "does-not-exist"))
+}
@@ -0,0 +1,401 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package simulate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/alzlib/assets"
+)
+
+// negatedOperators maps the negated condition operators to the operator they negate.
+var negatedOperators = map[string]string{
+	"notEquals":             "equals",
+	"notLike":               "like",
+	"notMatch":              "match",
+	"notMatchInsensitively": "matchInsensitively",
+	"notContains":           "contains",
+	"notIn":                 "in",
+	"notContainsKey":        "containsKey",
+}
+
+// expression evaluates a policy rule expression.
+// The logical operators short circuit, as they do in Azure, so later expressions are not evaluated
+// once the result is known.
+func (ec *evalContext) expression(ctx context.Context, expr assets.PolicyRuleExpression) (bool, error) {
+	switch e := expr.(type) {
+	case *assets.PolicyRuleLogical:
+		allOf := e.Operator == assets.PolicyRuleLogicalAllOf
+
+		for _, child := range e.Expressions {
+			ok, err := ec.expression(ctx, child)
+			if err != nil {
+				return false, err
+			}
+
+			if ok != allOf {
+				return ok, nil
+			}
+		}
+
+		return allOf, nil
+	case *assets.PolicyRuleNot:
+		ok, err := ec.expression(ctx, e.Expression)
+		if err != nil {
+			return false, err
+		}
+
+		return !ok, nil
+	case *assets.PolicyRuleCondition:
+		ok, err := ec.condition(ctx, e)
+		if err != nil {
+			// Errors from the where condition of a count already have the path.
+			var ruleErr *assets.PolicyRuleError
+			if errors.As(err, &ruleErr) {
+				return false, err
+			}
+
+			return false, &assets.PolicyRuleError{Path: e.Path(), Message: err.Error()}
+		}
+
+		return ok, nil
+	}
+
+	return false, fmt.Errorf("unexpected policy rule expression type %T", expr)
+}
+
+func (ec *evalContext) condition(ctx context.Context, cond *assets.PolicyRuleCondition) (bool, error) {
+	arg, err := ec.evaluate(ctx, cond.Argument)
+	if err != nil {
+		return false, err
+	}
+
+	switch op := cond.Operand.(type) {
+	case *assets.PolicyRuleField:
+		values, multi := ec.field(op.Field)
+		if !multi {
+			if len(values) == 0 {
+				return compare(cond.Operator, nil, false, arg)
+			}
+
+			return compare(cond.Operator, values[0], true, arg)
+		}
+
+		// A condition on an array alias is true if all the array members meet it.
+		for _, v := range values {
+			ok, err := compare(cond.Operator, v, true, arg)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+
+		return true, nil
+	case *assets.PolicyRuleValue:
+		v, err := ec.evaluate(ctx, op.Value)
+		if err != nil {
+			return false, err
+		}
+
+		return compare(cond.Operator, v, v != nil, arg)
+	case *assets.PolicyRuleCount:
+		n, err := ec.count(ctx, op)
+		if err != nil {
+			return false, err
+		}
+
+		return compare(cond.Operator, n, true, arg)
+	}
+
+	return false, fmt.Errorf("unexpected policy rule operand type %T", cond.Operand)
+}
+
+// count returns the number of array members that meet the where condition of the count expression.
+func (ec *evalContext) count(ctx context.Context, c *assets.PolicyRuleCount) (int, error) {
+	var (
+		members []any
+		scope   countScope
+	)
+
+	if c.Field != "" {
+		members, _ = ec.field(c.Field)
+		scope.field = strings.ToLower(c.Field)
+	} else {
+		v, err := ec.evaluate(ctx, c.Value)
+		if err != nil {
+			return 0, err
+		}
+
+		arr, ok := v.([]any)
+		if !ok && v != nil {
+			return 0, fmt.Errorf("count value must be an array, got %v", v)
+		}
+
+		members = arr
+		scope.name = c.Name
+	}
+
+	if c.Where == nil {
+		return len(members), nil
+	}
+
+	n := 0
+
+	for _, member := range members {
+		scope.value = member
+
+		ok, err := ec.withScope(scope).expression(ctx, c.Where)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// compare applies the condition operator.
+// The found parameter is false if the field is not present in the resource.
+func compare(op string, v any, found bool, arg any) (bool, error) {
+	if negated, ok := negatedOperators[op]; ok {
+		res, err := compare(negated, v, found, arg)
+		return !res, err
+	}
+
+	switch op {
+	case "equals":
+		return found && valuesEqual(v, arg), nil
+	case "like", "match", "matchInsensitively":
+		pattern, ok := arg.(string)
+		if !ok {
+			return false, fmt.Errorf("%s requires a string argument, got %v", op, arg)
+		}
+
+		s, ok := v.(string)
+
+		return ok && patternRegexp(op, pattern).MatchString(s), nil
+	case "contains":
+		switch val := v.(type) {
+		case string:
+			s, ok := scalarString(arg)
+			return ok && strings.Contains(strings.ToLower(val), strings.ToLower(s)), nil
+		case []any:
+			return containsValue(val, arg), nil
+		}
+
+		return false, nil
+	case "in":
+		arr, ok := arg.([]any)
+		if !ok {
+			return false, fmt.Errorf("in requires an array argument, got %v", arg)
+		}
+
+		return found && containsValue(arr, v), nil
+	case "containsKey":
+		m, ok := v.(map[string]any)
+		if !ok {
+			return false, nil
+		}
+
+		key, ok := arg.(string)
+		if !ok {
+			return false, fmt.Errorf("containsKey requires a string argument, got %v", arg)
+		}
+
+		_, ok = lookupKey(m, key)
+
+		return ok, nil
+	case "less", "lessOrEquals", "greater", "greaterOrEquals":
+		c, ok := compareOrdered(v, arg)
+		if !ok {
+			return false, nil
+		}
+
+		switch op {
+		case "less":
+			return c < 0, nil
+		case "lessOrEquals":
+			return c <= 0, nil
+		case "greater":
+			return c > 0, nil
+		}
+
+		return c >= 0, nil
+	case "exists":
+		want, ok := toBool(arg)
+		if !ok {
+			return false, fmt.Errorf("exists requires a boolean argument, got %v", arg)
+		}
+
+		return (found && v != nil) == want, nil
+	}
+
+	return false, fmt.Errorf("unsupported operator `%s`", op)
+}
+
+// patternRegexp converts a like, match or matchInsensitively pattern to a regular expression.
+// For like, `*` matches any characters.
+// For match, `#` matches a digit, `?` a letter and `.` any character.
+func patternRegexp(op, pattern string) *regexp.Regexp {
+	var sb strings.Builder
+
+	sb.WriteString("(?s)")
+
+	if op != "match" {
+		sb.WriteString("(?i)")
+	}
+
+	sb.WriteString("^")
+
+	for _, r := range pattern {
+		switch {
+		case op == "like" && r == '*':
+			sb.WriteString(".*")
+		case op != "like" && r == '#':
+			sb.WriteString("[0-9]")
+		case op != "like" && r == '?':
+			sb.WriteString("[a-zA-Z]")
+		case op != "like" && r == '.':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	sb.WriteString("$")
+
+	return regexp.MustCompile(sb.String())
+}
+
+// valuesEqual compares values the way Azure Policy does: strings case insensitively,
+// numbers numerically, and scalars of different types by their string representation.
+func valuesEqual(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			return af == bf
+		}
+	}
+
+	switch av := a.(type) {
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+
+		for i := range av {
+			if !valuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+
+		return true
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+
+		for k, v := range av {
+			other, ok := lookupKey(bv, k)
+			if !ok || !valuesEqual(v, other) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	as, aok := scalarString(a)
+	bs, bok := scalarString(b)
+
+	return aok && bok && strings.EqualFold(as, bs)
+}
+
+func containsValue(arr []any, v any) bool {
+	for _, member := range arr {
+		if valuesEqual(member, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compareOrdered compares numbers numerically, date times chronologically and other strings case insensitively.
+func compareOrdered(a, b any) (int, bool) {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		return cmp.Compare(af, bf), ok
+	}
+
+	as, aok := a.(string)
+	bs, bok := b.(string)
+
+	if !aok || !bok {
+		return 0, false
+	}
+
+	at, aerr := time.Parse(time.RFC3339, as)
+	bt, berr := time.Parse(time.RFC3339, bs)
+
+	if aerr == nil && berr == nil {
+		return at.Compare(bt), true
+	}
+
+	return cmp.Compare(strings.ToLower(as), strings.ToLower(bs)), true
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+
+	return 0, false
+}
+
+func toBool(v any) (bool, bool) {
+	switch b := v.(type) {
+	case bool:
+		return b, true
+	case string:
+		res, err := strconv.ParseBool(b)
+		return res, err == nil
+	}
+
+	return false, false
+}
+
+func scalarString(v any) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case bool:
+		return strconv.FormatBool(s), true
+	}
+
+	if f, ok := toFloat(v); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package simulate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/alzlib/assets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		op    string
+		v     any
+		found bool
+		arg   any
+		want  bool
+	}{
+		{name: "equals case insensitive", op: "equals", v: "Deny", found: true, arg: "deny", want: true},
+		{name: "equals number", op: "equals", v: float64(2), found: true, arg: 2, want: true},
+		{name: "equals bool and string", op: "equals", v: true, found: true, arg: "True", want: true},
+		{name: "equals missing", op: "equals", found: false, arg: "", want: false},
+		{name: "notEquals missing", op: "notEquals", found: false, arg: "a", want: true},
+		{name: "like", op: "like", v: "vnet-hub-01", found: true, arg: "VNET-*-01", want: true},
+		{name: "notLike", op: "notLike", v: "vnet-hub-01", found: true, arg: "snet-*", want: true},
+		{name: "match", op: "match", v: "ab-12", found: true, arg: "??-##", want: true},
+		{name: "match case sensitive", op: "match", v: "ab-12", found: true, arg: "AB-##", want: false},
+		{name: "matchInsensitively", op: "matchInsensitively", v: "ab-12", found: true, arg: "AB-##", want: true},
+		{name: "match dot", op: "match", v: "a.b", found: true, arg: "a.b", want: true},
+		{name: "contains string", op: "contains", v: "Standard_LRS", found: true, arg: "lrs", want: true},
+		{name: "contains array", op: "contains", v: []any{"a", "b"}, found: true, arg: "B", want: true},
+		{name: "notContains", op: "notContains", v: []any{"a", "b"}, found: true, arg: "c", want: true},
+		{name: "in", op: "in", v: "westeurope", found: true, arg: []any{"WestEurope", "northeurope"}, want: true},
+		{name: "notIn missing", op: "notIn", found: false, arg: []any{"a"}, want: true},
+		{name: "containsKey", op: "containsKey", v: map[string]any{"Env": "prod"}, found: true, arg: "env", want: true},
+		{name: "less", op: "less", v: float64(1), found: true, arg: 2, want: true},
+		{name: "greaterOrEquals", op: "greaterOrEquals", v: 2, found: true, arg: float64(2), want: true},
+		{
+			name: "greater date", op: "greater", v: "2025-01-02T00:00:00Z", found: true,
+			arg: "2025-01-01T12:00:00+00:00", want: true,
+		},
+		{name: "less mismatched types", op: "less", v: "a", found: true, arg: 1, want: false},
+		{name: "exists", op: "exists", v: "a", found: true, arg: "true", want: true},
+		{name: "exists null", op: "exists", v: nil, found: true, arg: true, want: false},
+		{name: "not exists", op: "exists", found: false, arg: false, want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := compare(tc.op, tc.v, tc.found, tc.arg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err := compare("in", "a", true, "a")
+	require.EqualError(t, err, "in requires an array argument, got a")
+
+	_, err = compare("exists", "a", true, "maybe")
+	require.EqualError(t, err, "exists requires a boolean argument, got maybe")
+}
+
+func TestValueCount(t *testing.T) {
+	t.Parallel()
+
+	rule, err := assets.ParsePolicyRule(map[string]any{
+		"if": map[string]any{
+			"count": map[string]any{
+				"value": "[parameters('allowedPrefixes')]",
+				"name":  "prefix",
+				"where": map[string]any{
+					"field": "name",
+					"like":  "[concat(current('prefix'), '*')]",
+				},
+			},
+			"equals": 0,
+		},
+		"then": map[string]any{"effect": "deny"},
+	})
+	require.NoError(t, err)
+
+	ec := &evalContext{
+		params:   map[string]any{"allowedPrefixes": []any{"rg-", "vnet-"}},
+		resource: map[string]any{"name": "vnet-hub"},
+	}
+
+	match, err := ec.expression(context.Background(), rule.If)
+	require.NoError(t, err)
+	assert.False(t, match)
+
+	ec.resource = map[string]any{"name": "hub"}
+
+	match, err = ec.expression(context.Background(), rule.If)
+	require.NoError(t, err)
+	assert.True(t, match)
+}
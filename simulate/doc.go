@@ -0,0 +1,17 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package simulate evaluates policy definitions, policy set definitions and policy assignments
+// against resource JSON documents, without Azure.
+// This enables custom policy definitions to be unit tested locally.
+//
+// The evaluation approximates the Azure Policy engine:
+//
+//   - Aliases are resolved against the resource document by removing the resource type prefix,
+//     e.g. `Microsoft.Storage/storageAccounts/minimumTlsVersion` is read from `properties.minimumTlsVersion`,
+//     falling back to the top level of the document, e.g. for `sku.name`.
+//   - ARM template functions are evaluated using goarmfunctions, with the addition of
+//     the policy functions `field()` and `current()`. Other functions result in an error.
+//   - The existence condition of the auditIfNotExists and deployIfNotExists effects is not evaluated,
+//     as it requires the related resources.
+package simulate
@@ -0,0 +1,327 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package simulate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+const effectDisabled = "disabled"
+
+// Result is the outcome of evaluating a policy definition against a resource.
+type Result struct {
+	// PolicyAssignmentName is set when the result was produced by Evaluator.PolicyAssignment.
+	PolicyAssignmentName string `json:"policy_assignment_name,omitempty"`
+	// PolicyDefinitionReferenceID is set when the policy definition was evaluated as a member of a policy set.
+	PolicyDefinitionReferenceID string `json:"policy_definition_reference_id,omitempty"`
+	// PolicyDefinitionName is the name of the evaluated policy definition.
+	PolicyDefinitionName string `json:"policy_definition_name"`
+	// Match is true if the resource matches the if condition of the policy rule.
+	Match bool `json:"match"`
+	// Effect is the evaluated effect of the policy rule, e.g. `Deny`.
+	// It is set regardless of whether the resource matches.
+	Effect string `json:"effect"`
+	// Enforced is false if the policy assignment has an enforcement mode of DoNotEnforce.
+	Enforced bool `json:"enforced"`
+}
+
+// Applies returns true if the resource matches the policy rule and the effect is not disabled.
+func (r *Result) Applies() bool {
+	return r.Match && !strings.EqualFold(r.Effect, effectDisabled)
+}
+
+// Evaluator evaluates the policy assets held by AlzLib against resources.
+type Evaluator struct {
+	az *alzlib.AlzLib
+}
+
+// NewEvaluator returns a new Evaluator that resolves referenced policy definitions using the supplied AlzLib.
+func NewEvaluator(az *alzlib.AlzLib) *Evaluator {
+	return &Evaluator{az: az}
+}
+
+// PolicyDefinition evaluates the policy definition against the resource, using the supplied parameter values.
+// Parameters that are not supplied take the default value from the policy definition.
+func (e *Evaluator) PolicyDefinition(
+	ctx context.Context,
+	pd *assets.PolicyDefinition,
+	params map[string]any,
+	resource map[string]any,
+) (*Result, error) {
+	res, err := evaluatePolicyDefinition(ctx, pd, params, normaliseResource(resource))
+	if err != nil {
+		return nil, fmt.Errorf("Evaluator.PolicyDefinition: %w", err)
+	}
+
+	return res, nil
+}
+
+// PolicySetDefinition evaluates each policy definition referenced by the policy set definition
+// against the resource, using the supplied policy set parameter values.
+// Parameters that are not supplied take the default value from the policy set definition.
+// Referenced policy definitions are resolved using AlzLib.
+// If some referenced policy definitions cannot be evaluated, the results of the others are returned
+// together with the joined errors.
+func (e *Evaluator) PolicySetDefinition(
+	ctx context.Context,
+	psd *assets.PolicySetDefinition,
+	params map[string]any,
+	resource map[string]any,
+) ([]*Result, error) {
+	res, err := e.evaluatePolicySetDefinition(ctx, psd, params, normaliseResource(resource))
+	if err != nil {
+		return res, fmt.Errorf("Evaluator.PolicySetDefinition: %w", err)
+	}
+
+	return res, nil
+}
+
+// PolicyAssignment evaluates the policy definition or policy set definition referenced by the assignment
+// against the resource, using the parameter values of the assignment.
+// Referenced definitions are resolved using AlzLib.
+// As with PolicySetDefinition, partial results may be returned together with an error.
+func (e *Evaluator) PolicyAssignment(
+	ctx context.Context,
+	pa *assets.PolicyAssignment,
+	resource map[string]any,
+) ([]*Result, error) {
+	if pa == nil || pa.Properties == nil || pa.Properties.PolicyDefinitionID == nil {
+		return nil, errors.New("Evaluator.PolicyAssignment: policy definition id is not set")
+	}
+
+	name := ""
+	if pa.Name != nil {
+		name = *pa.Name
+	}
+
+	ref, ver, err := pa.ReferencedPolicyDefinitionResourceIDAndVersion()
+	if err != nil {
+		return nil, fmt.Errorf("Evaluator.PolicyAssignment: policy assignment `%s`: %w", name, err)
+	}
+
+	params := parameterValues(pa.Properties.Parameters)
+	resource = normaliseResource(resource)
+
+	var results []*Result
+
+	switch strings.ToLower(ref.ResourceType.Type) {
+	case alzlib.PolicyDefinitionsType:
+		pd := e.az.PolicyDefinition(ref.Name, ver)
+		if pd == nil {
+			return nil, fmt.Errorf(
+				"Evaluator.PolicyAssignment: policy assignment `%s`: policy definition `%s` not found", name, ref.Name,
+			)
+		}
+
+		res, evalErr := evaluatePolicyDefinition(ctx, pd, params, resource)
+		if res != nil {
+			results = append(results, res)
+		}
+
+		err = evalErr
+	case alzlib.PolicySetDefinitionsType:
+		psd := e.az.PolicySetDefinition(ref.Name, ver)
+		if psd == nil {
+			return nil, fmt.Errorf(
+				"Evaluator.PolicyAssignment: policy assignment `%s`: policy set definition `%s` not found", name, ref.Name,
+			)
+		}
+
+		results, err = e.evaluatePolicySetDefinition(ctx, psd, params, resource)
+	default:
+		return nil, fmt.Errorf(
+			"Evaluator.PolicyAssignment: policy assignment `%s`: unexpected referenced resource type `%s`",
+			name,
+			ref.ResourceType.Type,
+		)
+	}
+
+	enforced := pa.Properties.EnforcementMode == nil ||
+		*pa.Properties.EnforcementMode != armpolicy.EnforcementModeDoNotEnforce
+
+	for _, res := range results {
+		res.PolicyAssignmentName = name
+		res.Enforced = enforced
+	}
+
+	if err != nil {
+		return results, fmt.Errorf("Evaluator.PolicyAssignment: policy assignment `%s`: %w", name, err)
+	}
+
+	return results, nil
+}
+
+func (e *Evaluator) evaluatePolicySetDefinition(
+	ctx context.Context,
+	psd *assets.PolicySetDefinition,
+	params map[string]any,
+	resource map[string]any,
+) ([]*Result, error) {
+	if psd == nil || psd.Properties == nil {
+		return nil, errors.New("policy set definition properties are not set")
+	}
+
+	setParams := mergeParameters(psd.Properties.Parameters, params)
+	refs := psd.PolicyDefinitionReferences()
+	results := make([]*Result, 0, len(refs))
+
+	var errs []error
+
+	for _, ref := range refs {
+		refID := ""
+		if ref.PolicyDefinitionReferenceID != nil {
+			refID = *ref.PolicyDefinitionReferenceID
+		}
+
+		res, err := e.evaluatePolicyDefinitionReference(ctx, ref, setParams, resource)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("policy definition reference `%s`: %w", refID, err))
+			continue
+		}
+
+		res.PolicyDefinitionReferenceID = refID
+		results = append(results, res)
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func (e *Evaluator) evaluatePolicyDefinitionReference(
+	ctx context.Context,
+	ref *armpolicy.DefinitionReference,
+	setParams map[string]any,
+	resource map[string]any,
+) (*Result, error) {
+	if ref.PolicyDefinitionID == nil {
+		return nil, errors.New("policy definition id is not set")
+	}
+
+	id, err := arm.ParseResourceID(*ref.PolicyDefinitionID)
+	if err != nil {
+		return nil, err
+	}
+
+	pd := e.az.PolicyDefinition(id.Name, ref.DefinitionVersion)
+	if pd == nil {
+		return nil, fmt.Errorf("policy definition `%s` not found", id.Name)
+	}
+
+	// The parameter values of the reference are usually expressions that refer to the set parameters.
+	ec := &evalContext{params: setParams, resource: resource}
+	params := make(map[string]any, len(ref.Parameters))
+
+	for name, v := range ref.Parameters {
+		if v == nil {
+			continue
+		}
+
+		val, err := ec.evaluate(ctx, v.Value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter `%s`: %w", name, err)
+		}
+
+		params[name] = val
+	}
+
+	return evaluatePolicyDefinition(ctx, pd, params, resource)
+}
+
+func evaluatePolicyDefinition(
+	ctx context.Context,
+	pd *assets.PolicyDefinition,
+	params map[string]any,
+	resource map[string]any,
+) (*Result, error) {
+	if pd == nil || pd.Properties == nil {
+		return nil, errors.New("policy definition properties are not set")
+	}
+
+	name := ""
+	if pd.Name != nil {
+		name = *pd.Name
+	}
+
+	rule, err := pd.ParsePolicyRule()
+	if err != nil {
+		return nil, fmt.Errorf("policy definition `%s`: %w", name, err)
+	}
+
+	ec := &evalContext{
+		params:   mergeParameters(pd.Properties.Parameters, params),
+		resource: resource,
+	}
+
+	match, err := ec.expression(ctx, rule.If)
+	if err != nil {
+		return nil, fmt.Errorf("policy definition `%s`: %w", name, err)
+	}
+
+	effect, err := ec.evaluate(ctx, rule.Then.Effect)
+	if err != nil {
+		return nil, fmt.Errorf("policy definition `%s`: effect: %w", name, err)
+	}
+
+	effectStr, ok := effect.(string)
+	if !ok {
+		return nil, fmt.Errorf("policy definition `%s`: effect: expected a string, got %v", name, effect)
+	}
+
+	return &Result{
+		PolicyDefinitionName: name,
+		Match:                match,
+		Effect:               effectStr,
+		Enforced:             true,
+	}, nil
+}
+
+// mergeParameters returns the default values of the parameter definitions, overridden by the supplied values.
+func mergeParameters(defs map[string]*armpolicy.ParameterDefinitionsValue, values map[string]any) map[string]any {
+	result := make(map[string]any, len(defs)+len(values))
+
+	for name, def := range defs {
+		if def == nil || def.DefaultValue == nil {
+			continue
+		}
+
+		result[name] = normalise(def.DefaultValue)
+	}
+
+	for name, v := range values {
+		result[name] = normalise(v)
+	}
+
+	return result
+}
+
+// normaliseResource converts the resource to the types produced by encoding/json.
+func normaliseResource(resource map[string]any) map[string]any {
+	if m, ok := normalise(resource).(map[string]any); ok {
+		return m
+	}
+
+	return resource
+}
+
+// parameterValues converts policy assignment parameter values to a map of values.
+func parameterValues(params map[string]*armpolicy.ParameterValuesValue) map[string]any {
+	result := make(map[string]any, len(params))
+
+	for name, v := range params {
+		if v == nil || v.Value == nil {
+			continue
+		}
+
+		result[name] = v.Value
+	}
+
+	return result
+}
@@ -0,0 +1,234 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package simulate
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Azure/alzlib"
+	"github.com/Azure/alzlib/assets"
+	"github.com/Azure/alzlib/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicyDefinition = `{
+  "name": "storage-tls",
+  "type": "Microsoft.Authorization/policyDefinitions",
+  "properties": {
+    "displayName": "Storage accounts should be secure",
+    "description": "Storage accounts should use TLS 1.2 and not allow all networks",
+    "mode": "Indexed",
+    "policyType": "Custom",
+    "parameters": {
+      "effect": {"type": "String", "allowedValues": ["Audit", "Deny", "Disabled"], "defaultValue": "Audit"},
+      "minimumTlsVersion": {"type": "String", "defaultValue": "TLS1_2"}
+    },
+    "policyRule": {
+      "if": {
+        "allOf": [
+          {"field": "type", "equals": "Microsoft.Storage/storageAccounts"},
+          {
+            "anyOf": [
+              {"field": "Microsoft.Storage/storageAccounts/minimumTlsVersion", "notEquals": "[parameters('minimumTlsVersion')]"},
+              {
+                "count": {
+                  "field": "Microsoft.Storage/storageAccounts/networkAcls.ipRules[*]",
+                  "where": {"value": "[current('Microsoft.Storage/storageAccounts/networkAcls.ipRules[*].value')]", "equals": "0.0.0.0/0"}
+                },
+                "greater": 0
+              }
+            ]
+          }
+        ]
+      },
+      "then": {"effect": "[parameters('effect')]"}
+    }
+  }
+}`
+
+const testPolicySetDefinition = `{
+  "name": "storage",
+  "type": "Microsoft.Authorization/policySetDefinitions",
+  "properties": {
+    "displayName": "Storage",
+    "description": "Storage policies",
+    "policyType": "Custom",
+    "parameters": {
+      "storageEffect": {"type": "String", "defaultValue": "Deny"}
+    },
+    "policyDefinitions": [
+      {
+        "policyDefinitionReferenceId": "tls",
+        "policyDefinitionId": "/providers/Microsoft.Authorization/policyDefinitions/storage-tls",
+        "parameters": {"effect": {"value": "[parameters('storageEffect')]"}}
+      }
+    ]
+  }
+}`
+
+const testPolicyAssignment = `{
+  "name": "storage",
+  "type": "Microsoft.Authorization/policyAssignments",
+  "properties": {
+    "displayName": "Storage",
+    "description": "Storage policies",
+    "enforcementMode": "DoNotEnforce",
+    "policyDefinitionId": "/providers/Microsoft.Authorization/policySetDefinitions/storage",
+    "parameters": {"storageEffect": {"value": "Audit"}},
+    "scope": "/providers/Microsoft.Management/managementGroups/placeholder"
+  }
+}`
+
+func newTestAlzLib(t *testing.T) *alzlib.AlzLib {
+	t.Helper()
+
+	lib := alzlib.NewCustomLibraryReferenceFromFS("simulate", fstest.MapFS{
+		"storage-tls.alz_policy_definition.json": {Data: []byte(testPolicyDefinition)},
+		"storage.alz_policy_set_definition.json": {Data: []byte(testPolicySetDefinition)},
+		"storage.alz_policy_assignment.json":     {Data: []byte(testPolicyAssignment)},
+		"storage.alz_archetype_definition.json": {Data: []byte(`{
+  "name": "storage",
+  "policy_assignments": ["storage"],
+  "policy_definitions": ["storage-tls"],
+  "policy_set_definitions": ["storage"],
+  "role_definitions": []
+}`)},
+	})
+
+	az := alzlib.NewAlzLib(nil)
+	require.NoError(t, az.Init(context.Background(), lib))
+
+	return az
+}
+
+func testResource(t *testing.T, s string) map[string]any {
+	t.Helper()
+
+	var resource map[string]any
+	require.NoError(t, json.Unmarshal([]byte(s), &resource))
+
+	return resource
+}
+
+func TestEvaluatorPolicyDefinition(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	az := newTestAlzLib(t)
+	e := NewEvaluator(az)
+	pd := az.PolicyDefinition("storage-tls", nil)
+
+	compliant := testResource(t, `{
+  "name": "sa1",
+  "type": "Microsoft.Storage/storageAccounts",
+  "location": "northeurope",
+  "properties": {"minimumTlsVersion": "TLS1_2", "networkAcls": {"ipRules": [{"value": "10.0.0.0/8"}]}}
+}`)
+	oldTLS := testResource(t, `{
+  "name": "sa2",
+  "type": "Microsoft.Storage/storageAccounts",
+  "properties": {"minimumTlsVersion": "TLS1_0"}
+}`)
+	openNetwork := testResource(t, `{
+  "name": "sa3",
+  "type": "microsoft.storage/storageaccounts",
+  "properties": {"minimumTlsVersion": "tls1_2", "networkAcls": {"ipRules": [{"value": "0.0.0.0/0"}]}}
+}`)
+	other := testResource(t, `{"name": "kv", "type": "Microsoft.KeyVault/vaults"}`)
+
+	res, err := e.PolicyDefinition(ctx, pd, nil, compliant)
+	require.NoError(t, err)
+	assert.False(t, res.Match)
+	assert.Equal(t, "Audit", res.Effect)
+	assert.Equal(t, "storage-tls", res.PolicyDefinitionName)
+
+	res, err = e.PolicyDefinition(ctx, pd, map[string]any{"effect": "Deny"}, oldTLS)
+	require.NoError(t, err)
+	assert.True(t, res.Match)
+	assert.True(t, res.Applies())
+	assert.Equal(t, "Deny", res.Effect)
+
+	res, err = e.PolicyDefinition(ctx, pd, nil, openNetwork)
+	require.NoError(t, err)
+	assert.True(t, res.Match)
+
+	res, err = e.PolicyDefinition(ctx, pd, map[string]any{"effect": "Disabled"}, openNetwork)
+	require.NoError(t, err)
+	assert.True(t, res.Match)
+	assert.False(t, res.Applies())
+
+	res, err = e.PolicyDefinition(ctx, pd, nil, other)
+	require.NoError(t, err)
+	assert.False(t, res.Match)
+}
+
+func TestEvaluatorPolicyAssignment(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	az := newTestAlzLib(t)
+	e := NewEvaluator(az)
+
+	resource := testResource(t, `{
+  "name": "sa",
+  "type": "Microsoft.Storage/storageAccounts",
+  "properties": {"minimumTlsVersion": "TLS1_0"}
+}`)
+
+	results, err := e.PolicySetDefinition(ctx, az.PolicySetDefinition("storage", nil), nil, resource)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "tls", results[0].PolicyDefinitionReferenceID)
+	assert.Equal(t, "Deny", results[0].Effect)
+	assert.True(t, results[0].Match)
+
+	results, err = e.PolicyAssignment(ctx, az.PolicyAssignment("storage"), resource)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, &Result{
+		PolicyAssignmentName:        "storage",
+		PolicyDefinitionReferenceID: "tls",
+		PolicyDefinitionName:        "storage-tls",
+		Match:                       true,
+		Effect:                      "Audit",
+		Enforced:                    false,
+	}, results[0])
+}
+
+func TestEvaluatorUnsupportedFunction(t *testing.T) {
+	t.Parallel()
+
+	var rule any
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "if": {"allOf": [
+    {"field": "type", "equals": "Microsoft.Network/virtualNetworks"},
+    {"value": "[length(field('Microsoft.Network/virtualNetworks/subnets'))]", "greater": 0}
+  ]},
+  "then": {"effect": "audit"}
+}`), &rule))
+
+	pd := assets.NewPolicyDefinition(armpolicy.Definition{
+		Name:       to.Ptr("vnet"),
+		Properties: &armpolicy.DefinitionProperties{PolicyRule: rule},
+	})
+	e := NewEvaluator(nil)
+
+	// The first condition is false, so the unsupported function is never evaluated.
+	res, err := e.PolicyDefinition(context.Background(), pd, nil, map[string]any{"type": "Microsoft.Compute/disks"})
+	require.NoError(t, err)
+	assert.False(t, res.Match)
+
+	_, err = e.PolicyDefinition(context.Background(), pd, nil, map[string]any{"type": "Microsoft.Network/virtualNetworks"})
+
+	var ruleErr *assets.PolicyRuleError
+
+	require.ErrorAs(t, err, &ruleErr)
+	assert.Equal(t, "if.allOf[1]", ruleErr.Path)
+	assert.ErrorContains(t, err, "unknown function: length")
+}
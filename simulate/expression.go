@@ -0,0 +1,148 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package simulate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"strings"
+
+	"github.com/matt-FFFFFF/goarmfunctions"
+	"github.com/matt-FFFFFF/goarmfunctions/armparser"
+)
+
+// policyFunctionRegexp matches the policy specific functions that goarmfunctions does not implement.
+var policyFunctionRegexp = regexp.MustCompile(`(?i)\b(field|current)\(\s*(?:'((?:[^']|'')*)')?\s*\)`)
+
+// evalContext holds the state required to evaluate a policy rule against a resource.
+type evalContext struct {
+	params   map[string]any
+	resource map[string]any
+	scopes   []countScope
+}
+
+// withScope returns a copy of the context with the count scope added.
+func (ec *evalContext) withScope(s countScope) *evalContext {
+	scopes := make([]countScope, len(ec.scopes), len(ec.scopes)+1)
+	copy(scopes, ec.scopes)
+
+	return &evalContext{
+		params:   ec.params,
+		resource: ec.resource,
+		scopes:   append(scopes, s),
+	}
+}
+
+// evaluate evaluates the ARM template expressions in the value.
+// Strings that are not expressions, and other types, are returned unchanged.
+// The members of arrays are evaluated individually.
+func (ec *evalContext) evaluate(ctx context.Context, v any) (any, error) {
+	switch val := v.(type) {
+	case string:
+		return ec.evaluateString(ctx, val)
+	case []any:
+		result := make([]any, len(val))
+
+		for i, member := range val {
+			res, err := ec.evaluate(ctx, member)
+			if err != nil {
+				return nil, err
+			}
+
+			result[i] = res
+		}
+
+		return result, nil
+	}
+
+	return v, nil
+}
+
+func (ec *evalContext) evaluateString(ctx context.Context, s string) (any, error) {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return s, nil
+	}
+
+	// A leading `[[` escapes a literal string that starts with a bracket.
+	if strings.HasPrefix(s, "[[") {
+		return s[1:], nil
+	}
+
+	evalCtx := make(armparser.EvalContext, len(ec.params))
+	maps.Copy(evalCtx, ec.params)
+
+	var substErr error
+
+	// Replace field() and current() with references to parameters holding their values.
+	i := 0
+	expr := policyFunctionRegexp.ReplaceAllStringFunc(s, func(call string) string {
+		m := policyFunctionRegexp.FindStringSubmatch(call)
+		fn, arg := strings.ToLower(m[1]), strings.ReplaceAll(m[2], "''", "'")
+
+		var val any
+
+		switch fn {
+		case "field":
+			values, multi := ec.field(arg)
+
+			switch {
+			case multi:
+				val = values
+			case len(values) == 1:
+				val = values[0]
+			}
+		case "current":
+			v, err := ec.current(arg)
+			if err != nil && substErr == nil {
+				substErr = err
+			}
+
+			val = v
+		}
+
+		key := fmt.Sprintf("__simulate_%s_%d", fn, i)
+		i++
+		evalCtx[key] = val
+
+		return fmt.Sprintf("parameters('%s')", key)
+	})
+
+	if substErr != nil {
+		return nil, fmt.Errorf("evaluating expression `%s`: %w", s, substErr)
+	}
+
+	lgr := slog.New(slog.DiscardHandler)
+
+	res, err := goarmfunctions.LexAndParse(ctx, expr, evalCtx, lgr)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating expression `%s`: %w", s, err)
+	}
+
+	return res, nil
+}
+
+// normalise converts the value to the types produced by encoding/json, e.g. []string to []any.
+// The value is returned unchanged if it cannot be converted.
+func normalise(v any) any {
+	switch v.(type) {
+	case nil, string, bool, float64:
+		return v
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var result any
+	if err := json.Unmarshal(b, &result); err != nil {
+		return v
+	}
+
+	return result
+}
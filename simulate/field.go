@@ -0,0 +1,232 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package simulate
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	wildcardSuffix = "[*]"
+	tagsPrefix     = "tags"
+)
+
+// countScope is the current array member of an enclosing count expression.
+type countScope struct {
+	// field is the lower case array alias of a field count, e.g. `microsoft.network/vnets/subnets[*]`.
+	field string
+	// name is the name of a value count, it may be empty.
+	name  string
+	value any
+}
+
+// pathSegment is a member of a property path, e.g. `ipRules[*]` in `networkAcls.ipRules[*].value`.
+type pathSegment struct {
+	name     string
+	wildcard bool
+}
+
+// field resolves a field of the resource, or of the current array member in a count expression.
+// If the field contains a wildcard, i.e. `[*]`, multi is true and values contains the value of each array member.
+// Otherwise, values is empty if the field is not present in the resource, or contains the single value.
+func (ec *evalContext) field(name string) (values []any, multi bool) {
+	lower := strings.ToLower(name)
+
+	for i := len(ec.scopes) - 1; i >= 0; i-- {
+		s := ec.scopes[i]
+		if s.field == "" || !strings.HasPrefix(lower, s.field) {
+			continue
+		}
+
+		return resolvePath(s.value, parsePath(name[len(s.field):]))
+	}
+
+	switch {
+	case lower == "fullname":
+		return resolvePath(ec.resource, parsePath("name"))
+	case lower == tagsPrefix:
+		return resolvePath(ec.resource, parsePath(tagsPrefix))
+	case strings.HasPrefix(lower, tagsPrefix+"."), strings.HasPrefix(lower, tagsPrefix+"["):
+		return resolveTag(ec.resource, name[len(tagsPrefix):])
+	case !strings.Contains(name, "/"):
+		return resolvePath(ec.resource, parsePath(name))
+	}
+
+	return resolveAlias(ec.resource, name)
+}
+
+// current returns the value of the current array member of the enclosing count expression
+// referred to by the `current()` function.
+// The argument is either the name of a value count, a field count alias or a path within it,
+// or empty to refer to the innermost count.
+func (ec *evalContext) current(arg string) (any, error) {
+	if len(ec.scopes) == 0 {
+		return nil, fmt.Errorf("current('%s') used outside of a count expression", arg)
+	}
+
+	if arg == "" {
+		return ec.scopes[len(ec.scopes)-1].value, nil
+	}
+
+	lower := strings.ToLower(arg)
+
+	for i := len(ec.scopes) - 1; i >= 0; i-- {
+		s := ec.scopes[i]
+
+		switch {
+		case s.field == "" && strings.EqualFold(s.name, arg):
+			return s.value, nil
+		case s.field != "" && strings.HasPrefix(lower, s.field):
+			values, multi := resolvePath(s.value, parsePath(arg[len(s.field):]))
+			if multi {
+				return values, nil
+			}
+
+			if len(values) == 0 {
+				return nil, nil
+			}
+
+			return values[0], nil
+		}
+	}
+
+	return nil, fmt.Errorf("current('%s') does not refer to an enclosing count expression", arg)
+}
+
+// resolveAlias resolves an alias by removing the resource type prefix and reading the remaining path from
+// the resource properties, or from the top level of the resource if it is not a property.
+// Aliases of other resource types are not present.
+func resolveAlias(resource map[string]any, alias string) ([]any, bool) {
+	typ, _ := lookupKey(resource, "type")
+	typStr, _ := typ.(string)
+	prefix := strings.ToLower(typStr) + "/"
+
+	if typStr == "" || !strings.HasPrefix(strings.ToLower(alias), prefix) {
+		return nil, strings.Contains(alias, wildcardSuffix)
+	}
+
+	rest := alias[len(prefix):]
+	if rest == "" || strings.Contains(rest, "/") {
+		return nil, strings.Contains(alias, wildcardSuffix)
+	}
+
+	path := parsePath(rest)
+
+	if props, ok := lookupKey(resource, "properties"); ok {
+		if m, ok := props.(map[string]any); ok {
+			if _, ok := lookupKey(m, path[0].name); ok {
+				return resolvePath(props, path)
+			}
+		}
+	}
+
+	return resolvePath(resource, path)
+}
+
+// resolveTag resolves a tag field, the key is in the form `.key`, `['key']` or `[key]`.
+func resolveTag(resource map[string]any, key string) ([]any, bool) {
+	if strings.HasPrefix(key, ".") {
+		key = key[1:]
+	} else {
+		key = strings.TrimSuffix(strings.TrimPrefix(key, "["), "]")
+		key = strings.TrimSuffix(strings.TrimPrefix(key, "'"), "'")
+	}
+
+	tags, ok := lookupKey(resource, tagsPrefix)
+	if !ok {
+		return nil, false
+	}
+
+	m, ok := tags.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+
+	if v, ok := lookupKey(m, key); ok {
+		return []any{v}, false
+	}
+
+	return nil, false
+}
+
+// parsePath parses a dot separated property path, a leading dot is ignored.
+// An empty path refers to the value itself.
+func parsePath(path string) []pathSegment {
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return nil
+	}
+
+	parts := strings.Split(path, ".")
+	segments := make([]pathSegment, len(parts))
+
+	for i, part := range parts {
+		segments[i] = pathSegment{
+			name:     strings.TrimSuffix(part, wildcardSuffix),
+			wildcard: strings.HasSuffix(part, wildcardSuffix),
+		}
+	}
+
+	return segments
+}
+
+// resolvePath returns the values at the path, see evalContext.field.
+func resolvePath(v any, path []pathSegment) ([]any, bool) {
+	if len(path) == 0 {
+		return []any{v}, false
+	}
+
+	multi := hasWildcard(path)
+
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, multi
+	}
+
+	child, ok := lookupKey(m, path[0].name)
+	if !ok {
+		return nil, multi
+	}
+
+	if !path[0].wildcard {
+		return resolvePath(child, path[1:])
+	}
+
+	members, _ := child.([]any)
+	values := make([]any, 0, len(members))
+
+	for _, member := range members {
+		memberValues, _ := resolvePath(member, path[1:])
+		values = append(values, memberValues...)
+	}
+
+	return values, true
+}
+
+func hasWildcard(path []pathSegment) bool {
+	for _, s := range path {
+		if s.wildcard {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookupKey returns the value of the key in the map, matching the key case insensitively
+// if there is no exact match.
+func lookupKey(m map[string]any, key string) (any, bool) {
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
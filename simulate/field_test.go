@@ -0,0 +1,74 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package simulate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestField(t *testing.T) {
+	t.Parallel()
+
+	ec := &evalContext{
+		resource: map[string]any{
+			"name":     "nsg",
+			"type":     "Microsoft.Network/networkSecurityGroups",
+			"location": "northeurope",
+			"tags":     map[string]any{"Environment": "prod", "cost.centre": "123"},
+			"sku":      map[string]any{"name": "Standard"},
+			"properties": map[string]any{
+				"securityRules": []any{
+					map[string]any{"name": "allow-ssh", "properties": map[string]any{"destinationPortRange": "22"}},
+					map[string]any{"name": "allow-rdp", "properties": map[string]any{"destinationPortRange": "3389"}},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		field  string
+		values []any
+		multi  bool
+	}{
+		{field: "name", values: []any{"nsg"}},
+		{field: "fullName", values: []any{"nsg"}},
+		{field: "Location", values: []any{"northeurope"}},
+		{field: "kind"},
+		{field: "tags['environment']", values: []any{"prod"}},
+		{field: "tags[Environment]", values: []any{"prod"}},
+		{field: "tags.cost.centre", values: []any{"123"}},
+		{field: "Microsoft.Network/networkSecurityGroups/sku.name", values: []any{"Standard"}},
+		{
+			field:  "Microsoft.Network/networkSecurityGroups/securityRules[*].properties.destinationPortRange",
+			values: []any{"22", "3389"},
+			multi:  true,
+		},
+		{field: "Microsoft.Network/networkSecurityGroups/securityRules/destinationPortRange"},
+		{field: "Microsoft.Network/virtualNetworks/subnets[*]", multi: true},
+	}
+
+	for _, tc := range cases {
+		values, multi := ec.field(tc.field)
+		assert.Equal(t, tc.multi, multi, tc.field)
+		assert.ElementsMatch(t, tc.values, values, tc.field)
+	}
+
+	scoped := ec.withScope(countScope{
+		field: "microsoft.network/networksecuritygroups/securityrules[*]",
+		value: map[string]any{"name": "allow-ssh"},
+	})
+
+	values, multi := scoped.field("Microsoft.Network/networkSecurityGroups/securityRules[*].name")
+	assert.False(t, multi)
+	assert.Equal(t, []any{"allow-ssh"}, values)
+
+	v, err := scoped.current("Microsoft.Network/networkSecurityGroups/securityRules[*]")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"name": "allow-ssh"}, v)
+
+	_, err = ec.current("")
+	assert.EqualError(t, err, "current('') used outside of a count expression")
+}